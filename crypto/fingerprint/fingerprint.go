@@ -25,6 +25,9 @@ const (
 	Base64RawURLFingerprint
 	// EmojiFingerprint represents the emoji encoding of the fingerprint.
 	EmojiFingerprint
+	// ColonHexFingerprint represents the upper-case, colon-separated hex
+	// encoding of the fingerprint used by OpenSSL.
+	ColonHexFingerprint
 )
 
 type options struct {
@@ -100,6 +103,8 @@ func encode(input []byte, encoding Encoding) string {
 		return base64.RawURLEncoding.EncodeToString(input)
 	case EmojiFingerprint:
 		return toEmoji(input)
+	case ColonHexFingerprint:
+		return colonHex(input)
 	default:
 		panic(fmt.Sprintf("BUG: invalid encoding: %#v", encoding))
 	}
@@ -126,7 +131,20 @@ func decode(input string, encoding Encoding) ([]byte, error) {
 		return base64.RawURLEncoding.DecodeString(input)
 	case EmojiFingerprint:
 		return nil, errors.New("decoding emoji fingerprint not supported")
+	case ColonHexFingerprint:
+		return hex.DecodeString(strings.ReplaceAll(input, ":", ""))
 	default:
 		panic(fmt.Sprintf("BUG: invalid encoding: %#v", encoding))
 	}
 }
+
+// colonHex returns the upper-case hex encoding of the input with the bytes
+// separated by colons, e.g. "AB:CD:EF".
+func colonHex(input []byte) string {
+	h := strings.ToUpper(hex.EncodeToString(input))
+	parts := make([]string, 0, len(input))
+	for i := 0; i < len(h); i += 2 {
+		parts = append(parts, h[i:i+2])
+	}
+	return strings.Join(parts, ":")
+}
@@ -42,6 +42,9 @@ func TestEncodedFingerprint(t *testing.T) {
 		{"emoji", "testdata/ca.der", "🚁🍎👺🚌🏮☁️🎍👀🇮🇹✋🍼🚽⛅🐼🚬🎅🇷🇺🇷🇺🚂🤢🎀💩🚁🎆👺🎨👌✔️🚸🌈⚡🐼",
 			[]Option{WithHash(crypto.SHA256), WithEncoding(EmojiFingerprint)},
 		},
+		{"colon", "testdata/ca.der", "69:08:75:1F:68:29:0D:45:73:AE:0B:E3:9A:98:C8:B9:B7:B7:D4:E8:B2:A6:69:4B:75:09:94:66:26:AD:FE:98",
+			[]Option{WithHash(crypto.SHA256), WithEncoding(ColonHexFingerprint)},
+		},
 
 		{"prefix, hex", "testdata/ca.der", "PREFIX:6908751f68290d4573ae0be39a98c8b9b7b7d4e8b2a6694b7509946626adfe98",
 			[]Option{WithHash(crypto.SHA256), WithEncoding(HexFingerprint), WithPrefix("PREFIX:")},
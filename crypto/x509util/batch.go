@@ -0,0 +1,233 @@
+package x509util
+
+import (
+	"context"
+	"crypto"
+	"crypto/x509"
+	"runtime"
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+// Result is the result of the issuance of a certificate in a batch. Index is
+// the position of the CSR in the input, and Certificate is the DER encoded
+// certificate if Err is nil.
+type Result struct {
+	Index       int
+	Certificate []byte
+	Err         error
+}
+
+// WithBatchWorkers returns a Profile modifier that sets the number of
+// concurrent workers used by IssueBatch, if n is less than 1, the number of
+// CPUs is used. The modifier has no effect on profiles created outside of a
+// batch.
+func WithBatchWorkers(n int) WithOption {
+	return func(p Profile) error {
+		b, err := getBase(p)
+		if err != nil {
+			return err
+		}
+		b.batchWorkers = n
+		return nil
+	}
+}
+
+// IssueBatch signs a leaf certificate for each of the given CSRs using
+// concurrent workers, one per CPU by default, use WithBatchWorkers to change
+// it. The results are returned in the same order as the CSRs, and the failure
+// of one certificate does not abort the batch.
+//
+// The issuer certificate and its key are validated once, and an error is
+// returned if they are not valid; the profiles of the batch are created with
+// WithSkipIssuerValidation and do not validate them again. The options are
+// applied to every profile, so they must be safe for concurrent use and must
+// not set per-certificate values like the serial number.
+func IssueBatch(iss *x509.Certificate, issPriv crypto.PrivateKey, csrs []*x509.CertificateRequest, opts ...WithOption) ([]Result, error) {
+	if iss == nil {
+		return nil, errors.New("issuing certificate cannot be nil")
+	}
+	if issPriv == nil {
+		return nil, errors.New("issuing private key cannot be nil")
+	}
+	if err := validateIssuer(iss); err != nil {
+		return nil, err
+	}
+	if err := validateIssuerKey(iss, issPriv); err != nil {
+		return nil, err
+	}
+	opts = append([]WithOption{WithSkipIssuerValidation()}, opts...)
+
+	// The number of workers is set by the options, so the first profile is
+	// created before starting the workers to read it.
+	results := make([]Result, len(csrs))
+	var first Profile
+	start := 0
+	for ; start < len(csrs); start++ {
+		p, err := newBatchProfile(csrs[start], iss, issPriv, opts)
+		if err != nil {
+			results[start] = Result{Index: start, Err: err}
+			continue
+		}
+		first = p
+		break
+	}
+	if first == nil {
+		return results, nil
+	}
+	b, err := getBase(first)
+	if err != nil {
+		return nil, err
+	}
+
+	workers := b.batchWorkers
+	if workers < 1 {
+		workers = runtime.NumCPU()
+	}
+	if n := len(csrs) - start; workers > n {
+		workers = n
+	}
+
+	indexes := make(chan int)
+	var wg sync.WaitGroup
+	wg.Add(workers)
+	for w := 0; w < workers; w++ {
+		go func() {
+			defer wg.Done()
+			for i := range indexes {
+				p := first
+				if i != start {
+					var err error
+					if p, err = newBatchProfile(csrs[i], iss, issPriv, opts); err != nil {
+						results[i] = Result{Index: i, Err: err}
+						continue
+					}
+				}
+				results[i] = issueBatchItem(i, p)
+			}
+		}()
+	}
+	for i := start; i < len(csrs); i++ {
+		indexes <- i
+	}
+	close(indexes)
+	wg.Wait()
+
+	return results, nil
+}
+
+func newBatchProfile(csr *x509.CertificateRequest, iss *x509.Certificate, issPriv crypto.PrivateKey, opts []WithOption) (Profile, error) {
+	if csr == nil {
+		return nil, errors.New("CSR cannot be nil")
+	}
+	return NewLeafProfileWithCSR(csr, iss, issPriv, opts...)
+}
+
+func issueBatchItem(i int, p Profile) Result {
+	der, err := p.CreateCertificate()
+	if err != nil {
+		return Result{Index: i, Err: err}
+	}
+	return Result{Index: i, Certificate: der}
+}
+
+// IssueBatchFunc creates n certificates using the profiles returned by
+// makeProfile, creating and signing the profiles concurrently using the given
+// number of workers. The certificates are returned in the same order as the
+// indexes passed to makeProfile.
+//
+// Unlike IssueBatch, the first error stops the batch: the context passed to
+// makeProfile is canceled, no new work is started and the error is returned.
+// Profiles created with WithContext and that context stop the key generation
+// in progress, and profiles without a context use it to abort the signature.
+func IssueBatchFunc(n int, makeProfile func(ctx context.Context, i int) (Profile, error), workers int) ([]*x509.Certificate, error) {
+	if makeProfile == nil {
+		return nil, errors.New("makeProfile cannot be nil")
+	}
+	if n <= 0 {
+		return nil, nil
+	}
+	if workers < 1 {
+		workers = 1
+	}
+	if workers > n {
+		workers = n
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	var (
+		once     sync.Once
+		firstErr error
+	)
+	fail := func(err error) {
+		once.Do(func() {
+			firstErr = err
+			cancel()
+		})
+	}
+
+	certs := make([]*x509.Certificate, n)
+	indexes := make(chan int)
+	var wg sync.WaitGroup
+	wg.Add(workers)
+	for w := 0; w < workers; w++ {
+		go func() {
+			defer wg.Done()
+			for i := range indexes {
+				if ctx.Err() != nil {
+					continue
+				}
+				crt, err := issueBatchFuncItem(ctx, i, makeProfile)
+				if err != nil {
+					fail(err)
+					continue
+				}
+				certs[i] = crt
+			}
+		}()
+	}
+
+loop:
+	for i := 0; i < n; i++ {
+		select {
+		case indexes <- i:
+		case <-ctx.Done():
+			break loop
+		}
+	}
+	close(indexes)
+	wg.Wait()
+
+	if firstErr != nil {
+		return nil, firstErr
+	}
+	return certs, nil
+}
+
+func issueBatchFuncItem(ctx context.Context, i int, makeProfile func(ctx context.Context, i int) (Profile, error)) (*x509.Certificate, error) {
+	p, err := makeProfile(ctx, i)
+	if err != nil {
+		return nil, errors.Wrapf(err, "error creating profile %d", i)
+	}
+	if p == nil {
+		return nil, errors.Errorf("error creating profile %d: profile cannot be nil", i)
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	if b, err := getBase(p); err == nil && b.ctx == nil {
+		b.ctx = ctx
+	}
+	der, err := p.CreateCertificate()
+	if err != nil {
+		return nil, errors.Wrapf(err, "error creating certificate %d", i)
+	}
+	crt, err := x509.ParseCertificate(der)
+	if err != nil {
+		return nil, errors.Wrapf(err, "error parsing certificate %d", i)
+	}
+	return crt, nil
+}
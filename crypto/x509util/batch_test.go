@@ -0,0 +1,275 @@
+package x509util
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"errors"
+	"fmt"
+	"runtime"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func mustCreateCSRs(t testing.TB, n int) []*x509.CertificateRequest {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	csrs := make([]*x509.CertificateRequest, n)
+	for i := range csrs {
+		der, err := x509.CreateCertificateRequest(rand.Reader, &x509.CertificateRequest{
+			Subject:  pkix.Name{CommonName: fmt.Sprintf("device-%d", i)},
+			DNSNames: []string{fmt.Sprintf("device-%d.smallstep.com", i)},
+		}, key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if csrs[i], err = x509.ParseCertificateRequest(der); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return csrs
+}
+
+func TestIssueBatch(t *testing.T) {
+	iss := mustParseCertificate(t, "test_files/noPasscodeCa.crt")
+	issPriv := mustParseRSAKey(t, "test_files/noPasscodeCa.key")
+
+	csrs := mustCreateCSRs(t, 20)
+	csrs[7] = nil
+	csrs[11] = &x509.CertificateRequest{Subject: pkix.Name{CommonName: "no-public-key"}}
+
+	results, err := IssueBatch(iss, issPriv, csrs, WithBatchWorkers(4))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != len(csrs) {
+		t.Fatalf("IssueBatch() returned %d results, want %d", len(results), len(csrs))
+	}
+	for i, r := range results {
+		if r.Index != i {
+			t.Errorf("results[%d].Index = %d", i, r.Index)
+		}
+		if i == 7 || i == 11 {
+			if r.Err == nil {
+				t.Errorf("results[%d].Err = nil, want error", i)
+			}
+			continue
+		}
+		if r.Err != nil {
+			t.Errorf("results[%d].Err = %v", i, r.Err)
+			continue
+		}
+		cert, err := x509.ParseCertificate(r.Certificate)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want := csrs[i].Subject.CommonName; cert.Subject.CommonName != want {
+			t.Errorf("results[%d] common name = %s, want %s", i, cert.Subject.CommonName, want)
+		}
+		if err := cert.CheckSignatureFrom(iss); err != nil {
+			t.Errorf("results[%d] CheckSignatureFrom() error = %v", i, err)
+		}
+	}
+
+	t.Run("ok/workers", func(t *testing.T) {
+		var mu sync.Mutex
+		var running, maxRunning int
+		// The hook blocks for a bit to let the workers overlap.
+		hook := WithPreIssuanceHook(func(*x509.Certificate) error {
+			mu.Lock()
+			running++
+			if running > maxRunning {
+				maxRunning = running
+			}
+			mu.Unlock()
+			time.Sleep(5 * time.Millisecond)
+			mu.Lock()
+			running--
+			mu.Unlock()
+			return nil
+		})
+		results, err := IssueBatch(iss, issPriv, csrs[:7], WithBatchWorkers(2), hook)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for i, r := range results {
+			if r.Err != nil {
+				t.Errorf("results[%d].Err = %v", i, r.Err)
+			}
+		}
+		if maxRunning > 2 {
+			t.Errorf("IssueBatch() ran %d workers, want at most 2", maxRunning)
+		}
+	})
+
+	t.Run("ok/failed-first", func(t *testing.T) {
+		results, err := IssueBatch(iss, issPriv, []*x509.CertificateRequest{nil, csrs[11], csrs[0]})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if results[0].Err == nil || results[1].Err == nil || results[2].Err != nil {
+			t.Errorf("IssueBatch() = %v, want errors only in the first two results", results)
+		}
+		if results, err := IssueBatch(iss, issPriv, []*x509.CertificateRequest{nil}); err != nil || results[0].Err == nil {
+			t.Errorf("IssueBatch() = %v, %v, want an error in the result", results, err)
+		}
+	})
+
+	t.Run("ok/issuer-key-once", func(t *testing.T) {
+		// The batch profiles skip the issuer key check done by IssueBatch.
+		otherKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := NewLeafProfileWithCSR(csrs[0], iss, otherKey, WithSkipIssuerValidation()); err != nil {
+			t.Errorf("NewLeafProfileWithCSR() error = %v, want nil", err)
+		}
+	})
+
+	t.Run("fail/issuer-key", func(t *testing.T) {
+		otherKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := IssueBatch(iss, otherKey, csrs); !errors.Is(err, ErrIssuerKeyMismatch) {
+			t.Errorf("IssueBatch() error = %v, want ErrIssuerKeyMismatch", err)
+		}
+	})
+
+	t.Run("fail/issuer", func(t *testing.T) {
+		leaf := mustCreateCertificate(t, mustNewProfile(t)(NewLeafProfile("leaf", iss, issPriv)))
+		if _, err := IssueBatch(leaf, issPriv, csrs); err == nil {
+			t.Error("IssueBatch() error = nil, want error")
+		}
+	})
+}
+
+func BenchmarkIssueBatch(b *testing.B) {
+	iss := mustParseCertificate(b, "test_files/noPasscodeCa.crt")
+	issPriv := mustParseRSAKey(b, "test_files/noPasscodeCa.key")
+	csrs := mustCreateCSRs(b, 100)
+
+	b.Run("loop", func(b *testing.B) {
+		for n := 0; n < b.N; n++ {
+			for _, csr := range csrs {
+				p, err := NewLeafProfileWithCSR(csr, iss, issPriv)
+				if err != nil {
+					b.Fatal(err)
+				}
+				if _, err := p.CreateCertificate(); err != nil {
+					b.Fatal(err)
+				}
+			}
+		}
+	})
+	b.Run("batch", func(b *testing.B) {
+		for n := 0; n < b.N; n++ {
+			if _, err := IssueBatch(iss, issPriv, csrs, WithBatchWorkers(4)); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+	b.Run("batch-func", func(b *testing.B) {
+		makeProfile := func(ctx context.Context, i int) (Profile, error) {
+			return NewLeafProfileWithCSR(csrs[i], iss, issPriv, WithContext(ctx))
+		}
+		for n := 0; n < b.N; n++ {
+			if _, err := IssueBatchFunc(len(csrs), makeProfile, runtime.NumCPU()); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
+
+func TestIssueBatchFunc(t *testing.T) {
+	iss := mustParseCertificate(t, "test_files/noPasscodeCa.crt")
+	issPriv := mustParseRSAKey(t, "test_files/noPasscodeCa.key")
+
+	makeProfile := func(ctx context.Context, i int) (Profile, error) {
+		return NewLeafProfile(fmt.Sprintf("device-%d", i), iss, issPriv, WithContext(ctx))
+	}
+	certs, err := IssueBatchFunc(50, makeProfile, 4)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(certs) != 50 {
+		t.Fatalf("IssueBatchFunc() returned %d certificates, want 50", len(certs))
+	}
+	serials := make(map[string]struct{})
+	for i, cert := range certs {
+		if want := fmt.Sprintf("device-%d", i); cert.Subject.CommonName != want {
+			t.Errorf("certs[%d] common name = %s, want %s", i, cert.Subject.CommonName, want)
+		}
+		if _, ok := serials[cert.SerialNumber.String()]; ok {
+			t.Errorf("certs[%d] serial number %s is duplicated", i, cert.SerialNumber)
+		}
+		serials[cert.SerialNumber.String()] = struct{}{}
+	}
+
+	t.Run("ok/empty", func(t *testing.T) {
+		certs, err := IssueBatchFunc(0, makeProfile, 4)
+		if err != nil || certs != nil {
+			t.Errorf("IssueBatchFunc() = %v, %v, want nil, nil", certs, err)
+		}
+	})
+
+	t.Run("fail/nil", func(t *testing.T) {
+		if _, err := IssueBatchFunc(10, nil, 4); err == nil {
+			t.Error("IssueBatchFunc() error = nil, want error")
+		}
+	})
+
+	t.Run("fail/first-error", func(t *testing.T) {
+		const workers = 2
+		var mu sync.Mutex
+		var calls int
+		_, err := IssueBatchFunc(1000, func(ctx context.Context, i int) (Profile, error) {
+			mu.Lock()
+			calls++
+			mu.Unlock()
+			switch {
+			case i == 3:
+				return nil, errors.New("force")
+			case i > 3:
+				// Later items cannot finish before the failure.
+				<-ctx.Done()
+				return nil, ctx.Err()
+			}
+			return makeProfile(ctx, i)
+		}, workers)
+		if err == nil || !strings.Contains(err.Error(), "force") {
+			t.Fatalf("IssueBatchFunc() error = %v, want force error", err)
+		}
+		// The items up to the failing one, plus at most one item started by
+		// each worker before the cancellation.
+		if calls > 4+workers {
+			t.Errorf("IssueBatchFunc() made %d profiles, want at most %d", calls, 4+workers)
+		}
+	})
+
+	t.Run("fail/in-flight", func(t *testing.T) {
+		// The first profile blocks until the batch is canceled by the
+		// failure of the second one.
+		_, err := IssueBatchFunc(2, func(ctx context.Context, i int) (Profile, error) {
+			if i == 1 {
+				return nil, errors.New("force")
+			}
+			return NewLeafProfile("device-0", iss, issPriv, WithContext(ctx), WithKeyPairGenerator(func() (crypto.PublicKey, crypto.PrivateKey, error) {
+				<-ctx.Done()
+				return nil, nil, ctx.Err()
+			}))
+		}, 2)
+		if err == nil || !strings.Contains(err.Error(), "force") {
+			t.Fatalf("IssueBatchFunc() error = %v, want force error", err)
+		}
+	})
+}
@@ -0,0 +1,60 @@
+package x509util
+
+import (
+	"crypto/x509"
+	"encoding/pem"
+	"io"
+
+	"github.com/pkg/errors"
+	"github.com/smallstep/cli/crypto/pemutil"
+)
+
+// flusher is implemented by buffered writers like bufio.Writer.
+type flusher interface {
+	Flush() error
+}
+
+// WritePEMBundle writes the last certificate created by CreateCertificate to
+// the given writer, followed by the certificates in the chain, and if
+// includeKey is true, the unencrypted subject private key. Each PEM block is
+// written and flushed, if the writer implements a Flush method, before the
+// next one is encoded. It returns the first write error.
+func (b *base) WritePEMBundle(w io.Writer, chain []*x509.Certificate, includeKey bool) error {
+	if b.crt == nil {
+		return newError(ErrNotCreated, "certificate has not been created yet, call 'profile.CreateCertificate()' first")
+	}
+	blocks := make([]*pem.Block, 0, len(chain)+2)
+	blocks = append(blocks, &pem.Block{Type: "CERTIFICATE", Bytes: b.crt.Raw})
+	for i, crt := range chain {
+		if crt == nil {
+			return errors.Errorf("chain certificate %d cannot be nil", i)
+		}
+		blocks = append(blocks, &pem.Block{Type: "CERTIFICATE", Bytes: crt.Raw})
+	}
+	// The key is serialized before writing anything, so an opaque key does
+	// not produce a partial bundle.
+	if includeKey {
+		key, err := b.exportableSubjectPrivateKey()
+		if err != nil {
+			return err
+		}
+		block, err := pemutil.Serialize(key)
+		if err != nil {
+			return errors.Wrap(err, "error serializing private key")
+		}
+		blocks = append(blocks, block)
+	}
+
+	f, _ := w.(flusher)
+	for _, block := range blocks {
+		if err := pem.Encode(w, block); err != nil {
+			return errors.Wrap(err, "error writing PEM bundle")
+		}
+		if f != nil {
+			if err := f.Flush(); err != nil {
+				return errors.Wrap(err, "error writing PEM bundle")
+			}
+		}
+	}
+	return nil
+}
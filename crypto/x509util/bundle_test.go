@@ -0,0 +1,147 @@
+package x509util
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/smallstep/cli/crypto/pemutil"
+)
+
+// failWriter fails after writing n bytes.
+type failWriter struct {
+	n int
+}
+
+func (w *failWriter) Write(p []byte) (int, error) {
+	if len(p) > w.n {
+		n := w.n
+		w.n = 0
+		return n, errors.New("write failed")
+	}
+	w.n -= len(p)
+	return len(p), nil
+}
+
+func TestBase_WritePEMBundle(t *testing.T) {
+	root, intermediate, leaf, err := NewTestPKI("root", "intermediate", "leaf.smallstep.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	mustCertificate := func(p Profile) *x509.Certificate {
+		der, err := p.CertificateDER()
+		if err != nil {
+			t.Fatal(err)
+		}
+		crt, err := x509.ParseCertificate(der)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return crt
+	}
+	leafCrt := mustCertificate(leaf)
+	chain := []*x509.Certificate{mustCertificate(intermediate), mustCertificate(root)}
+
+	tests := []struct {
+		name       string
+		chain      []*x509.Certificate
+		includeKey bool
+	}{
+		{"ok", chain, true},
+		{"ok/no-key", chain, false},
+		{"ok/no-chain", nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			if err := leaf.WritePEMBundle(&buf, tt.chain, tt.includeKey); err != nil {
+				t.Fatalf("WritePEMBundle() error = %v", err)
+			}
+
+			var blocks []*pem.Block
+			for rest := buf.Bytes(); len(rest) > 0; {
+				var block *pem.Block
+				if block, rest = pem.Decode(rest); block == nil {
+					t.Fatalf("WritePEMBundle() wrote invalid PEM data: %q", rest)
+				}
+				blocks = append(blocks, block)
+			}
+			want := append([]*x509.Certificate{leafCrt}, tt.chain...)
+			wantBlocks := len(want)
+			if tt.includeKey {
+				wantBlocks++
+			}
+			if len(blocks) != wantBlocks {
+				t.Fatalf("WritePEMBundle() wrote %d blocks, want %d", len(blocks), wantBlocks)
+			}
+			for i, crt := range want {
+				if blocks[i].Type != "CERTIFICATE" || !bytes.Equal(blocks[i].Bytes, crt.Raw) {
+					t.Errorf("block %d is not the certificate %q", i, crt.Subject.CommonName)
+				}
+			}
+			if tt.includeKey {
+				key, err := pemutil.ParseKey(pem.EncodeToMemory(blocks[len(blocks)-1]))
+				if err != nil {
+					t.Fatalf("pemutil.ParseKey() error = %v", err)
+				}
+				if !reflect.DeepEqual(key, leaf.SubjectPrivateKey()) {
+					t.Error("private key does not match the subject private key")
+				}
+			}
+		})
+	}
+
+	t.Run("ok/flush", func(t *testing.T) {
+		var buf bytes.Buffer
+		w := bufio.NewWriterSize(&buf, 16)
+		if err := leaf.WritePEMBundle(w, chain, true); err != nil {
+			t.Fatalf("WritePEMBundle() error = %v", err)
+		}
+		if w.Buffered() != 0 {
+			t.Errorf("WritePEMBundle() left %d bytes buffered", w.Buffered())
+		}
+		if !bytes.Contains(buf.Bytes(), pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: leafCrt.Raw})) {
+			t.Error("WritePEMBundle() did not write the certificate")
+		}
+	})
+
+	t.Run("fail/write", func(t *testing.T) {
+		w := &failWriter{n: 100}
+		if err := leaf.WritePEMBundle(w, chain, true); err == nil {
+			t.Error("WritePEMBundle() error = nil, want error")
+		}
+	})
+
+	t.Run("fail/not-created", func(t *testing.T) {
+		p := mustNewProfile(t)(NewLeafProfile("leaf.smallstep.com", chain[0], intermediate.SubjectPrivateKey()))
+		if err := p.WritePEMBundle(new(bytes.Buffer), chain, true); err == nil {
+			t.Error("WritePEMBundle() error = nil, want error")
+		}
+	})
+
+	t.Run("fail/nil-chain-certificate", func(t *testing.T) {
+		if err := leaf.WritePEMBundle(new(bytes.Buffer), []*x509.Certificate{nil}, false); err == nil {
+			t.Error("WritePEMBundle() error = nil, want error")
+		}
+	})
+
+	t.Run("fail/no-private-key", func(t *testing.T) {
+		p := mustNewProfile(t)(NewLeafProfile("leaf.smallstep.com", chain[0], intermediate.SubjectPrivateKey(),
+			WithPublicKey(mustParseCertificate(t, "test_files/ca.crt").PublicKey)))
+		mustCreateCertificate(t, p)
+		var buf bytes.Buffer
+		if err := p.WritePEMBundle(&buf, chain, true); err == nil {
+			t.Error("WritePEMBundle() error = nil, want error")
+		}
+		if buf.Len() > 0 {
+			t.Errorf("WritePEMBundle() wrote %d bytes, want 0", buf.Len())
+		}
+		if err := p.WritePEMBundle(&buf, chain, false); err != nil {
+			t.Errorf("WritePEMBundle() error = %v", err)
+		}
+	})
+}
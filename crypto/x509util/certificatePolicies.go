@@ -0,0 +1,181 @@
+package x509util
+
+import (
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"net/url"
+	"unicode/utf8"
+
+	"github.com/pkg/errors"
+)
+
+var (
+	// oidPolicyQualifierCPS is id-qt-cps, the CPS pointer qualifier defined
+	// in RFC 5280, section 4.2.1.4.
+	oidPolicyQualifierCPS = asn1.ObjectIdentifier{1, 3, 6, 1, 5, 5, 7, 2, 1}
+	// oidPolicyQualifierUserNotice is id-qt-unotice, the user notice
+	// qualifier defined in RFC 5280, section 4.2.1.4.
+	oidPolicyQualifierUserNotice = asn1.ObjectIdentifier{1, 3, 6, 1, 5, 5, 7, 2, 2}
+)
+
+// maxExplicitTextLength is the maximum number of characters of the explicit
+// text of a user notice.
+const maxExplicitTextLength = 200
+
+// policyInformation is the ASN.1 structure of a certificate policy.
+//
+//	PolicyInformation ::= SEQUENCE {
+//	     policyIdentifier   CertPolicyId,
+//	     policyQualifiers   SEQUENCE SIZE (1..MAX) OF
+//	                             PolicyQualifierInfo OPTIONAL }
+type policyInformation struct {
+	PolicyIdentifier asn1.ObjectIdentifier
+	PolicyQualifiers []policyQualifierInfo `asn1:"optional,omitempty"`
+}
+
+// policyQualifierInfo is the ASN.1 structure of a policy qualifier.
+//
+//	PolicyQualifierInfo ::= SEQUENCE {
+//	     policyQualifierId  PolicyQualifierId,
+//	     qualifier          ANY DEFINED BY policyQualifierId }
+type policyQualifierInfo struct {
+	PolicyQualifierID asn1.ObjectIdentifier
+	Qualifier         asn1.RawValue
+}
+
+// userNotice is the ASN.1 structure of a user notice without a notice
+// reference, the explicit text is encoded as an UTF8String.
+//
+//	UserNotice ::= SEQUENCE {
+//	     noticeRef        NoticeReference OPTIONAL,
+//	     explicitText     DisplayText OPTIONAL }
+type userNotice struct {
+	ExplicitText string `asn1:"utf8"`
+}
+
+// WithCertificatePolicy returns a Profile modifier that adds a certificate
+// policy with the given policy qualifiers to the certificate policies
+// extension. cpsURI is the URI of the certification practice statement and
+// userNotice is the explicit text of a user notice, an empty value omits the
+// qualifier.
+//
+// The modifier can be used multiple times, the qualifiers of the same policy
+// are merged into one entry. The policies in the PolicyIdentifiers field of
+// the template are kept without qualifiers, and if a policy is in both, the
+// extension contains it only once with the qualifiers set by this modifier.
+func WithCertificatePolicy(oid asn1.ObjectIdentifier, cpsURI, userNotice string) WithOption {
+	return func(p Profile) error {
+		if len(oid) == 0 {
+			return errors.New("certificate policy identifier cannot be empty")
+		}
+		b, err := getBase(p)
+		if err != nil {
+			return err
+		}
+		var qualifiers []policyQualifierInfo
+		if cpsURI != "" {
+			q, err := newCPSQualifier(cpsURI)
+			if err != nil {
+				return err
+			}
+			qualifiers = append(qualifiers, q)
+		}
+		if userNotice != "" {
+			q, err := newUserNoticeQualifier(userNotice)
+			if err != nil {
+				return err
+			}
+			qualifiers = append(qualifiers, q)
+		}
+		for i, pi := range b.certificatePolicies {
+			if pi.PolicyIdentifier.Equal(oid) {
+				b.certificatePolicies[i].PolicyQualifiers = append(pi.PolicyQualifiers, qualifiers...)
+				return nil
+			}
+		}
+		b.certificatePolicies = append(b.certificatePolicies, policyInformation{
+			PolicyIdentifier: oid,
+			PolicyQualifiers: qualifiers,
+		})
+		return nil
+	}
+}
+
+func newCPSQualifier(cpsURI string) (policyQualifierInfo, error) {
+	u, err := url.Parse(cpsURI)
+	if err != nil || u.Scheme == "" || u.Host == "" {
+		return policyQualifierInfo{}, errors.Errorf("invalid certification practice statement URI %q", cpsURI)
+	}
+	for i := 0; i < len(cpsURI); i++ {
+		if cpsURI[i] >= utf8.RuneSelf {
+			return policyQualifierInfo{}, errors.Errorf("certification practice statement URI %q must be ASCII", cpsURI)
+		}
+	}
+	der, err := asn1.MarshalWithParams(cpsURI, "ia5")
+	if err != nil {
+		return policyQualifierInfo{}, errors.Wrap(err, "error marshaling certification practice statement URI")
+	}
+	return policyQualifierInfo{
+		PolicyQualifierID: oidPolicyQualifierCPS,
+		Qualifier:         asn1.RawValue{FullBytes: der},
+	}, nil
+}
+
+func newUserNoticeQualifier(text string) (policyQualifierInfo, error) {
+	if !utf8.ValidString(text) {
+		return policyQualifierInfo{}, errors.New("user notice must be a valid UTF-8 string")
+	}
+	if n := utf8.RuneCountInString(text); n > maxExplicitTextLength {
+		return policyQualifierInfo{}, errors.Errorf("user notice cannot be longer than %d characters", maxExplicitTextLength)
+	}
+	der, err := asn1.Marshal(userNotice{ExplicitText: text})
+	if err != nil {
+		return policyQualifierInfo{}, errors.Wrap(err, "error marshaling user notice")
+	}
+	return policyQualifierInfo{
+		PolicyQualifierID: oidPolicyQualifierUserNotice,
+		Qualifier:         asn1.RawValue{FullBytes: der},
+	}, nil
+}
+
+// applyCertificatePolicies replaces the certificate policies extension
+// generated by the x509 package with one that contains the policies in the
+// template and the policies with qualifiers added to the profile.
+func (b *base) applyCertificatePolicies(tpl *x509.Certificate) error {
+	if len(b.certificatePolicies) == 0 {
+		return nil
+	}
+	var policies []policyInformation
+	for _, oid := range tpl.PolicyIdentifiers {
+		if indexPolicy(policies, oid) < 0 {
+			policies = append(policies, policyInformation{PolicyIdentifier: oid})
+		}
+	}
+	for _, pi := range b.certificatePolicies {
+		if i := indexPolicy(policies, pi.PolicyIdentifier); i >= 0 {
+			policies[i].PolicyQualifiers = pi.PolicyQualifiers
+		} else {
+			policies = append(policies, pi)
+		}
+	}
+	value, err := asn1.Marshal(policies)
+	if err != nil {
+		return errors.Wrap(err, "error marshaling certificate policies")
+	}
+	exts := removeExtension(tpl.ExtraExtensions, oidExtCertificatePolicies)
+	tpl.ExtraExtensions = append(exts, pkix.Extension{
+		Id:    oidExtCertificatePolicies,
+		Value: value,
+	})
+	return nil
+}
+
+func indexPolicy(policies []policyInformation, oid asn1.ObjectIdentifier) int {
+	for i, pi := range policies {
+		if pi.PolicyIdentifier.Equal(oid) {
+			return i
+		}
+	}
+	return -1
+}
@@ -0,0 +1,96 @@
+package x509util
+
+import (
+	"bytes"
+	"crypto/x509"
+	"encoding/asn1"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestWithCertificatePolicy(t *testing.T) {
+	root := mustNewProfile(t)(NewRootProfile("Root"))
+	rootCert := mustCreateCertificate(t, root)
+
+	// The fixture was created with openssl using the policies 2.23.140.1.2.1
+	// and 1.3.6.1.4.1.37476.9000.64.1 with a CPS URI and a user notice.
+	fixture, ok := findExtension(mustParseCertificate(t, "test_files/certificatePolicies.crt"), oidExtCertificatePolicies)
+	if !ok {
+		t.Fatal("fixture does not have a certificate policies extension")
+	}
+	dvPolicy := asn1.ObjectIdentifier{2, 23, 140, 1, 2, 1}
+	policy := asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 37476, 9000, 64, 1}
+	withPolicyIdentifiers := func(oids ...asn1.ObjectIdentifier) WithOption {
+		return withTemplateFields(func(crt *x509.Certificate) {
+			crt.PolicyIdentifiers = oids
+		})
+	}
+
+	tests := []struct {
+		name    string
+		options []WithOption
+		want    []byte
+		wantErr bool
+	}{
+		{"ok", []WithOption{
+			withPolicyIdentifiers(dvPolicy),
+			WithCertificatePolicy(policy, "https://smallstep.com/cps", "Smallstep Certificate Policy"),
+		}, fixture.Value, false},
+		{"ok merge calls", []WithOption{
+			withPolicyIdentifiers(dvPolicy),
+			WithCertificatePolicy(policy, "https://smallstep.com/cps", ""),
+			WithCertificatePolicy(policy, "", "Smallstep Certificate Policy"),
+		}, fixture.Value, false},
+		{"ok policy identifier once", []WithOption{
+			withPolicyIdentifiers(dvPolicy, policy),
+			WithCertificatePolicy(policy, "https://smallstep.com/cps", "Smallstep Certificate Policy"),
+		}, fixture.Value, false},
+		{"ok without qualifiers", []WithOption{
+			WithCertificatePolicy(dvPolicy, "", ""),
+		}, []byte{0x30, 0x0a, 0x30, 0x08, 0x06, 0x06, 0x67, 0x81, 0x0c, 0x01, 0x02, 0x01}, false},
+		{"fail empty", []WithOption{WithCertificatePolicy(nil, "https://smallstep.com/cps", "")}, nil, true},
+		{"fail relative URI", []WithOption{WithCertificatePolicy(policy, "/cps", "")}, nil, true},
+		{"fail non-ASCII URI", []WithOption{WithCertificatePolicy(policy, "https://smallstep.com/cps/ñ", "")}, nil, true},
+		{"fail long notice", []WithOption{WithCertificatePolicy(policy, "", strings.Repeat("a", 201))}, nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, err := NewIntermediateProfile("Intermediate", rootCert, root.SubjectPrivateKey(), tt.options...)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("NewIntermediateProfile() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			crt := mustCreateCertificate(t, p)
+			var n int
+			for _, ext := range crt.Extensions {
+				if ext.Id.Equal(oidExtCertificatePolicies) {
+					n++
+				}
+			}
+			if n != 1 {
+				t.Fatalf("certificate has %d certificate policies extensions, want 1", n)
+			}
+			ext, _ := findExtension(crt, oidExtCertificatePolicies)
+			if ext.Critical {
+				t.Error("certificate policies extension is critical")
+			}
+			if !bytes.Equal(ext.Value, tt.want) {
+				t.Errorf("extension value = %x, want %x", ext.Value, tt.want)
+			}
+			var policies []policyInformation
+			if rest, err := asn1.Unmarshal(ext.Value, &policies); err != nil || len(rest) > 0 {
+				t.Fatalf("asn1.Unmarshal() error = %v", err)
+			}
+			var oids []asn1.ObjectIdentifier
+			for _, pi := range policies {
+				oids = append(oids, pi.PolicyIdentifier)
+			}
+			if !reflect.DeepEqual(crt.PolicyIdentifiers, oids) {
+				t.Errorf("PolicyIdentifiers = %v, want %v", crt.PolicyIdentifiers, oids)
+			}
+		})
+	}
+}
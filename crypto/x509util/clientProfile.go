@@ -0,0 +1,103 @@
+package x509util
+
+import (
+	"crypto"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// DefaultClientCertValidity is the default validity of a TLS client
+// certificate.
+var DefaultClientCertValidity = 90 * 24 * time.Hour
+
+// NewClientProfile returns a new leaf x509 Certificate profile for a TLS
+// client. The certificate only has the clientAuth extended key usage and the
+// DigitalSignature key usage, and the default duration is
+// DefaultClientCertValidity.
+//
+// The subject is the identity of the client, and it is classified to set the
+// right name:
+//   - A URI, like spiffe://example.org/workload or urn:uuid:..., is set as
+//     the URI subject alternative name and the subject is left empty. SPIFFE
+//     IDs are validated like in WithSPIFFEID.
+//   - An email address is set as the email subject alternative name and as
+//     the common name. It is validated like in WithEmailAddresses.
+//   - Any other value is set as the common name.
+//
+// Other names can be added with modifiers like WithHosts or WithURIs. Creating
+// the certificate fails with an error matching ErrLint if the serverAuth
+// extended key usage is added, unless WithSkipLint(LintClientServerAuth) is
+// used.
+//
+// A new public/private key pair will be generated for the Profile if
+// not set in the `withOps` profile modifiers.
+func NewClientProfile(subject string, iss *x509.Certificate, issPriv crypto.PrivateKey, withOps ...WithOption) (Profile, error) {
+	sub, err := defaultClientTemplate(subject, iss.Subject)
+	if err != nil {
+		return nil, err
+	}
+	withOps = append([]WithOption{
+		withLintRule(clientLintRule),
+		WithDefaultDuration(DefaultClientCertValidity),
+	}, withOps...)
+	return newProfile(&Leaf{}, sub, iss, issPriv, withOps...)
+}
+
+// clientLintRule is enabled by NewClientProfile, it reports
+// LintClientServerAuth if the certificate has the serverAuth or the any
+// extended key usage.
+var clientLintRule = lintRule{
+	name: "client",
+	check: func(b *base, crt *x509.Certificate, add func(code, msg string)) {
+		for _, eku := range crt.ExtKeyUsage {
+			if eku == x509.ExtKeyUsageServerAuth || eku == x509.ExtKeyUsageAny {
+				add(LintClientServerAuth, "TLS client certificates cannot have the serverAuth extended key usage")
+				return
+			}
+		}
+	},
+}
+
+func defaultClientTemplate(subject string, iss pkix.Name) (*x509.Certificate, error) {
+	crt := &x509.Certificate{
+		IsCA:                  false,
+		KeyUsage:              x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+		BasicConstraintsValid: false,
+		Issuer:                iss,
+	}
+	switch {
+	case subject == "":
+		return nil, errors.New("client subject cannot be empty")
+	case strings.HasPrefix(subject, "spiffe://"):
+		u, err := parseSPIFFEID(subject)
+		if err != nil {
+			return nil, err
+		}
+		crt.URIs = []*url.URL{u}
+	case strings.Contains(subject, "://") || strings.HasPrefix(strings.ToLower(subject), "urn:"):
+		u, err := url.Parse(subject)
+		if err != nil {
+			return nil, errors.Wrapf(err, "invalid client URI %q", subject)
+		}
+		if u.Scheme == "" || (u.Host == "" && u.Opaque == "") {
+			return nil, errors.Errorf("invalid client URI %q: scheme and host are required", subject)
+		}
+		crt.URIs = []*url.URL{u}
+	case strings.Contains(subject, "@"):
+		email, err := normalizeEmailAddress(subject)
+		if err != nil {
+			return nil, errors.Wrapf(err, "invalid client email address %q", subject)
+		}
+		crt.Subject = pkix.Name{CommonName: email}
+		crt.EmailAddresses = []string{email}
+	default:
+		crt.Subject = pkix.Name{CommonName: subject}
+	}
+	return crt, nil
+}
@@ -0,0 +1,91 @@
+package x509util
+
+import (
+	"crypto/x509"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+func TestNewClientProfile(t *testing.T) {
+	root := mustNewProfile(t)(NewRootProfile("Root"))
+	iss := mustCreateCertificate(t, root)
+	issPriv := root.SubjectPrivateKey()
+	now := time.Now().Truncate(time.Second)
+	clock := WithClock(func() time.Time { return now })
+
+	tests := []struct {
+		name       string
+		subject    string
+		options    []WithOption
+		wantCN     string
+		wantEmails []string
+		wantURIs   []string
+		wantDNS    []string
+		wantEKU    []x509.ExtKeyUsage
+		wantErr    bool
+	}{
+		{"ok/name", "jane", nil, "jane", nil, nil, nil, []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth}, false},
+		{"ok/service", "billing.internal", nil, "billing.internal", nil, nil, nil, []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth}, false},
+		{"ok/email", "jane@smallstep.com", nil, "jane@smallstep.com", []string{"jane@smallstep.com"}, nil, nil, []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth}, false},
+		{"ok/email-idn", "jane@bücher.example", nil, "jane@xn--bcher-kva.example", []string{"jane@xn--bcher-kva.example"}, nil, nil, []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth}, false},
+		{"ok/spiffe", "spiffe://example.org/billing", nil, "", nil, []string{"spiffe://example.org/billing"}, nil, []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth}, false},
+		{"ok/https", "https://smallstep.com/users/jane", nil, "", nil, []string{"https://smallstep.com/users/jane"}, nil, []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth}, false},
+		{"ok/urn", "urn:uuid:f81d4fae-7dec-11d0-a765-00a0c91e6bf6", nil, "", nil, []string{"urn:uuid:f81d4fae-7dec-11d0-a765-00a0c91e6bf6"}, nil, []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth}, false},
+		{"ok/more-sans", "jane@smallstep.com", []WithOption{WithHosts("laptop.smallstep.com")}, "jane@smallstep.com", []string{"jane@smallstep.com"}, nil, []string{"laptop.smallstep.com"}, []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth}, false},
+		{"ok/forced-server-auth", "jane", []WithOption{WithExtKeyUsage(x509.ExtKeyUsageClientAuth, x509.ExtKeyUsageServerAuth), WithSkipLint(LintClientServerAuth)}, "jane", nil, nil, nil, []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth, x509.ExtKeyUsageServerAuth}, false},
+		{"fail/empty", "", nil, "", nil, nil, nil, nil, true},
+		{"fail/email", "jane@", nil, "", nil, nil, nil, nil, true},
+		{"fail/spiffe", "spiffe://Example.org/billing", nil, "", nil, nil, nil, nil, true},
+		{"fail/uri", "https://", nil, "", nil, nil, nil, nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, err := NewClientProfile(tt.subject, iss, issPriv, append([]WithOption{clock}, tt.options...)...)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("NewClientProfile() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			cert := mustCreateCertificate(t, p)
+			if cert.Subject.CommonName != tt.wantCN {
+				t.Errorf("CommonName = %q, want %q", cert.Subject.CommonName, tt.wantCN)
+			}
+			if !reflect.DeepEqual(cert.EmailAddresses, tt.wantEmails) {
+				t.Errorf("EmailAddresses = %v, want %v", cert.EmailAddresses, tt.wantEmails)
+			}
+			var uris []string
+			for _, u := range cert.URIs {
+				uris = append(uris, u.String())
+			}
+			if !reflect.DeepEqual(uris, tt.wantURIs) {
+				t.Errorf("URIs = %v, want %v", uris, tt.wantURIs)
+			}
+			if !reflect.DeepEqual(cert.DNSNames, tt.wantDNS) || len(cert.IPAddresses) != 0 {
+				t.Errorf("DNSNames = %v, IPAddresses = %v, want %v", cert.DNSNames, cert.IPAddresses, tt.wantDNS)
+			}
+			if !reflect.DeepEqual(cert.ExtKeyUsage, tt.wantEKU) || len(cert.UnknownExtKeyUsage) != 0 {
+				t.Errorf("ExtKeyUsage = %v %v, want %v", cert.ExtKeyUsage, cert.UnknownExtKeyUsage, tt.wantEKU)
+			}
+			if cert.KeyUsage != x509.KeyUsageDigitalSignature {
+				t.Errorf("KeyUsage = %v, want DigitalSignature", cert.KeyUsage)
+			}
+			if !cert.NotAfter.Equal(now.Add(DefaultClientCertValidity)) {
+				t.Errorf("NotAfter = %s, want %s", cert.NotAfter, now.Add(DefaultClientCertValidity))
+			}
+		})
+	}
+
+	// The serverAuth extended key usage is rejected.
+	for _, eku := range []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageAny} {
+		p := mustNewProfile(t)(NewClientProfile("jane", iss, issPriv, WithExtKeyUsage(x509.ExtKeyUsageClientAuth, eku)))
+		_, err := p.CreateCertificate()
+		var lintErrs LintErrors
+		if !errors.Is(err, ErrLint) || !errors.As(err, &lintErrs) || lintErrs[0].Code != LintClientServerAuth {
+			t.Errorf("CreateCertificate() error = %v, want %s", err, LintClientServerAuth)
+		}
+	}
+}
@@ -0,0 +1,110 @@
+package x509util
+
+// Clone returns a copy of the leaf profile, see cloneBase.
+func (l *Leaf) Clone() Profile {
+	return &Leaf{base: l.cloneBase()}
+}
+
+// Clone returns a copy of the intermediate profile, see cloneBase.
+func (i *Intermediate) Clone() Profile {
+	return &Intermediate{base: i.cloneBase()}
+}
+
+// Clone returns a copy of the root profile, see cloneBase.
+func (r *Root) Clone() Profile {
+	return &Root{base: r.cloneBase()}
+}
+
+// cloneBase returns a copy of the profile state that can be modified and
+// signed independently of the original.
+//
+// The subject template, including its slices, and the settings of the profile
+// are deep-copied. The issuer certificate, the keys, the context, the random
+// reader, the key pool and the functions set with the profile modifiers are
+// shared; use WithNewKey on the clone to replace the subject key. The
+// certificate created by the original profile and the serial number of the
+// template are not copied, a new serial number is generated when the clone is
+// signed, even if the original used WithSerialNumber.
+//
+// A profile is not safe for concurrent use, but clones of the same profile can
+// be used concurrently as long as the shared values are safe for concurrent
+// use; the issuer key must be, and a reader set with WithDeterministicRandom
+// usually is not.
+func (b *base) cloneBase() base {
+	c := *b
+	c.sub = copyCertificate(b.sub)
+	// Self-signed profiles use the subject as the issuer.
+	if b.iss == b.sub {
+		c.iss = c.sub
+	}
+	c.ext = append(b.ext[:0:0], b.ext...)
+	c.hooks = append(b.hooks[:0:0], b.hooks...)
+	c.mutatingHooks = append(b.mutatingHooks[:0:0], b.mutatingHooks...)
+	c.templateFuncs = append(b.templateFuncs[:0:0], b.templateFuncs...)
+	c.criticalExts = append(b.criticalExts[:0:0], b.criticalExts...)
+	c.generalNames = append(b.generalNames[:0:0], b.generalNames...)
+	c.lintRules = append(b.lintRules[:0:0], b.lintRules...)
+	c.sanOrder = append(b.sanOrder[:0:0], b.sanOrder...)
+	if b.certificatePolicies != nil {
+		c.certificatePolicies = make([]policyInformation, len(b.certificatePolicies))
+		for i, pi := range b.certificatePolicies {
+			pi.PolicyQualifiers = append(pi.PolicyQualifiers[:0:0], pi.PolicyQualifiers...)
+			c.certificatePolicies[i] = pi
+		}
+	}
+	if b.skipLints != nil {
+		c.skipLints = make(map[string]struct{}, len(b.skipLints))
+		for k := range b.skipLints {
+			c.skipLints[k] = struct{}{}
+		}
+	}
+	if b.keyPolicy != nil {
+		kp := *b.keyPolicy
+		kp.ECDSACurves = append(kp.ECDSACurves[:0:0], kp.ECDSACurves...)
+		c.keyPolicy = &kp
+	}
+	c.sub.SerialNumber = nil
+	c.crt, c.tbs = nil, nil
+	return c
+}
+
+// WithNewKey returns a Profile modifier that replaces the subject key pair
+// with a new one, generated with the parameters set with GenerateKeyPair or
+// WithKeyPairGenerator, or the default ones. It is meant to be applied to a
+// clone, which shares the keys of the original profile:
+//
+//	c := p.Clone()
+//	if err := WithNewKey()(c); err != nil {
+//		return err
+//	}
+//
+// The subject key identifier and the key usage set with the key type are
+// updated for the new key. Self-signed profiles are also signed with it.
+func WithNewKey() WithOption {
+	return func(p Profile) error {
+		b, err := getBase(p)
+		if err != nil {
+			return err
+		}
+		if err := b.generateSubjectKeyPair(); err != nil {
+			return err
+		}
+		if b.iss != nil && b.iss == b.sub && b.subPriv != nil {
+			b.issPriv = b.subPriv
+		}
+		if b.sub == nil {
+			return nil
+		}
+		if b.keyUsageFromKey {
+			b.sub.KeyUsage = DefaultKeyUsageForKey(b.subPub)
+		}
+		if b.sub.SubjectKeyId != nil {
+			id, err := generateSubjectKeyIDWithMethod(b.subPub, b.skiMethod)
+			if err != nil {
+				return err
+			}
+			b.sub.SubjectKeyId = id
+		}
+		return nil
+	}
+}
@@ -0,0 +1,188 @@
+package x509util
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"fmt"
+	"math/big"
+	"reflect"
+	"sync"
+	"testing"
+)
+
+func TestClone(t *testing.T) {
+	iss := mustParseCertificate(t, "test_files/noPasscodeCa.crt")
+	issPriv := mustParseRSAKey(t, "test_files/noPasscodeCa.key")
+	ext := pkix.Extension{Id: asn1.ObjectIdentifier{1, 2, 3, 4}, Value: []byte{0x05, 0x00}}
+
+	p := mustNewProfile(t)(NewLeafProfile("leaf", iss, issPriv,
+		WithHosts("leaf.smallstep.com"), WithSubjectOrganization("Smallstep"), WithExtraExtension(ext),
+		WithSkipLint(LintValidityPeriod)))
+	want := mustCreateCertificate(t, p)
+
+	c := p.Clone()
+	if _, ok := c.(*Leaf); !ok {
+		t.Fatalf("Clone() = %T, want *Leaf", c)
+	}
+	if c.Issuer() != p.Issuer() || c.SubjectPrivateKey() != p.SubjectPrivateKey() {
+		t.Error("clone does not share the issuer and the keys")
+	}
+	if _, err := c.Fingerprint(); err == nil {
+		t.Error("clone Fingerprint() error = nil, want error")
+	}
+
+	// Mutate the clone in place.
+	sub := c.Subject()
+	sub.DNSNames[0] = "clone.smallstep.com"
+	sub.Subject.Organization[0] = "Clone"
+	sub.ExtraExtensions[0].Id = asn1.ObjectIdentifier{1, 2, 3, 5}
+	sub.Subject.CommonName = "clone"
+	c.AddExtension(pkix.Extension{Id: asn1.ObjectIdentifier{1, 2, 3, 6}, Value: []byte{0x05, 0x00}})
+	cloneCrt := mustCreateCertificate(t, c)
+	if cloneCrt.Subject.CommonName != "clone" || !reflect.DeepEqual(cloneCrt.DNSNames, []string{"clone.smallstep.com"}) {
+		t.Errorf("clone certificate subject = %s, DNSNames = %v", cloneCrt.Subject, cloneCrt.DNSNames)
+	}
+
+	got := mustCreateCertificate(t, p)
+	if got.Subject.String() != want.Subject.String() || !reflect.DeepEqual(got.DNSNames, want.DNSNames) {
+		t.Errorf("certificate subject = %s, DNSNames = %v, want %s and %v", got.Subject, got.DNSNames, want.Subject, want.DNSNames)
+	}
+	if !reflect.DeepEqual(got.Extensions, want.Extensions) {
+		t.Errorf("certificate extensions = %v, want %v", got.Extensions, want.Extensions)
+	}
+}
+
+func TestClone_serialAndKeys(t *testing.T) {
+	iss := mustParseCertificate(t, "test_files/noPasscodeCa.crt")
+	issPriv := mustParseRSAKey(t, "test_files/noPasscodeCa.key")
+	p := mustNewProfile(t)(NewLeafProfile("leaf", iss, issPriv, WithHosts("leaf.smallstep.com"), WithSerialNumber(big.NewInt(1234))))
+	want := mustCreateCertificate(t, p)
+
+	c1, c2 := p.Clone(), p.Clone()
+	if c1.Subject().SerialNumber != nil {
+		t.Errorf("clone SerialNumber = %v, want nil", c1.Subject().SerialNumber)
+	}
+	c1.Subject().DNSNames = []string{"one.smallstep.com"}
+	c2.Subject().DNSNames = []string{"two.smallstep.com"}
+	crt1, crt2 := mustCreateCertificate(t, c1), mustCreateCertificate(t, c2)
+	serials := map[string]bool{want.SerialNumber.String(): true}
+	for _, crt := range []*x509.Certificate{crt1, crt2} {
+		if serials[crt.SerialNumber.String()] {
+			t.Errorf("certificate SerialNumber = %v, want a new serial number", crt.SerialNumber)
+		}
+		serials[crt.SerialNumber.String()] = true
+		if crt.Subject.String() != want.Subject.String() {
+			t.Errorf("certificate subject = %s, want %s", crt.Subject, want.Subject)
+		}
+		if !bytes.Equal(crt.RawSubjectPublicKeyInfo, want.RawSubjectPublicKeyInfo) || !bytes.Equal(crt.SubjectKeyId, want.SubjectKeyId) {
+			t.Error("clone does not share the subject key")
+		}
+	}
+	if crt1.DNSNames[0] != "one.smallstep.com" || crt2.DNSNames[0] != "two.smallstep.com" {
+		t.Errorf("certificate DNSNames = %v and %v", crt1.DNSNames, crt2.DNSNames)
+	}
+	if c1.Subject().SerialNumber.Cmp(crt1.SerialNumber) != 0 {
+		t.Errorf("clone SerialNumber = %v, want %v", c1.Subject().SerialNumber, crt1.SerialNumber)
+	}
+	if crt := mustCreateCertificate(t, p); crt.SerialNumber.Int64() != 1234 {
+		t.Errorf("certificate SerialNumber = %v, want 1234", crt.SerialNumber)
+	}
+
+	t.Run("WithNewKey", func(t *testing.T) {
+		c := p.Clone()
+		if err := WithNewKey()(c); err != nil {
+			t.Fatal(err)
+		}
+		if c.SubjectPrivateKey() == p.SubjectPrivateKey() {
+			t.Fatal("WithNewKey() did not replace the subject key")
+		}
+		crt := mustCreateCertificate(t, c)
+		if bytes.Equal(crt.RawSubjectPublicKeyInfo, want.RawSubjectPublicKeyInfo) || bytes.Equal(crt.SubjectKeyId, want.SubjectKeyId) {
+			t.Error("certificate uses the key of the original profile")
+		}
+		if id, err := generateSubjectKeyID(crt.PublicKey); err != nil || !bytes.Equal(crt.SubjectKeyId, id) {
+			t.Errorf("certificate SubjectKeyId = %x, want %x", crt.SubjectKeyId, id)
+		}
+		if crt := mustCreateCertificate(t, p); !bytes.Equal(crt.RawSubjectPublicKeyInfo, want.RawSubjectPublicKeyInfo) {
+			t.Error("WithNewKey() modified the original profile")
+		}
+	})
+
+	t.Run("WithNewKey/root", func(t *testing.T) {
+		root := mustNewProfile(t)(NewRootProfile("Root"))
+		c := root.Clone()
+		if err := WithNewKey()(c); err != nil {
+			t.Fatal(err)
+		}
+		crt := mustCreateCertificate(t, c)
+		if err := crt.CheckSignatureFrom(crt); err != nil {
+			t.Errorf("CheckSignatureFrom() error = %v", err)
+		}
+		if crt.PublicKey.(interface{ Equal(crypto.PublicKey) bool }).Equal(root.SubjectPublicKey()) {
+			t.Error("root clone uses the key of the original profile")
+		}
+	})
+}
+
+func TestClone_root(t *testing.T) {
+	p := mustNewProfile(t)(NewRootProfile("Root"))
+	c := p.Clone()
+	if _, ok := c.(*Root); !ok {
+		t.Fatalf("Clone() = %T, want *Root", c)
+	}
+	if c.Issuer() != c.Subject() || c.Subject() == p.Subject() {
+		t.Fatal("root clone is not self-signed with its own template")
+	}
+	c.Subject().Subject.CommonName = "Clone Root"
+	crt := mustCreateCertificate(t, c)
+	if crt.Subject.CommonName != "Clone Root" || crt.Issuer.CommonName != "Clone Root" {
+		t.Errorf("certificate subject = %s, issuer = %s, want Clone Root", crt.Subject, crt.Issuer)
+	}
+	if crt := mustCreateCertificate(t, p); crt.Subject.CommonName != "Root" {
+		t.Errorf("certificate subject = %s, want Root", crt.Subject)
+	}
+}
+
+func TestClone_concurrent(t *testing.T) {
+	iss := mustParseCertificate(t, "test_files/noPasscodeCa.crt")
+	issPriv := mustParseRSAKey(t, "test_files/noPasscodeCa.key")
+	p := mustNewProfile(t)(NewLeafProfile("leaf", iss, issPriv, WithHosts("leaf.smallstep.com")))
+
+	const n = 100
+	certs := make([]*x509.Certificate, n)
+	errs := make([]error, n)
+	var wg sync.WaitGroup
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			c := p.Clone()
+			sub := c.Subject()
+			sub.Subject.CommonName = fmt.Sprintf("leaf-%d", i)
+			sub.DNSNames = append(sub.DNSNames, fmt.Sprintf("leaf-%d.smallstep.com", i))
+			der, err := c.CreateCertificate()
+			if err != nil {
+				errs[i] = err
+				return
+			}
+			certs[i], errs[i] = x509.ParseCertificate(der)
+		}(i)
+	}
+	wg.Wait()
+
+	for i := 0; i < n; i++ {
+		if errs[i] != nil {
+			t.Fatalf("certificate %d error = %v", i, errs[i])
+		}
+		want := []string{"leaf.smallstep.com", fmt.Sprintf("leaf-%d.smallstep.com", i)}
+		if certs[i].Subject.CommonName != fmt.Sprintf("leaf-%d", i) || !reflect.DeepEqual(certs[i].DNSNames, want) {
+			t.Errorf("certificate %d subject = %s, DNSNames = %v", i, certs[i].Subject, certs[i].DNSNames)
+		}
+	}
+	if !reflect.DeepEqual(p.Subject().DNSNames, []string{"leaf.smallstep.com"}) {
+		t.Errorf("original DNSNames = %v, want [leaf.smallstep.com]", p.Subject().DNSNames)
+	}
+}
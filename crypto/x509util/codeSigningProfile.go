@@ -0,0 +1,126 @@
+package x509util
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"fmt"
+	"time"
+)
+
+const (
+	// MaxCodeSigningCertMonths is the maximum validity in months of a code
+	// signing certificate, as defined in the Code Signing Baseline
+	// Requirements.
+	MaxCodeSigningCertMonths = 39
+	// MinCodeSigningRSABits is the minimum size of the RSA keys of code signing
+	// certificates.
+	MinCodeSigningRSABits = 3072
+)
+
+// DefaultCodeSigningCertValidity is the default validity of a code signing
+// certificate.
+var DefaultCodeSigningCertValidity = 365 * 24 * time.Hour
+
+// OIDPolicyCodeSigning is the CA/Browser Forum policy for non-EV code signing
+// certificates. It can be added using WithCertificatePolicy.
+var OIDPolicyCodeSigning = asn1.ObjectIdentifier{2, 23, 140, 1, 4, 1}
+
+// NewCodeSigningProfile returns a new leaf x509 Certificate profile for code
+// signing following the Code Signing Baseline Requirements. The certificate
+// only has the DigitalSignature key usage and the codeSigning extended key
+// usage, and the default duration is DefaultCodeSigningCertValidity.
+//
+// The strict code signing checks are enabled, creating the certificate
+// returns an error matching ErrWeakKey if the subject key is an RSA key of
+// less than MinCodeSigningRSABits or an ECDSA key with a curve smaller than
+// P-256, and an error matching ErrLint with one of the LintCodeSigning codes
+// if the key is not RSA or ECDSA, if the key usages are changed, or if the
+// validity is longer than MaxCodeSigningCertMonths. The policy OID is not
+// added by default, use WithCertificatePolicy(OIDPolicyCodeSigning, "", "").
+//
+// A new public/private key pair will be generated for the Profile if
+// not set in the `withOps` profile modifiers.
+func NewCodeSigningProfile(cn string, iss *x509.Certificate, issPriv crypto.PrivateKey, withOps ...WithOption) (Profile, error) {
+	sub := defaultCodeSigningTemplate(pkix.Name{CommonName: cn}, iss.Subject)
+	withOps = append(codeSigningOptions(), withOps...)
+	return newProfile(&Leaf{}, sub, iss, issPriv, withOps...)
+}
+
+// NewCodeSigningProfileWithCSR returns a new code signing profile like
+// NewCodeSigningProfile, using the subject and the public key of the given
+// CSR. The subject alternative names and the extensions of the CSR are not
+// copied.
+//
+// It returns an error matching ErrMissingPublicKey or ErrInvalidCSRSignature
+// if the CSR does not have a public key or its signature is not valid.
+func NewCodeSigningProfileWithCSR(csr *x509.CertificateRequest, iss *x509.Certificate, issPriv crypto.PrivateKey, withOps ...WithOption) (Profile, error) {
+	if csr.PublicKey == nil {
+		return nil, newError(ErrMissingPublicKey, "CSR must have PublicKey")
+	}
+	if err := csr.CheckSignature(); err != nil {
+		return nil, newError(ErrInvalidCSRSignature, "error validating CSR signature: %v", err)
+	}
+
+	sub := defaultCodeSigningTemplate(csr.Subject, iss.Subject)
+	withOps = append(codeSigningOptions(), withOps...)
+	withOps = append(withOps, WithPublicKey(csr.PublicKey), withCSRRawSubject(csr))
+	return newProfile(&Leaf{}, sub, iss, issPriv, withOps...)
+}
+
+// WithStrictCodeSigning returns a Profile modifier that enables the linter
+// checks for code signing certificates. It is used by NewCodeSigningProfile
+// and NewCodeSigningProfileWithCSR.
+func WithStrictCodeSigning() WithOption {
+	return withLintRule(codeSigningLintRule)
+}
+
+// codeSigningLintRule reports the findings of the Code Signing Baseline
+// Requirements checks.
+var codeSigningLintRule = lintRule{
+	name: "code_signing",
+	check: func(b *base, crt *x509.Certificate, add func(code, msg string)) {
+		if len(crt.ExtKeyUsage) != 1 || crt.ExtKeyUsage[0] != x509.ExtKeyUsageCodeSigning || len(crt.UnknownExtKeyUsage) > 0 {
+			add(LintCodeSigningEKU, "codeSigning must be the only extended key usage")
+		}
+		if crt.KeyUsage != x509.KeyUsageDigitalSignature {
+			add(LintCodeSigningKeyUsage, "DigitalSignature must be the only key usage")
+		}
+		switch b.subPub.(type) {
+		case *rsa.PublicKey, *ecdsa.PublicKey:
+		default:
+			add(LintCodeSigningKeyType, fmt.Sprintf("code signing certificates require an RSA or ECDSA key, got %T", b.subPub))
+		}
+		if !crt.NotBefore.IsZero() && crt.NotAfter.After(crt.NotBefore.AddDate(0, MaxCodeSigningCertMonths, 0)) {
+			add(LintCodeSigningValidity, fmt.Sprintf("the validity cannot be longer than %d months", MaxCodeSigningCertMonths))
+		}
+	},
+}
+
+// codeSigningOptions returns the modifiers applied before the user modifiers
+// in the code signing profiles.
+func codeSigningOptions() []WithOption {
+	return []WithOption{
+		WithStrictCodeSigning(),
+		WithKeyPolicy(KeyPolicy{
+			MinRSABits:  MinCodeSigningRSABits,
+			ECDSACurves: []elliptic.Curve{elliptic.P256(), elliptic.P384(), elliptic.P521()},
+		}),
+		WithDefaultDuration(DefaultCodeSigningCertValidity),
+	}
+}
+
+func defaultCodeSigningTemplate(sub, iss pkix.Name) *x509.Certificate {
+	return &x509.Certificate{
+		IsCA:                  false,
+		KeyUsage:              x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageCodeSigning},
+		BasicConstraintsValid: false,
+		Issuer:                iss,
+		Subject:               sub,
+	}
+}
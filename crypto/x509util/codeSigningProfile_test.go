@@ -0,0 +1,129 @@
+package x509util
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+func TestNewCodeSigningProfile(t *testing.T) {
+	now := time.Date(2026, 1, 31, 0, 0, 0, 0, time.UTC)
+	clock := WithClock(func() time.Time { return now })
+	root := mustNewProfile(t)(NewRootProfile("Root", clock))
+	iss := mustCreateCertificate(t, root)
+	issPriv := root.SubjectPrivateKey()
+
+	tests := []struct {
+		name     string
+		options  []WithOption
+		validity time.Duration
+		policies int
+		wantErr  error
+		wantLint string
+	}{
+		{"ok", []WithOption{clock}, DefaultCodeSigningCertValidity, 0, nil, ""},
+		{"ok/rsa3072", []WithOption{clock, GenerateKeyPair("RSA", "", 3072)}, DefaultCodeSigningCertValidity, 0, nil, ""},
+		{"ok/p384", []WithOption{clock, GenerateKeyPair("EC", "P-384", 0)}, DefaultCodeSigningCertValidity, 0, nil, ""},
+		{"ok/policy", []WithOption{clock, WithCertificatePolicy(OIDPolicyCodeSigning, "", "")}, DefaultCodeSigningCertValidity, 1, nil, ""},
+		{"ok/max-validity", []WithOption{WithNotBeforeAfterDuration(now, now.AddDate(0, 39, 0), 0)}, now.AddDate(0, 39, 0).Sub(now), 0, nil, ""},
+		{"fail/rsa2048", []WithOption{clock, GenerateKeyPair("RSA", "", 2048)}, 0, 0, ErrWeakKey, ""},
+		{"fail/ed25519", []WithOption{clock, GenerateKeyPair("OKP", "Ed25519", 0)}, 0, 0, ErrLint, LintCodeSigningKeyType},
+		{"fail/validity", []WithOption{WithNotBeforeAfterDuration(now, now.AddDate(0, 39, 1), 0)}, 0, 0, ErrLint, LintCodeSigningValidity},
+		{"fail/eku", []WithOption{clock, WithExtKeyUsage(x509.ExtKeyUsageCodeSigning, x509.ExtKeyUsageServerAuth)}, 0, 0, ErrLint, LintCodeSigningEKU},
+		{"fail/key-usage", []WithOption{clock, WithAddKeyUsage(x509.KeyUsageKeyAgreement)}, 0, 0, ErrLint, LintCodeSigningKeyUsage},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := mustNewProfile(t)(NewCodeSigningProfile("Code Signer", iss, issPriv, tt.options...))
+			der, err := p.CreateCertificate()
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("CreateCertificate() error = %v, want %v", err, tt.wantErr)
+				}
+				var lintErrs LintErrors
+				if tt.wantLint != "" && (!errors.As(err, &lintErrs) || len(lintErrs) != 1 || lintErrs[0].Code != tt.wantLint) {
+					t.Errorf("CreateCertificate() error = %v, want lint %s", err, tt.wantLint)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("CreateCertificate() error = %v", err)
+			}
+			cert, err := x509.ParseCertificate(der)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if cert.KeyUsage != x509.KeyUsageDigitalSignature {
+				t.Errorf("KeyUsage = %v, want DigitalSignature", cert.KeyUsage)
+			}
+			if !reflect.DeepEqual(cert.ExtKeyUsage, []x509.ExtKeyUsage{x509.ExtKeyUsageCodeSigning}) || len(cert.UnknownExtKeyUsage) != 0 {
+				t.Errorf("ExtKeyUsage = %v %v, want codeSigning", cert.ExtKeyUsage, cert.UnknownExtKeyUsage)
+			}
+			if hasSANs(cert) {
+				t.Error("certificate has subject alternative names")
+			}
+			if !cert.NotBefore.Equal(now) || !cert.NotAfter.Equal(now.Add(tt.validity)) {
+				t.Errorf("validity = %s - %s, want %s", cert.NotBefore, cert.NotAfter, tt.validity)
+			}
+			if len(cert.PolicyIdentifiers) != tt.policies || (tt.policies == 1 && !cert.PolicyIdentifiers[0].Equal(OIDPolicyCodeSigning)) {
+				t.Errorf("PolicyIdentifiers = %v", cert.PolicyIdentifiers)
+			}
+		})
+	}
+}
+
+func TestNewCodeSigningProfileWithCSR(t *testing.T) {
+	root := mustNewProfile(t)(NewRootProfile("Root"))
+	iss := mustCreateCertificate(t, root)
+	issPriv := root.SubjectPrivateKey()
+
+	key, err := ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	csrDER, err := x509.CreateCertificateRequest(rand.Reader, &x509.CertificateRequest{
+		Subject:  pkix.Name{CommonName: "Code Signer", Organization: []string{"Smallstep"}},
+		DNSNames: []string{"code.smallstep.com"},
+	}, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	csr, err := x509.ParseCertificateRequest(csrDER)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	p := mustNewProfile(t)(NewCodeSigningProfileWithCSR(csr, iss, issPriv))
+	cert := mustCreateCertificate(t, p)
+	if !key.PublicKey.Equal(cert.PublicKey) {
+		t.Error("certificate does not have the CSR public key")
+	}
+	if cert.Subject.CommonName != "Code Signer" || hasSANs(cert) {
+		t.Errorf("Subject = %s, DNSNames = %v", cert.Subject, cert.DNSNames)
+	}
+	if !reflect.DeepEqual(cert.ExtKeyUsage, []x509.ExtKeyUsage{x509.ExtKeyUsageCodeSigning}) {
+		t.Errorf("ExtKeyUsage = %v, want codeSigning", cert.ExtKeyUsage)
+	}
+
+	// Weak CSR keys are rejected when the certificate is created.
+	for _, fn := range []string{"test_files/test.smallstep.com.csr", "test_files/weakRSA.csr", "test_files/p224.csr"} {
+		p := mustNewProfile(t)(NewCodeSigningProfileWithCSR(mustLoadCSR(t, fn), iss, issPriv))
+		if _, err := p.CreateCertificate(); !errors.Is(err, ErrWeakKey) {
+			t.Errorf("%s: CreateCertificate() error = %v, want ErrWeakKey", fn, err)
+		}
+	}
+
+	if _, err := NewCodeSigningProfileWithCSR(mustLoadCSR(t, "test_files/badsig.csr"), iss, issPriv); !errors.Is(err, ErrInvalidCSRSignature) {
+		t.Errorf("NewCodeSigningProfileWithCSR() error = %v, want ErrInvalidCSRSignature", err)
+	}
+	if _, err := NewCodeSigningProfileWithCSR(&x509.CertificateRequest{}, iss, issPriv); !errors.Is(err, ErrMissingPublicKey) {
+		t.Errorf("NewCodeSigningProfileWithCSR() error = %v, want ErrMissingPublicKey", err)
+	}
+}
@@ -0,0 +1,399 @@
+package x509util
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/json"
+	"math/big"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+var (
+	// oidExtCRLReason is the OID for the reason code CRL entry extension
+	// defined in RFC 5280, section 5.3.1.
+	oidExtCRLReason = asn1.ObjectIdentifier{2, 5, 29, 21}
+	// oidExtInvalidityDate is the OID for the invalidity date CRL entry
+	// extension defined in RFC 5280, section 5.3.2.
+	oidExtInvalidityDate = asn1.ObjectIdentifier{2, 5, 29, 24}
+)
+
+// DefaultCRLInterval is the default time between ThisUpdate and NextUpdate of
+// the CRLs created by a CRLIssuer.
+var DefaultCRLInterval = 24 * time.Hour
+
+// RevocationReason is the reason code of a revoked certificate as defined in
+// RFC 5280, section 5.3.1.
+type RevocationReason int
+
+// Reason codes defined in RFC 5280, the value 7 is not used.
+const (
+	ReasonUnspecified          RevocationReason = 0
+	ReasonKeyCompromise        RevocationReason = 1
+	ReasonCACompromise         RevocationReason = 2
+	ReasonAffiliationChanged   RevocationReason = 3
+	ReasonSuperseded           RevocationReason = 4
+	ReasonCessationOfOperation RevocationReason = 5
+	ReasonCertificateHold      RevocationReason = 6
+	ReasonRemoveFromCRL        RevocationReason = 8
+	ReasonPrivilegeWithdrawn   RevocationReason = 9
+	ReasonAACompromise         RevocationReason = 10
+)
+
+// CRLIssuer keeps track of the revoked certificates of an issuer and creates
+// CRLs with increasing CRL numbers. It is safe for concurrent use.
+//
+// Only the bookkeeping state, the CRL number, the time of the last CRL and
+// the revoked certificates, is serialized to JSON; to restore it, unmarshal
+// the JSON into a CRLIssuer created with NewCRLIssuer.
+type CRLIssuer struct {
+	iss           *x509.Certificate
+	signer        crypto.Signer
+	interval      time.Duration
+	clock         func() time.Time
+	removeExpired bool
+
+	mu         sync.Mutex
+	number     *big.Int
+	lastUpdate time.Time
+	entries    []revocationEntry
+}
+
+type revocationEntry struct {
+	serialNumber   *big.Int
+	revokedAt      time.Time
+	reason         RevocationReason
+	invalidityDate time.Time
+	notAfter       time.Time
+}
+
+// CRLIssuerOption is the type used to configure a CRLIssuer.
+type CRLIssuerOption func(c *CRLIssuer) error
+
+// WithCRLInterval returns a CRLIssuerOption that sets the time between
+// ThisUpdate and NextUpdate of the CRLs, by default DefaultCRLInterval.
+func WithCRLInterval(d time.Duration) CRLIssuerOption {
+	return func(c *CRLIssuer) error {
+		if d <= 0 {
+			return errors.Errorf("CRL interval must be greater than 0, got %s", d)
+		}
+		c.interval = d
+		return nil
+	}
+}
+
+// WithCRLClock returns a CRLIssuerOption that sets the function used to get
+// the current time.
+func WithCRLClock(now func() time.Time) CRLIssuerOption {
+	return func(c *CRLIssuer) error {
+		if now == nil {
+			return errors.New("clock cannot be nil")
+		}
+		c.clock = now
+		return nil
+	}
+}
+
+// WithRemoveExpiredEntries returns a CRLIssuerOption that removes the entries
+// of expired certificates from the CRLs. As required by RFC 5280, section
+// 3.3, an entry is removed only after it has appeared in one CRL issued after
+// the certificate expired. Only the entries revoked using WithCertificateExpiry
+// are removed.
+func WithRemoveExpiredEntries() CRLIssuerOption {
+	return func(c *CRLIssuer) error {
+		c.removeExpired = true
+		return nil
+	}
+}
+
+// RevokeOption is the type used to set optional values of a revoked
+// certificate in CRLIssuer.Revoke.
+type RevokeOption func(e *revocationEntry) error
+
+// WithInvalidityDate returns a RevokeOption that adds the invalidity date
+// entry extension, the time at which the key is known or suspected to have
+// been compromised.
+func WithInvalidityDate(t time.Time) RevokeOption {
+	return func(e *revocationEntry) error {
+		if t.IsZero() {
+			return errors.New("invalidity date cannot be zero")
+		}
+		e.invalidityDate = t
+		return nil
+	}
+}
+
+// WithCertificateExpiry returns a RevokeOption that sets the NotAfter of the
+// revoked certificate, it is used by WithRemoveExpiredEntries.
+func WithCertificateExpiry(notAfter time.Time) RevokeOption {
+	return func(e *revocationEntry) error {
+		e.notAfter = notAfter
+		return nil
+	}
+}
+
+// NewCRLIssuer returns a new CRLIssuer that signs CRLs with the given issuer
+// certificate and signer. The issuer must be a CA with the CRLSign key usage.
+func NewCRLIssuer(iss *x509.Certificate, signer crypto.Signer, opts ...CRLIssuerOption) (*CRLIssuer, error) {
+	if iss == nil {
+		return nil, errors.New("issuer certificate cannot be nil")
+	}
+	if signer == nil {
+		return nil, errors.New("issuer signer cannot be nil")
+	}
+	if !iss.BasicConstraintsValid || !iss.IsCA {
+		return nil, &InvalidIssuerError{Property: "IsCA"}
+	}
+	if iss.KeyUsage&x509.KeyUsageCRLSign == 0 {
+		return nil, errors.New("issuer certificate cannot sign CRLs: KeyUsageCRLSign is required")
+	}
+	if err := validateIssuerKey(iss, signer); err != nil {
+		return nil, err
+	}
+	c := &CRLIssuer{
+		iss:      iss,
+		signer:   signer,
+		interval: DefaultCRLInterval,
+		clock:    time.Now,
+		number:   new(big.Int),
+	}
+	for _, fn := range opts {
+		if err := fn(c); err != nil {
+			return nil, err
+		}
+	}
+	return c, nil
+}
+
+// Revoke adds the certificate with the given serial number to the revoked
+// certificates. A reason code extension is added to the entry unless the
+// reason is ReasonUnspecified, as recommended by RFC 5280. It returns an
+// error if the certificate is already revoked.
+func (c *CRLIssuer) Revoke(serial *big.Int, revokedAt time.Time, reason RevocationReason, opts ...RevokeOption) error {
+	if serial == nil || serial.Sign() <= 0 {
+		return errors.New("serial number must be a positive number")
+	}
+	if revokedAt.IsZero() {
+		return errors.New("revocation time cannot be zero")
+	}
+	switch {
+	case reason < ReasonUnspecified || reason == 7 || reason > ReasonAACompromise:
+		return errors.Errorf("invalid revocation reason %d", reason)
+	case reason == ReasonRemoveFromCRL:
+		return errors.New("revocation reason removeFromCRL can only be used in delta CRLs")
+	}
+	e := revocationEntry{
+		serialNumber: new(big.Int).Set(serial),
+		revokedAt:    revokedAt,
+		reason:       reason,
+	}
+	for _, fn := range opts {
+		if err := fn(&e); err != nil {
+			return err
+		}
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.indexEntry(serial) >= 0 {
+		return errors.Errorf("certificate with serial number %s is already revoked", serial)
+	}
+	c.entries = append(c.entries, e)
+	return nil
+}
+
+// IsRevoked returns true if the certificate with the given serial number is
+// in the revoked certificates.
+func (c *CRLIssuer) IsRevoked(serial *big.Int) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.indexEntry(serial) >= 0
+}
+
+// Number returns the number of the last CRL created, or 0 if no CRL has been
+// created yet.
+func (c *CRLIssuer) Number() *big.Int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return new(big.Int).Set(c.number)
+}
+
+// CreateCRL creates a new DER encoded CRL with the revoked certificates. The
+// CRL number is the number of the previous CRL plus one, ThisUpdate is the
+// current time and NextUpdate is ThisUpdate plus the configured interval.
+func (c *CRLIssuer) CreateCRL() ([]byte, error) {
+	if c.iss == nil || c.signer == nil {
+		return nil, errors.New("CRL issuer must be created with NewCRLIssuer")
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := c.clock()
+	if now.Before(c.lastUpdate) {
+		return nil, errors.Errorf("current time %s is before the time of the last CRL %s", now, c.lastUpdate)
+	}
+
+	var entries []revocationEntry
+	revoked := make([]pkix.RevokedCertificate, 0, len(c.entries))
+	for _, e := range c.entries {
+		// The previous CRL was issued after the certificate expired, and it
+		// included the entry.
+		if c.removeExpired && !e.notAfter.IsZero() && !c.lastUpdate.IsZero() && e.notAfter.Before(c.lastUpdate) {
+			continue
+		}
+		rc, err := e.revokedCertificate()
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, e)
+		revoked = append(revoked, rc)
+	}
+
+	number := new(big.Int).Add(c.number, big.NewInt(1))
+	der, err := x509.CreateRevocationList(rand.Reader, &x509.RevocationList{
+		RevokedCertificates: revoked,
+		Number:              number,
+		ThisUpdate:          now,
+		NextUpdate:          now.Add(c.interval),
+	}, c.iss, c.signer)
+	if err != nil {
+		return nil, errors.Wrap(err, "error creating CRL")
+	}
+
+	c.number = number
+	c.lastUpdate = now
+	c.entries = entries
+	return der, nil
+}
+
+func (c *CRLIssuer) indexEntry(serial *big.Int) int {
+	for i, e := range c.entries {
+		if e.serialNumber.Cmp(serial) == 0 {
+			return i
+		}
+	}
+	return -1
+}
+
+// revokedCertificate returns the CRL entry of the revoked certificate.
+func (e revocationEntry) revokedCertificate() (pkix.RevokedCertificate, error) {
+	rc := pkix.RevokedCertificate{
+		SerialNumber:   e.serialNumber,
+		RevocationTime: e.revokedAt.UTC(),
+	}
+	if e.reason != ReasonUnspecified {
+		value, err := asn1.Marshal(asn1.Enumerated(e.reason))
+		if err != nil {
+			return rc, errors.Wrap(err, "error marshaling revocation reason")
+		}
+		rc.Extensions = append(rc.Extensions, pkix.Extension{Id: oidExtCRLReason, Value: value})
+	}
+	if !e.invalidityDate.IsZero() {
+		value, err := asn1.MarshalWithParams(e.invalidityDate.UTC(), "generalized")
+		if err != nil {
+			return rc, errors.Wrap(err, "error marshaling invalidity date")
+		}
+		rc.Extensions = append(rc.Extensions, pkix.Extension{Id: oidExtInvalidityDate, Value: value})
+	}
+	return rc, nil
+}
+
+// crlIssuerState is the JSON representation of the state of a CRLIssuer. The
+// serial numbers and the CRL number are encoded as decimal strings.
+type crlIssuerState struct {
+	Number     string               `json:"number"`
+	LastUpdate *time.Time           `json:"lastUpdate,omitempty"`
+	Entries    []crlIssuerStateItem `json:"entries"`
+}
+
+type crlIssuerStateItem struct {
+	SerialNumber   string           `json:"serialNumber"`
+	RevokedAt      time.Time        `json:"revokedAt"`
+	Reason         RevocationReason `json:"reason"`
+	InvalidityDate *time.Time       `json:"invalidityDate,omitempty"`
+	NotAfter       *time.Time       `json:"notAfter,omitempty"`
+}
+
+// MarshalJSON implements the json.Marshaler interface. It marshals the CRL
+// number, the time of the last CRL and the revoked certificates.
+func (c *CRLIssuer) MarshalJSON() ([]byte, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	state := crlIssuerState{
+		Number:     c.number.String(),
+		LastUpdate: timePtr(c.lastUpdate),
+		Entries:    make([]crlIssuerStateItem, len(c.entries)),
+	}
+	for i, e := range c.entries {
+		state.Entries[i] = crlIssuerStateItem{
+			SerialNumber:   e.serialNumber.String(),
+			RevokedAt:      e.revokedAt,
+			Reason:         e.reason,
+			InvalidityDate: timePtr(e.invalidityDate),
+			NotAfter:       timePtr(e.notAfter),
+		}
+	}
+	return json.Marshal(state)
+}
+
+// UnmarshalJSON implements the json.Unmarshaler interface. It replaces the
+// state of the CRLIssuer with the one in the given JSON, the issuer
+// certificate, signer and options are not modified.
+func (c *CRLIssuer) UnmarshalJSON(data []byte) error {
+	var state crlIssuerState
+	if err := json.Unmarshal(data, &state); err != nil {
+		return errors.Wrap(err, "error unmarshaling CRL issuer state")
+	}
+	number, ok := new(big.Int).SetString(state.Number, 10)
+	if !ok || number.Sign() < 0 {
+		return errors.Errorf("invalid CRL number %q", state.Number)
+	}
+	entries := make([]revocationEntry, 0, len(state.Entries))
+	for _, item := range state.Entries {
+		sn, ok := new(big.Int).SetString(item.SerialNumber, 10)
+		if !ok || sn.Sign() <= 0 {
+			return errors.Errorf("invalid serial number %q", item.SerialNumber)
+		}
+		for _, e := range entries {
+			if e.serialNumber.Cmp(sn) == 0 {
+				return errors.Errorf("duplicate serial number %s", sn)
+			}
+		}
+		e := revocationEntry{
+			serialNumber: sn,
+			revokedAt:    item.RevokedAt,
+			reason:       item.Reason,
+		}
+		if item.InvalidityDate != nil {
+			e.invalidityDate = *item.InvalidityDate
+		}
+		if item.NotAfter != nil {
+			e.notAfter = *item.NotAfter
+		}
+		entries = append(entries, e)
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.number = number
+	c.lastUpdate = time.Time{}
+	if state.LastUpdate != nil {
+		c.lastUpdate = *state.LastUpdate
+	}
+	c.entries = entries
+	return nil
+}
+
+// timePtr returns a pointer to the given time, or nil if it is zero.
+func timePtr(t time.Time) *time.Time {
+	if t.IsZero() {
+		return nil
+	}
+	return &t
+}
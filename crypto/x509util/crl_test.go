@@ -0,0 +1,267 @@
+package x509util
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/json"
+	"math/big"
+	"testing"
+	"time"
+)
+
+func mustParseCRL(t *testing.T, iss *x509.Certificate, der []byte) *pkix.CertificateList {
+	t.Helper()
+	crl, err := x509.ParseCRL(der)
+	if err != nil {
+		t.Fatalf("ParseCRL() error = %v", err)
+	}
+	if err := iss.CheckCRLSignature(crl); err != nil {
+		t.Fatalf("CheckCRLSignature() error = %v", err)
+	}
+	return crl
+}
+
+func crlNumber(t *testing.T, crl *pkix.CertificateList) int64 {
+	t.Helper()
+	for _, ext := range crl.TBSCertList.Extensions {
+		if ext.Id.Equal(asn1.ObjectIdentifier{2, 5, 29, 20}) {
+			var n *big.Int
+			if _, err := asn1.Unmarshal(ext.Value, &n); err != nil {
+				t.Fatal(err)
+			}
+			return n.Int64()
+		}
+	}
+	t.Fatal("CRL does not have a CRL number extension")
+	return 0
+}
+
+func findEntryExtension(exts []pkix.Extension, oid asn1.ObjectIdentifier) (pkix.Extension, bool) {
+	for _, ext := range exts {
+		if ext.Id.Equal(oid) {
+			return ext, true
+		}
+	}
+	return pkix.Extension{}, false
+}
+
+func TestCRLIssuer(t *testing.T) {
+	root := mustNewProfile(t)(NewRootProfile("Root"))
+	rootCert := mustCreateCertificate(t, root)
+	signer := root.SubjectPrivateKey().(crypto.Signer)
+
+	now := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	clock := func() time.Time { return now }
+	ci, err := NewCRLIssuer(rootCert, signer, WithCRLClock(clock), WithCRLInterval(6*time.Hour))
+	if err != nil {
+		t.Fatalf("NewCRLIssuer() error = %v", err)
+	}
+
+	// Empty CRL.
+	crl := mustParseCRL(t, rootCert, mustCreateCRL(t, ci))
+	if n := crlNumber(t, crl); n != 1 {
+		t.Errorf("CRL number = %d, want 1", n)
+	}
+	if len(crl.TBSCertList.RevokedCertificates) != 0 {
+		t.Errorf("RevokedCertificates = %v, want none", crl.TBSCertList.RevokedCertificates)
+	}
+	if !crl.TBSCertList.ThisUpdate.Equal(now) || !crl.TBSCertList.NextUpdate.Equal(now.Add(6*time.Hour)) {
+		t.Errorf("ThisUpdate = %s, NextUpdate = %s", crl.TBSCertList.ThisUpdate, crl.TBSCertList.NextUpdate)
+	}
+
+	revokedAt := now.Add(-time.Hour)
+	invalidity := now.Add(-48 * time.Hour)
+	if err := ci.Revoke(big.NewInt(100), revokedAt, ReasonKeyCompromise, WithInvalidityDate(invalidity)); err != nil {
+		t.Fatalf("Revoke() error = %v", err)
+	}
+	if err := ci.Revoke(big.NewInt(200), revokedAt, ReasonUnspecified); err != nil {
+		t.Fatalf("Revoke() error = %v", err)
+	}
+	if err := ci.Revoke(big.NewInt(100), now, ReasonSuperseded); err == nil {
+		t.Error("Revoke() duplicate error = nil, want error")
+	}
+	if !ci.IsRevoked(big.NewInt(100)) || ci.IsRevoked(big.NewInt(300)) {
+		t.Error("IsRevoked() returned unexpected values")
+	}
+
+	now = now.Add(time.Hour)
+	crl = mustParseCRL(t, rootCert, mustCreateCRL(t, ci))
+	if n := crlNumber(t, crl); n != 2 {
+		t.Errorf("CRL number = %d, want 2", n)
+	}
+	revoked := crl.TBSCertList.RevokedCertificates
+	if len(revoked) != 2 {
+		t.Fatalf("RevokedCertificates = %v, want 2 entries", revoked)
+	}
+	if revoked[0].SerialNumber.Int64() != 100 || !revoked[0].RevocationTime.Equal(revokedAt) {
+		t.Errorf("entry 0 = %d %s", revoked[0].SerialNumber, revoked[0].RevocationTime)
+	}
+	ext, ok := findEntryExtension(revoked[0].Extensions, oidExtCRLReason)
+	if !ok {
+		t.Fatal("entry 0 does not have a reason code")
+	}
+	var reason asn1.Enumerated
+	if _, err := asn1.Unmarshal(ext.Value, &reason); err != nil || RevocationReason(reason) != ReasonKeyCompromise {
+		t.Errorf("entry 0 reason = %d, %v, want %d", reason, err, ReasonKeyCompromise)
+	}
+	ext, ok = findEntryExtension(revoked[0].Extensions, oidExtInvalidityDate)
+	if !ok {
+		t.Fatal("entry 0 does not have an invalidity date")
+	}
+	var date time.Time
+	if _, err := asn1.UnmarshalWithParams(ext.Value, &date, "generalized"); err != nil || !date.Equal(invalidity) {
+		t.Errorf("entry 0 invalidity date = %s, %v, want %s", date, err, invalidity)
+	}
+	if len(revoked[1].Extensions) != 0 {
+		t.Errorf("entry 1 extensions = %v, want none", revoked[1].Extensions)
+	}
+
+	// The state is restored and the CRL number keeps increasing.
+	data, err := json.Marshal(ci)
+	if err != nil {
+		t.Fatalf("json.Marshal() error = %v", err)
+	}
+	restored, err := NewCRLIssuer(rootCert, signer, WithCRLClock(clock))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := json.Unmarshal(data, restored); err != nil {
+		t.Fatalf("json.Unmarshal() error = %v", err)
+	}
+	if restored.Number().Int64() != 2 || !restored.IsRevoked(big.NewInt(100)) || !restored.IsRevoked(big.NewInt(200)) {
+		t.Errorf("restored state = %s", data)
+	}
+	now = now.Add(time.Hour)
+	crl = mustParseCRL(t, rootCert, mustCreateCRL(t, restored))
+	if n := crlNumber(t, crl); n != 3 {
+		t.Errorf("CRL number = %d, want 3", n)
+	}
+	if len(crl.TBSCertList.RevokedCertificates) != 2 {
+		t.Errorf("RevokedCertificates = %v, want 2 entries", crl.TBSCertList.RevokedCertificates)
+	}
+	if data2, err := json.Marshal(restored); err != nil || len(data2) != len(data) {
+		t.Errorf("json.Marshal() = %s, %v, want the same state as %s", data2, err, data)
+	}
+
+	// The clock cannot go backwards.
+	now = now.Add(-time.Minute)
+	if _, err := restored.CreateCRL(); err == nil {
+		t.Error("CreateCRL() error = nil, want error")
+	}
+}
+
+func TestCRLIssuer_removeExpired(t *testing.T) {
+	root := mustNewProfile(t)(NewRootProfile("Root"))
+	rootCert := mustCreateCertificate(t, root)
+
+	now := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	ci, err := NewCRLIssuer(rootCert, root.SubjectPrivateKey().(crypto.Signer),
+		WithCRLClock(func() time.Time { return now }), WithRemoveExpiredEntries())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := ci.Revoke(big.NewInt(1), now, ReasonSuperseded, WithCertificateExpiry(now.Add(time.Hour))); err != nil {
+		t.Fatal(err)
+	}
+	if err := ci.Revoke(big.NewInt(2), now, ReasonSuperseded); err != nil {
+		t.Fatal(err)
+	}
+
+	// The expired entry must appear in one CRL issued after it expires.
+	for i, want := range []int{2, 2, 1, 1} {
+		crl := mustParseCRL(t, rootCert, mustCreateCRL(t, ci))
+		if n := len(crl.TBSCertList.RevokedCertificates); n != want {
+			t.Errorf("CRL %d has %d entries, want %d", i+1, n, want)
+		}
+		now = now.Add(2 * time.Hour)
+	}
+	if ci.IsRevoked(big.NewInt(1)) || !ci.IsRevoked(big.NewInt(2)) {
+		t.Error("IsRevoked() returned unexpected values")
+	}
+}
+
+func TestCRLIssuer_fail(t *testing.T) {
+	root := mustNewProfile(t)(NewRootProfile("Root"))
+	rootCert := mustCreateCertificate(t, root)
+	signer := root.SubjectPrivateKey().(crypto.Signer)
+	other, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	noCRLSign := mustNewProfile(t)(NewRootProfile("Root", WithKeyUsage(x509.KeyUsageCertSign)))
+	leaf := mustNewProfile(t)(NewLeafProfile("leaf", rootCert, signer, WithHosts("leaf.smallstep.com")))
+
+	newIssuer := []struct {
+		name   string
+		iss    *x509.Certificate
+		signer crypto.Signer
+		opts   []CRLIssuerOption
+	}{
+		{"nil issuer", nil, signer, nil},
+		{"nil signer", rootCert, nil, nil},
+		{"not CA", mustCreateCertificate(t, leaf), leaf.SubjectPrivateKey().(crypto.Signer), nil},
+		{"no CRLSign", mustCreateCertificate(t, noCRLSign), noCRLSign.SubjectPrivateKey().(crypto.Signer), nil},
+		{"key mismatch", rootCert, other, nil},
+		{"interval", rootCert, signer, []CRLIssuerOption{WithCRLInterval(0)}},
+		{"clock", rootCert, signer, []CRLIssuerOption{WithCRLClock(nil)}},
+	}
+	for _, tt := range newIssuer {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := NewCRLIssuer(tt.iss, tt.signer, tt.opts...); err == nil {
+				t.Error("NewCRLIssuer() error = nil, want error")
+			}
+		})
+	}
+
+	ci, err := NewCRLIssuer(rootCert, signer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now()
+	revoke := []struct {
+		name   string
+		serial *big.Int
+		at     time.Time
+		reason RevocationReason
+		opts   []RevokeOption
+	}{
+		{"nil serial", nil, now, ReasonUnspecified, nil},
+		{"zero serial", big.NewInt(0), now, ReasonUnspecified, nil},
+		{"zero time", big.NewInt(1), time.Time{}, ReasonUnspecified, nil},
+		{"reason 7", big.NewInt(1), now, 7, nil},
+		{"reason removeFromCRL", big.NewInt(1), now, ReasonRemoveFromCRL, nil},
+		{"reason out of range", big.NewInt(1), now, 11, nil},
+		{"zero invalidity date", big.NewInt(1), now, ReasonKeyCompromise, []RevokeOption{WithInvalidityDate(time.Time{})}},
+	}
+	for _, tt := range revoke {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := ci.Revoke(tt.serial, tt.at, tt.reason, tt.opts...); err == nil {
+				t.Error("Revoke() error = nil, want error")
+			}
+		})
+	}
+
+	for _, data := range []string{`{"number":"x","entries":[]}`, `{"number":"1","entries":[{"serialNumber":"0"}]}`,
+		`{"number":"1","entries":[{"serialNumber":"5"},{"serialNumber":"5"}]}`} {
+		if err := json.Unmarshal([]byte(data), ci); err == nil {
+			t.Errorf("json.Unmarshal(%s) error = nil, want error", data)
+		}
+	}
+	if _, err := new(CRLIssuer).CreateCRL(); err == nil {
+		t.Error("CreateCRL() error = nil, want error")
+	}
+}
+
+func mustCreateCRL(t *testing.T, ci *CRLIssuer) []byte {
+	t.Helper()
+	der, err := ci.CreateCRL()
+	if err != nil {
+		t.Fatalf("CreateCRL() error = %v", err)
+	}
+	return der
+}
@@ -0,0 +1,55 @@
+package x509util
+
+import (
+	"crypto"
+	"crypto/x509"
+
+	"github.com/pkg/errors"
+)
+
+// NewCrossSignProfile returns a new intermediate x509 Certificate profile that
+// re-issues the given CA certificate under a new issuer.
+//
+// The subject, public key, subject key identifier, validity, key usages, basic
+// constraints and name constraints of the cross-signed certificate are
+// preserved, the issuer and authority key identifier are taken from the new
+// issuer, and a new serial number is generated. The subject is copied from the
+// raw DER so it is byte-identical to the original and chains can be built
+// with either certificate; modifiers that change the parsed subject have no
+// effect.
+func NewCrossSignProfile(toCross, newIssuer *x509.Certificate, newIssuerPriv crypto.PrivateKey, withOps ...WithOption) (Profile, error) {
+	if toCross == nil {
+		return nil, errors.New("certificate to cross-sign cannot be nil")
+	}
+	if newIssuer == nil {
+		return nil, errors.New("issuing certificate cannot be nil")
+	}
+
+	sub := &x509.Certificate{
+		Subject:                     toCross.Subject,
+		RawSubject:                  toCross.RawSubject,
+		Issuer:                      newIssuer.Subject,
+		NotBefore:                   toCross.NotBefore,
+		NotAfter:                    toCross.NotAfter,
+		KeyUsage:                    toCross.KeyUsage,
+		ExtKeyUsage:                 toCross.ExtKeyUsage,
+		UnknownExtKeyUsage:          toCross.UnknownExtKeyUsage,
+		BasicConstraintsValid:       toCross.BasicConstraintsValid,
+		IsCA:                        toCross.IsCA,
+		MaxPathLen:                  toCross.MaxPathLen,
+		MaxPathLenZero:              toCross.MaxPathLenZero,
+		SubjectKeyId:                toCross.SubjectKeyId,
+		PermittedDNSDomainsCritical: toCross.PermittedDNSDomainsCritical,
+		PermittedDNSDomains:         toCross.PermittedDNSDomains,
+		ExcludedDNSDomains:          toCross.ExcludedDNSDomains,
+		PermittedIPRanges:           toCross.PermittedIPRanges,
+		ExcludedIPRanges:            toCross.ExcludedIPRanges,
+		PermittedEmailAddresses:     toCross.PermittedEmailAddresses,
+		ExcludedEmailAddresses:      toCross.ExcludedEmailAddresses,
+		PermittedURIDomains:         toCross.PermittedURIDomains,
+		ExcludedURIDomains:          toCross.ExcludedURIDomains,
+	}
+
+	withOps = append([]WithOption{WithPublicKey(toCross.PublicKey)}, withOps...)
+	return newProfile(&Intermediate{}, sub, newIssuer, newIssuerPriv, withOps...)
+}
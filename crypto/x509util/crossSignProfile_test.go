@@ -0,0 +1,107 @@
+package x509util
+
+import (
+	"bytes"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"testing"
+)
+
+func TestNewCrossSignProfile(t *testing.T) {
+	oldRoot := mustNewProfile(t)(NewRootProfile("Old Root"))
+	oldRootCert := mustCreateCertificate(t, oldRoot)
+	newRoot := mustNewProfile(t)(NewRootProfile("New Root"))
+	newRootCert := mustCreateCertificate(t, newRoot)
+
+	intermediate := mustNewProfile(t)(NewIntermediateProfile("Intermediate", oldRootCert, oldRoot.SubjectPrivateKey()))
+	intermediateCert := mustCreateCertificate(t, intermediate)
+
+	p, err := NewCrossSignProfile(intermediateCert, newRootCert, newRoot.SubjectPrivateKey())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.SubjectPrivateKey() != nil {
+		t.Error("SubjectPrivateKey() is not nil")
+	}
+	crossCert := mustCreateCertificate(t, p)
+
+	roots := x509.NewCertPool()
+	roots.AddCert(newRootCert)
+	if _, err := crossCert.Verify(x509.VerifyOptions{Roots: roots}); err != nil {
+		t.Errorf("Verify() error = %v", err)
+	}
+	if !bytes.Equal(crossCert.SubjectKeyId, intermediateCert.SubjectKeyId) {
+		t.Errorf("SubjectKeyId = %x, want %x", crossCert.SubjectKeyId, intermediateCert.SubjectKeyId)
+	}
+	if !bytes.Equal(crossCert.AuthorityKeyId, newRootCert.SubjectKeyId) {
+		t.Errorf("AuthorityKeyId = %x, want %x", crossCert.AuthorityKeyId, newRootCert.SubjectKeyId)
+	}
+	if !bytes.Equal(crossCert.RawSubject, intermediateCert.RawSubject) {
+		t.Errorf("RawSubject = %x, want %x", crossCert.RawSubject, intermediateCert.RawSubject)
+	}
+	if !bytes.Equal(crossCert.RawSubjectPublicKeyInfo, intermediateCert.RawSubjectPublicKeyInfo) {
+		t.Error("RawSubjectPublicKeyInfo does not match the cross-signed certificate")
+	}
+	if crossCert.SerialNumber.Cmp(intermediateCert.SerialNumber) == 0 {
+		t.Error("SerialNumber is equal to the serial number of the cross-signed certificate")
+	}
+	if crossCert.KeyUsage != intermediateCert.KeyUsage {
+		t.Errorf("KeyUsage = %x, want %x", crossCert.KeyUsage, intermediateCert.KeyUsage)
+	}
+	if crossCert.IsCA != intermediateCert.IsCA || crossCert.MaxPathLen != intermediateCert.MaxPathLen || crossCert.MaxPathLenZero != intermediateCert.MaxPathLenZero {
+		t.Error("basic constraints do not match the cross-signed certificate")
+	}
+
+	if _, err := NewCrossSignProfile(nil, newRootCert, newRoot.SubjectPrivateKey()); err == nil {
+		t.Error("NewCrossSignProfile() error = nil, want error")
+	}
+}
+
+func TestNewCrossSignProfile_rawSubject(t *testing.T) {
+	// A multi-valued RDN with UTF8String values that the x509 package would
+	// re-encode as two RDNs with PrintableString values.
+	utf8 := func(s string) asn1.RawValue {
+		return asn1.RawValue{Class: asn1.ClassUniversal, Tag: asn1.TagUTF8String, Bytes: []byte(s)}
+	}
+	rawSubject, err := asn1.Marshal(pkix.RDNSequence{{
+		{Type: asn1.ObjectIdentifier{2, 5, 4, 10}, Value: utf8("Smallstep")},
+		{Type: asn1.ObjectIdentifier{2, 5, 4, 3}, Value: utf8("Intermediate")},
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	oldRoot := mustNewProfile(t)(NewRootProfile("Old Root"))
+	oldRootCert := mustCreateCertificate(t, oldRoot)
+	newRoot := mustNewProfile(t)(NewRootProfile("New Root"))
+	newRootCert := mustCreateCertificate(t, newRoot)
+	intermediate := mustNewProfile(t)(NewIntermediateProfile("Intermediate", oldRootCert, oldRoot.SubjectPrivateKey(),
+		withTemplateFields(func(crt *x509.Certificate) {
+			crt.RawSubject = rawSubject
+		})))
+	intermediateCert := mustCreateCertificate(t, intermediate)
+	if !bytes.Equal(intermediateCert.RawSubject, rawSubject) {
+		t.Fatalf("RawSubject = %x, want %x", intermediateCert.RawSubject, rawSubject)
+	}
+	if reencoded, _ := asn1.Marshal(intermediateCert.Subject.ToRDNSequence()); bytes.Equal(reencoded, rawSubject) {
+		t.Fatal("re-encoded subject is equal to the raw subject")
+	}
+
+	p := mustNewProfile(t)(NewCrossSignProfile(intermediateCert, newRootCert, newRoot.SubjectPrivateKey()))
+	crossCert := mustCreateCertificate(t, p)
+	if !bytes.Equal(crossCert.RawSubject, rawSubject) {
+		t.Errorf("RawSubject = %x, want %x", crossCert.RawSubject, rawSubject)
+	}
+
+	// A leaf issued by the original intermediate chains to the new root using
+	// the cross-signed certificate.
+	leaf := mustNewProfile(t)(NewLeafProfile("leaf.smallstep.com", intermediateCert, intermediate.SubjectPrivateKey(), WithHosts("leaf.smallstep.com")))
+	leafCert := mustCreateCertificate(t, leaf)
+	roots, intermediates := x509.NewCertPool(), x509.NewCertPool()
+	roots.AddCert(newRootCert)
+	intermediates.AddCert(crossCert)
+	if _, err := leafCert.Verify(x509.VerifyOptions{Roots: roots, Intermediates: intermediates}); err != nil {
+		t.Errorf("Verify() error = %v", err)
+	}
+}
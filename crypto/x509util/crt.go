@@ -1,6 +1,7 @@
 package x509util
 
 import (
+	"crypto"
 	"crypto/sha1"
 	"crypto/sha256"
 	"crypto/x509"
@@ -38,6 +39,9 @@ const (
 	Base64RawStdFingerprint = FingerprintEncoding(fingerprint.Base64RawStdFingerprint)
 	// EmojiFingerprint represents emoji encoding of fingerprint.
 	EmojiFingerprint = FingerprintEncoding(fingerprint.EmojiFingerprint)
+	// ColonHexFingerprint represents the upper-case, colon-separated hex
+	// encoding of fingerprint used by OpenSSL.
+	ColonHexFingerprint = FingerprintEncoding(fingerprint.ColonHexFingerprint)
 )
 
 // EncodedFingerprint returns an encoded fingerprint of the certificate.
@@ -55,6 +59,25 @@ func EncodedFingerprint(cert *x509.Certificate, encoding FingerprintEncoding,
 	return fingerprint.Fingerprint(sum[:], fingerprint.WithEncoding(fingerprint.Encoding(encoding))), nil
 }
 
+// SPKIFingerprint returns the SHA-256 fingerprint of the DER encoded
+// SubjectPublicKeyInfo of the given public key, the value used for public key
+// pinning.
+func SPKIFingerprint(pub crypto.PublicKey) (string, error) {
+	return EncodedSPKIFingerprint(pub, HexFingerprint)
+}
+
+// EncodedSPKIFingerprint returns the encoded SHA-256 fingerprint of the DER
+// encoded SubjectPublicKeyInfo of the given public key. HTTP public key pins
+// use the Base64Fingerprint encoding.
+func EncodedSPKIFingerprint(pub crypto.PublicKey, encoding FingerprintEncoding) (string, error) {
+	der, err := x509.MarshalPKIXPublicKey(pub)
+	if err != nil {
+		return "", errors.Wrap(err, "error marshaling public key")
+	}
+	sum := sha256.Sum256(der)
+	return fingerprint.Fingerprint(sum[:], fingerprint.WithEncoding(fingerprint.Encoding(encoding))), nil
+}
+
 // SplitSANs splits a slice of Subject Alternative Names into slices of
 // IP Addresses and DNS Names. If an element is not an IP address, then it
 // is bucketed as a DNS Name.
@@ -42,6 +42,7 @@ func TestEncodedFingerprint(t *testing.T) {
 		{"base64raw", "test_files/ca.crt", Base64RawStdFingerprint, "aQh1H2gpDUVzrgvjmpjIube31OiypmlLdQmUZiat/pg"},
 		{"base64raw", "test_files/ca.crt", Base64RawURLFingerprint, "aQh1H2gpDUVzrgvjmpjIube31OiypmlLdQmUZiat_pg"},
 		{"emoji", "test_files/ca.crt", EmojiFingerprint, "🚁🍎👺🚌🏮☁️🎍👀🇮🇹✋🍼🚽⛅🐼🚬🎅🇷🇺🇷🇺🚂🤢🎀💩🚁🎆👺🎨👌✔️🚸🌈⚡🐼"},
+		{"colon", "test_files/ca.crt", ColonHexFingerprint, "69:08:75:1F:68:29:0D:45:73:AE:0B:E3:9A:98:C8:B9:B7:B7:D4:E8:B2:A6:69:4B:75:09:94:66:26:AD:FE:98"},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
@@ -53,7 +54,52 @@ func TestEncodedFingerprint(t *testing.T) {
 	}
 }
 
-func mustParseCertificate(t *testing.T, filename string) *x509.Certificate {
+func TestSPKIFingerprint(t *testing.T) {
+	tests := []struct {
+		name     string
+		fn       string
+		encoding FingerprintEncoding
+		want     string
+	}{
+		{"hex", "test_files/ca.crt", HexFingerprint, "ef0fb6ceff01045db8983cfc9dac8efd74a43488084469684cb8a682b00864db"},
+		{"base64", "test_files/ca.crt", Base64Fingerprint, "7w+2zv8BBF24mDz8nayO/XSkNIgIRGloTLimgrAIZNs="},
+		{"base64url", "test_files/ca.crt", Base64URLFingerprint, "7w-2zv8BBF24mDz8nayO_XSkNIgIRGloTLimgrAIZNs="},
+		{"colon", "test_files/ca.crt", ColonHexFingerprint, "EF:0F:B6:CE:FF:01:04:5D:B8:98:3C:FC:9D:AC:8E:FD:74:A4:34:88:08:44:69:68:4C:B8:A6:82:B0:08:64:DB"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cert := mustParseCertificate(t, tt.fn)
+			got, err := EncodedSPKIFingerprint(cert.PublicKey, tt.encoding)
+			if err != nil {
+				t.Fatalf("EncodedSPKIFingerprint() error = %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("EncodedSPKIFingerprint() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	cert := mustParseCertificate(t, "test_files/ca.crt")
+	if got, err := SPKIFingerprint(cert.PublicKey); err != nil || got != tests[0].want {
+		t.Errorf("SPKIFingerprint() = %v, %v, want %v", got, err, tests[0].want)
+	}
+	if _, err := SPKIFingerprint([]byte("foo")); err == nil {
+		t.Error("SPKIFingerprint() error = nil, want error")
+	}
+}
+
+func TestBase_Fingerprint(t *testing.T) {
+	p := mustNewProfile(t)(NewRootProfile("root"))
+	if _, err := p.Fingerprint(); err == nil {
+		t.Error("Fingerprint() error = nil, want error")
+	}
+	crt := mustCreateCertificate(t, p)
+	if got, err := p.Fingerprint(); err != nil || got != Fingerprint(crt) {
+		t.Errorf("Fingerprint() = %v, %v, want %v", got, err, Fingerprint(crt))
+	}
+}
+
+func mustParseCertificate(t testing.TB, filename string) *x509.Certificate {
 	pemData, err := os.ReadFile(filename)
 	if err != nil {
 		t.Fatalf("failed to read %s: %v", filename, err)
@@ -2,11 +2,29 @@ package x509util
 
 import (
 	"crypto/x509"
+	"encoding/asn1"
 	"encoding/pem"
+	"unicode/utf8"
 
 	"github.com/pkg/errors"
 )
 
+var oidChallengePassword = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 7}
+
+// tbsCertificateRequest is the ASN.1 structure of the certificate request
+// info defined in RFC 2986.
+type tbsCertificateRequest struct {
+	Version       int
+	Subject       asn1.RawValue
+	PublicKey     asn1.RawValue
+	RawAttributes []csrAttribute `asn1:"tag:0,set"`
+}
+
+type csrAttribute struct {
+	Type   asn1.ObjectIdentifier
+	Values []asn1.RawValue `asn1:"set"`
+}
+
 // LoadCSRFromBytes loads a CSR given the ASN.1 DER format.
 func LoadCSRFromBytes(der []byte) (*x509.CertificateRequest, error) {
 	block, _ := pem.Decode(der)
@@ -19,3 +37,108 @@ func LoadCSRFromBytes(der []byte) (*x509.CertificateRequest, error) {
 	}
 	return csr, nil
 }
+
+// ParseChallengePassword returns the value of the challengePassword attribute
+// (OID 1.2.840.113549.1.9.7) in the given CSR, used in SCEP enrollments. The
+// boolean is false if the CSR does not contain the attribute.
+//
+// The attribute can be encoded as a PrintableString, UTF8String, IA5String
+// or BMPString.
+func ParseChallengePassword(csr *x509.CertificateRequest) (string, bool, error) {
+	if csr == nil {
+		return "", false, errors.New("CSR cannot be nil")
+	}
+	var tbs tbsCertificateRequest
+	if _, err := asn1.Unmarshal(csr.RawTBSCertificateRequest, &tbs); err != nil {
+		return "", false, errors.Wrap(err, "error parsing certificate request")
+	}
+	for _, attr := range tbs.RawAttributes {
+		if !attr.Type.Equal(oidChallengePassword) {
+			continue
+		}
+		if len(attr.Values) != 1 {
+			return "", true, errors.Errorf("challengePassword attribute must have one value, found %d", len(attr.Values))
+		}
+		s, err := parseDirectoryString(attr.Values[0])
+		if err != nil {
+			return "", true, errors.Wrap(err, "error parsing challengePassword attribute")
+		}
+		return s, true, nil
+	}
+	return "", false, nil
+}
+
+// parseDirectoryString parses the DirectoryString encodings used in CSR
+// attributes.
+func parseDirectoryString(v asn1.RawValue) (string, error) {
+	if v.Class != asn1.ClassUniversal {
+		return "", errors.Errorf("unexpected ASN.1 class %d", v.Class)
+	}
+	switch v.Tag {
+	case asn1.TagPrintableString, asn1.TagIA5String, asn1.TagT61String:
+		var s string
+		if _, err := asn1.Unmarshal(v.FullBytes, &s); err != nil {
+			return "", err
+		}
+		return s, nil
+	case asn1.TagUTF8String:
+		if !utf8.Valid(v.Bytes) {
+			return "", errors.New("invalid UTF8String")
+		}
+		return string(v.Bytes), nil
+	case asn1.TagBMPString:
+		if len(v.Bytes)%2 != 0 {
+			return "", errors.New("invalid BMPString")
+		}
+		runes := make([]rune, 0, len(v.Bytes)/2)
+		for i := 0; i < len(v.Bytes); i += 2 {
+			runes = append(runes, rune(v.Bytes[i])<<8|rune(v.Bytes[i+1]))
+		}
+		return string(runes), nil
+	default:
+		return "", errors.Errorf("unsupported string type %d", v.Tag)
+	}
+}
+
+// WithChallengePasswordValidator returns a Profile modifier that validates the
+// challengePassword attribute of the CSR in profiles created with
+// NewLeafProfileWithCSR. The creation of the profile fails if the CSR does not
+// contain the attribute, or if the validator returns an error.
+func WithChallengePasswordValidator(fn func(string) error) WithOption {
+	return func(p Profile) error {
+		if fn == nil {
+			return errors.New("challenge password validator cannot be nil")
+		}
+		b, err := getBase(p)
+		if err != nil {
+			return err
+		}
+		b.challengePasswordValidator = fn
+		return nil
+	}
+}
+
+// withCSRChallengePassword is the modifier used in NewLeafProfileWithCSR to
+// run the challenge password validator.
+func withCSRChallengePassword(csr *x509.CertificateRequest) WithOption {
+	return func(p Profile) error {
+		b, err := getBase(p)
+		if err != nil {
+			return err
+		}
+		if b.challengePasswordValidator == nil {
+			return nil
+		}
+		password, ok, err := ParseChallengePassword(csr)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			return errors.New("CSR does not contain a challengePassword attribute")
+		}
+		if err := b.challengePasswordValidator(password); err != nil {
+			return errors.Wrap(err, "challengePassword validation failed")
+		}
+		return nil
+	}
+}
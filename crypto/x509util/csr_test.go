@@ -6,6 +6,7 @@ import (
 	"crypto/x509"
 	"crypto/x509/pkix"
 	"encoding/pem"
+	"os"
 	"testing"
 
 	"github.com/pkg/errors"
@@ -76,3 +77,77 @@ func TestCSR_LoadCSRFromBytes(t *testing.T) {
 		})
 	}
 }
+
+func mustLoadCSR(t *testing.T, filename string) *x509.CertificateRequest {
+	t.Helper()
+	b, err := os.ReadFile(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	csr, err := LoadCSRFromBytes(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return csr
+}
+
+func TestParseChallengePassword(t *testing.T) {
+	tests := []struct {
+		name    string
+		csr     *x509.CertificateRequest
+		want    string
+		wantOK  bool
+		wantErr bool
+	}{
+		{"ok/utf8", mustLoadCSR(t, "test_files/challengePasswordUTF8.csr"), "s3cr3t-challenge", true, false},
+		{"ok/printable", mustLoadCSR(t, "test_files/challengePasswordPrintable.csr"), "s3cr3t-challenge", true, false},
+		{"ok/missing", mustLoadCSR(t, "test_files/test.smallstep.com.csr"), "", false, false},
+		{"fail/nil", nil, "", false, true},
+		{"fail/parse", &x509.CertificateRequest{RawTBSCertificateRequest: []byte("foo")}, "", false, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok, err := ParseChallengePassword(tt.csr)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseChallengePassword() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want || ok != tt.wantOK {
+				t.Errorf("ParseChallengePassword() = %q, %v, want %q, %v", got, ok, tt.want, tt.wantOK)
+			}
+		})
+	}
+}
+
+func TestWithChallengePasswordValidator(t *testing.T) {
+	iss := mustParseCertificate(t, "test_files/noPasscodeCa.crt")
+	issPriv := mustParseRSAKey(t, "test_files/noPasscodeCa.key")
+
+	validator := func(s string) error {
+		if s != "s3cr3t-challenge" {
+			return errors.New("invalid challenge password")
+		}
+		return nil
+	}
+	tests := []struct {
+		name    string
+		csr     *x509.CertificateRequest
+		options []WithOption
+		wantErr bool
+	}{
+		{"ok", mustLoadCSR(t, "test_files/challengePasswordUTF8.csr"), []WithOption{WithChallengePasswordValidator(validator)}, false},
+		{"ok/no-validator", mustLoadCSR(t, "test_files/test.smallstep.com.csr"), nil, false},
+		{"fail/invalid", mustLoadCSR(t, "test_files/challengePasswordPrintable.csr"), []WithOption{WithChallengePasswordValidator(func(string) error {
+			return errors.New("invalid challenge password")
+		})}, true},
+		{"fail/missing", mustLoadCSR(t, "test_files/test.smallstep.com.csr"), []WithOption{WithChallengePasswordValidator(validator)}, true},
+		{"fail/nil", mustLoadCSR(t, "test_files/challengePasswordUTF8.csr"), []WithOption{WithChallengePasswordValidator(nil)}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := NewLeafProfileWithCSR(tt.csr, iss, issPriv, tt.options...)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("NewLeafProfileWithCSR() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,92 @@
+package x509util
+
+import (
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"math/big"
+	"net"
+	"net/url"
+	"time"
+)
+
+// ProfileSummary describes the certificate that a profile will create. It is
+// returned by Describe and can be used to log or review a profile before
+// signing it.
+type ProfileSummary struct {
+	Subject            pkix.Name
+	Issuer             pkix.Name
+	SerialNumber       *big.Int
+	NotBefore          time.Time
+	NotAfter           time.Time
+	SignatureAlgorithm x509.SignatureAlgorithm
+	IsCA               bool
+	// MaxPathLen is the path length constraint of a CA certificate, -1 if it
+	// is unconstrained.
+	MaxPathLen         int
+	KeyUsage           x509.KeyUsage
+	ExtKeyUsage        []x509.ExtKeyUsage
+	UnknownExtKeyUsage []asn1.ObjectIdentifier
+	DNSNames           []string
+	IPAddresses        []net.IP
+	EmailAddresses     []string
+	URIs               []*url.URL
+	// Extensions are the extensions copied verbatim into the certificate.
+	// The standard extensions generated from the other fields are not
+	// included.
+	Extensions []pkix.Extension
+}
+
+// Describe returns a summary of the certificate that CreateCertificate will
+// create, with the modifiers of the profile already applied. It does not sign
+// the certificate or run the pre-issuance hooks, so hooks that modify the
+// template are not reflected in the summary.
+func (b *base) Describe() ProfileSummary {
+	sub := b.Subject()
+	if sub == nil {
+		return ProfileSummary{}
+	}
+
+	keyUsage := sub.KeyUsage
+	if _, ok := b.SubjectPublicKey().(*rsa.PublicKey); !ok {
+		keyUsage &^= x509.KeyUsageKeyEncipherment | x509.KeyUsageDataEncipherment
+	}
+	maxPathLen := 0
+	if sub.IsCA {
+		maxPathLen = pathLen(sub)
+	}
+	sigAlg := sub.SignatureAlgorithm
+	if sigAlg == x509.UnknownSignatureAlgorithm {
+		sigAlg = defaultSignatureAlgorithm(b.issPriv)
+	}
+
+	var serial *big.Int
+	if sub.SerialNumber != nil {
+		serial = new(big.Int).Set(sub.SerialNumber)
+	}
+	var issuer pkix.Name
+	if iss := b.Issuer(); iss != nil {
+		issuer = iss.Subject
+	}
+	exts := append(append([]pkix.Extension(nil), sub.ExtraExtensions...), b.ext...)
+
+	return ProfileSummary{
+		Subject:            sub.Subject,
+		Issuer:             issuer,
+		SerialNumber:       serial,
+		NotBefore:          sub.NotBefore,
+		NotAfter:           sub.NotAfter,
+		SignatureAlgorithm: sigAlg,
+		IsCA:               sub.IsCA,
+		MaxPathLen:         maxPathLen,
+		KeyUsage:           keyUsage,
+		ExtKeyUsage:        append([]x509.ExtKeyUsage(nil), sub.ExtKeyUsage...),
+		UnknownExtKeyUsage: append([]asn1.ObjectIdentifier(nil), sub.UnknownExtKeyUsage...),
+		DNSNames:           append([]string(nil), sub.DNSNames...),
+		IPAddresses:        append([]net.IP(nil), sub.IPAddresses...),
+		EmailAddresses:     append([]string(nil), sub.EmailAddresses...),
+		URIs:               append([]*url.URL(nil), sub.URIs...),
+		Extensions:         removeStdExtensions(exts),
+	}
+}
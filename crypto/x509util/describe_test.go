@@ -0,0 +1,84 @@
+package x509util
+
+import (
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"net"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestBase_Describe(t *testing.T) {
+	iss := mustParseCertificate(t, "test_files/noPasscodeCa.crt")
+	issPriv := mustParseRSAKey(t, "test_files/noPasscodeCa.key")
+	now := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+	ext := pkix.Extension{Id: asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 37476, 9000, 64, 2}, Value: []byte{0x05, 0x00}}
+
+	p := mustNewProfile(t)(NewLeafProfile("test.smallstep.com", iss, issPriv,
+		WithClock(func() time.Time { return now }),
+		WithValidity(time.Hour),
+		WithDNSNames([]string{"test.smallstep.com", "www.smallstep.com"}),
+		WithIPAddresses([]net.IP{net.ParseIP("127.0.0.1")}),
+		WithExtraExtension(ext)))
+	got := p.Describe()
+
+	if got.Subject.CommonName != "test.smallstep.com" {
+		t.Errorf("Subject = %v, want test.smallstep.com", got.Subject)
+	}
+	if got.Issuer.CommonName != iss.Subject.CommonName {
+		t.Errorf("Issuer = %v, want %v", got.Issuer, iss.Subject)
+	}
+	if got.SerialNumber == nil || got.SerialNumber.Cmp(p.Subject().SerialNumber) != 0 {
+		t.Errorf("SerialNumber = %v, want %v", got.SerialNumber, p.Subject().SerialNumber)
+	}
+	if !got.NotBefore.Equal(now) || !got.NotAfter.Equal(now.Add(time.Hour)) {
+		t.Errorf("validity = [%s, %s], want [%s, %s]", got.NotBefore, got.NotAfter, now, now.Add(time.Hour))
+	}
+	if !reflect.DeepEqual(got.DNSNames, []string{"test.smallstep.com", "www.smallstep.com"}) {
+		t.Errorf("DNSNames = %v, want [test.smallstep.com www.smallstep.com]", got.DNSNames)
+	}
+	if len(got.IPAddresses) != 1 || !got.IPAddresses[0].Equal(net.ParseIP("127.0.0.1")) {
+		t.Errorf("IPAddresses = %v, want [127.0.0.1]", got.IPAddresses)
+	}
+	if !reflect.DeepEqual(got.Extensions, []pkix.Extension{ext}) {
+		t.Errorf("Extensions = %v, want %v", got.Extensions, []pkix.Extension{ext})
+	}
+	if got.IsCA || got.MaxPathLen != 0 {
+		t.Errorf("IsCA, MaxPathLen = %v, %d, want false, 0", got.IsCA, got.MaxPathLen)
+	}
+
+	// The summary matches the certificate.
+	cert := mustCreateCertificate(t, p)
+	if got.KeyUsage != cert.KeyUsage {
+		t.Errorf("KeyUsage = %v, want %v", got.KeyUsage, cert.KeyUsage)
+	}
+	if !reflect.DeepEqual(got.ExtKeyUsage, cert.ExtKeyUsage) {
+		t.Errorf("ExtKeyUsage = %v, want %v", got.ExtKeyUsage, cert.ExtKeyUsage)
+	}
+	if got.SerialNumber.Cmp(cert.SerialNumber) != 0 {
+		t.Errorf("SerialNumber = %v, want %v", got.SerialNumber, cert.SerialNumber)
+	}
+
+	// Modifying the summary does not modify the profile.
+	got.DNSNames[0] = "modified.smallstep.com"
+	got.SerialNumber.SetInt64(1)
+	if p.Subject().DNSNames[0] != "test.smallstep.com" || p.Subject().SerialNumber.Cmp(cert.SerialNumber) != 0 {
+		t.Error("Describe() returned values shared with the profile")
+	}
+
+	t.Run("ok/ca", func(t *testing.T) {
+		root := mustNewProfile(t)(NewRootProfile("root", WithMaxPathLen(1)))
+		got := root.Describe()
+		if !got.IsCA || got.MaxPathLen != 1 {
+			t.Errorf("IsCA, MaxPathLen = %v, %d, want true, 1", got.IsCA, got.MaxPathLen)
+		}
+		if got.KeyUsage&x509.KeyUsageCertSign == 0 {
+			t.Errorf("KeyUsage = %v, want CertSign", got.KeyUsage)
+		}
+		if got.ExtKeyUsage != nil {
+			t.Errorf("ExtKeyUsage = %v, want nil", got.ExtKeyUsage)
+		}
+	})
+}
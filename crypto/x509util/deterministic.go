@@ -0,0 +1,176 @@
+package x509util
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"io"
+	"math/big"
+
+	"github.com/pkg/errors"
+)
+
+// WithDeterministicRandom returns a Profile modifier that uses the given
+// reader instead of crypto/rand to generate the subject key pair and the
+// serial number. Profiles created with readers that return the same bytes
+// have the same keys and serial numbers, this can be used to create
+// reproducible test fixtures.
+//
+// THIS OPTION IS FOR TESTING ONLY. Keys and serial numbers generated with a
+// predictable reader are predictable too, never use it to create real
+// certificates. The certificate signature is always created using
+// crypto/rand.
+//
+// The key pair is derived from the reader bytes by this package, so the keys
+// do not depend on the key generation algorithms of the Go version.
+func WithDeterministicRandom(r io.Reader) WithOption {
+	return func(p Profile) error {
+		if r == nil {
+			return errors.New("random reader cannot be nil")
+		}
+		b, err := getBase(p)
+		if err != nil {
+			return err
+		}
+		b.random = r
+		return nil
+	}
+}
+
+// randomReader returns the reader used to generate keys and serial numbers.
+func (b *base) randomReader() io.Reader {
+	if b.random != nil {
+		return b.random
+	}
+	return rand.Reader
+}
+
+// generateDeterministicKeyPair generates a key pair using only the bytes read
+// from the given reader.
+func generateDeterministicKeyPair(r io.Reader, kty, crv string, size int) (interface{}, interface{}, error) {
+	switch kty {
+	case "EC":
+		var c elliptic.Curve
+		switch crv {
+		case "P-256":
+			c = elliptic.P256()
+		case "P-384":
+			c = elliptic.P384()
+		case "P-521":
+			c = elliptic.P521()
+		default:
+			return nil, nil, errors.Errorf("invalid value for argument crv (crv: '%s')", crv)
+		}
+		key, err := deterministicECKey(r, c)
+		if err != nil {
+			return nil, nil, err
+		}
+		return key.Public(), key, nil
+	case "RSA":
+		key, err := deterministicRSAKey(r, size)
+		if err != nil {
+			return nil, nil, err
+		}
+		return key.Public(), key, nil
+	case "OKP":
+		if crv != "Ed25519" {
+			return nil, nil, errors.Errorf("missing or invalid value for argument 'crv'. "+
+				"expected 'Ed25519', but got '%s'", crv)
+		}
+		seed := make([]byte, ed25519.SeedSize)
+		if _, err := io.ReadFull(r, seed); err != nil {
+			return nil, nil, errors.Wrap(err, "error reading random bytes")
+		}
+		key := ed25519.NewKeyFromSeed(seed)
+		return key.Public(), key, nil
+	default:
+		return nil, nil, errors.Errorf("unsupported key type %s", kty)
+	}
+}
+
+// deterministicECKey derives an ECDSA key using the method described in FIPS
+// 186-4, appendix B.4.1.
+func deterministicECKey(r io.Reader, c elliptic.Curve) (*ecdsa.PrivateKey, error) {
+	params := c.Params()
+	b := make([]byte, params.BitSize/8+8)
+	if _, err := io.ReadFull(r, b); err != nil {
+		return nil, errors.Wrap(err, "error reading random bytes")
+	}
+	n := new(big.Int).Sub(params.N, big.NewInt(1))
+	k := new(big.Int).SetBytes(b)
+	k.Mod(k, n)
+	k.Add(k, big.NewInt(1))
+
+	key := &ecdsa.PrivateKey{D: k}
+	key.PublicKey.Curve = c
+	key.PublicKey.X, key.PublicKey.Y = c.ScalarBaseMult(k.Bytes())
+	return key, nil
+}
+
+// deterministicRSAKey generates an RSA key with the given size and public
+// exponent 65537.
+func deterministicRSAKey(r io.Reader, bits int) (*rsa.PrivateKey, error) {
+	if bits < 1024 {
+		return nil, errors.Errorf("the size of the RSA key should be at least 1024 bits, got %d", bits)
+	}
+	e := big.NewInt(65537)
+	one := big.NewInt(1)
+	for {
+		p, err := deterministicPrime(r, bits-bits/2, e)
+		if err != nil {
+			return nil, err
+		}
+		q, err := deterministicPrime(r, bits/2, e)
+		if err != nil {
+			return nil, err
+		}
+		n := new(big.Int).Mul(p, q)
+		if p.Cmp(q) == 0 || n.BitLen() != bits {
+			continue
+		}
+		pm1 := new(big.Int).Sub(p, one)
+		qm1 := new(big.Int).Sub(q, one)
+		phi := new(big.Int).Mul(pm1, qm1)
+		d := new(big.Int).ModInverse(e, phi)
+		if d == nil {
+			continue
+		}
+		key := &rsa.PrivateKey{
+			PublicKey: rsa.PublicKey{N: n, E: int(e.Int64())},
+			D:         d,
+			Primes:    []*big.Int{p, q},
+		}
+		key.Precompute()
+		if err := key.Validate(); err != nil {
+			return nil, errors.Wrap(err, "error generating RSA key")
+		}
+		return key, nil
+	}
+}
+
+// deterministicPrime returns a prime of the given size with the two most
+// significant bits set, and such that p-1 is coprime with e.
+func deterministicPrime(r io.Reader, bits int, e *big.Int) (*big.Int, error) {
+	b := make([]byte, (bits+7)/8)
+	if _, err := io.ReadFull(r, b); err != nil {
+		return nil, errors.Wrap(err, "error reading random bytes")
+	}
+	b[0] &= byte(0xff >> uint(len(b)*8-bits))
+	p := new(big.Int).SetBytes(b)
+	p.SetBit(p, bits-1, 1)
+	p.SetBit(p, bits-2, 1)
+	p.SetBit(p, 0, 1)
+
+	two := big.NewInt(2)
+	pm1, gcd := new(big.Int), new(big.Int)
+	for p.BitLen() == bits {
+		pm1.Sub(p, big.NewInt(1))
+		if gcd.GCD(nil, nil, pm1, e).Cmp(big.NewInt(1)) == 0 && p.ProbablyPrime(20) {
+			return p, nil
+		}
+		p.Add(p, two)
+	}
+	return nil, errors.New("error generating RSA key: prime not found")
+}
@@ -0,0 +1,63 @@
+package x509util
+
+import (
+	mathrand "math/rand"
+	"reflect"
+	"testing"
+)
+
+func TestWithDeterministicRandom(t *testing.T) {
+	iss := mustParseCertificate(t, "test_files/noPasscodeCa.crt")
+	issPriv := mustParseRSAKey(t, "test_files/noPasscodeCa.key")
+
+	newProfile := func(t *testing.T, seed int64, opts ...WithOption) Profile {
+		opts = append([]WithOption{WithDeterministicRandom(mathrand.New(mathrand.NewSource(seed)))}, opts...)
+		return mustNewProfile(t)(NewLeafProfile("test.smallstep.com", iss, issPriv, opts...))
+	}
+
+	tests := []struct {
+		name string
+		opts []WithOption
+	}{
+		{"ok/default", nil},
+		{"ok/p384", []WithOption{GenerateKeyPair("EC", "P-384", 0)}},
+		{"ok/p521", []WithOption{GenerateKeyPair("EC", "P-521", 0)}},
+		{"ok/rsa", []WithOption{GenerateKeyPair("RSA", "", 2048)}},
+		{"ok/ed25519", []WithOption{GenerateKeyPair("OKP", "Ed25519", 0)}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p1 := newProfile(t, 1, tt.opts...)
+			p2 := newProfile(t, 1, tt.opts...)
+			if !reflect.DeepEqual(p1.SubjectPrivateKey(), p2.SubjectPrivateKey()) {
+				t.Error("profiles with the same seed have different private keys")
+			}
+			if !reflect.DeepEqual(p1.SubjectPublicKey(), p2.SubjectPublicKey()) {
+				t.Error("profiles with the same seed have different public keys")
+			}
+			if p1.Subject().SerialNumber.Cmp(p2.Subject().SerialNumber) != 0 {
+				t.Errorf("serial numbers %s and %s are not equal", p1.Subject().SerialNumber, p2.Subject().SerialNumber)
+			}
+
+			// The key pair must be valid and usable.
+			crt := mustCreateCertificate(t, p1)
+			if err := crt.CheckSignatureFrom(iss); err != nil {
+				t.Errorf("CheckSignatureFrom() error = %v", err)
+			}
+
+			p3 := newProfile(t, 2, tt.opts...)
+			if reflect.DeepEqual(p1.SubjectPrivateKey(), p3.SubjectPrivateKey()) {
+				t.Error("profiles with different seeds have the same private key")
+			}
+			if p1.Subject().SerialNumber.Cmp(p3.Subject().SerialNumber) == 0 {
+				t.Error("profiles with different seeds have the same serial number")
+			}
+		})
+	}
+
+	t.Run("fail/nil", func(t *testing.T) {
+		if _, err := NewLeafProfile("test.smallstep.com", iss, issPriv, WithDeterministicRandom(nil)); err == nil {
+			t.Error("NewLeafProfile() error = nil, want error")
+		}
+	})
+}
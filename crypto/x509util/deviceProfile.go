@@ -0,0 +1,36 @@
+package x509util
+
+import (
+	"crypto"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"time"
+)
+
+// DefaultDeviceCertValidity is the default validity of a device certificate.
+var DefaultDeviceCertValidity = 7 * 24 * time.Hour
+
+// NewDeviceProfile returns a new leaf x509 Certificate profile for devices
+// authenticating with mutual TLS. The certificate only has the
+// DigitalSignature key usage and the client authentication extended key
+// usage, and a default duration of DefaultDeviceCertValidity that can be
+// changed using WithValidity or WithDefaultDuration.
+//
+// A new public/private key pair will be generated for the Profile if
+// not set in the `withOps` profile modifiers.
+func NewDeviceProfile(cn string, iss *x509.Certificate, issPriv crypto.PrivateKey, withOps ...WithOption) (Profile, error) {
+	sub := defaultDeviceTemplate(pkix.Name{CommonName: cn}, iss.Subject)
+	withOps = append([]WithOption{WithDefaultDuration(DefaultDeviceCertValidity)}, withOps...)
+	return newProfile(&Leaf{}, sub, iss, issPriv, withOps...)
+}
+
+func defaultDeviceTemplate(sub, iss pkix.Name) *x509.Certificate {
+	return &x509.Certificate{
+		IsCA:                  false,
+		KeyUsage:              x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+		BasicConstraintsValid: false,
+		Issuer:                iss,
+		Subject:               sub,
+	}
+}
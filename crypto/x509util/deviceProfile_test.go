@@ -0,0 +1,59 @@
+package x509util
+
+import (
+	"crypto/x509"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestNewDeviceProfile(t *testing.T) {
+	iss := mustParseCertificate(t, "test_files/noPasscodeCa.crt")
+	issPriv := mustParseRSAKey(t, "test_files/noPasscodeCa.key")
+	now := time.Now().Truncate(time.Second)
+
+	tests := []struct {
+		name     string
+		options  []WithOption
+		validity time.Duration
+		wantErr  bool
+	}{
+		{"ok", []WithOption{WithClock(func() time.Time { return now })}, DefaultDeviceCertValidity, false},
+		{"ok/rsa", []WithOption{WithClock(func() time.Time { return now }), GenerateKeyPair("RSA", "", 2048)}, DefaultDeviceCertValidity, false},
+		{"ok/validity", []WithOption{WithClock(func() time.Time { return now }), WithValidity(time.Hour)}, time.Hour, false},
+		{"fail/validity", []WithOption{WithValidity(0)}, 0, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, err := NewDeviceProfile("device-1234", iss, issPriv, tt.options...)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("NewDeviceProfile() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if _, ok := p.(*Leaf); !ok {
+				t.Errorf("NewDeviceProfile() = %T, want *Leaf", p)
+			}
+			cert := mustCreateCertificate(t, p)
+			if cert.KeyUsage != x509.KeyUsageDigitalSignature {
+				t.Errorf("KeyUsage = %v, want %v", cert.KeyUsage, x509.KeyUsageDigitalSignature)
+			}
+			if !reflect.DeepEqual(cert.ExtKeyUsage, []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth}) {
+				t.Errorf("ExtKeyUsage = %v, want [ClientAuth]", cert.ExtKeyUsage)
+			}
+			if len(cert.PolicyIdentifiers) != 0 {
+				t.Errorf("PolicyIdentifiers = %v, want none", cert.PolicyIdentifiers)
+			}
+			if cert.IsCA {
+				t.Error("IsCA = true, want false")
+			}
+			if !cert.NotBefore.Equal(now) {
+				t.Errorf("NotBefore = %v, want %v", cert.NotBefore, now)
+			}
+			if !cert.NotAfter.Equal(now.Add(tt.validity)) {
+				t.Errorf("NotAfter = %v, want %v", cert.NotAfter, now.Add(tt.validity))
+			}
+		})
+	}
+}
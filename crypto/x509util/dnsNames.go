@@ -0,0 +1,165 @@
+package x509util
+
+import (
+	"crypto/x509"
+	"fmt"
+	"strings"
+
+	"github.com/pkg/errors"
+	"golang.org/x/net/idna"
+)
+
+const (
+	// maxDNSNameLength is the maximum length of a DNS name without the
+	// trailing dot, as defined in RFC 1035.
+	maxDNSNameLength = 253
+	// maxDNSLabelLength is the maximum length of a DNS label.
+	maxDNSLabelLength = 63
+)
+
+// DNSNamePolicy is the policy used to validate the DNS names in the subject
+// alternative names.
+type DNSNamePolicy int
+
+const (
+	// DNSNamePolicyNormalize converts Unicode labels to their ASCII form
+	// (xn--) using IDNA and removes the trailing dot, and rejects the names
+	// that cannot be fixed. This is the default.
+	DNSNamePolicyNormalize DNSNamePolicy = iota + 1
+	// DNSNamePolicyStrict rejects the names with Unicode labels or with a
+	// trailing dot.
+	DNSNamePolicyStrict
+)
+
+// WithDNSNamePolicy returns a Profile modifier that sets the policy used to
+// validate the DNS names of the certificate. With both policies, names must
+// be composed of labels of letters, digits and hyphens of at most 63
+// characters, with a total length of at most 253 characters. A wildcard is
+// only allowed as the complete first label, and names with schemes, ports or
+// paths, like https://example.com, are rejected.
+//
+// The DNS names are validated after all the modifiers have been applied,
+// including the names copied from a CSR.
+func WithDNSNamePolicy(policy DNSNamePolicy) WithOption {
+	return func(p Profile) error {
+		if policy != DNSNamePolicyNormalize && policy != DNSNamePolicyStrict {
+			return errors.Errorf("unsupported DNS name policy %d", policy)
+		}
+		b, err := getBase(p)
+		if err != nil {
+			return err
+		}
+		b.dnsNamePolicy = policy
+		return nil
+	}
+}
+
+// validateDNSNames validates the DNS names of the given template using the
+// DNS name policy of the profile, and replaces them with the normalized ones.
+func (b *base) validateDNSNames(crt *x509.Certificate) error {
+	if len(crt.DNSNames) == 0 {
+		return nil
+	}
+	var invalid []string
+	names := make([]string, len(crt.DNSNames))
+	for i, name := range crt.DNSNames {
+		s, err := normalizeDNSName(name, b.dnsNamePolicy == DNSNamePolicyStrict)
+		if err != nil {
+			invalid = append(invalid, fmt.Sprintf("%q (%v)", name, err))
+			continue
+		}
+		if s != name {
+			b.renameSANOrder(nameTypeDNS, name, s)
+		}
+		names[i] = s
+	}
+	if len(invalid) > 0 {
+		return errors.Errorf("invalid DNS names: %s", strings.Join(invalid, ", "))
+	}
+	crt.DNSNames = names
+	return nil
+}
+
+// normalizeDNSName validates the given DNS name and returns it in ASCII form
+// without the trailing dot. In strict mode names that need to be converted are
+// rejected.
+func normalizeDNSName(name string, strict bool) (string, error) {
+	if name == "" {
+		return "", errors.New("name cannot be empty")
+	}
+	if strings.ContainsAny(name, "/:?#@ \t") {
+		return "", errors.New("name cannot have a scheme, port or path")
+	}
+	if strings.HasSuffix(name, ".") {
+		if strict {
+			return "", errors.New("name cannot have a trailing dot")
+		}
+		name = name[:len(name)-1]
+	}
+
+	labels := strings.Split(name, ".")
+	for i, label := range labels {
+		switch {
+		case label == "*":
+			if i != 0 {
+				return "", errors.New("a wildcard is only allowed as the first label")
+			}
+			if len(labels) == 1 {
+				return "", errors.New("a wildcard must be followed by a domain")
+			}
+			continue
+		case label == "":
+			return "", errors.New("name cannot have empty labels")
+		case !isASCII(label):
+			if strict {
+				return "", errors.Errorf("label %q is not ASCII, use the xn-- form", label)
+			}
+			s, err := idna.Lookup.ToASCII(label)
+			if err != nil {
+				return "", errors.Wrapf(err, "invalid label %q", label)
+			}
+			label = s
+		case strings.HasPrefix(strings.ToLower(label), "xn--"):
+			if _, err := idna.Punycode.ToUnicode(label); err != nil {
+				return "", errors.Wrapf(err, "invalid label %q", label)
+			}
+		}
+		if err := validateDNSLabel(label); err != nil {
+			return "", err
+		}
+		labels[i] = label
+	}
+
+	name = strings.Join(labels, ".")
+	if len(name) > maxDNSNameLength {
+		return "", errors.Errorf("name cannot be longer than %d characters", maxDNSNameLength)
+	}
+	return name, nil
+}
+
+// validateDNSLabel checks that the given ASCII label only contains letters,
+// digits and hyphens, and does not start or end with a hyphen.
+func validateDNSLabel(label string) error {
+	if len(label) > maxDNSLabelLength {
+		return errors.Errorf("label %q is longer than %d characters", label, maxDNSLabelLength)
+	}
+	if label[0] == '-' || label[len(label)-1] == '-' {
+		return errors.Errorf("label %q cannot start or end with a hyphen", label)
+	}
+	for _, c := range label {
+		if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '-') {
+			return errors.Errorf("label %q contains the invalid character %q", label, c)
+		}
+	}
+	return nil
+}
+
+// isASCII returns true if the given string only contains ASCII characters.
+func isASCII(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if s[i] >= 0x80 {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,114 @@
+package x509util
+
+import (
+	"crypto/x509"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestNormalizeDNSName(t *testing.T) {
+	long := strings.Repeat(strings.Repeat("a", 63)+".", 4) + "com" // 259 characters
+	tests := []struct {
+		name       string
+		normalized string
+		strict     string
+		wantErr    bool
+	}{
+		{"smallstep.com", "smallstep.com", "smallstep.com", false},
+		{"Test-1.Smallstep.com", "Test-1.Smallstep.com", "Test-1.Smallstep.com", false},
+		{"*.smallstep.com", "*.smallstep.com", "*.smallstep.com", false},
+		{"localhost", "localhost", "localhost", false},
+		{"smallstep.com.", "smallstep.com", "", false},
+		{"bücher.example", "xn--bcher-kva.example", "", false},
+		{"*.bücher.example", "*.xn--bcher-kva.example", "", false},
+		{"xn--bcher-kva.example", "xn--bcher-kva.example", "xn--bcher-kva.example", false},
+		{strings.Repeat("a", 63) + ".com", strings.Repeat("a", 63) + ".com", strings.Repeat("a", 63) + ".com", false},
+		{"", "", "", true},
+		{"https://smallstep.com", "", "", true},
+		{"smallstep.com/path", "", "", true},
+		{"smallstep.com:443", "", "", true},
+		{"jane@smallstep.com", "", "", true},
+		{"*.*.smallstep.com", "", "", true},
+		{"www.*.smallstep.com", "", "", true},
+		{"*smallstep.com", "", "", true},
+		{"*", "", "", true},
+		{"_acme-challenge.smallstep.com", "", "", true},
+		{"smallstep..com", "", "", true},
+		{".smallstep.com", "", "", true},
+		{"smallstep.com..", "", "", true},
+		{"-smallstep.com", "", "", true},
+		{"smallstep-.com", "", "", true},
+		{"xn--zz.example", "", "", true},
+		{strings.Repeat("a", 64) + ".com", "", "", true},
+		{long, "", "", true},
+		{long + ".", "", "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := normalizeDNSName(tt.name, false)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("normalizeDNSName() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.normalized {
+				t.Errorf("normalizeDNSName() = %q, want %q", got, tt.normalized)
+			}
+			got, err = normalizeDNSName(tt.name, true)
+			if (err != nil) != (tt.strict == "") {
+				t.Fatalf("normalizeDNSName() strict error = %v, want %q", err, tt.strict)
+			}
+			if got != tt.strict {
+				t.Errorf("normalizeDNSName() strict = %q, want %q", got, tt.strict)
+			}
+		})
+	}
+}
+
+func TestWithDNSNamePolicy(t *testing.T) {
+	iss := mustParseCertificate(t, "test_files/noPasscodeCa.crt")
+	issPriv := mustParseRSAKey(t, "test_files/noPasscodeCa.key")
+
+	tests := []struct {
+		name    string
+		options []WithOption
+		want    []string
+		wantErr bool
+	}{
+		{"ok/default", []WithOption{WithSANs([]string{"bücher.example", "smallstep.com.", "10.0.0.1"})}, []string{"xn--bcher-kva.example", "smallstep.com"}, false},
+		{"ok/normalize", []WithOption{WithDNSNamePolicy(DNSNamePolicyNormalize), WithHosts("*.bücher.example")}, []string{"*.xn--bcher-kva.example"}, false},
+		{"ok/strict", []WithOption{WithDNSNamePolicy(DNSNamePolicyStrict), WithHosts("*.smallstep.com,xn--bcher-kva.example")}, []string{"*.smallstep.com", "xn--bcher-kva.example"}, false},
+		{"ok/template-func", []WithOption{WithTemplateFunc(func(crt *x509.Certificate) error {
+			crt.DNSNames = append(crt.DNSNames, "bücher.example.")
+			return nil
+		})}, []string{"xn--bcher-kva.example"}, false},
+		{"fail/strict-unicode", []WithOption{WithDNSNamePolicy(DNSNamePolicyStrict), WithHosts("bücher.example")}, nil, true},
+		{"fail/strict-trailing-dot", []WithOption{WithDNSNamePolicy(DNSNamePolicyStrict), WithHosts("smallstep.com.")}, nil, true},
+		{"fail/double-wildcard", []WithOption{WithHosts("*.*.smallstep.com")}, nil, true},
+		{"fail/url", []WithOption{WithDNSNames([]string{"https://smallstep.com"})}, nil, true},
+		{"fail/long", []WithOption{WithHosts(strings.Repeat("a.", 127) + "com")}, nil, true},
+		{"fail/policy", []WithOption{WithDNSNamePolicy(0)}, nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, err := NewLeafProfile("test.smallstep.com", iss, issPriv, tt.options...)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("NewLeafProfile() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			crt := mustCreateCertificate(t, p)
+			if !reflect.DeepEqual(crt.DNSNames, tt.want) {
+				t.Errorf("DNSNames = %v, want %v", crt.DNSNames, tt.want)
+			}
+		})
+	}
+
+	// The normalized names keep their position.
+	p := mustNewProfile(t)(NewLeafProfile("test.smallstep.com", iss, issPriv, WithPreserveSANOrder(),
+		WithSANs([]string{"10.0.0.1"}), WithHosts("bücher.example"), WithEmailAddresses("jane@smallstep.com")))
+	want := []string{"7:10.0.0.1", "2:xn--bcher-kva.example", "1:jane@smallstep.com"}
+	if got := sanNames(t, mustCreateCertificate(t, p)); !reflect.DeepEqual(got, want) {
+		t.Errorf("SANs = %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,177 @@
+package x509util
+
+import (
+	"crypto/x509"
+	"encoding/asn1"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/smallstep/cli/crypto/keys"
+)
+
+// Suffixes of the environment variables read by OptionsFromEnv.
+const (
+	envValidity = "VALIDITY"
+	envBackdate = "BACKDATE"
+	envKeyType  = "KEY_TYPE"
+	envKeyCurve = "KEY_CURVE"
+	envKeySize  = "KEY_SIZE"
+	envKeyUsage = "KEY_USAGE"
+	envEKU      = "EKU"
+)
+
+// OptionsFromEnv returns the profile modifiers configured in the environment
+// variables with the given prefix. The following variables are supported,
+// e.g. with the prefix STEP:
+//
+//	STEP_VALIDITY   the validity of the certificate, e.g. 720h, see WithValidity
+//	STEP_BACKDATE   the backdate of the default NotBefore, see WithBackdate
+//	STEP_KEY_TYPE   the type of the generated key: EC, RSA or OKP
+//	STEP_KEY_CURVE  the curve of EC and OKP keys, e.g. P-256 or Ed25519
+//	STEP_KEY_SIZE   the size in bits of RSA keys
+//	STEP_KEY_USAGE  a comma separated list of key usages, see WithKeyUsage
+//	STEP_EKU        a comma separated list of extended key usages, names or
+//	                object identifiers, see WithExtKeyUsage
+//
+// The key usages and extended key usages use the same names as the JSON
+// templates. Unset or empty variables are ignored. The returned error names
+// the variable with an invalid value.
+func OptionsFromEnv(prefix string) ([]WithOption, error) {
+	if prefix == "" {
+		return nil, errors.New("environment variable prefix cannot be empty")
+	}
+	getenv := func(name string) (string, string) {
+		name = prefix + "_" + name
+		return name, strings.TrimSpace(os.Getenv(name))
+	}
+
+	var opts []WithOption
+	if name, v := getenv(envValidity); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil || d <= 0 {
+			return nil, errors.Errorf("invalid %s %q: validity must be a positive duration", name, v)
+		}
+		opts = append(opts, WithValidity(d))
+	}
+	if name, v := getenv(envBackdate); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil || d < 0 {
+			return nil, errors.Errorf("invalid %s %q: backdate must be a non-negative duration", name, v)
+		}
+		opts = append(opts, WithBackdate(d))
+	}
+
+	keyOpt, err := keyOptionFromEnv(getenv)
+	if err != nil {
+		return nil, err
+	}
+	if keyOpt != nil {
+		opts = append(opts, keyOpt)
+	}
+
+	if name, v := getenv(envKeyUsage); v != "" {
+		var ku x509.KeyUsage
+		for _, s := range splitEnvList(v) {
+			u, err := parseKeyUsage(s)
+			if err != nil {
+				return nil, errors.Wrapf(err, "invalid %s", name)
+			}
+			ku |= u
+		}
+		opts = append(opts, WithKeyUsage(ku))
+	}
+	if name, v := getenv(envEKU); v != "" {
+		var ekus []x509.ExtKeyUsage
+		var oids []asn1.ObjectIdentifier
+		for _, s := range splitEnvList(v) {
+			eku, oid, err := parseExtKeyUsage(s)
+			if err != nil {
+				return nil, errors.Wrapf(err, "invalid %s", name)
+			}
+			if oid != nil {
+				oids = append(oids, oid)
+			} else {
+				ekus = append(ekus, eku)
+			}
+		}
+		opts = append(opts, WithExtKeyUsage(ekus...), func(p Profile) error {
+			p.Subject().UnknownExtKeyUsage = oids
+			return nil
+		})
+	}
+	return opts, nil
+}
+
+// keyOptionFromEnv returns the GenerateKeyPair modifier configured in the
+// environment, or nil if the key variables are not set. The values that are
+// not set use the defaults of the keys package.
+func keyOptionFromEnv(getenv func(string) (string, string)) (WithOption, error) {
+	typeName, kty := getenv(envKeyType)
+	curveName, crv := getenv(envKeyCurve)
+	sizeName, sizeValue := getenv(envKeySize)
+	if kty == "" && crv == "" && sizeValue == "" {
+		return nil, nil
+	}
+
+	size := 0
+	if sizeValue != "" {
+		n, err := strconv.Atoi(sizeValue)
+		if err != nil || n <= 0 {
+			return nil, errors.Errorf("invalid %s %q: key size must be a positive number", sizeName, sizeValue)
+		}
+		size = n
+	}
+	if kty == "" {
+		kty = keys.DefaultKeyType
+	}
+	kty = strings.ToUpper(kty)
+
+	switch kty {
+	case "EC":
+		switch crv {
+		case "":
+			crv = keys.DefaultKeyCurve
+		case "P-256", "P-384", "P-521":
+		default:
+			return nil, errors.Errorf("invalid %s %q: EC keys support the curves P-256, P-384 and P-521", curveName, crv)
+		}
+		if size != 0 {
+			return nil, errors.Errorf("invalid %s %q: the key size can only be used with RSA keys", sizeName, sizeValue)
+		}
+	case "RSA":
+		if crv != "" {
+			return nil, errors.Errorf("invalid %s %q: the curve cannot be used with RSA keys", curveName, crv)
+		}
+		if size == 0 {
+			size = keys.DefaultKeySize
+		}
+	case "OKP":
+		switch crv {
+		case "":
+			crv = "Ed25519"
+		case "Ed25519":
+		default:
+			return nil, errors.Errorf("invalid %s %q: OKP keys support the curve Ed25519", curveName, crv)
+		}
+		if size != 0 {
+			return nil, errors.Errorf("invalid %s %q: the key size can only be used with RSA keys", sizeName, sizeValue)
+		}
+	default:
+		return nil, errors.Errorf("invalid %s %q: key type must be EC, RSA or OKP", typeName, kty)
+	}
+	return GenerateKeyPair(kty, crv, size), nil
+}
+
+// splitEnvList splits a comma separated list and removes the empty elements.
+func splitEnvList(s string) []string {
+	var ret []string
+	for _, v := range strings.Split(s, ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			ret = append(ret, v)
+		}
+	}
+	return ret
+}
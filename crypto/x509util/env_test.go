@@ -0,0 +1,122 @@
+package x509util
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/asn1"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestOptionsFromEnv(t *testing.T) {
+	iss := mustParseCertificate(t, "test_files/noPasscodeCa.crt")
+	issPriv := mustParseRSAKey(t, "test_files/noPasscodeCa.key")
+	now := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name  string
+		env   map[string]string
+		check func(t *testing.T, crt *x509.Certificate)
+	}{
+		{"empty", nil, func(t *testing.T, crt *x509.Certificate) {
+			if !crt.NotAfter.Equal(now.Add(DefaultLeafCertValidity)) {
+				t.Errorf("NotAfter = %s, want %s", crt.NotAfter, now.Add(DefaultLeafCertValidity))
+			}
+		}},
+		{"validity", map[string]string{"VALIDITY": "72h", "BACKDATE": "1m"}, func(t *testing.T, crt *x509.Certificate) {
+			if !crt.NotBefore.Equal(now.Add(-time.Minute)) || !crt.NotAfter.Equal(now.Add(72*time.Hour)) {
+				t.Errorf("validity = %s - %s", crt.NotBefore, crt.NotAfter)
+			}
+		}},
+		{"key rsa", map[string]string{"KEY_TYPE": "RSA", "KEY_SIZE": "3072"}, func(t *testing.T, crt *x509.Certificate) {
+			if k, ok := crt.PublicKey.(*rsa.PublicKey); !ok || k.N.BitLen() != 3072 {
+				t.Errorf("PublicKey = %T, want RSA 3072", crt.PublicKey)
+			}
+		}},
+		{"key rsa default size", map[string]string{"KEY_TYPE": "rsa"}, func(t *testing.T, crt *x509.Certificate) {
+			if k, ok := crt.PublicKey.(*rsa.PublicKey); !ok || k.N.BitLen() != 2048 {
+				t.Errorf("PublicKey = %T, want RSA 2048", crt.PublicKey)
+			}
+		}},
+		{"key ec", map[string]string{"KEY_TYPE": "EC", "KEY_CURVE": "P-384"}, func(t *testing.T, crt *x509.Certificate) {
+			if k, ok := crt.PublicKey.(*ecdsa.PublicKey); !ok || k.Curve != elliptic.P384() {
+				t.Errorf("PublicKey = %T, want EC P-384", crt.PublicKey)
+			}
+		}},
+		{"key curve only", map[string]string{"KEY_CURVE": "P-521"}, func(t *testing.T, crt *x509.Certificate) {
+			if k, ok := crt.PublicKey.(*ecdsa.PublicKey); !ok || k.Curve != elliptic.P521() {
+				t.Errorf("PublicKey = %T, want EC P-521", crt.PublicKey)
+			}
+		}},
+		{"key okp", map[string]string{"KEY_TYPE": "OKP"}, func(t *testing.T, crt *x509.Certificate) {
+			if _, ok := crt.PublicKey.(ed25519.PublicKey); !ok {
+				t.Errorf("PublicKey = %T, want Ed25519", crt.PublicKey)
+			}
+		}},
+		{"key usage", map[string]string{"KEY_USAGE": "digitalSignature, keyEncipherment", "KEY_TYPE": "RSA"}, func(t *testing.T, crt *x509.Certificate) {
+			if crt.KeyUsage != x509.KeyUsageDigitalSignature|x509.KeyUsageKeyEncipherment {
+				t.Errorf("KeyUsage = %v", crt.KeyUsage)
+			}
+		}},
+		{"eku", map[string]string{"EKU": "clientAuth,1.3.6.1.4.1.311.20.2.2,"}, func(t *testing.T, crt *x509.Certificate) {
+			if !reflect.DeepEqual(crt.ExtKeyUsage, []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth}) ||
+				len(crt.UnknownExtKeyUsage) != 1 || !crt.UnknownExtKeyUsage[0].Equal(asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 311, 20, 2, 2}) {
+				t.Errorf("ExtKeyUsage = %v, UnknownExtKeyUsage = %v", crt.ExtKeyUsage, crt.UnknownExtKeyUsage)
+			}
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for k, v := range tt.env {
+				t.Setenv("TEST_X509_"+k, v)
+			}
+			opts, err := OptionsFromEnv("TEST_X509")
+			if err != nil {
+				t.Fatalf("OptionsFromEnv() error = %v", err)
+			}
+			opts = append([]WithOption{WithHosts("test.smallstep.com"), WithClock(func() time.Time { return now }), WithAllowIssuerValidityMismatch()}, opts...)
+			p := mustNewProfile(t)(NewLeafProfile("test.smallstep.com", iss, issPriv, opts...))
+			tt.check(t, mustCreateCertificate(t, p))
+		})
+	}
+}
+
+func TestOptionsFromEnv_fail(t *testing.T) {
+	tests := []struct {
+		name    string
+		env     map[string]string
+		wantVar string
+	}{
+		{"validity", map[string]string{"VALIDITY": "1 day"}, "TEST_X509_VALIDITY"},
+		{"validity negative", map[string]string{"VALIDITY": "-1h"}, "TEST_X509_VALIDITY"},
+		{"backdate", map[string]string{"BACKDATE": "-1m"}, "TEST_X509_BACKDATE"},
+		{"key type", map[string]string{"KEY_TYPE": "DSA"}, "TEST_X509_KEY_TYPE"},
+		{"key curve", map[string]string{"KEY_TYPE": "EC", "KEY_CURVE": "P-224"}, "TEST_X509_KEY_CURVE"},
+		{"key curve okp", map[string]string{"KEY_TYPE": "OKP", "KEY_CURVE": "X25519"}, "TEST_X509_KEY_CURVE"},
+		{"key curve rsa", map[string]string{"KEY_TYPE": "RSA", "KEY_CURVE": "P-256"}, "TEST_X509_KEY_CURVE"},
+		{"key size", map[string]string{"KEY_TYPE": "RSA", "KEY_SIZE": "big"}, "TEST_X509_KEY_SIZE"},
+		{"key size ec", map[string]string{"KEY_TYPE": "EC", "KEY_SIZE": "2048"}, "TEST_X509_KEY_SIZE"},
+		{"key usage", map[string]string{"KEY_USAGE": "digitalSignature,signEverything"}, "TEST_X509_KEY_USAGE"},
+		{"eku", map[string]string{"EKU": "serverAuth,webAuth"}, "TEST_X509_EKU"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for k, v := range tt.env {
+				t.Setenv("TEST_X509_"+k, v)
+			}
+			_, err := OptionsFromEnv("TEST_X509")
+			if err == nil || !strings.Contains(err.Error(), tt.wantVar) {
+				t.Errorf("OptionsFromEnv() error = %v, want error with %s", err, tt.wantVar)
+			}
+		})
+	}
+
+	if _, err := OptionsFromEnv(""); err == nil {
+		t.Error("OptionsFromEnv() error = nil, want error")
+	}
+}
@@ -0,0 +1,177 @@
+package x509util
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// Sentinel errors that identify the failure modes of the profiles. The errors
+// returned by the constructors and the signing methods wrap them, so they can
+// be identified using errors.Is, while keeping a descriptive message.
+//
+// The profile constructors, like NewLeafProfile, can return ErrIssuerNotCA,
+// ErrIssuerKeyMismatch and ErrValidityExceedsIssuer if the issuer cannot be
+// used, and ErrCAOnly or ErrLeafOnly if an option is not valid for the type of
+// profile. The constructors from a CSR can also return ErrMissingPublicKey and
+// ErrInvalidCSRSignature.
+//
+// CreateCertificate, CreatePrecertificate and TBSCertificate can return
+// ErrMissingPublicKey, ErrMissingIssuerKey, ErrWeakKey, ErrIssuerKeyReuse,
+// ErrInvalidSignatureAlgorithm, ErrNameConstraints, ErrPathLenConstraint and
+// ErrLint. The methods that export the certificate or the key can return
+// ErrNotCreated, ErrMissingPrivateKey and ErrKeyNotExportable.
+var (
+	// ErrMissingPublicKey is returned when a CSR or a profile does not have a
+	// subject public key.
+	ErrMissingPublicKey = errors.New("missing subject public key")
+	// ErrUnsupportedKey is returned when the type of the subject public key
+	// is not supported.
+	ErrUnsupportedKey = errors.New("unsupported subject public key")
+	// ErrMissingPrivateKey is returned when a subject private key is required
+	// but the profile does not have one.
+	ErrMissingPrivateKey = errors.New("missing subject private key")
+	// ErrKeyNotExportable is returned when an opaque subject private key, like
+	// a key in an HSM, is serialized.
+	ErrKeyNotExportable = errors.New("subject private key cannot be exported")
+	// ErrMissingIssuerKey is returned when a certificate is signed without an
+	// issuer private key.
+	ErrMissingIssuerKey = errors.New("missing issuer private key")
+	// ErrInvalidCSRSignature is returned when the signature of a CSR is not
+	// valid.
+	ErrInvalidCSRSignature = errors.New("invalid CSR signature")
+	// ErrIssuerNotCA is returned when the issuer certificate cannot sign
+	// certificates. The error is an *InvalidIssuerError.
+	ErrIssuerNotCA = errors.New("issuer certificate is not a CA")
+	// ErrIssuerKeyMismatch is returned when the issuer private key does not
+	// match the public key of the issuer certificate.
+	ErrIssuerKeyMismatch = errors.New("issuer private key does not match the issuer certificate")
+	// ErrIssuerKeyReuse is returned when the subject public key is the key of
+	// the issuer certificate. The error is an *IssuerKeyReuseError.
+	ErrIssuerKeyReuse = errors.New("subject public key is the issuer public key")
+	// ErrValidityExceedsIssuer is returned when the issuer certificate is
+	// expired or not yet valid, or when the validity of the certificate is
+	// not within the validity of the issuer.
+	ErrValidityExceedsIssuer = errors.New("certificate validity exceeds the issuer validity")
+	// ErrWeakKey is returned when the subject public key is rejected by the
+	// key policy.
+	ErrWeakKey = errors.New("subject public key is not allowed")
+	// ErrNameConstraints is returned when the subject alternative names do not
+	// satisfy the name constraints of the issuer. The error is a
+	// *NameConstraintError.
+	ErrNameConstraints = errors.New("name constraints violation")
+	// ErrPathLenConstraint is returned when a CA certificate does not satisfy
+	// the path length constraint of the issuer.
+	ErrPathLenConstraint = errors.New("path length constraint violation")
+	// ErrInvalidSignatureAlgorithm is returned when the signature algorithm
+	// cannot be used with the issuer key.
+	ErrInvalidSignatureAlgorithm = errors.New("invalid signature algorithm")
+	// ErrCAOnly is returned when an option that is only valid in CA profiles
+	// is used in a leaf profile.
+	ErrCAOnly = errors.New("option can only be used in CA profiles")
+	// ErrLeafOnly is returned when an option that is only valid in leaf
+	// profiles is used in a CA profile.
+	ErrLeafOnly = errors.New("option can only be used in leaf profiles")
+	// ErrNotCreated is returned by the methods that require a certificate if
+	// CreateCertificate has not been called yet.
+	ErrNotCreated = errors.New("certificate has not been created yet")
+	// ErrLint is returned when the linter reports any finding. The error is a
+	// LintErrors.
+	ErrLint = errors.New("certificate lint failed")
+)
+
+// profileError is an error with a descriptive message that matches a sentinel
+// error using errors.Is.
+type profileError struct {
+	err error
+	msg string
+}
+
+// Error implements the error interface.
+func (e *profileError) Error() string {
+	return e.msg
+}
+
+// Unwrap returns the sentinel error.
+func (e *profileError) Unwrap() error {
+	return e.err
+}
+
+// newError returns an error with the given message that wraps the given
+// sentinel error.
+func newError(sentinel error, format string, args ...interface{}) error {
+	return errors.WithStack(&profileError{err: sentinel, msg: fmt.Sprintf(format, args...)})
+}
+
+// InvalidIssuerError is the error returned when the issuer certificate of a
+// profile cannot be used to sign certificates. Property contains the name of
+// the missing property.
+type InvalidIssuerError struct {
+	Property string
+}
+
+// Error implements the error interface.
+func (e *InvalidIssuerError) Error() string {
+	return fmt.Sprintf("issuer certificate cannot sign certificates: %s is required", e.Property)
+}
+
+// Is returns true if target is ErrIssuerNotCA.
+func (e *InvalidIssuerError) Is(target error) bool {
+	return target == ErrIssuerNotCA
+}
+
+// IssuerKeyReuseError is the error returned when the subject public key of a
+// certificate that is not self-signed is the public key of the issuer
+// certificate. Use WithAllowIssuerKeyReuse if this is intentional.
+type IssuerKeyReuseError struct {
+	// Issuer is the subject of the issuer certificate.
+	Issuer string
+}
+
+// Error implements the error interface.
+func (e *IssuerKeyReuseError) Error() string {
+	return fmt.Sprintf("subject public key is the public key of the issuer certificate %q", e.Issuer)
+}
+
+// Is returns true if target is ErrIssuerKeyReuse.
+func (e *IssuerKeyReuseError) Is(target error) bool {
+	return target == ErrIssuerKeyReuse
+}
+
+// NameConstraintViolation is a subject alternative name that does not satisfy
+// the name constraints of the issuer certificate.
+type NameConstraintViolation struct {
+	// Type is the type of the name: "DNS", "IP", "email" or "URI".
+	Type string
+	// Name is the subject alternative name.
+	Name string
+	// Reason describes the constraint that is not satisfied.
+	Reason string
+}
+
+// String returns the description of the violation.
+func (v NameConstraintViolation) String() string {
+	return fmt.Sprintf("%s name %q %s", v.Type, v.Name, v.Reason)
+}
+
+// NameConstraintError is the error returned when the subject alternative names
+// of a certificate do not satisfy the name constraints of the issuer
+// certificate. Violations contains each invalid name.
+type NameConstraintError struct {
+	Violations []NameConstraintViolation
+}
+
+// Error implements the error interface.
+func (e *NameConstraintError) Error() string {
+	msgs := make([]string, len(e.Violations))
+	for i, v := range e.Violations {
+		msgs[i] = v.String()
+	}
+	return "certificate violates the issuer name constraints: " + strings.Join(msgs, "; ")
+}
+
+// Is returns true if target is ErrNameConstraints.
+func (e *NameConstraintError) Is(target error) bool {
+	return target == ErrNameConstraints
+}
@@ -0,0 +1,165 @@
+package x509util
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestErrors(t *testing.T) {
+	iss := mustParseCertificate(t, "test_files/noPasscodeCa.crt")
+	issPriv := mustParseRSAKey(t, "test_files/noPasscodeCa.key")
+	otherKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	leaf := func(opts ...WithOption) Profile {
+		return mustNewProfile(t)(NewLeafProfile("leaf.smallstep.com", iss, issPriv, append([]WithOption{WithHosts("leaf.smallstep.com")}, opts...)...))
+	}
+	create := func(p Profile) error {
+		_, err := p.CreateCertificate()
+		return err
+	}
+	constrainedRoot := mustNewProfile(t)(NewRootProfile("constrained", withTemplateFields(func(crt *x509.Certificate) {
+		crt.PermittedDNSDomains = []string{"smallstep.com"}
+	})))
+	constrainedCert := mustCreateCertificate(t, constrainedRoot)
+	leafProfile := leaf()
+	leafCert := mustCreateCertificate(t, leafProfile)
+	leafKey := leafProfile.SubjectPrivateKey()
+
+	tests := []struct {
+		name string
+		err  func() error
+		want error
+	}{
+		{"missing public key", func() error {
+			_, err := NewLeafProfileWithCSR(&x509.CertificateRequest{}, iss, issPriv)
+			return err
+		}, ErrMissingPublicKey},
+		{"missing public key intermediate", func() error {
+			_, err := NewIntermediateProfileWithCSR(&x509.CertificateRequest{}, iss, issPriv)
+			return err
+		}, ErrMissingPublicKey},
+		{"invalid CSR signature", func() error {
+			_, err := NewIntermediateProfileWithCSR(mustLoadCSR(t, "test_files/badsig.csr"), iss, issPriv)
+			return err
+		}, ErrInvalidCSRSignature},
+		{"issuer not CA", func() error {
+			_, err := NewLeafProfile("leaf", leafCert, leafKey)
+			return err
+		}, ErrIssuerNotCA},
+		{"issuer key mismatch", func() error {
+			_, err := NewLeafProfile("leaf", iss, otherKey)
+			return err
+		}, ErrIssuerKeyMismatch},
+		{"issuer key mismatch self-signed", func() error {
+			p := mustNewProfile(t)(NewRootProfile("root"))
+			p.SetIssuerPrivateKey(otherKey)
+			return create(p)
+		}, ErrIssuerKeyMismatch},
+		{"unsupported key", func() error {
+			_, err := NewLeafProfileWithPublicKey(otherKey, "leaf", iss, issPriv)
+			return err
+		}, ErrUnsupportedKey},
+		{"validity exceeds issuer", func() error {
+			_, err := NewLeafProfile("leaf", iss, issPriv, WithNotBeforeAfterDuration(iss.NotBefore, iss.NotAfter.Add(time.Hour), 0))
+			return err
+		}, ErrValidityExceedsIssuer},
+		{"missing issuer key", func() error {
+			p := leaf()
+			p.SetIssuerPrivateKey(nil)
+			return create(p)
+		}, ErrMissingIssuerKey},
+		{"issuer key reuse", func() error {
+			return create(leaf(WithPublicKey(iss.PublicKey)))
+		}, ErrIssuerKeyReuse},
+		{"weak key", func() error {
+			return create(leaf(WithPublicKey(mustLoadCSR(t, "test_files/weakRSA.csr").PublicKey)))
+		}, ErrWeakKey},
+		{"name constraints", func() error {
+			p := mustNewProfile(t)(NewLeafProfile("leaf.example.com", constrainedCert, constrainedRoot.SubjectPrivateKey(), WithHosts("leaf.example.com")))
+			return create(p)
+		}, ErrNameConstraints},
+		{"path length", func() error {
+			return create(mustNewProfile(t)(NewIntermediateProfile("intermediate", iss, issPriv)))
+		}, ErrPathLenConstraint},
+		{"signature algorithm", func() error {
+			return create(leaf(WithSignatureAlgorithm(x509.PureEd25519)))
+		}, ErrInvalidSignatureAlgorithm},
+		{"lint", func() error {
+			return create(leaf(WithAddKeyUsage(x509.KeyUsageCertSign)))
+		}, ErrLint},
+		{"CA only", func() error {
+			_, err := NewLeafProfile("leaf", iss, issPriv, WithMaxPathLen(1))
+			return err
+		}, ErrCAOnly},
+		{"leaf only", func() error {
+			_, err := NewRootProfile("root", WithMustStaple())
+			return err
+		}, ErrLeafOnly},
+		{"not created", func() error {
+			_, err := leaf().Fingerprint()
+			return err
+		}, ErrNotCreated},
+		{"missing private key", func() error {
+			_, err := leaf(WithPublicKey(mustParseCertificate(t, "test_files/ca.crt").PublicKey)).EncryptedSubjectKeyPEM([]byte("password"))
+			return err
+		}, ErrMissingPrivateKey},
+		{"key not exportable", func() error {
+			p := leaf(WithKeyPairGenerator(func() (crypto.PublicKey, crypto.PrivateKey, error) {
+				return otherKey.Public(), testSigner{otherKey}, nil
+			}))
+			_, err := p.EncryptedSubjectKeyPEM([]byte("password"))
+			return err
+		}, ErrKeyNotExportable},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.err()
+			if !errors.Is(err, tt.want) {
+				t.Fatalf("error = %v, want errors.Is(err, %v)", err, tt.want)
+			}
+			if err.Error() == tt.want.Error() {
+				t.Errorf("error message = %q, want a descriptive message", err)
+			}
+			for _, other := range []error{ErrMissingPublicKey, ErrIssuerNotCA, ErrWeakKey, ErrLint, ErrNotCreated} {
+				if other != tt.want && errors.Is(err, other) {
+					t.Errorf("error = %v, should not match %v", err, other)
+				}
+			}
+		})
+	}
+
+	t.Run("errors.As", func(t *testing.T) {
+		_, err := NewLeafProfile("leaf", leafCert, leafKey)
+		var issErr *InvalidIssuerError
+		if !errors.As(err, &issErr) || issErr.Property == "" {
+			t.Errorf("errors.As(%v, *InvalidIssuerError) = %v", err, issErr)
+		}
+
+		err = create(leaf(WithPublicKey(iss.PublicKey)))
+		var reuseErr *IssuerKeyReuseError
+		if !errors.As(err, &reuseErr) {
+			t.Errorf("errors.As(%v, *IssuerKeyReuseError) = false", err)
+		}
+
+		err = create(mustNewProfile(t)(NewLeafProfile("leaf.example.com", constrainedCert, constrainedRoot.SubjectPrivateKey(), WithHosts("leaf.example.com"))))
+		var ncErr *NameConstraintError
+		if !errors.As(err, &ncErr) || len(ncErr.Violations) != 1 {
+			t.Errorf("errors.As(%v, *NameConstraintError) = %v", err, ncErr)
+		}
+
+		err = create(leaf(WithAddKeyUsage(x509.KeyUsageCertSign)))
+		var lintErrs LintErrors
+		if !errors.As(err, &lintErrs) || len(lintErrs) != 1 {
+			t.Errorf("errors.As(%v, LintErrors) = %v", err, lintErrs)
+		}
+	})
+}
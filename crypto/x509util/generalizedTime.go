@@ -0,0 +1,162 @@
+package x509util
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/asn1"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// WithForceGeneralizedTime returns a Profile modifier that encodes both
+// NotBefore and NotAfter as GeneralizedTime. By default, as required by RFC
+// 5280, section 4.1.2.5, dates before 2050 are encoded as UTCTime, and only
+// later dates use GeneralizedTime, so a certificate can mix both types. Some
+// strict parsers do not accept UTCTime or mixed encodings.
+//
+// The x509 package does not support this, so the to-be-signed certificate is
+// created with a temporary key, the validity is replaced, and the result is
+// signed with the issuer key.
+func WithForceGeneralizedTime() WithOption {
+	return func(p Profile) error {
+		b, err := getBase(p)
+		if err != nil {
+			return err
+		}
+		b.forceGeneralizedTime = true
+		return nil
+	}
+}
+
+// validity is the ASN.1 structure of the validity of a certificate encoded
+// using GeneralizedTime.
+type validity struct {
+	NotBefore time.Time `asn1:"generalized"`
+	NotAfter  time.Time `asn1:"generalized"`
+}
+
+// createCertificateWithGeneralizedTime works like x509.CreateCertificate but
+// it encodes the validity using GeneralizedTime.
+func createCertificateWithGeneralizedTime(tpl, parent *x509.Certificate, pub, issPriv interface{}) ([]byte, error) {
+	signer, ok := issPriv.(crypto.Signer)
+	if !ok {
+		return nil, errors.Errorf("issuer private key %T is not a crypto.Signer", issPriv)
+	}
+	tmp, err := newTemporaryKey(signer.Public())
+	if err != nil {
+		return nil, err
+	}
+	tmpParent := *parent
+	tmpParent.PublicKey = tmp.Public()
+	der, err := x509.CreateCertificate(rand.Reader, tpl, &tmpParent, pub, tmp)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	crt, err := x509.ParseCertificate(der)
+	if err != nil {
+		return nil, errors.Wrap(err, "error parsing certificate")
+	}
+	var c certificate
+	if _, err := asn1.Unmarshal(der, &c); err != nil {
+		return nil, errors.Wrap(err, "error parsing certificate")
+	}
+
+	tbs, err := replaceValidity(crt.RawTBSCertificate, crt.NotBefore, crt.NotAfter)
+	if err != nil {
+		return nil, err
+	}
+	signature, err := signTBSCertificate(signer, crt.SignatureAlgorithm, tbs)
+	if err != nil {
+		return nil, err
+	}
+	der, err = asn1.Marshal(certificate{
+		TBSCertificate:     asn1.RawValue{FullBytes: tbs},
+		SignatureAlgorithm: c.SignatureAlgorithm,
+		SignatureValue:     asn1.BitString{Bytes: signature, BitLength: 8 * len(signature)},
+	})
+	return der, errors.Wrap(err, "error marshaling certificate")
+}
+
+// replaceValidity returns the given DER encoded to-be-signed certificate with
+// the validity encoded using GeneralizedTime.
+func replaceValidity(tbs []byte, notBefore, notAfter time.Time) ([]byte, error) {
+	var fields []asn1.RawValue
+	if rest, err := asn1.Unmarshal(tbs, &fields); err != nil || len(rest) > 0 {
+		return nil, errors.New("error parsing to-be-signed certificate")
+	}
+	// The validity follows the serial number, the signature algorithm and the
+	// issuer, and the optional version.
+	i := 3
+	if len(fields) > 0 && fields[0].Class == asn1.ClassContextSpecific && fields[0].Tag == 0 {
+		i = 4
+	}
+	if len(fields) <= i {
+		return nil, errors.New("error parsing to-be-signed certificate: validity not found")
+	}
+	v, err := asn1.Marshal(validity{NotBefore: notBefore.UTC(), NotAfter: notAfter.UTC()})
+	if err != nil {
+		return nil, errors.Wrap(err, "error marshaling validity")
+	}
+	fields[i] = asn1.RawValue{FullBytes: v}
+
+	var content []byte
+	for _, f := range fields {
+		content = append(content, f.FullBytes...)
+	}
+	return asn1.Marshal(asn1.RawValue{
+		Class:      asn1.ClassUniversal,
+		Tag:        asn1.TagSequence,
+		IsCompound: true,
+		Bytes:      content,
+	})
+}
+
+// signTBSCertificate signs the given to-be-signed certificate using the given
+// signature algorithm, and verifies the signature.
+func signTBSCertificate(signer crypto.Signer, alg x509.SignatureAlgorithm, tbs []byte) ([]byte, error) {
+	var (
+		hash crypto.Hash
+		pss  bool
+	)
+	switch alg {
+	case x509.SHA256WithRSA, x509.ECDSAWithSHA256:
+		hash = crypto.SHA256
+	case x509.SHA384WithRSA, x509.ECDSAWithSHA384:
+		hash = crypto.SHA384
+	case x509.SHA512WithRSA, x509.ECDSAWithSHA512:
+		hash = crypto.SHA512
+	case x509.SHA256WithRSAPSS:
+		hash, pss = crypto.SHA256, true
+	case x509.SHA384WithRSAPSS:
+		hash, pss = crypto.SHA384, true
+	case x509.SHA512WithRSAPSS:
+		hash, pss = crypto.SHA512, true
+	case x509.PureEd25519:
+		hash = crypto.Hash(0)
+	default:
+		return nil, errors.Errorf("unsupported signature algorithm %s", alg)
+	}
+
+	digest := tbs
+	if hash != crypto.Hash(0) {
+		h := hash.New()
+		h.Write(tbs)
+		digest = h.Sum(nil)
+	}
+	var opts crypto.SignerOpts = hash
+	if pss {
+		opts = &rsa.PSSOptions{SaltLength: rsa.PSSSaltLengthEqualsHash, Hash: hash}
+	}
+	signature, err := signer.Sign(rand.Reader, digest, opts)
+	if err != nil {
+		return nil, errors.Wrap(err, "error signing certificate")
+	}
+	issuer := &x509.Certificate{PublicKey: signer.Public()}
+	if err := issuer.CheckSignature(alg, tbs, signature); err != nil {
+		return nil, errors.Wrap(err, "error verifying certificate signature")
+	}
+	return signature, nil
+}
@@ -0,0 +1,94 @@
+package x509util
+
+import (
+	"crypto"
+	"crypto/x509"
+	"encoding/asn1"
+	"testing"
+	"time"
+)
+
+// validityTags returns the ASN.1 tags of NotBefore and NotAfter of the given
+// DER encoded certificate.
+func validityTags(t *testing.T, der []byte) (int, int) {
+	t.Helper()
+	var c certificate
+	if _, err := asn1.Unmarshal(der, &c); err != nil {
+		t.Fatal(err)
+	}
+	var fields []asn1.RawValue
+	if _, err := asn1.Unmarshal(c.TBSCertificate.FullBytes, &fields); err != nil {
+		t.Fatal(err)
+	}
+	var times []asn1.RawValue
+	if _, err := asn1.Unmarshal(fields[4].FullBytes, &times); err != nil || len(times) != 2 {
+		t.Fatalf("error parsing validity: %v", err)
+	}
+	return times[0].Tag, times[1].Tag
+}
+
+func TestWithForceGeneralizedTime(t *testing.T) {
+	rsaRoot := mustNewProfile(t)(NewRootProfile("RSA Root", GenerateKeyPair("RSA", "", 2048), WithForceGeneralizedTime()))
+	rsaRootCert := mustCreateCertificate(t, rsaRoot)
+	ecRoot := mustNewProfile(t)(NewRootProfile("EC Root", GenerateKeyPair("EC", "P-384", 0)))
+	ecRootCert := mustCreateCertificate(t, ecRoot)
+	edRoot := mustNewProfile(t)(NewRootProfile("Ed25519 Root", GenerateKeyPair("OKP", "Ed25519", 0)))
+	edRootCert := mustCreateCertificate(t, edRoot)
+
+	// A root is signed with its own key.
+	if nb, na := validityTags(t, rsaRootCert.Raw); nb != asn1.TagGeneralizedTime || na != asn1.TagGeneralizedTime {
+		t.Errorf("root validity tags = %d, %d, want GeneralizedTime", nb, na)
+	}
+	if err := rsaRootCert.CheckSignatureFrom(rsaRootCert); err != nil {
+		t.Errorf("CheckSignatureFrom() error = %v", err)
+	}
+
+	notBefore := time.Now().Truncate(time.Second)
+	tests := []struct {
+		name    string
+		iss     *x509.Certificate
+		issPriv crypto.PrivateKey
+		options []WithOption
+		want    int
+	}{
+		{"rsa", rsaRootCert, rsaRoot.SubjectPrivateKey(), []WithOption{WithForceGeneralizedTime()}, asn1.TagGeneralizedTime},
+		{"rsa-pss", rsaRootCert, rsaRoot.SubjectPrivateKey(), []WithOption{WithForceGeneralizedTime(), WithSignatureAlgorithm(x509.SHA384WithRSAPSS)}, asn1.TagGeneralizedTime},
+		{"ecdsa", ecRootCert, ecRoot.SubjectPrivateKey(), []WithOption{WithForceGeneralizedTime()}, asn1.TagGeneralizedTime},
+		{"ed25519", edRootCert, testSigner{edRoot.SubjectPrivateKey().(crypto.Signer)}, []WithOption{WithForceGeneralizedTime()}, asn1.TagGeneralizedTime},
+		{"default", ecRootCert, ecRoot.SubjectPrivateKey(), nil, asn1.TagUTCTime},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			opts := append([]WithOption{WithHosts("leaf.smallstep.com"), WithNotBeforeAfterDuration(notBefore, time.Time{}, time.Hour)}, tt.options...)
+			p := mustNewProfile(t)(NewLeafProfile("leaf.smallstep.com", tt.iss, tt.issPriv, opts...))
+			crt := mustCreateCertificate(t, p)
+			if nb, na := validityTags(t, crt.Raw); nb != tt.want || na != tt.want {
+				t.Errorf("validity tags = %d, %d, want %d", nb, na, tt.want)
+			}
+			if !crt.NotBefore.Equal(notBefore) || !crt.NotAfter.Equal(notBefore.Add(time.Hour)) {
+				t.Errorf("validity = %s - %s, want %s - %s", crt.NotBefore, crt.NotAfter, notBefore, notBefore.Add(time.Hour))
+			}
+			if err := crt.CheckSignatureFrom(tt.iss); err != nil {
+				t.Errorf("CheckSignatureFrom() error = %v", err)
+			}
+		})
+	}
+
+	// The to-be-signed certificate uses GeneralizedTime too.
+	p := mustNewProfile(t)(NewLeafProfile("leaf.smallstep.com", ecRootCert, ecRoot.SubjectPrivateKey(), WithHosts("leaf.smallstep.com"), WithForceGeneralizedTime()))
+	tbs, alg, err := p.TBSCertificate()
+	if err != nil {
+		t.Fatalf("TBSCertificate() error = %v", err)
+	}
+	signature, err := signTBSCertificate(ecRoot.SubjectPrivateKey().(crypto.Signer), alg, tbs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	der, err := p.AssembleSignedCertificate(signature)
+	if err != nil {
+		t.Fatalf("AssembleSignedCertificate() error = %v", err)
+	}
+	if nb, na := validityTags(t, der); nb != asn1.TagGeneralizedTime || na != asn1.TagGeneralizedTime {
+		t.Errorf("validity tags = %d, %d, want GeneralizedTime", nb, na)
+	}
+}
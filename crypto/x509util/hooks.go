@@ -0,0 +1,130 @@
+package x509util
+
+import (
+	"crypto/x509"
+
+	"github.com/pkg/errors"
+)
+
+// PreIssuanceHook is a function called with the final template of the
+// certificate right before signing it. Any error returned aborts the
+// issuance.
+type PreIssuanceHook func(tbs *x509.Certificate) error
+
+// WithPreIssuanceHook returns a Profile modifier that adds a read-only hook
+// that will be called with the final template of the certificate right before
+// signing it. This hook can be used, for example, to lint the certificate
+// using an external linter.
+//
+// The hook receives a copy of the fully resolved template, with
+// KeyEncipherment already removed for non-RSA keys, with the serial number and
+// the key identifiers already set, and with the subject alternative names,
+// certificate policies and critical extensions already encoded in
+// ExtraExtensions. Any change done by the hook is discarded, use
+// WithMutatingHook to modify the template.
+//
+// The modifier can be used multiple times, and the hooks are called in order
+// after the mutating hooks.
+func WithPreIssuanceHook(fn PreIssuanceHook) WithOption {
+	return func(p Profile) error {
+		if fn == nil {
+			return errors.New("pre-issuance hook cannot be nil")
+		}
+		b, err := getBase(p)
+		if err != nil {
+			return err
+		}
+		b.hooks = append(b.hooks, fn)
+		return nil
+	}
+}
+
+// WithMutatingHook returns a Profile modifier that adds a hook that will be
+// called with the template of the certificate when it is signed. Unlike
+// WithPreIssuanceHook, the changes done by the hook are kept in the signed
+// certificate.
+//
+// The hooks run before the template is checked, so their changes are subject
+// to the same rules as the ones done by the other modifiers: KeyEncipherment
+// and DataEncipherment are removed for non-RSA keys, the signature algorithm,
+// the DNS names and IP addresses are validated, and the linter runs.
+//
+// The modifier can be used multiple times, and the hooks are called in order
+// before the read-only hooks.
+func WithMutatingHook(fn PreIssuanceHook) WithOption {
+	return func(p Profile) error {
+		if fn == nil {
+			return errors.New("mutating hook cannot be nil")
+		}
+		b, err := getBase(p)
+		if err != nil {
+			return err
+		}
+		b.mutatingHooks = append(b.mutatingHooks, fn)
+		return nil
+	}
+}
+
+// runMutatingHooks calls the mutating hooks with the given template.
+func (b *base) runMutatingHooks(tpl *x509.Certificate) error {
+	for i, fn := range b.mutatingHooks {
+		if err := fn(tpl); err != nil {
+			return errors.Wrapf(err, "mutating hook %d failed", i)
+		}
+	}
+	return nil
+}
+
+// runPreIssuanceHooks calls the read-only hooks with a copy of the given
+// template. The copy has the authority key identifier that the x509 package
+// takes from the parent.
+func (b *base) runPreIssuanceHooks(tpl, parent *x509.Certificate) error {
+	if len(b.hooks) == 0 {
+		return nil
+	}
+	final := copyCertificate(tpl)
+	if len(final.AuthorityKeyId) == 0 && b.iss != b.sub && len(parent.SubjectKeyId) > 0 {
+		final.AuthorityKeyId = append([]byte(nil), parent.SubjectKeyId...)
+	}
+	for i, fn := range b.hooks {
+		if err := fn(copyCertificate(final)); err != nil {
+			return errors.Wrapf(err, "pre-issuance hook %d failed", i)
+		}
+	}
+	return nil
+}
+
+// WithTemplateFunc returns a Profile modifier that adds a function to edit the
+// subject template. The functions run when the profile is created, after all
+// the other modifiers, once the default validity, the subject key and the key
+// usage are set, and they are called in the same order they are added. An
+// error returned by the function aborts the creation of the profile.
+//
+// Some fields are still set after the functions run: the subject key
+// identifier and the serial number are generated if they are not set. And
+// when the certificate is signed, KeyEncipherment and DataEncipherment are
+// removed for non-RSA keys, and standard extensions in ExtraExtensions are
+// replaced by the ones generated from the template fields. The x509 package
+// also replaces the authority key identifier with the subject key identifier
+// of the issuer, if the issuer has one; use WithAuthorityKeyId to set it.
+func WithTemplateFunc(fn func(*x509.Certificate) error) WithOption {
+	return func(p Profile) error {
+		if fn == nil {
+			return errors.New("template function cannot be nil")
+		}
+		b, err := getBase(p)
+		if err != nil {
+			return err
+		}
+		b.templateFuncs = append(b.templateFuncs, fn)
+		return nil
+	}
+}
+
+// WithTemplateMutator returns a Profile modifier that adds a last-chance
+// function to edit the subject template at the end of the option processing.
+//
+// Deprecated: use WithTemplateFunc, this is the same modifier.
+func WithTemplateMutator(fn func(*x509.Certificate) error) WithOption {
+	return WithTemplateFunc(fn)
+}
@@ -0,0 +1,319 @@
+package x509util
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/asn1"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/pkg/errors"
+)
+
+func TestWithPreIssuanceHook(t *testing.T) {
+	iss := mustParseCertificate(t, "test_files/noPasscodeCa.crt")
+	issPriv := mustParseRSAKey(t, "test_files/noPasscodeCa.key")
+
+	var calls []string
+	readOnly := func(name string) PreIssuanceHook {
+		return func(tbs *x509.Certificate) error {
+			calls = append(calls, name)
+			if tbs.KeyUsage&x509.KeyUsageKeyEncipherment != 0 {
+				t.Error("hook template has KeyEncipherment")
+			}
+			if tbs.SubjectKeyId == nil {
+				t.Error("hook template does not have a SubjectKeyId")
+			}
+			if tbs.SerialNumber == nil {
+				t.Error("hook template does not have a SerialNumber")
+			}
+			tbs.DNSNames = append(tbs.DNSNames, "read-only.smallstep.com")
+			return nil
+		}
+	}
+	mutating := func(tbs *x509.Certificate) error {
+		calls = append(calls, "mutating")
+		tbs.DNSNames = append(tbs.DNSNames, "mutating.smallstep.com")
+		return nil
+	}
+
+	p, err := NewLeafProfile("test.smallstep.com", iss, issPriv,
+		WithPreIssuanceHook(readOnly("first")), WithMutatingHook(mutating), WithPreIssuanceHook(readOnly("second")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert := mustCreateCertificate(t, p)
+	if got := strings.Join(calls, ","); got != "mutating,first,second" {
+		t.Errorf("hook calls = %s, want mutating,first,second", got)
+	}
+	if len(cert.DNSNames) != 1 || cert.DNSNames[0] != "mutating.smallstep.com" {
+		t.Errorf("DNSNames = %v, want [mutating.smallstep.com]", cert.DNSNames)
+	}
+
+	t.Run("fail", func(t *testing.T) {
+		hookErr := errors.New("zlint failed")
+		p, err := NewLeafProfile("test.smallstep.com", iss, issPriv,
+			WithPreIssuanceHook(func(*x509.Certificate) error { return nil }),
+			WithPreIssuanceHook(func(*x509.Certificate) error { return hookErr }))
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, err = p.CreateCertificate()
+		if errors.Cause(err) != hookErr {
+			t.Fatalf("CreateCertificate() error = %v, want %v", err, hookErr)
+		}
+		if !strings.Contains(err.Error(), "pre-issuance hook 1 failed") {
+			t.Errorf("CreateCertificate() error = %v, want pre-issuance hook 1 failed", err)
+		}
+	})
+
+	t.Run("fail/nil", func(t *testing.T) {
+		if _, err := NewLeafProfile("test.smallstep.com", iss, issPriv, WithPreIssuanceHook(nil)); err == nil {
+			t.Error("NewLeafProfile() error = nil, want error")
+		}
+		if _, err := NewLeafProfile("test.smallstep.com", iss, issPriv, WithMutatingHook(nil)); err == nil {
+			t.Error("NewLeafProfile() error = nil, want error")
+		}
+	})
+}
+
+func TestWithMutatingHook_checked(t *testing.T) {
+	iss := mustParseCertificate(t, "test_files/noPasscodeCa.crt")
+	issPriv := mustParseRSAKey(t, "test_files/noPasscodeCa.key")
+	ecKey, err := ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ecRoot := mustNewProfile(t)(NewRootProfile("EC Root", WithPublicKey(ecKey.Public())))
+	ecRoot.SetIssuerPrivateKey(ecKey)
+	ecRootCert := mustCreateCertificate(t, ecRoot)
+
+	t.Run("key usage", func(t *testing.T) {
+		p := mustNewProfile(t)(NewLeafProfile("test.smallstep.com", iss, issPriv, GenerateKeyPair("EC", "P-256", 0),
+			WithMutatingHook(func(tbs *x509.Certificate) error {
+				tbs.KeyUsage |= x509.KeyUsageKeyEncipherment
+				return nil
+			}),
+			WithPreIssuanceHook(func(tbs *x509.Certificate) error {
+				if tbs.KeyUsage&x509.KeyUsageKeyEncipherment != 0 {
+					t.Error("hook template has KeyEncipherment")
+				}
+				return nil
+			})))
+		if crt := mustCreateCertificate(t, p); crt.KeyUsage&x509.KeyUsageKeyEncipherment != 0 {
+			t.Errorf("KeyUsage = %x, want no KeyEncipherment", crt.KeyUsage)
+		}
+	})
+
+	t.Run("signature algorithm", func(t *testing.T) {
+		p := mustNewProfile(t)(NewLeafProfile("test.smallstep.com", ecRootCert, ecKey,
+			WithMutatingHook(func(tbs *x509.Certificate) error {
+				tbs.SignatureAlgorithm = x509.ECDSAWithSHA256
+				return nil
+			})))
+		if _, err := p.CreateCertificate(); !errors.Is(err, ErrInvalidSignatureAlgorithm) {
+			t.Errorf("CreateCertificate() error = %v, want ErrInvalidSignatureAlgorithm", err)
+		}
+	})
+
+	t.Run("lint", func(t *testing.T) {
+		p := mustNewProfile(t)(NewServerProfile("test.smallstep.com", iss, issPriv, WithHosts("test.smallstep.com"),
+			WithMutatingHook(func(tbs *x509.Certificate) error {
+				tbs.DNSNames = nil
+				return nil
+			})))
+		if _, err := p.CreateCertificate(); !errors.Is(err, ErrLint) {
+			t.Errorf("CreateCertificate() error = %v, want ErrLint", err)
+		}
+	})
+
+	t.Run("dns names", func(t *testing.T) {
+		p := mustNewProfile(t)(NewLeafProfile("test.smallstep.com", iss, issPriv,
+			WithMutatingHook(func(tbs *x509.Certificate) error {
+				tbs.DNSNames = append(tbs.DNSNames, "https://smallstep.com")
+				return nil
+			})))
+		if _, err := p.CreateCertificate(); err == nil {
+			t.Error("CreateCertificate() error = nil, want error")
+		}
+	})
+
+	t.Run("subject", func(t *testing.T) {
+		p := mustNewProfile(t)(NewLeafProfile("test.smallstep.com", iss, issPriv, WithHosts("test.smallstep.com"),
+			WithMutatingHook(func(tbs *x509.Certificate) error {
+				tbs.DNSNames[0] = "mutated.smallstep.com"
+				return nil
+			})))
+		mustCreateCertificate(t, p)
+		if got := p.Subject().DNSNames; !reflect.DeepEqual(got, []string{"test.smallstep.com"}) {
+			t.Errorf("Subject().DNSNames = %v, want [test.smallstep.com]", got)
+		}
+	})
+}
+
+func TestWithPreIssuanceHook_resolvedTemplate(t *testing.T) {
+	iss := mustParseCertificate(t, "test_files/noPasscodeCa.crt")
+	issPriv := mustParseRSAKey(t, "test_files/noPasscodeCa.key")
+
+	var called bool
+	hook := func(tbs *x509.Certificate) error {
+		called = true
+		if !hasExtension(tbs.ExtraExtensions, oidExtSubjectAltName) {
+			t.Error("hook template does not have the subject alternative name extension")
+		}
+		if !hasExtension(tbs.ExtraExtensions, oidExtCertificatePolicies) {
+			t.Error("hook template does not have the certificate policies extension")
+		}
+		if !bytes.Equal(tbs.AuthorityKeyId, iss.SubjectKeyId) {
+			t.Errorf("hook template AuthorityKeyId = %x, want %x", tbs.AuthorityKeyId, iss.SubjectKeyId)
+		}
+		return nil
+	}
+	p := mustNewProfile(t)(NewLeafProfile("test.smallstep.com", iss, issPriv,
+		WithHosts("test.smallstep.com"), WithUPN("jane@smallstep.com"),
+		WithCertificatePolicy(asn1.ObjectIdentifier{1, 2, 3, 4}, "https://smallstep.com/cps", ""),
+		WithPreIssuanceHook(hook)))
+	mustCreateCertificate(t, p)
+	if !called {
+		t.Fatal("pre-issuance hook was not called")
+	}
+
+	t.Run("authority key id", func(t *testing.T) {
+		aki := []byte{1, 2, 3, 4}
+		p := mustNewProfile(t)(NewLeafProfile("test.smallstep.com", iss, issPriv, WithAuthorityKeyId(aki),
+			WithPreIssuanceHook(func(tbs *x509.Certificate) error {
+				if !bytes.Equal(tbs.AuthorityKeyId, aki) {
+					t.Errorf("hook template AuthorityKeyId = %x, want %x", tbs.AuthorityKeyId, aki)
+				}
+				return nil
+			})))
+		mustCreateCertificate(t, p)
+	})
+}
+
+func TestWithTemplateFunc(t *testing.T) {
+	iss := mustParseCertificate(t, "test_files/noPasscodeCa.crt")
+	issPriv := mustParseRSAKey(t, "test_files/noPasscodeCa.key")
+
+	addCodeSigning := func(crt *x509.Certificate) error {
+		crt.ExtKeyUsage = append(crt.ExtKeyUsage, x509.ExtKeyUsageCodeSigning)
+		return nil
+	}
+	removeCodeSigning := func(crt *x509.Certificate) error {
+		var ekus []x509.ExtKeyUsage
+		for _, eku := range crt.ExtKeyUsage {
+			if eku != x509.ExtKeyUsageCodeSigning {
+				ekus = append(ekus, eku)
+			}
+		}
+		crt.ExtKeyUsage = ekus
+		return nil
+	}
+
+	tests := []struct {
+		name    string
+		options []WithOption
+		want    []x509.ExtKeyUsage
+		wantErr bool
+	}{
+		{"ok/add", []WithOption{WithTemplateFunc(addCodeSigning)}, []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth, x509.ExtKeyUsageCodeSigning}, false},
+		{"ok/add-remove", []WithOption{WithTemplateFunc(addCodeSigning), WithTemplateFunc(removeCodeSigning)}, []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth}, false},
+		{"ok/remove-add", []WithOption{WithTemplateFunc(removeCodeSigning), WithTemplateFunc(addCodeSigning)}, []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth, x509.ExtKeyUsageCodeSigning}, false},
+		{"ok/after-options", []WithOption{WithTemplateFunc(removeCodeSigning), WithExtKeyUsage(x509.ExtKeyUsageCodeSigning)}, nil, false},
+		{"fail/error", []WithOption{WithTemplateFunc(func(*x509.Certificate) error {
+			return errors.New("force")
+		})}, nil, true},
+		{"fail/nil", []WithOption{WithTemplateFunc(nil)}, nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, err := NewLeafProfile("test.smallstep.com", iss, issPriv, tt.options...)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("NewLeafProfile() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			cert := mustCreateCertificate(t, p)
+			if len(cert.ExtKeyUsage) != len(tt.want) {
+				t.Fatalf("ExtKeyUsage = %v, want %v", cert.ExtKeyUsage, tt.want)
+			}
+			for i := range tt.want {
+				if cert.ExtKeyUsage[i] != tt.want[i] {
+					t.Errorf("ExtKeyUsage = %v, want %v", cert.ExtKeyUsage, tt.want)
+				}
+			}
+			// The subject key identifier and serial number are still set.
+			if len(cert.SubjectKeyId) == 0 || cert.SerialNumber == nil {
+				t.Error("SubjectKeyId or SerialNumber are not set")
+			}
+		})
+	}
+}
+
+func TestWithTemplateMutator(t *testing.T) {
+	iss := mustParseCertificate(t, "test_files/noPasscodeCa.crt")
+	issPriv := mustParseRSAKey(t, "test_files/noPasscodeCa.key")
+
+	// The mutator runs at the end of the option processing, like
+	// WithTemplateFunc.
+	p := mustNewProfile(t)(NewLeafProfile("test.smallstep.com", iss, issPriv,
+		WithTemplateMutator(func(crt *x509.Certificate) error {
+			crt.DNSNames = append(crt.DNSNames, "mutated.smallstep.com")
+			return nil
+		}),
+		WithHosts("test.smallstep.com"),
+	))
+	want := []string{"test.smallstep.com", "mutated.smallstep.com"}
+	if !reflect.DeepEqual(p.Subject().DNSNames, want) {
+		t.Errorf("Subject().DNSNames = %v, want %v", p.Subject().DNSNames, want)
+	}
+	if cert := mustCreateCertificate(t, p); !reflect.DeepEqual(cert.DNSNames, want) {
+		t.Errorf("DNSNames = %v, want %v", cert.DNSNames, want)
+	}
+
+	t.Run("fail", func(t *testing.T) {
+		mutatorErr := errors.New("mutator failed")
+		if _, err := NewLeafProfile("test.smallstep.com", iss, issPriv,
+			WithTemplateMutator(func(*x509.Certificate) error { return mutatorErr })); errors.Cause(err) != mutatorErr {
+			t.Errorf("NewLeafProfile() error = %v, want %v", err, mutatorErr)
+		}
+		if _, err := NewLeafProfile("test.smallstep.com", iss, issPriv, WithTemplateMutator(nil)); err == nil {
+			t.Error("NewLeafProfile() error = nil, want error")
+		}
+		// Invalid names added by the mutator are rejected.
+		if _, err := NewLeafProfile("test.smallstep.com", iss, issPriv, WithTemplateMutator(func(crt *x509.Certificate) error {
+			crt.DNSNames = append(crt.DNSNames, "https://smallstep.com")
+			return nil
+		})); err == nil {
+			t.Error("NewLeafProfile() error = nil, want error")
+		}
+	})
+}
+
+func TestWithTemplateFunc_lastChance(t *testing.T) {
+	iss := mustParseCertificate(t, "test_files/noPasscodeCa.crt")
+	issPriv := mustParseRSAKey(t, "test_files/noPasscodeCa.key")
+
+	// The function runs after the options, even if it is added first.
+	p := mustNewProfile(t)(NewLeafProfile("test.smallstep.com", iss, issPriv,
+		WithTemplateFunc(func(crt *x509.Certificate) error {
+			crt.DNSNames = append(crt.DNSNames, "mutated.smallstep.com")
+			crt.AuthorityKeyId = []byte{1, 2, 3, 4}
+			return nil
+		}),
+		WithHosts("test.smallstep.com"),
+	))
+	cert := mustCreateCertificate(t, p)
+	if want := []string{"test.smallstep.com", "mutated.smallstep.com"}; !reflect.DeepEqual(cert.DNSNames, want) {
+		t.Errorf("DNSNames = %v, want %v", cert.DNSNames, want)
+	}
+	// The authority key identifier is recomputed when signing.
+	if !bytes.Equal(cert.AuthorityKeyId, iss.SubjectKeyId) {
+		t.Errorf("AuthorityKeyId = %x, want %x", cert.AuthorityKeyId, iss.SubjectKeyId)
+	}
+}
@@ -1,7 +1,9 @@
 package x509util
 
 import (
+	"crypto"
 	"crypto/x509"
+	"encoding/pem"
 	"os"
 
 	"github.com/pkg/errors"
@@ -42,3 +44,66 @@ func LoadIdentityFromDisk(crtPath, keyPath string, pemOpts ...pemutil.Options) (
 
 	return NewIdentity(crt, key), nil
 }
+
+// IssuerFromPEM returns the first certificate and the first private key in the
+// given PEM bundle. The private key can be a PKCS#1, PKCS#8 or EC key, and if it
+// is encrypted it will be decrypted using the given passphrase. It returns an
+// error if the bundle does not contain a certificate or a private key, or if
+// the private key does not match the certificate.
+func IssuerFromPEM(pemData []byte, passphrase []byte) (*x509.Certificate, crypto.PrivateKey, error) {
+	var (
+		crt *x509.Certificate
+		key crypto.PrivateKey
+		err error
+	)
+	for rest := pemData; crt == nil || key == nil; {
+		var block *pem.Block
+		if block, rest = pem.Decode(rest); block == nil {
+			break
+		}
+		switch block.Type {
+		case "CERTIFICATE":
+			if crt == nil {
+				if crt, err = x509.ParseCertificate(block.Bytes); err != nil {
+					return nil, nil, errors.Wrap(err, "error parsing certificate")
+				}
+			}
+		case "RSA PRIVATE KEY", "EC PRIVATE KEY", "PRIVATE KEY", "ENCRYPTED PRIVATE KEY":
+			if key == nil {
+				if key, err = parsePrivateKeyBlock(block, passphrase); err != nil {
+					return nil, nil, err
+				}
+			}
+		}
+	}
+	switch {
+	case crt == nil:
+		return nil, nil, errors.New("PEM bundle does not contain a certificate")
+	case key == nil:
+		return nil, nil, errors.New("PEM bundle does not contain a private key")
+	}
+	if err := validateIssuerKey(crt, key); err != nil {
+		return nil, nil, err
+	}
+	return crt, key, nil
+}
+
+// parsePrivateKeyBlock parses a private key PEM block, decrypting it with the
+// passphrase if necessary.
+func parsePrivateKeyBlock(block *pem.Block, passphrase []byte) (crypto.PrivateKey, error) {
+	encrypted := block.Headers["Proc-Type"] == "4,ENCRYPTED" || block.Type == "ENCRYPTED PRIVATE KEY"
+	if encrypted && len(passphrase) == 0 {
+		return nil, errors.New("error decrypting private key: passphrase is required")
+	}
+	key, err := pemutil.Parse(pem.EncodeToMemory(block), pemutil.WithFilename("private key"), pemutil.WithPassword(passphrase))
+	if err != nil && block.Type == "ENCRYPTED PRIVATE KEY" {
+		// Keys encrypted with EncryptedSubjectKeyPEM can use AES-GCM.
+		if k, e := DecryptSubjectKeyPEM(block, passphrase); e == nil {
+			return k, nil
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+	return key, nil
+}
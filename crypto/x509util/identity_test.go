@@ -1,6 +1,10 @@
 package x509util
 
 import (
+	"bytes"
+	"encoding/pem"
+	"os"
+	"strings"
 	"testing"
 
 	"github.com/pkg/errors"
@@ -66,3 +70,78 @@ func TestLoadIdentityFromDisk(t *testing.T) {
 		}
 	}
 }
+
+func TestIssuerFromPEM(t *testing.T) {
+	crtPEM, err := os.ReadFile("test_files/noPasscodeCa.crt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyPEM, err := os.ReadFile("test_files/noPasscodeCa.key")
+	if err != nil {
+		t.Fatal(err)
+	}
+	key := mustParseRSAKey(t, "test_files/noPasscodeCa.key")
+	pass := []byte("password")
+
+	mustSerialize := func(opts ...pemutil.Options) []byte {
+		block, err := pemutil.Serialize(key, opts...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return pem.EncodeToMemory(block)
+	}
+	concat := func(bs ...[]byte) []byte {
+		return bytes.Join(bs, nil)
+	}
+
+	p := mustNewProfile(t)(NewLeafProfile("leaf", mustParseCertificate(t, "test_files/noPasscodeCa.crt"), key, WithPublicKey(key.Public())))
+	p.SetSubjectPrivateKey(key)
+	gcmBlock, err := p.EncryptedSubjectKeyPEM(pass)
+	if err != nil {
+		t.Fatal(err)
+	}
+	otherKey := mustNewProfile(t)(NewRootProfile("other")).SubjectPrivateKey()
+	otherBlock, err := pemutil.Serialize(otherKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name       string
+		pemData    []byte
+		passphrase []byte
+		wantErr    string
+	}{
+		{"ok pkcs1", concat(crtPEM, keyPEM), nil, ""},
+		{"ok key first", concat(keyPEM, crtPEM), nil, ""},
+		{"ok pkcs8", concat(crtPEM, mustSerialize(pemutil.WithPKCS8(true))), nil, ""},
+		{"ok encrypted pkcs1", concat(crtPEM, mustSerialize(pemutil.WithPassword(pass))), pass, ""},
+		{"ok encrypted pkcs8", concat(crtPEM, mustSerialize(pemutil.WithPKCS8(true), pemutil.WithPassword(pass))), pass, ""},
+		{"ok encrypted gcm", concat(crtPEM, pem.EncodeToMemory(gcmBlock)), pass, ""},
+		{"fail no certificate", keyPEM, nil, "does not contain a certificate"},
+		{"fail no key", crtPEM, nil, "does not contain a private key"},
+		{"fail no passphrase", concat(crtPEM, mustSerialize(pemutil.WithPassword(pass))), nil, "passphrase is required"},
+		{"fail wrong passphrase", concat(crtPEM, mustSerialize(pemutil.WithPKCS8(true), pemutil.WithPassword(pass))), []byte("wrong"), "private key"},
+		{"fail key mismatch", concat(crtPEM, pem.EncodeToMemory(otherBlock)), nil, "does not match"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			crt, priv, err := IssuerFromPEM(tt.pemData, tt.passphrase)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("IssuerFromPEM() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("IssuerFromPEM() error = %v", err)
+			}
+			if crt.Subject.CommonName == "" {
+				t.Error("IssuerFromPEM() certificate does not have a subject")
+			}
+			if !key.Equal(priv) {
+				t.Error("IssuerFromPEM() private key does not match")
+			}
+		})
+	}
+}
@@ -4,7 +4,10 @@ import (
 	"crypto"
 	"crypto/x509"
 	"crypto/x509/pkix"
+	"encoding/asn1"
 	"time"
+
+	"github.com/pkg/errors"
 )
 
 // DefaultIntermediateCertValidity is the default validity of a intermediate certificate in the step PKI.
@@ -17,21 +20,96 @@ type Intermediate struct {
 
 // DefaultDuration returns the default Intermediate Certificate duration.
 func (i *Intermediate) DefaultDuration() time.Duration {
+	if i.defaultDuration > 0 {
+		return i.defaultDuration
+	}
 	return DefaultIntermediateCertValidity
 }
 
 // NewIntermediateProfile returns a new intermediate x509 Certificate profile.
+//
+// The intermediate has a path length of 0 by default and can only issue leaf
+// certificates, use WithMaxPathLen or WithNoPathLenConstraint to create
+// deeper hierarchies. The path length must be lower than the one of the
+// issuer unless WithSkipPathLenCheck is used.
 func NewIntermediateProfile(name string, iss *x509.Certificate, issPriv crypto.PrivateKey, withOps ...WithOption) (Profile, error) {
 	sub := defaultIntermediateTemplate(name)
 	return newProfile(&Intermediate{}, sub, iss, issPriv, withOps...)
 }
 
+// NewIntermediateProfileWithCSR returns a new intermediate x509 Certificate
+// profile with the subject and the public key of the given CSR. The signature
+// of the CSR is verified, and the intermediate defaults of
+// NewIntermediateProfile are applied.
+//
+// The extended key usage and basic constraints extensions requested in the
+// CSR are ignored unless the policy set with WithCSRExtensionPolicy keeps
+// them; a kept basic constraints extension must be the one of a CA, and sets
+// the path length of the certificate. Like in NewLeafProfileWithCSR, the
+// subject alternative names and the non-standard extensions are copied using
+// the policy.
+//
+// It returns an error matching ErrMissingPublicKey or ErrInvalidCSRSignature
+// if the CSR cannot be used.
+func NewIntermediateProfileWithCSR(csr *x509.CertificateRequest, iss *x509.Certificate, issPriv crypto.PrivateKey, withOps ...WithOption) (Profile, error) {
+	if csr == nil {
+		return nil, errors.New("CSR cannot be nil")
+	}
+	if csr.PublicKey == nil {
+		return nil, newError(ErrMissingPublicKey, "CSR must have PublicKey")
+	}
+	if err := csr.CheckSignature(); err != nil {
+		return nil, newError(ErrInvalidCSRSignature, "error validating CSR signature: %v", err)
+	}
+
+	sub := defaultIntermediateTemplate("")
+	sub.Subject = csr.Subject
+	sub.Issuer = iss.Subject
+	sub.ExtraExtensions = removeStdExtensions(csr.Extensions)
+	sub.DNSNames = csr.DNSNames
+	sub.EmailAddresses = csr.EmailAddresses
+	sub.IPAddresses = csr.IPAddresses
+	sub.URIs = csr.URIs
+
+	withOps = append(withOps, WithPublicKey(csr.PublicKey), withCSRExtensionPolicy(csr))
+	return newProfile(&Intermediate{}, sub, iss, issPriv, withOps...)
+}
+
+// applyCSRCAExtension sets the extended key usage or the basic constraints of
+// an intermediate certificate from an extension in the CSR kept by the CSR
+// extension policy. Other extensions are ignored.
+func applyCSRCAExtension(crt *x509.Certificate, ext pkix.Extension) error {
+	switch {
+	case ext.Id.Equal(oidExtExtendedKeyUsage):
+		var oids []asn1.ObjectIdentifier
+		if rest, err := asn1.Unmarshal(ext.Value, &oids); err != nil || len(rest) > 0 {
+			return errors.New("error parsing the extended key usage extension of the CSR")
+		}
+		crt.ExtKeyUsage, crt.UnknownExtKeyUsage = nil, nil
+		for _, oid := range oids {
+			if eku, ok := extKeyUsageFromOID(oid); ok {
+				crt.ExtKeyUsage = append(crt.ExtKeyUsage, eku)
+			} else {
+				crt.UnknownExtKeyUsage = append(crt.UnknownExtKeyUsage, oid)
+			}
+		}
+	case ext.Id.Equal(oidExtBasicConstraints):
+		var bc basicConstraints
+		if rest, err := asn1.Unmarshal(ext.Value, &bc); err != nil || len(rest) > 0 {
+			return errors.New("error parsing the basic constraints extension of the CSR")
+		}
+		if !bc.IsCA {
+			return errors.New("the basic constraints extension of the CSR is not the one of a CA")
+		}
+		crt.MaxPathLen = bc.MaxPathLen
+		crt.MaxPathLenZero = bc.MaxPathLen == 0
+	}
+	return nil
+}
+
 func defaultIntermediateTemplate(name string) *x509.Certificate {
-	notBefore := time.Now()
 	return &x509.Certificate{
 		IsCA:                  true,
-		NotBefore:             notBefore,
-		NotAfter:              notBefore.Add(DefaultIntermediateCertValidity),
 		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageCRLSign,
 		BasicConstraintsValid: true,
 		MaxPathLen:            0,
@@ -0,0 +1,160 @@
+package x509util
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"reflect"
+	"testing"
+)
+
+func TestNewIntermediateProfile_pathLen(t *testing.T) {
+	root := mustNewProfile(t)(NewRootProfile("Root", WithMaxPathLen(2)))
+	rootCert := mustCreateCertificate(t, root)
+
+	policyCA := mustNewProfile(t)(NewIntermediateProfile("Policy CA", rootCert, root.SubjectPrivateKey(), WithMaxPathLen(1)))
+	policyCACert := mustCreateCertificate(t, policyCA)
+
+	// The default path length is 0.
+	issuingCA := mustNewProfile(t)(NewIntermediateProfile("Issuing CA", policyCACert, policyCA.SubjectPrivateKey()))
+	issuingCACert := mustCreateCertificate(t, issuingCA)
+	if issuingCACert.MaxPathLen != 0 || !issuingCACert.MaxPathLenZero {
+		t.Errorf("issuing CA MaxPathLen = %d, MaxPathLenZero = %v, want 0 and true", issuingCACert.MaxPathLen, issuingCACert.MaxPathLenZero)
+	}
+
+	leaf := mustNewProfile(t)(NewLeafProfile("leaf.smallstep.com", issuingCACert, issuingCA.SubjectPrivateKey(), WithHosts("leaf.smallstep.com")))
+	leafCert := mustCreateCertificate(t, leaf)
+
+	roots := x509.NewCertPool()
+	roots.AddCert(rootCert)
+	intermediates := x509.NewCertPool()
+	intermediates.AddCert(policyCACert)
+	intermediates.AddCert(issuingCACert)
+	chains, err := leafCert.Verify(x509.VerifyOptions{
+		DNSName:       "leaf.smallstep.com",
+		Roots:         roots,
+		Intermediates: intermediates,
+	})
+	if err != nil {
+		t.Fatalf("Verify() error = %v", err)
+	}
+	if len(chains) != 1 || len(chains[0]) != 4 {
+		t.Errorf("Verify() chains = %v, want one chain of 4 certificates", chains)
+	}
+
+	// The issuing CA cannot issue another CA.
+	p := mustNewProfile(t)(NewIntermediateProfile("Sub CA", issuingCACert, issuingCA.SubjectPrivateKey()))
+	if _, err := p.CreateCertificate(); err == nil {
+		t.Error("CreateCertificate() error = nil, want error")
+	}
+	// The policy CA cannot issue a CA with the same path length.
+	p = mustNewProfile(t)(NewIntermediateProfile("Sub CA", policyCACert, policyCA.SubjectPrivateKey(), WithMaxPathLen(1)))
+	if _, err := p.CreateCertificate(); err == nil {
+		t.Error("CreateCertificate() error = nil, want error")
+	}
+}
+
+func TestNewIntermediateProfileWithCSR(t *testing.T) {
+	root := mustNewProfile(t)(NewRootProfile("Root"))
+	rootCert := mustCreateCertificate(t, root)
+
+	mustMarshal := func(v interface{}) []byte {
+		b, err := asn1.Marshal(v)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return b
+	}
+	ekuExt := pkix.Extension{Id: oidExtExtendedKeyUsage, Value: mustMarshal([]asn1.ObjectIdentifier{oidExtKeyUsageServerAuth, {1, 2, 3, 4}})}
+	mustCSR := func(exts ...pkix.Extension) (*x509.CertificateRequest, crypto.Signer) {
+		key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		if err != nil {
+			t.Fatal(err)
+		}
+		der, err := x509.CreateCertificateRequest(rand.Reader, &x509.CertificateRequest{
+			Subject:         pkix.Name{CommonName: "Intermediate CA", Organization: []string{"Smallstep"}},
+			ExtraExtensions: exts,
+		}, key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		csr, err := x509.ParseCertificateRequest(der)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return csr, key
+	}
+	keepAll := func(pkix.Extension) (bool, error) { return true, nil }
+
+	t.Run("ok", func(t *testing.T) {
+		csr, key := mustCSR(ekuExt, pkix.Extension{Id: oidExtBasicConstraints, Critical: true, Value: mustMarshal(basicConstraints{IsCA: true, MaxPathLen: 5})})
+		p := mustNewProfile(t)(NewIntermediateProfileWithCSR(csr, rootCert, root.SubjectPrivateKey()))
+		crt := mustCreateCertificate(t, p)
+		if !reflect.DeepEqual(crt.Subject.Organization, csr.Subject.Organization) || crt.Subject.CommonName != csr.Subject.CommonName {
+			t.Errorf("certificate subject = %s, want %s", crt.Subject, csr.Subject)
+		}
+		if !reflect.DeepEqual(crt.PublicKey, csr.PublicKey) {
+			t.Error("certificate public key does not match the CSR public key")
+		}
+		if !crt.IsCA || crt.MaxPathLen != 0 || !crt.MaxPathLenZero || crt.KeyUsage != x509.KeyUsageCertSign|x509.KeyUsageCRLSign {
+			t.Errorf("certificate IsCA = %v, MaxPathLen = %d, KeyUsage = %v, want an intermediate", crt.IsCA, crt.MaxPathLen, crt.KeyUsage)
+		}
+		if len(crt.ExtKeyUsage) > 0 || len(crt.UnknownExtKeyUsage) > 0 {
+			t.Errorf("certificate ExtKeyUsage = %v, %v, want none", crt.ExtKeyUsage, crt.UnknownExtKeyUsage)
+		}
+
+		// A leaf issued by the intermediate chains to the root.
+		leaf := mustNewProfile(t)(NewLeafProfile("leaf.smallstep.com", crt, key, WithHosts("leaf.smallstep.com")))
+		leafCert := mustCreateCertificate(t, leaf)
+		roots := x509.NewCertPool()
+		roots.AddCert(rootCert)
+		intermediates := x509.NewCertPool()
+		intermediates.AddCert(crt)
+		chains, err := leafCert.Verify(x509.VerifyOptions{
+			DNSName:       "leaf.smallstep.com",
+			Roots:         roots,
+			Intermediates: intermediates,
+		})
+		if err != nil {
+			t.Fatalf("Verify() error = %v", err)
+		}
+		if len(chains) != 1 || len(chains[0]) != 3 {
+			t.Errorf("Verify() chains = %v, want one chain of 3 certificates", chains)
+		}
+	})
+
+	t.Run("ok/whitelisted", func(t *testing.T) {
+		csr, _ := mustCSR(ekuExt, pkix.Extension{Id: oidExtBasicConstraints, Critical: true, Value: mustMarshal(basicConstraints{IsCA: true, MaxPathLen: 0})})
+		p := mustNewProfile(t)(NewIntermediateProfileWithCSR(csr, rootCert, root.SubjectPrivateKey(), WithCSRExtensionPolicy(keepAll)))
+		crt := mustCreateCertificate(t, p)
+		if !reflect.DeepEqual(crt.ExtKeyUsage, []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth}) ||
+			!reflect.DeepEqual(crt.UnknownExtKeyUsage, []asn1.ObjectIdentifier{{1, 2, 3, 4}}) {
+			t.Errorf("certificate ExtKeyUsage = %v, %v, want the CSR ones", crt.ExtKeyUsage, crt.UnknownExtKeyUsage)
+		}
+		if !crt.IsCA || crt.MaxPathLen != 0 || !crt.MaxPathLenZero {
+			t.Errorf("certificate IsCA = %v, MaxPathLen = %d, want a CA with path length 0", crt.IsCA, crt.MaxPathLen)
+		}
+	})
+
+	t.Run("fail/not-ca", func(t *testing.T) {
+		csr, _ := mustCSR(pkix.Extension{Id: oidExtBasicConstraints, Critical: true, Value: mustMarshal(basicConstraints{IsCA: false})})
+		if _, err := NewIntermediateProfileWithCSR(csr, rootCert, root.SubjectPrivateKey(), WithCSRExtensionPolicy(keepAll)); err == nil {
+			t.Error("NewIntermediateProfileWithCSR() error = nil, want error")
+		}
+	})
+	t.Run("fail/signature", func(t *testing.T) {
+		csr := mustLoadCSR(t, "test_files/badsig.csr")
+		if _, err := NewIntermediateProfileWithCSR(csr, rootCert, root.SubjectPrivateKey()); err == nil {
+			t.Error("NewIntermediateProfileWithCSR() error = nil, want error")
+		}
+	})
+	t.Run("fail/nil", func(t *testing.T) {
+		if _, err := NewIntermediateProfileWithCSR(nil, rootCert, root.SubjectPrivateKey()); err == nil {
+			t.Error("NewIntermediateProfileWithCSR() error = nil, want error")
+		}
+	})
+}
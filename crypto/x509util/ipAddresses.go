@@ -0,0 +1,96 @@
+package x509util
+
+import (
+	"crypto/x509"
+	"fmt"
+	"net"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// IPSANPolicy is the policy used to validate the IP addresses in the subject
+// alternative names.
+type IPSANPolicy int
+
+const (
+	// IPSANPolicyAllowInternal allows private, link-local and loopback
+	// addresses. This is the default.
+	IPSANPolicyAllowInternal IPSANPolicy = iota + 1
+	// IPSANPolicyPublicOnly rejects private (RFC 1918 and RFC 4193),
+	// link-local and loopback addresses.
+	IPSANPolicyPublicOnly
+)
+
+// WithIPSANPolicy returns a Profile modifier that sets the policy used to
+// validate the IP addresses of the certificate. With both policies, the
+// unspecified addresses, 0.0.0.0 and ::, and the multicast addresses are
+// rejected.
+//
+// The IP addresses are validated after all the modifiers have been applied,
+// including the addresses copied from a CSR. IPv4-mapped IPv6 addresses are
+// converted to their IPv4 form, and repeated addresses are removed.
+func WithIPSANPolicy(policy IPSANPolicy) WithOption {
+	return func(p Profile) error {
+		if policy != IPSANPolicyAllowInternal && policy != IPSANPolicyPublicOnly {
+			return errors.Errorf("unsupported IP SAN policy %d", policy)
+		}
+		b, err := getBase(p)
+		if err != nil {
+			return err
+		}
+		b.ipSANPolicy = policy
+		return nil
+	}
+}
+
+// validateIPAddresses validates the IP addresses of the given template using
+// the IP SAN policy of the profile, and replaces them with the normalized
+// ones.
+func (b *base) validateIPAddresses(crt *x509.Certificate) error {
+	if len(crt.IPAddresses) == 0 {
+		return nil
+	}
+	var invalid []string
+	var ips []net.IP
+	for _, ip := range crt.IPAddresses {
+		s, err := normalizeIPAddress(ip, b.ipSANPolicy == IPSANPolicyPublicOnly)
+		if err != nil {
+			invalid = append(invalid, fmt.Sprintf("%s (%v)", ip, err))
+			continue
+		}
+		ips = appendIfMissingIP(ips, s)
+	}
+	if len(invalid) > 0 {
+		return errors.Errorf("invalid IP addresses: %s", strings.Join(invalid, ", "))
+	}
+	crt.IPAddresses = ips
+	return nil
+}
+
+// normalizeIPAddress returns the given IP address in its 4-byte form if it is
+// an IPv4 or IPv4-mapped IPv6 address. It returns an error if the address is
+// not valid, or if it is not a public address and publicOnly is set.
+func normalizeIPAddress(ip net.IP, publicOnly bool) (net.IP, error) {
+	if v4 := ip.To4(); v4 != nil {
+		ip = v4
+	} else if len(ip) != net.IPv6len {
+		return nil, errors.New("invalid length")
+	}
+	switch {
+	case ip.IsUnspecified():
+		return nil, errors.New("unspecified address")
+	case ip.IsMulticast():
+		return nil, errors.New("multicast address")
+	case !publicOnly:
+		return ip, nil
+	case ip.IsLoopback():
+		return nil, errors.New("loopback address")
+	case ip.IsLinkLocalUnicast():
+		return nil, errors.New("link-local address")
+	case ip.IsPrivate():
+		return nil, errors.New("private address")
+	default:
+		return ip, nil
+	}
+}
@@ -0,0 +1,120 @@
+package x509util
+
+import (
+	"crypto/x509"
+	"net"
+	"reflect"
+	"testing"
+)
+
+func TestNormalizeIPAddress(t *testing.T) {
+	tests := []struct {
+		name       string
+		ip         net.IP
+		want       net.IP
+		wantErr    bool
+		publicOnly bool
+	}{
+		{"public v4", net.ParseIP("1.1.1.1"), net.IP{1, 1, 1, 1}, false, false},
+		{"public v6", net.ParseIP("2606:4700::1111"), net.ParseIP("2606:4700::1111"), false, false},
+		{"v4 bytes", net.IP{8, 8, 8, 8}, net.IP{8, 8, 8, 8}, false, false},
+		{"v4-mapped v6", net.ParseIP("::ffff:8.8.8.8"), net.IP{8, 8, 8, 8}, false, false},
+		{"private 10/8", net.ParseIP("10.0.0.1"), net.IP{10, 0, 0, 1}, false, true},
+		{"private 172.16/12", net.ParseIP("172.16.5.4"), net.IP{172, 16, 5, 4}, false, true},
+		{"private 192.168/16", net.ParseIP("192.168.1.1"), net.IP{192, 168, 1, 1}, false, true},
+		{"private fc00::/7", net.ParseIP("fd00::1"), net.ParseIP("fd00::1"), false, true},
+		{"private v4-mapped", net.ParseIP("::ffff:10.0.0.1"), net.IP{10, 0, 0, 1}, false, true},
+		{"loopback v4", net.ParseIP("127.0.0.1"), net.IP{127, 0, 0, 1}, false, true},
+		{"loopback v6", net.ParseIP("::1"), net.ParseIP("::1"), false, true},
+		{"link-local v4", net.ParseIP("169.254.1.1"), net.IP{169, 254, 1, 1}, false, true},
+		{"link-local v6", net.ParseIP("fe80::1"), net.ParseIP("fe80::1"), false, true},
+		{"unspecified v4", net.ParseIP("0.0.0.0"), nil, true, true},
+		{"unspecified v6", net.ParseIP("::"), nil, true, true},
+		{"multicast v4", net.ParseIP("224.0.0.1"), nil, true, true},
+		{"multicast v6", net.ParseIP("ff02::1"), nil, true, true},
+		{"invalid length", net.IP{1, 2, 3}, nil, true, true},
+		{"nil", nil, nil, true, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := normalizeIPAddress(tt.ip, false)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("normalizeIPAddress() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("normalizeIPAddress() = %v, want %v", got, tt.want)
+			}
+			got, err = normalizeIPAddress(tt.ip, true)
+			if (err != nil) != (tt.wantErr || tt.publicOnly) {
+				t.Fatalf("normalizeIPAddress() public only error = %v, wantErr %v", err, tt.wantErr || tt.publicOnly)
+			}
+			if err == nil && !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("normalizeIPAddress() public only = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestWithIPSANPolicy(t *testing.T) {
+	iss := mustParseCertificate(t, "test_files/noPasscodeCa.crt")
+	issPriv := mustParseRSAKey(t, "test_files/noPasscodeCa.key")
+
+	tests := []struct {
+		name    string
+		options []WithOption
+		want    []net.IP
+		wantErr bool
+	}{
+		{"ok/default", []WithOption{WithSANs([]string{"10.0.0.1", "127.0.0.1", "fe80::1", "1.1.1.1"})},
+			[]net.IP{{10, 0, 0, 1}, {127, 0, 0, 1}, net.ParseIP("fe80::1"), {1, 1, 1, 1}}, false},
+		{"ok/allow-internal", []WithOption{WithIPSANPolicy(IPSANPolicyAllowInternal), WithHosts("192.168.1.1,::1")},
+			[]net.IP{{192, 168, 1, 1}, net.ParseIP("::1")}, false},
+		{"ok/public-only", []WithOption{WithIPSANPolicy(IPSANPolicyPublicOnly), WithHosts("1.1.1.1,2606:4700::1111")},
+			[]net.IP{{1, 1, 1, 1}, net.ParseIP("2606:4700::1111")}, false},
+		{"ok/duplicates", []WithOption{WithIPAddresses([]net.IP{net.ParseIP("::ffff:1.1.1.1"), {1, 1, 1, 1}, net.ParseIP("1.1.1.1")})},
+			[]net.IP{{1, 1, 1, 1}}, false},
+		{"ok/template-func", []WithOption{WithTemplateFunc(func(crt *x509.Certificate) error {
+			crt.IPAddresses = append(crt.IPAddresses, net.ParseIP("::ffff:10.0.0.1"))
+			return nil
+		})}, []net.IP{{10, 0, 0, 1}}, false},
+		{"fail/unspecified", []WithOption{WithHosts("0.0.0.0")}, nil, true},
+		{"fail/unspecified-v6", []WithOption{WithHosts("::")}, nil, true},
+		{"fail/multicast", []WithOption{WithIPSANPolicy(IPSANPolicyAllowInternal), WithHosts("239.1.1.1")}, nil, true},
+		{"fail/public-only-private", []WithOption{WithIPSANPolicy(IPSANPolicyPublicOnly), WithHosts("172.16.0.1")}, nil, true},
+		{"fail/public-only-loopback", []WithOption{WithIPSANPolicy(IPSANPolicyPublicOnly), WithHosts("127.0.0.1")}, nil, true},
+		{"fail/public-only-link-local", []WithOption{WithIPSANPolicy(IPSANPolicyPublicOnly), WithHosts("169.254.0.1")}, nil, true},
+		{"fail/public-only-mapped", []WithOption{WithIPSANPolicy(IPSANPolicyPublicOnly), WithHosts("::ffff:192.168.0.1")}, nil, true},
+		{"fail/policy", []WithOption{WithIPSANPolicy(0)}, nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, err := NewLeafProfile("test.smallstep.com", iss, issPriv, tt.options...)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("NewLeafProfile() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			crt := mustCreateCertificate(t, p)
+			if len(crt.IPAddresses) != len(tt.want) {
+				t.Fatalf("IPAddresses = %v, want %v", crt.IPAddresses, tt.want)
+			}
+			for i, ip := range crt.IPAddresses {
+				if !ip.Equal(tt.want[i]) {
+					t.Errorf("IPAddresses = %v, want %v", crt.IPAddresses, tt.want)
+				}
+			}
+			if got := p.Subject().IPAddresses; !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Subject().IPAddresses = %#v, want %#v", got, tt.want)
+			}
+		})
+	}
+
+	t.Run("fail/csr", func(t *testing.T) {
+		csr := mustLoadCSR(t, "test_files/test.smallstep.com.csr")
+		csr.IPAddresses = []net.IP{net.ParseIP("192.168.0.1")}
+		if _, err := NewLeafProfileWithCSR(csr, iss, issPriv, WithIPSANPolicy(IPSANPolicyPublicOnly)); err == nil {
+			t.Error("NewLeafProfileWithCSR() error = nil, want error")
+		}
+	})
+}
@@ -0,0 +1,346 @@
+package x509util
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/json"
+	"net"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// keyUsageNames maps the names of the key usages, in lower case, to their
+// values.
+var keyUsageNames = map[string]x509.KeyUsage{
+	"digitalsignature":  x509.KeyUsageDigitalSignature,
+	"contentcommitment": x509.KeyUsageContentCommitment,
+	"nonrepudiation":    x509.KeyUsageContentCommitment,
+	"keyencipherment":   x509.KeyUsageKeyEncipherment,
+	"dataencipherment":  x509.KeyUsageDataEncipherment,
+	"keyagreement":      x509.KeyUsageKeyAgreement,
+	"keycertsign":       x509.KeyUsageCertSign,
+	"crlsign":           x509.KeyUsageCRLSign,
+	"encipheronly":      x509.KeyUsageEncipherOnly,
+	"decipheronly":      x509.KeyUsageDecipherOnly,
+}
+
+// extKeyUsageNames maps the names of the extended key usages, in lower case,
+// to their values.
+var extKeyUsageNames = map[string]x509.ExtKeyUsage{
+	"any":                            x509.ExtKeyUsageAny,
+	"serverauth":                     x509.ExtKeyUsageServerAuth,
+	"clientauth":                     x509.ExtKeyUsageClientAuth,
+	"codesigning":                    x509.ExtKeyUsageCodeSigning,
+	"emailprotection":                x509.ExtKeyUsageEmailProtection,
+	"ipsecendsystem":                 x509.ExtKeyUsageIPSECEndSystem,
+	"ipsectunnel":                    x509.ExtKeyUsageIPSECTunnel,
+	"ipsecuser":                      x509.ExtKeyUsageIPSECUser,
+	"timestamping":                   x509.ExtKeyUsageTimeStamping,
+	"ocspsigning":                    x509.ExtKeyUsageOCSPSigning,
+	"microsoftservergatedcrypto":     x509.ExtKeyUsageMicrosoftServerGatedCrypto,
+	"netscapeservergatedcrypto":      x509.ExtKeyUsageNetscapeServerGatedCrypto,
+	"microsoftcommercialcodesigning": x509.ExtKeyUsageMicrosoftCommercialCodeSigning,
+	"microsoftkernelcodesigning":     x509.ExtKeyUsageMicrosoftKernelCodeSigning,
+}
+
+// jsonTemplate is the JSON representation of a certificate template.
+type jsonTemplate struct {
+	Subject          *jsonName             `json:"subject"`
+	DNSNames         []string              `json:"dnsNames"`
+	EmailAddresses   []string              `json:"emailAddresses"`
+	IPAddresses      []string              `json:"ipAddresses"`
+	URIs             []string              `json:"uris"`
+	KeyUsage         []string              `json:"keyUsage"`
+	ExtKeyUsage      []string              `json:"extKeyUsage"`
+	BasicConstraints *jsonBasicConstraints `json:"basicConstraints"`
+	Validity         string                `json:"validity"`
+	Extensions       []jsonExtension       `json:"extensions"`
+}
+
+type jsonName struct {
+	CommonName         string   `json:"commonName"`
+	SerialNumber       string   `json:"serialNumber"`
+	Country            []string `json:"country"`
+	Organization       []string `json:"organization"`
+	OrganizationalUnit []string `json:"organizationalUnit"`
+	Locality           []string `json:"locality"`
+	Province           []string `json:"province"`
+	StreetAddress      []string `json:"streetAddress"`
+	PostalCode         []string `json:"postalCode"`
+}
+
+// jsonBasicConstraints are the basic constraints of the template. A nil
+// maxPathLen leaves the path length unconstrained.
+type jsonBasicConstraints struct {
+	IsCA       bool `json:"isCA"`
+	MaxPathLen *int `json:"maxPathLen"`
+}
+
+// jsonExtension is an extension with a base64 encoded DER value.
+type jsonExtension struct {
+	ID       string `json:"id"`
+	Critical bool   `json:"critical"`
+	Value    []byte `json:"value"`
+}
+
+// TemplateFromJSON returns a certificate template from the given JSON
+// document. The document can contain the following fields:
+//
+//	{
+//	  "subject": {"commonName": "...", "organization": ["..."], ...},
+//	  "dnsNames": ["..."], "emailAddresses": ["..."],
+//	  "ipAddresses": ["..."], "uris": ["..."],
+//	  "keyUsage": ["digitalSignature", "keyEncipherment"],
+//	  "extKeyUsage": ["serverAuth", "clientAuth"],
+//	  "basicConstraints": {"isCA": true, "maxPathLen": 0},
+//	  "validity": "24h",
+//	  "extensions": [{"id": "1.2.3.4", "critical": false, "value": "BQA="}]
+//	}
+//
+// Key usages and extended key usages are matched case-insensitively, and
+// extended key usages can also be object identifiers. Extensions have a base64
+// encoded DER value. Unknown fields are not allowed.
+//
+// If the validity is set, the template is valid from now, use one of the
+// JSON profile constructors to set the validity using the profile clock.
+func TemplateFromJSON(data []byte) (*x509.Certificate, error) {
+	tpl, d, err := parseJSONTemplate(data)
+	if err != nil {
+		return nil, err
+	}
+	if d > 0 {
+		tpl.NotBefore = time.Now()
+		tpl.NotAfter = tpl.NotBefore.Add(d)
+	}
+	return tpl, nil
+}
+
+// NewLeafProfileWithJSONTemplate returns a new leaf x509 Certificate profile
+// using the template in the given JSON document. See TemplateFromJSON for the
+// format of the document.
+//
+// A new public/private key pair will be generated for the Profile if
+// not set in the `withOps` profile modifiers.
+func NewLeafProfileWithJSONTemplate(data []byte, iss *x509.Certificate, issPriv crypto.PrivateKey, withOps ...WithOption) (Profile, error) {
+	sub, withOps, err := newJSONTemplate(data, withOps)
+	if err != nil {
+		return nil, err
+	}
+	sub.Issuer = iss.Subject
+	return newProfile(&Leaf{}, sub, iss, issPriv, withOps...)
+}
+
+// NewIntermediateProfileWithJSONTemplate returns a new intermediate x509
+// Certificate profile using the template in the given JSON document. See
+// TemplateFromJSON for the format of the document.
+func NewIntermediateProfileWithJSONTemplate(data []byte, iss *x509.Certificate, issPriv crypto.PrivateKey, withOps ...WithOption) (Profile, error) {
+	sub, withOps, err := newJSONTemplate(data, withOps)
+	if err != nil {
+		return nil, err
+	}
+	sub.Issuer = iss.Subject
+	return newProfile(&Intermediate{}, sub, iss, issPriv, withOps...)
+}
+
+// NewRootProfileWithJSONTemplate returns a new root x509 Certificate profile
+// using the template in the given JSON document. See TemplateFromJSON for the
+// format of the document.
+func NewRootProfileWithJSONTemplate(data []byte, withOps ...WithOption) (Profile, error) {
+	sub, withOps, err := newJSONTemplate(data, withOps)
+	if err != nil {
+		return nil, err
+	}
+	sub.Issuer = sub.Subject
+	return NewRootProfileWithTemplate(sub, withOps...)
+}
+
+// newJSONTemplate parses the JSON template and returns it with the options
+// prepended with the validity of the template.
+func newJSONTemplate(data []byte, withOps []WithOption) (*x509.Certificate, []WithOption, error) {
+	sub, d, err := parseJSONTemplate(data)
+	if err != nil {
+		return nil, nil, err
+	}
+	if d > 0 {
+		withOps = append([]WithOption{WithValidity(d)}, withOps...)
+	}
+	return sub, withOps, nil
+}
+
+// parseJSONTemplate returns the template and validity in the JSON document.
+func parseJSONTemplate(data []byte) (*x509.Certificate, time.Duration, error) {
+	var v jsonTemplate
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&v); err != nil {
+		return nil, 0, errors.Wrap(err, "error parsing JSON template")
+	}
+	if dec.More() {
+		return nil, 0, errors.New("error parsing JSON template: unexpected data after the template")
+	}
+
+	crt := new(x509.Certificate)
+	if v.Subject != nil {
+		crt.Subject = pkix.Name{
+			CommonName:         v.Subject.CommonName,
+			SerialNumber:       v.Subject.SerialNumber,
+			Country:            v.Subject.Country,
+			Organization:       v.Subject.Organization,
+			OrganizationalUnit: v.Subject.OrganizationalUnit,
+			Locality:           v.Subject.Locality,
+			Province:           v.Subject.Province,
+			StreetAddress:      v.Subject.StreetAddress,
+			PostalCode:         v.Subject.PostalCode,
+		}
+	}
+
+	// Subject alternative names
+	crt.DNSNames = v.DNSNames
+	crt.EmailAddresses = v.EmailAddresses
+	for _, s := range v.IPAddresses {
+		ip := net.ParseIP(s)
+		if ip == nil {
+			return nil, 0, errors.Errorf("error parsing JSON template: invalid IP address %q", s)
+		}
+		crt.IPAddresses = append(crt.IPAddresses, ip)
+	}
+	for _, s := range v.URIs {
+		u, err := url.Parse(s)
+		if err != nil {
+			return nil, 0, errors.Wrapf(err, "error parsing JSON template: invalid URI %q", s)
+		}
+		crt.URIs = append(crt.URIs, u)
+	}
+
+	// Key usages
+	for _, s := range v.KeyUsage {
+		ku, err := parseKeyUsage(s)
+		if err != nil {
+			return nil, 0, errors.Wrap(err, "error parsing JSON template")
+		}
+		crt.KeyUsage |= ku
+	}
+	for _, s := range v.ExtKeyUsage {
+		eku, oid, err := parseExtKeyUsage(s)
+		if err != nil {
+			return nil, 0, errors.Wrap(err, "error parsing JSON template")
+		}
+		if oid != nil {
+			crt.UnknownExtKeyUsage = append(crt.UnknownExtKeyUsage, oid)
+		} else {
+			crt.ExtKeyUsage = append(crt.ExtKeyUsage, eku)
+		}
+	}
+
+	// Basic constraints
+	if bc := v.BasicConstraints; bc != nil {
+		crt.BasicConstraintsValid = true
+		crt.IsCA = bc.IsCA
+		switch {
+		case !bc.IsCA:
+			crt.MaxPathLen = 0
+		case bc.MaxPathLen == nil || *bc.MaxPathLen < 0:
+			crt.MaxPathLen = -1
+		default:
+			crt.MaxPathLen = *bc.MaxPathLen
+			crt.MaxPathLenZero = *bc.MaxPathLen == 0
+		}
+	}
+
+	// Validity
+	var d time.Duration
+	if v.Validity != "" {
+		var err error
+		if d, err = time.ParseDuration(v.Validity); err != nil {
+			return nil, 0, errors.Wrapf(err, "error parsing JSON template: invalid validity %q", v.Validity)
+		}
+		if d <= 0 {
+			return nil, 0, errors.Errorf("error parsing JSON template: validity must be greater than 0, got %s", v.Validity)
+		}
+	}
+
+	// Extensions
+	for _, e := range v.Extensions {
+		oid, err := parseObjectIdentifier(e.ID)
+		if err != nil {
+			return nil, 0, errors.Wrapf(err, "error parsing JSON template: invalid extension id %q", e.ID)
+		}
+		ext := pkix.Extension{Id: oid, Critical: e.Critical, Value: e.Value}
+		if err := validateExtraExtension(ext); err != nil {
+			return nil, 0, errors.Wrap(err, "error parsing JSON template")
+		}
+		if hasExtension(crt.ExtraExtensions, oid) {
+			return nil, 0, errors.Errorf("error parsing JSON template: extension %s is duplicated", oid)
+		}
+		crt.ExtraExtensions = append(crt.ExtraExtensions, ext)
+	}
+
+	return crt, d, nil
+}
+
+// parseObjectIdentifier parses an object identifier in dot notation.
+func parseObjectIdentifier(s string) (asn1.ObjectIdentifier, error) {
+	parts := strings.Split(s, ".")
+	if len(parts) < 2 {
+		return nil, errors.Errorf("invalid object identifier %q", s)
+	}
+	oid := make(asn1.ObjectIdentifier, len(parts))
+	for i, p := range parts {
+		n, err := strconv.Atoi(p)
+		if err != nil || n < 0 {
+			return nil, errors.Errorf("invalid object identifier %q", s)
+		}
+		oid[i] = n
+	}
+	return oid, nil
+}
+
+// parseKeyUsage returns the key usage with the given case-insensitive name.
+func parseKeyUsage(s string) (x509.KeyUsage, error) {
+	ku, ok := keyUsageNames[strings.ToLower(s)]
+	if !ok {
+		return 0, errors.Errorf("unknown key usage %q, valid names are %s", s, keyUsageList())
+	}
+	return ku, nil
+}
+
+// parseExtKeyUsage returns the extended key usage with the given
+// case-insensitive name, or the object identifier if s is not a known name.
+func parseExtKeyUsage(s string) (x509.ExtKeyUsage, asn1.ObjectIdentifier, error) {
+	if eku, ok := extKeyUsageNames[strings.ToLower(s)]; ok {
+		return eku, nil, nil
+	}
+	oid, err := parseObjectIdentifier(s)
+	if err != nil {
+		return 0, nil, errors.Errorf("unknown extended key usage %q, valid names are %s or an object identifier", s, extKeyUsageList())
+	}
+	return 0, oid, nil
+}
+
+// keyUsageList returns the sorted list of valid key usage names.
+func keyUsageList() string {
+	names := make([]string, 0, len(keyUsageNames))
+	for k := range keyUsageNames {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+	return strings.Join(names, ", ")
+}
+
+// extKeyUsageList returns the sorted list of valid extended key usage names.
+func extKeyUsageList() string {
+	names := make([]string, 0, len(extKeyUsageNames))
+	for k := range extKeyUsageNames {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+	return strings.Join(names, ", ")
+}
@@ -0,0 +1,134 @@
+package x509util
+
+import (
+	"crypto/x509"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func mustReadFile(t *testing.T, filename string) []byte {
+	t.Helper()
+	b, err := os.ReadFile(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
+
+func TestTemplateFromJSON(t *testing.T) {
+	tests := []struct {
+		name    string
+		data    string
+		want    func(*x509.Certificate) bool
+		wantErr string
+	}{
+		{"ok", `{"subject":{"commonName":"test","organization":["Smallstep"]},"dnsNames":["test.smallstep.com"],"ipAddresses":["127.0.0.1"],"uris":["spiffe://smallstep.com/test"],"emailAddresses":["test@smallstep.com"]}`, func(crt *x509.Certificate) bool {
+			return crt.Subject.CommonName == "test" && reflect.DeepEqual(crt.Subject.Organization, []string{"Smallstep"}) &&
+				reflect.DeepEqual(crt.DNSNames, []string{"test.smallstep.com"}) && len(crt.IPAddresses) == 1 &&
+				len(crt.URIs) == 1 && reflect.DeepEqual(crt.EmailAddresses, []string{"test@smallstep.com"})
+		}, ""},
+		{"ok case insensitive", `{"keyUsage":["DIGITALSIGNATURE","keyencipherment"],"extKeyUsage":["ServerAuth","1.2.3.4"]}`, func(crt *x509.Certificate) bool {
+			return crt.KeyUsage == x509.KeyUsageDigitalSignature|x509.KeyUsageKeyEncipherment &&
+				reflect.DeepEqual(crt.ExtKeyUsage, []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth}) &&
+				len(crt.UnknownExtKeyUsage) == 1 && crt.UnknownExtKeyUsage[0].String() == "1.2.3.4"
+		}, ""},
+		{"ok basic constraints", `{"basicConstraints":{"isCA":true}}`, func(crt *x509.Certificate) bool {
+			return crt.BasicConstraintsValid && crt.IsCA && crt.MaxPathLen == -1
+		}, ""},
+		{"ok validity", `{"validity":"1h"}`, func(crt *x509.Certificate) bool {
+			return crt.NotAfter.Sub(crt.NotBefore) == time.Hour
+		}, ""},
+		{"ok extension", `{"extensions":[{"id":"1.2.3.4","critical":true,"value":"BQA="}]}`, func(crt *x509.Certificate) bool {
+			return len(crt.ExtraExtensions) == 1 && crt.ExtraExtensions[0].Critical &&
+				reflect.DeepEqual(crt.ExtraExtensions[0].Value, []byte{0x05, 0x00})
+		}, ""},
+		{"fail unknown field", `{"commonName":"test"}`, nil, `unknown field "commonName"`},
+		{"fail key usage", `{"keyUsage":["digitalSignatur"]}`, nil, `unknown key usage "digitalSignatur", valid names are contentcommitment, crlsign`},
+		{"fail ext key usage", `{"extKeyUsage":["serverAuh"]}`, nil, `unknown extended key usage "serverAuh", valid names are any, clientauth`},
+		{"fail ip", `{"ipAddresses":["foo"]}`, nil, `invalid IP address "foo"`},
+		{"fail validity", `{"validity":"-1h"}`, nil, "validity must be greater than 0"},
+		{"fail extension id", `{"extensions":[{"id":"foo","value":"BQA="}]}`, nil, `invalid extension id "foo"`},
+		{"fail std extension", `{"extensions":[{"id":"2.5.29.17","value":"BQA="}]}`, nil, "2.5.29.17"},
+		{"fail duplicated extension", `{"extensions":[{"id":"1.2.3.4","value":"BQA="},{"id":"1.2.3.4","value":"BQA="}]}`, nil, "extension 1.2.3.4 is duplicated"},
+		{"fail trailing data", `{}{}`, nil, "unexpected data after the template"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := TemplateFromJSON([]byte(tt.data))
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("TemplateFromJSON() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("TemplateFromJSON() error = %v", err)
+			}
+			if !tt.want(got) {
+				t.Errorf("TemplateFromJSON() = %+v", got)
+			}
+		})
+	}
+}
+
+func TestJSONTemplate_defaults(t *testing.T) {
+	iss := mustParseCertificate(t, "test_files/noPasscodeCa.crt")
+	issPriv := mustParseRSAKey(t, "test_files/noPasscodeCa.key")
+	pub := mustParseCertificate(t, "test_files/ca.crt").PublicKey
+
+	tests := []struct {
+		name     string
+		fixture  string
+		fromJSON func([]byte) (Profile, error)
+		defaults func() (Profile, error)
+	}{
+		{"leaf", "test_files/templates/leaf.json", func(b []byte) (Profile, error) {
+			return NewLeafProfileWithJSONTemplate(b, iss, issPriv, WithPublicKey(pub))
+		}, func() (Profile, error) {
+			return NewLeafProfile("leaf", iss, issPriv, WithHosts("leaf.example.com"), WithPublicKey(pub))
+		}},
+		{"intermediate", "test_files/templates/intermediate.json", func(b []byte) (Profile, error) {
+			return NewIntermediateProfileWithJSONTemplate(b, iss, issPriv, WithSkipPathLenCheck(), WithAllowIssuerValidityMismatch())
+		}, func() (Profile, error) {
+			return NewIntermediateProfile("intermediate", iss, issPriv, WithSkipPathLenCheck(), WithAllowIssuerValidityMismatch())
+		}},
+		{"root", "test_files/templates/root.json", func(b []byte) (Profile, error) {
+			return NewRootProfileWithJSONTemplate(b)
+		}, func() (Profile, error) {
+			return NewRootProfile("root")
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := mustCreateCertificate(t, mustNewProfile(t)(tt.fromJSON(mustReadFile(t, tt.fixture))))
+			want := mustCreateCertificate(t, mustNewProfile(t)(tt.defaults()))
+			if !reflect.DeepEqual(got.Subject, want.Subject) {
+				t.Errorf("Subject = %v, want %v", got.Subject, want.Subject)
+			}
+			if !reflect.DeepEqual(got.Issuer, want.Issuer) {
+				t.Errorf("Issuer = %v, want %v", got.Issuer, want.Issuer)
+			}
+			if !reflect.DeepEqual(got.DNSNames, want.DNSNames) {
+				t.Errorf("DNSNames = %v, want %v", got.DNSNames, want.DNSNames)
+			}
+			if got.KeyUsage != want.KeyUsage {
+				t.Errorf("KeyUsage = %v, want %v", got.KeyUsage, want.KeyUsage)
+			}
+			if !reflect.DeepEqual(got.ExtKeyUsage, want.ExtKeyUsage) {
+				t.Errorf("ExtKeyUsage = %v, want %v", got.ExtKeyUsage, want.ExtKeyUsage)
+			}
+			if got.BasicConstraintsValid != want.BasicConstraintsValid || got.IsCA != want.IsCA ||
+				got.MaxPathLen != want.MaxPathLen || got.MaxPathLenZero != want.MaxPathLenZero {
+				t.Errorf("BasicConstraints = {%v %v %d %v}, want {%v %v %d %v}",
+					got.BasicConstraintsValid, got.IsCA, got.MaxPathLen, got.MaxPathLenZero,
+					want.BasicConstraintsValid, want.IsCA, want.MaxPathLen, want.MaxPathLenZero)
+			}
+			if d, w := got.NotAfter.Sub(got.NotBefore), want.NotAfter.Sub(want.NotBefore); d != w {
+				t.Errorf("validity = %s, want %s", d, w)
+			}
+		})
+	}
+}
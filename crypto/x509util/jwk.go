@@ -0,0 +1,67 @@
+package x509util
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+
+	"github.com/pkg/errors"
+	"github.com/smallstep/cli/jose"
+)
+
+// SubjectKeyJWK returns the subject public key of the profile as a JSON Web
+// Key. RSA, ECDSA keys using the P-256, P-384 or P-521 curves, and Ed25519
+// keys are supported. The key ID is the subject key identifier of the
+// certificate encoded using base64url without padding.
+func (b *base) SubjectKeyJWK() ([]byte, error) {
+	pub := b.SubjectPublicKey()
+	if pub == nil {
+		return nil, newError(ErrMissingPublicKey, "profile does not have a subject public key")
+	}
+	return b.marshalJWK(pub)
+}
+
+// SubjectPrivateKeyJWK returns the subject private key of the profile as a
+// JSON Web Key, it supports the same keys as SubjectKeyJWK. Keys that cannot
+// be exported, like the ones in an HSM, return an error.
+func (b *base) SubjectPrivateKeyJWK() ([]byte, error) {
+	priv, err := b.exportableSubjectPrivateKey()
+	if err != nil {
+		return nil, err
+	}
+	return b.marshalJWK(priv)
+}
+
+func (b *base) marshalJWK(key interface{}) ([]byte, error) {
+	switch k := key.(type) {
+	case *rsa.PublicKey, *rsa.PrivateKey, ed25519.PublicKey, ed25519.PrivateKey:
+	case *ecdsa.PublicKey:
+		if err := validateJWKCurve(k.Curve); err != nil {
+			return nil, err
+		}
+	case *ecdsa.PrivateKey:
+		if err := validateJWKCurve(k.Curve); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, errors.Errorf("unsupported key type %T", key)
+	}
+	jwk := jose.JSONWebKey{Key: key}
+	if b.sub != nil && len(b.sub.SubjectKeyId) > 0 {
+		jwk.KeyID = base64.RawURLEncoding.EncodeToString(b.sub.SubjectKeyId)
+	}
+	data, err := json.Marshal(&jwk)
+	return data, errors.Wrap(err, "error marshaling JWK")
+}
+
+func validateJWKCurve(c elliptic.Curve) error {
+	switch c {
+	case elliptic.P256(), elliptic.P384(), elliptic.P521():
+		return nil
+	default:
+		return errors.Errorf("unsupported elliptic curve %s", c.Params().Name)
+	}
+}
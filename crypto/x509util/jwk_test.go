@@ -0,0 +1,112 @@
+package x509util
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/smallstep/cli/jose"
+)
+
+func TestSubjectKeyJWK(t *testing.T) {
+	iss := mustParseCertificate(t, "test_files/noPasscodeCa.crt")
+	issPriv := mustParseRSAKey(t, "test_files/noPasscodeCa.key")
+
+	tests := []struct {
+		name    string
+		kty     WithOption
+		wantKty string
+		wantCrv string
+	}{
+		{"rsa", GenerateKeyPair("RSA", "", 2048), "RSA", ""},
+		{"p256", GenerateKeyPair("EC", "P-256", 0), "EC", "P-256"},
+		{"p384", GenerateKeyPair("EC", "P-384", 0), "EC", "P-384"},
+		{"p521", GenerateKeyPair("EC", "P-521", 0), "EC", "P-521"},
+		{"ed25519", GenerateKeyPair("OKP", "Ed25519", 0), "OKP", "Ed25519"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := mustNewProfile(t)(NewLeafProfile("leaf", iss, issPriv, tt.kty, WithHosts("leaf.smallstep.com")))
+			crt := mustCreateCertificate(t, p)
+			wantKid := base64.RawURLEncoding.EncodeToString(crt.SubjectKeyId)
+
+			data, err := p.SubjectKeyJWK()
+			if err != nil {
+				t.Fatalf("SubjectKeyJWK() error = %v", err)
+			}
+			var fields map[string]interface{}
+			if err := json.Unmarshal(data, &fields); err != nil {
+				t.Fatal(err)
+			}
+			if fields["kty"] != tt.wantKty || (tt.wantCrv != "" && fields["crv"] != tt.wantCrv) {
+				t.Errorf("JWK kty = %v, crv = %v, want %s and %s", fields["kty"], fields["crv"], tt.wantKty, tt.wantCrv)
+			}
+			if _, ok := fields["d"]; ok {
+				t.Error("public JWK contains the private key")
+			}
+			var jwk jose.JSONWebKey
+			if err := json.Unmarshal(data, &jwk); err != nil {
+				t.Fatalf("json.Unmarshal() error = %v", err)
+			}
+			if jwk.KeyID != wantKid {
+				t.Errorf("JWK kid = %q, want %q", jwk.KeyID, wantKid)
+			}
+			if !jwk.IsPublic() || !publicKeyEqual(jwk.Key, p.SubjectPublicKey()) {
+				t.Errorf("JWK key = %v, want %v", jwk.Key, p.SubjectPublicKey())
+			}
+
+			data, err = p.SubjectPrivateKeyJWK()
+			if err != nil {
+				t.Fatalf("SubjectPrivateKeyJWK() error = %v", err)
+			}
+			var privJWK jose.JSONWebKey
+			if err := json.Unmarshal(data, &privJWK); err != nil {
+				t.Fatalf("json.Unmarshal() error = %v", err)
+			}
+			if privJWK.KeyID != wantKid || privJWK.IsPublic() {
+				t.Errorf("private JWK kid = %q, public = %v", privJWK.KeyID, privJWK.IsPublic())
+			}
+			priv, ok := privJWK.Key.(interface{ Equal(crypto.PrivateKey) bool })
+			if !ok || !priv.Equal(p.SubjectPrivateKey()) {
+				t.Errorf("private JWK key does not match the subject private key")
+			}
+		})
+	}
+}
+
+func TestSubjectKeyJWK_fail(t *testing.T) {
+	iss := mustParseCertificate(t, "test_files/noPasscodeCa.crt")
+	issPriv := mustParseRSAKey(t, "test_files/noPasscodeCa.key")
+
+	// Opaque signers only export the public key.
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := mustNewProfile(t)(NewLeafProfile("leaf", iss, issPriv, WithKeyPairGenerator(func() (crypto.PublicKey, crypto.PrivateKey, error) {
+		return key.Public(), testSigner{key}, nil
+	})))
+	if _, err := p.SubjectKeyJWK(); err != nil {
+		t.Errorf("SubjectKeyJWK() error = %v", err)
+	}
+	if _, err := p.SubjectPrivateKeyJWK(); !errors.Is(err, ErrKeyNotExportable) {
+		t.Errorf("SubjectPrivateKeyJWK() error = %v, want ErrKeyNotExportable", err)
+	}
+
+	// Public-only profiles.
+	p = mustNewProfile(t)(NewLeafProfile("leaf", iss, issPriv, WithPublicKey(mustParseCertificate(t, "test_files/ca.crt").PublicKey)))
+	if _, err := p.SubjectPrivateKeyJWK(); !errors.Is(err, ErrMissingPrivateKey) {
+		t.Errorf("SubjectPrivateKeyJWK() error = %v, want ErrMissingPrivateKey", err)
+	}
+
+	// Unsupported curves.
+	p = mustNewProfile(t)(NewLeafProfile("leaf", iss, issPriv, WithPublicKey(mustLoadCSR(t, "test_files/p224.csr").PublicKey)))
+	if _, err := p.SubjectKeyJWK(); err == nil {
+		t.Error("SubjectKeyJWK() error = nil, want error")
+	}
+}
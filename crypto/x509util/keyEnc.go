@@ -0,0 +1,351 @@
+package x509util
+
+import (
+	"crypto"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/pem"
+	"hash"
+
+	"github.com/pkg/errors"
+	"golang.org/x/crypto/pbkdf2"
+)
+
+// DefaultKeyEncIterations is the default number of PBKDF2 iterations used to
+// encrypt private keys.
+const DefaultKeyEncIterations = 600000
+
+// KeyEncCipher is the cipher used to encrypt a PKCS#8 private key.
+type KeyEncCipher int
+
+const (
+	// KeyEncAES256GCM encrypts the key using AES-256-GCM. This is the default.
+	KeyEncAES256GCM KeyEncCipher = iota
+	// KeyEncAES256CBC encrypts the key using AES-256-CBC, it can be used for
+	// compatibility with tools that do not support AES-GCM.
+	KeyEncAES256CBC
+)
+
+var (
+	oidPBES2          = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 5, 13}
+	oidPBKDF2         = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 5, 12}
+	oidHMACWithSHA1   = asn1.ObjectIdentifier{1, 2, 840, 113549, 2, 7}
+	oidHMACWithSHA256 = asn1.ObjectIdentifier{1, 2, 840, 113549, 2, 9}
+	oidAES256CBC      = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 1, 42}
+	oidAES256GCM      = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 1, 46}
+)
+
+type encryptedPrivateKeyInfo struct {
+	Algorithm     pkix.AlgorithmIdentifier
+	EncryptedData []byte
+}
+
+type pbes2Params struct {
+	KeyDerivationFunc pkix.AlgorithmIdentifier
+	EncryptionScheme  pkix.AlgorithmIdentifier
+}
+
+type pbkdf2Params struct {
+	Salt       []byte
+	Iterations int
+	PRF        pkix.AlgorithmIdentifier `asn1:"optional"`
+}
+
+// gcmParams are the AES-GCM parameters defined in RFC 5084.
+type gcmParams struct {
+	Nonce  []byte
+	ICVLen int `asn1:"optional,default:12"`
+}
+
+type keyEncOptions struct {
+	cipher          KeyEncCipher
+	iterations      int
+	emptyPassphrase bool
+}
+
+// KeyEncOption is the type used to configure the encryption of private keys
+// in EncryptedSubjectKeyPEM.
+type KeyEncOption func(o *keyEncOptions) error
+
+// WithKeyEncCipher returns a KeyEncOption that sets the cipher used to encrypt
+// the private key.
+func WithKeyEncCipher(c KeyEncCipher) KeyEncOption {
+	return func(o *keyEncOptions) error {
+		switch c {
+		case KeyEncAES256GCM, KeyEncAES256CBC:
+			o.cipher = c
+			return nil
+		default:
+			return errors.Errorf("unsupported key encryption cipher %d", c)
+		}
+	}
+}
+
+// WithKeyEncIterations returns a KeyEncOption that sets the number of PBKDF2
+// iterations used to derive the encryption key.
+func WithKeyEncIterations(n int) KeyEncOption {
+	return func(o *keyEncOptions) error {
+		if n < 1 {
+			return errors.Errorf("number of iterations must be greater than 0, got %d", n)
+		}
+		o.iterations = n
+		return nil
+	}
+}
+
+// WithKeyEncEmptyPassphrase returns a KeyEncOption that allows the use of an
+// empty passphrase.
+func WithKeyEncEmptyPassphrase() KeyEncOption {
+	return func(o *keyEncOptions) error {
+		o.emptyPassphrase = true
+		return nil
+	}
+}
+
+// EncryptedSubjectKeyPEM returns a PEM block with the subject private key
+// encrypted using PKCS#8 and PBES2. By default the key is encrypted with
+// AES-256-GCM using a key derived with PBKDF2-HMAC-SHA256 and
+// DefaultKeyEncIterations iterations.
+//
+// Use DecryptSubjectKeyPEM to decrypt the returned block.
+func (b *base) EncryptedSubjectKeyPEM(passphrase []byte, opts ...KeyEncOption) (*pem.Block, error) {
+	o := &keyEncOptions{
+		cipher:     KeyEncAES256GCM,
+		iterations: DefaultKeyEncIterations,
+	}
+	for _, fn := range opts {
+		if err := fn(o); err != nil {
+			return nil, err
+		}
+	}
+	if len(passphrase) == 0 && !o.emptyPassphrase {
+		return nil, errors.New("passphrase cannot be empty")
+	}
+	key, err := b.exportableSubjectPrivateKey()
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		return nil, errors.Wrap(err, "error marshaling private key")
+	}
+	alg, encrypted, err := pbes2Encrypt(data, passphrase, o.cipher, o.iterations)
+	if err != nil {
+		return nil, err
+	}
+	der, err := asn1.Marshal(encryptedPrivateKeyInfo{
+		Algorithm:     alg,
+		EncryptedData: encrypted,
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "error marshaling encrypted private key")
+	}
+	return &pem.Block{
+		Type:  "ENCRYPTED PRIVATE KEY",
+		Bytes: der,
+	}, nil
+}
+
+// EncryptedPrivateKeyPEM returns the PEM encoded subject private key
+// encrypted using PKCS#8 and PBES2 with AES-256-CBC and PBKDF2-HMAC-SHA256.
+// AES-256-CBC is used instead of the AES-256-GCM default of
+// EncryptedSubjectKeyPEM because it is supported by most tools, like OpenSSL.
+func (b *base) EncryptedPrivateKeyPEM(passphrase []byte) ([]byte, error) {
+	block, err := b.EncryptedSubjectKeyPEM(passphrase, WithKeyEncCipher(KeyEncAES256CBC))
+	if err != nil {
+		return nil, err
+	}
+	return pem.EncodeToMemory(block), nil
+}
+
+// DecryptSubjectKeyPEM decrypts a PEM block created by EncryptedSubjectKeyPEM
+// and returns the private key.
+func DecryptSubjectKeyPEM(block *pem.Block, passphrase []byte) (crypto.PrivateKey, error) {
+	if block == nil || block.Type != "ENCRYPTED PRIVATE KEY" {
+		return nil, errors.New("PEM block is not an encrypted private key")
+	}
+	var info encryptedPrivateKeyInfo
+	if rest, err := asn1.Unmarshal(block.Bytes, &info); err != nil {
+		return nil, errors.Wrap(err, "error parsing encrypted private key")
+	} else if len(rest) > 0 {
+		return nil, errors.New("error parsing encrypted private key: trailing data")
+	}
+	data, err := pbes2Decrypt(info.Algorithm, info.EncryptedData, passphrase)
+	if err != nil {
+		return nil, err
+	}
+	key, err := x509.ParsePKCS8PrivateKey(data)
+	if err != nil {
+		return nil, errors.Wrap(err, "error parsing private key")
+	}
+	return key, nil
+}
+
+// pbes2Encrypt encrypts the data using PBES2 as defined in RFC 8018, with a key
+// derived with PBKDF2-HMAC-SHA256 and the given cipher.
+func pbes2Encrypt(data, password []byte, c KeyEncCipher, iterations int) (pkix.AlgorithmIdentifier, []byte, error) {
+	salt := make([]byte, 16)
+	if _, err := rand.Read(salt); err != nil {
+		return pkix.AlgorithmIdentifier{}, nil, errors.Wrap(err, "error generating salt")
+	}
+	key := pbkdf2.Key(password, salt, iterations, 32, sha256.New)
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return pkix.AlgorithmIdentifier{}, nil, err
+	}
+
+	var encrypted []byte
+	var scheme pkix.AlgorithmIdentifier
+	switch c {
+	case KeyEncAES256GCM:
+		aead, err := cipher.NewGCM(block)
+		if err != nil {
+			return pkix.AlgorithmIdentifier{}, nil, err
+		}
+		nonce := make([]byte, aead.NonceSize())
+		if _, err := rand.Read(nonce); err != nil {
+			return pkix.AlgorithmIdentifier{}, nil, errors.Wrap(err, "error generating nonce")
+		}
+		encrypted = aead.Seal(nil, nonce, data, nil)
+		params, err := asn1.Marshal(gcmParams{Nonce: nonce, ICVLen: aead.Overhead()})
+		if err != nil {
+			return pkix.AlgorithmIdentifier{}, nil, err
+		}
+		scheme = pkix.AlgorithmIdentifier{
+			Algorithm:  oidAES256GCM,
+			Parameters: asn1.RawValue{FullBytes: params},
+		}
+	case KeyEncAES256CBC:
+		iv := make([]byte, aes.BlockSize)
+		if _, err := rand.Read(iv); err != nil {
+			return pkix.AlgorithmIdentifier{}, nil, errors.Wrap(err, "error generating iv")
+		}
+		// PKCS#7 padding
+		padding := aes.BlockSize - len(data)%aes.BlockSize
+		encrypted = make([]byte, len(data)+padding)
+		copy(encrypted, data)
+		for i := len(data); i < len(encrypted); i++ {
+			encrypted[i] = byte(padding)
+		}
+		cipher.NewCBCEncrypter(block, iv).CryptBlocks(encrypted, encrypted)
+		params, err := asn1.Marshal(iv)
+		if err != nil {
+			return pkix.AlgorithmIdentifier{}, nil, err
+		}
+		scheme = pkix.AlgorithmIdentifier{
+			Algorithm:  oidAES256CBC,
+			Parameters: asn1.RawValue{FullBytes: params},
+		}
+	default:
+		return pkix.AlgorithmIdentifier{}, nil, errors.Errorf("unsupported key encryption cipher %d", c)
+	}
+
+	kdfParams, err := asn1.Marshal(pbkdf2Params{
+		Salt:       salt,
+		Iterations: iterations,
+		PRF: pkix.AlgorithmIdentifier{
+			Algorithm:  oidHMACWithSHA256,
+			Parameters: asn1.NullRawValue,
+		},
+	})
+	if err != nil {
+		return pkix.AlgorithmIdentifier{}, nil, err
+	}
+	params, err := asn1.Marshal(pbes2Params{
+		KeyDerivationFunc: pkix.AlgorithmIdentifier{
+			Algorithm:  oidPBKDF2,
+			Parameters: asn1.RawValue{FullBytes: kdfParams},
+		},
+		EncryptionScheme: scheme,
+	})
+	if err != nil {
+		return pkix.AlgorithmIdentifier{}, nil, err
+	}
+	return pkix.AlgorithmIdentifier{
+		Algorithm:  oidPBES2,
+		Parameters: asn1.RawValue{FullBytes: params},
+	}, encrypted, nil
+}
+
+// pbes2Decrypt decrypts data encrypted with pbes2Encrypt.
+func pbes2Decrypt(alg pkix.AlgorithmIdentifier, encrypted, password []byte) ([]byte, error) {
+	if !alg.Algorithm.Equal(oidPBES2) {
+		return nil, errors.Errorf("unsupported encryption algorithm %s", alg.Algorithm)
+	}
+	var params pbes2Params
+	if _, err := asn1.Unmarshal(alg.Parameters.FullBytes, &params); err != nil {
+		return nil, errors.Wrap(err, "error parsing PBES2 parameters")
+	}
+	if !params.KeyDerivationFunc.Algorithm.Equal(oidPBKDF2) {
+		return nil, errors.Errorf("unsupported key derivation function %s", params.KeyDerivationFunc.Algorithm)
+	}
+	var kdfParams pbkdf2Params
+	if _, err := asn1.Unmarshal(params.KeyDerivationFunc.Parameters.FullBytes, &kdfParams); err != nil {
+		return nil, errors.Wrap(err, "error parsing PBKDF2 parameters")
+	}
+
+	var h func() hash.Hash
+	switch {
+	case kdfParams.PRF.Algorithm.Equal(oidHMACWithSHA256):
+		h = sha256.New
+	case len(kdfParams.PRF.Algorithm) == 0, kdfParams.PRF.Algorithm.Equal(oidHMACWithSHA1):
+		h = sha1.New
+	default:
+		return nil, errors.Errorf("unsupported PBKDF2 function %s", kdfParams.PRF.Algorithm)
+	}
+
+	key := pbkdf2.Key(password, kdfParams.Salt, kdfParams.Iterations, 32, h)
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+
+	switch {
+	case params.EncryptionScheme.Algorithm.Equal(oidAES256GCM):
+		var gcm gcmParams
+		if _, err := asn1.Unmarshal(params.EncryptionScheme.Parameters.FullBytes, &gcm); err != nil {
+			return nil, errors.Wrap(err, "error parsing AES-GCM parameters")
+		}
+		aead, err := cipher.NewGCMWithNonceSize(block, len(gcm.Nonce))
+		if err != nil {
+			return nil, err
+		}
+		if gcm.ICVLen != aead.Overhead() {
+			return nil, errors.Errorf("unsupported AES-GCM tag size %d", gcm.ICVLen)
+		}
+		data, err := aead.Open(nil, gcm.Nonce, encrypted, nil)
+		if err != nil {
+			return nil, errors.New("error decrypting private key: invalid passphrase or corrupted data")
+		}
+		return data, nil
+	case params.EncryptionScheme.Algorithm.Equal(oidAES256CBC):
+		var iv []byte
+		if _, err := asn1.Unmarshal(params.EncryptionScheme.Parameters.FullBytes, &iv); err != nil {
+			return nil, errors.Wrap(err, "error parsing AES-CBC parameters")
+		}
+		if len(iv) != aes.BlockSize || len(encrypted) == 0 || len(encrypted)%aes.BlockSize != 0 {
+			return nil, errors.New("error decrypting private key: invalid AES-CBC data")
+		}
+		data := make([]byte, len(encrypted))
+		cipher.NewCBCDecrypter(block, iv).CryptBlocks(data, encrypted)
+		padding := int(data[len(data)-1])
+		if padding == 0 || padding > aes.BlockSize {
+			return nil, errors.New("error decrypting private key: invalid passphrase or corrupted data")
+		}
+		for _, p := range data[len(data)-padding:] {
+			if int(p) != padding {
+				return nil, errors.New("error decrypting private key: invalid passphrase or corrupted data")
+			}
+		}
+		return data[:len(data)-padding], nil
+	default:
+		return nil, errors.Errorf("unsupported encryption scheme %s", params.EncryptionScheme.Algorithm)
+	}
+}
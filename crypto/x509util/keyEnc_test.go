@@ -0,0 +1,126 @@
+package x509util
+
+import (
+	"encoding/pem"
+	"reflect"
+	"testing"
+
+	"github.com/smallstep/cli/crypto/pemutil"
+)
+
+func TestBase_EncryptedSubjectKeyPEM(t *testing.T) {
+	iss := mustParseCertificate(t, "test_files/noPasscodeCa.crt")
+	issPriv := mustParseRSAKey(t, "test_files/noPasscodeCa.key")
+
+	tests := []struct {
+		name       string
+		keyOptions []WithOption
+		passphrase []byte
+		opts       []KeyEncOption
+		wantErr    bool
+	}{
+		{"ok", nil, []byte("password"), []KeyEncOption{WithKeyEncIterations(1000)}, false},
+		{"ok/cbc", nil, []byte("password"), []KeyEncOption{WithKeyEncCipher(KeyEncAES256CBC), WithKeyEncIterations(1000)}, false},
+		{"ok/rsa", []WithOption{GenerateKeyPair("RSA", "", 2048)}, []byte("password"), []KeyEncOption{WithKeyEncIterations(1000)}, false},
+		{"ok/ed25519", []WithOption{GenerateKeyPair("OKP", "Ed25519", 0)}, []byte("password"), []KeyEncOption{WithKeyEncCipher(KeyEncAES256CBC), WithKeyEncIterations(1000)}, false},
+		{"ok/default-iterations", nil, []byte("password"), nil, false},
+		{"ok/empty-passphrase", nil, nil, []KeyEncOption{WithKeyEncEmptyPassphrase(), WithKeyEncIterations(1000)}, false},
+		{"fail/empty-passphrase", nil, nil, nil, true},
+		{"fail/iterations", nil, []byte("password"), []KeyEncOption{WithKeyEncIterations(0)}, true},
+		{"fail/cipher", nil, []byte("password"), []KeyEncOption{WithKeyEncCipher(KeyEncCipher(100))}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := mustNewProfile(t)(NewLeafProfile("test.smallstep.com", iss, issPriv, tt.keyOptions...))
+			block, err := p.EncryptedSubjectKeyPEM(tt.passphrase, tt.opts...)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("EncryptedSubjectKeyPEM() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if block.Type != "ENCRYPTED PRIVATE KEY" {
+				t.Errorf("EncryptedSubjectKeyPEM() type = %s, want ENCRYPTED PRIVATE KEY", block.Type)
+			}
+			// Round trip through PEM encoding.
+			block, _ = pem.Decode(pem.EncodeToMemory(block))
+			key, err := DecryptSubjectKeyPEM(block, tt.passphrase)
+			if err != nil {
+				t.Fatalf("DecryptSubjectKeyPEM() error = %v", err)
+			}
+			if !reflect.DeepEqual(key, p.SubjectPrivateKey()) {
+				t.Error("DecryptSubjectKeyPEM() key does not match the subject private key")
+			}
+			if _, err := DecryptSubjectKeyPEM(block, append(tt.passphrase, 'x')); err == nil {
+				t.Error("DecryptSubjectKeyPEM() with wrong passphrase error = nil")
+			}
+		})
+	}
+}
+
+func TestBase_EncryptedSubjectKeyPEM_noPrivateKey(t *testing.T) {
+	iss := mustParseCertificate(t, "test_files/noPasscodeCa.crt")
+	issPriv := mustParseRSAKey(t, "test_files/noPasscodeCa.key")
+
+	p := mustNewProfile(t)(NewLeafProfile("test.smallstep.com", iss, issPriv,
+		WithPublicKey(mustParseCertificate(t, "test_files/ca.crt").PublicKey)))
+	if _, err := p.EncryptedSubjectKeyPEM([]byte("password")); err == nil {
+		t.Error("EncryptedSubjectKeyPEM() error = nil, want error")
+	}
+}
+
+func TestDecryptSubjectKeyPEM(t *testing.T) {
+	if _, err := DecryptSubjectKeyPEM(nil, []byte("password")); err == nil {
+		t.Error("DecryptSubjectKeyPEM(nil) error = nil, want error")
+	}
+	if _, err := DecryptSubjectKeyPEM(&pem.Block{Type: "PRIVATE KEY"}, []byte("password")); err == nil {
+		t.Error("DecryptSubjectKeyPEM() with unencrypted key error = nil, want error")
+	}
+	if _, err := DecryptSubjectKeyPEM(&pem.Block{Type: "ENCRYPTED PRIVATE KEY", Bytes: []byte{0x30, 0x00}}, []byte("password")); err == nil {
+		t.Error("DecryptSubjectKeyPEM() with invalid data error = nil, want error")
+	}
+}
+
+func TestBase_EncryptedPrivateKeyPEM(t *testing.T) {
+	iss := mustParseCertificate(t, "test_files/noPasscodeCa.crt")
+	issPriv := mustParseRSAKey(t, "test_files/noPasscodeCa.key")
+	passphrase := []byte("password")
+
+	p := mustNewProfile(t)(NewLeafProfile("test.smallstep.com", iss, issPriv))
+	data, err := p.EncryptedPrivateKeyPEM(passphrase)
+	if err != nil {
+		t.Fatalf("EncryptedPrivateKeyPEM() error = %v", err)
+	}
+	block, rest := pem.Decode(data)
+	if block == nil || len(rest) > 0 || block.Type != "ENCRYPTED PRIVATE KEY" {
+		t.Fatalf("EncryptedPrivateKeyPEM() = %s, want a single ENCRYPTED PRIVATE KEY block", data)
+	}
+
+	// The key can be decrypted by pemutil, that does not support AES-GCM.
+	key, err := pemutil.Parse(data, pemutil.WithPassword(passphrase))
+	if err != nil {
+		t.Fatalf("pemutil.Parse() error = %v", err)
+	}
+	if !reflect.DeepEqual(key, p.SubjectPrivateKey()) {
+		t.Error("decrypted key does not match the subject private key")
+	}
+	if key, err := DecryptSubjectKeyPEM(block, passphrase); err != nil || !reflect.DeepEqual(key, p.SubjectPrivateKey()) {
+		t.Errorf("DecryptSubjectKeyPEM() = %v, %v, want the subject private key", key, err)
+	}
+	if _, err := DecryptSubjectKeyPEM(block, []byte("wrong-password")); err == nil {
+		t.Error("DecryptSubjectKeyPEM() with wrong passphrase error = nil")
+	}
+
+	t.Run("fail/no-private-key", func(t *testing.T) {
+		p := mustNewProfile(t)(NewLeafProfile("test.smallstep.com", iss, issPriv, WithPublicKey(mustParseCertificate(t, "test_files/ca.crt").PublicKey)))
+		if _, err := p.EncryptedPrivateKeyPEM(passphrase); err == nil {
+			t.Error("EncryptedPrivateKeyPEM() error = nil, want error")
+		}
+	})
+
+	t.Run("fail/empty-passphrase", func(t *testing.T) {
+		if _, err := p.EncryptedPrivateKeyPEM(nil); err == nil {
+			t.Error("EncryptedPrivateKeyPEM() error = nil, want error")
+		}
+	})
+}
@@ -0,0 +1,93 @@
+package x509util
+
+import (
+	"crypto/dsa"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// KeyPolicy is the policy used to validate the subject public key before
+// signing a certificate. Ed25519 keys are always accepted and DSA keys are
+// always rejected.
+type KeyPolicy struct {
+	// MinRSABits is the minimum size in bits of RSA keys.
+	MinRSABits int
+	// ECDSACurves are the curves accepted for ECDSA keys.
+	ECDSACurves []elliptic.Curve
+}
+
+// DefaultKeyPolicy returns the key policy used by default. It accepts RSA keys
+// of at least 2048 bits, and ECDSA keys using the P-256, P-384 and P-521
+// curves.
+func DefaultKeyPolicy() KeyPolicy {
+	return KeyPolicy{
+		MinRSABits:  2048,
+		ECDSACurves: []elliptic.Curve{elliptic.P256(), elliptic.P384(), elliptic.P521()},
+	}
+}
+
+// Validate returns an error if the given public key is not accepted by the
+// policy.
+func (kp KeyPolicy) Validate(pub interface{}) error {
+	switch k := pub.(type) {
+	case *rsa.PublicKey:
+		if bits := k.N.BitLen(); bits < kp.MinRSABits {
+			return newError(ErrWeakKey, "RSA key of %d bits is not allowed, the minimum is %d bits", bits, kp.MinRSABits)
+		}
+	case *ecdsa.PublicKey:
+		for _, c := range kp.ECDSACurves {
+			if c == k.Curve {
+				return nil
+			}
+		}
+		names := make([]string, len(kp.ECDSACurves))
+		for i, c := range kp.ECDSACurves {
+			names[i] = curveName(c)
+		}
+		return newError(ErrWeakKey, "ECDSA key with curve %s is not allowed, the allowed curves are %s",
+			curveName(k.Curve), strings.Join(names, ", "))
+	case *dsa.PublicKey:
+		return newError(ErrWeakKey, "DSA key of %d bits is not allowed, DSA keys are not supported", k.P.BitLen())
+	}
+	return nil
+}
+
+// curveName returns the name of the given curve.
+func curveName(c elliptic.Curve) string {
+	if c == nil || c.Params() == nil {
+		return "unknown"
+	}
+	return c.Params().Name
+}
+
+// WithKeyPolicy returns a Profile modifier that sets the policy used to
+// validate the subject public key before signing the certificate. By default
+// DefaultKeyPolicy is used.
+func WithKeyPolicy(policy KeyPolicy) WithOption {
+	return func(p Profile) error {
+		if policy.MinRSABits < 0 {
+			return errors.Errorf("minimum RSA key size cannot be negative, got %d", policy.MinRSABits)
+		}
+		b, err := getBase(p)
+		if err != nil {
+			return err
+		}
+		b.keyPolicy = &policy
+		return nil
+	}
+}
+
+// validateSubjectKey validates the subject public key using the key policy of
+// the profile.
+func (b *base) validateSubjectKey(pub interface{}) error {
+	policy := b.keyPolicy
+	if policy == nil {
+		p := DefaultKeyPolicy()
+		policy = &p
+	}
+	return errors.Wrap(policy.Validate(pub), "subject public key rejected by the key policy")
+}
@@ -0,0 +1,76 @@
+package x509util
+
+import (
+	"crypto/elliptic"
+	"strings"
+	"testing"
+)
+
+func TestWithKeyPolicy(t *testing.T) {
+	iss := mustParseCertificate(t, "test_files/noPasscodeCa.crt")
+	issPriv := mustParseRSAKey(t, "test_files/noPasscodeCa.key")
+	weakRSA := mustLoadCSR(t, "test_files/weakRSA.csr")
+	p224 := mustLoadCSR(t, "test_files/p224.csr")
+	good := mustLoadCSR(t, "test_files/test.smallstep.com.csr")
+
+	permissive := KeyPolicy{
+		MinRSABits:  1024,
+		ECDSACurves: []elliptic.Curve{elliptic.P224(), elliptic.P256(), elliptic.P384(), elliptic.P521()},
+	}
+	strict := KeyPolicy{MinRSABits: 3072, ECDSACurves: []elliptic.Curve{elliptic.P384()}}
+
+	tests := []struct {
+		name    string
+		profile func() (Profile, error)
+		wantErr string
+	}{
+		{"ok/default", func() (Profile, error) {
+			return NewLeafProfileWithCSR(good, iss, issPriv)
+		}, ""},
+		{"ok/rsa-2048", func() (Profile, error) {
+			return NewLeafProfile("test.smallstep.com", iss, issPriv, GenerateKeyPair("RSA", "", 2048))
+		}, ""},
+		{"ok/ed25519", func() (Profile, error) {
+			return NewLeafProfile("test.smallstep.com", iss, issPriv, GenerateKeyPair("OKP", "Ed25519", 0))
+		}, ""},
+		{"ok/permissive-rsa", func() (Profile, error) {
+			return NewLeafProfileWithCSR(weakRSA, iss, issPriv, WithKeyPolicy(permissive))
+		}, ""},
+		{"ok/permissive-p224", func() (Profile, error) {
+			return NewLeafProfileWithCSR(p224, iss, issPriv, WithKeyPolicy(permissive))
+		}, ""},
+		{"ok/strict-p384", func() (Profile, error) {
+			return NewLeafProfile("test.smallstep.com", iss, issPriv, GenerateKeyPair("EC", "P-384", 0), WithKeyPolicy(strict))
+		}, ""},
+		{"fail/weak-rsa", func() (Profile, error) {
+			return NewLeafProfileWithCSR(weakRSA, iss, issPriv)
+		}, "RSA key of 1024 bits is not allowed, the minimum is 2048 bits"},
+		{"fail/p224", func() (Profile, error) {
+			return NewLeafProfileWithCSR(p224, iss, issPriv)
+		}, "ECDSA key with curve P-224 is not allowed, the allowed curves are P-256, P-384, P-521"},
+		{"fail/strict-rsa", func() (Profile, error) {
+			return NewLeafProfile("test.smallstep.com", iss, issPriv, GenerateKeyPair("RSA", "", 2048), WithKeyPolicy(strict))
+		}, "RSA key of 2048 bits is not allowed, the minimum is 3072 bits"},
+		{"fail/strict-p256", func() (Profile, error) {
+			return NewLeafProfile("test.smallstep.com", iss, issPriv, WithKeyPolicy(strict))
+		}, "ECDSA key with curve P-256 is not allowed, the allowed curves are P-384"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := mustNewProfile(t)(tt.profile())
+			_, err := p.CreateCertificate()
+			switch {
+			case tt.wantErr == "" && err != nil:
+				t.Errorf("CreateCertificate() error = %v", err)
+			case tt.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tt.wantErr)):
+				t.Errorf("CreateCertificate() error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+
+	t.Run("fail/negative", func(t *testing.T) {
+		if _, err := NewLeafProfile("test.smallstep.com", iss, issPriv, WithKeyPolicy(KeyPolicy{MinRSABits: -1})); err == nil {
+			t.Error("NewLeafProfile() error = nil, want error")
+		}
+	})
+}
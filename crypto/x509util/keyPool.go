@@ -0,0 +1,161 @@
+package x509util
+
+import (
+	"runtime"
+	"sync"
+
+	"github.com/pkg/errors"
+	"github.com/smallstep/cli/crypto/keys"
+)
+
+// KeyPool is a pool of key pairs generated in the background. It can be used
+// with WithKeyPool to avoid the cost of generating RSA keys when creating
+// many profiles, for example in tests.
+//
+// Each key pair in the pool is returned only once. If the pool is empty, a new
+// key pair is generated inline. If the background generation fails, the pool
+// stops filling up, the error is returned by Err and Close, and Get keeps
+// generating the key pairs inline.
+type KeyPool struct {
+	kty, crv string
+	size     int
+	gen      func(kty, crv string, size int) (interface{}, interface{}, error)
+	keys     chan keyPoolItem
+	done     chan struct{}
+	wg       sync.WaitGroup
+	once     sync.Once
+	mu       sync.Mutex
+	err      error
+}
+
+type keyPoolItem struct {
+	pub, priv interface{}
+}
+
+// NewKeyPool creates a new pool of key pairs of the given type, curve and size
+// and starts generating them in the background. The pool will hold at most
+// depth key pairs. Close must be called to stop the background goroutines.
+func NewKeyPool(kty, crv string, size, depth int) (*KeyPool, error) {
+	return newKeyPool(kty, crv, size, depth, keys.GenerateKeyPair)
+}
+
+func newKeyPool(kty, crv string, size, depth int, gen func(string, string, int) (interface{}, interface{}, error)) (*KeyPool, error) {
+	if depth < 1 {
+		return nil, errors.New("key pool depth must be greater than 0")
+	}
+	// Validate the parameters generating the first key.
+	pub, priv, err := gen(kty, crv, size)
+	if err != nil {
+		return nil, err
+	}
+
+	kp := &KeyPool{
+		kty:  kty,
+		crv:  crv,
+		size: size,
+		gen:  gen,
+		keys: make(chan keyPoolItem, depth),
+		done: make(chan struct{}),
+	}
+	kp.keys <- keyPoolItem{pub, priv}
+
+	workers := runtime.NumCPU()
+	if workers > depth {
+		workers = depth
+	}
+	kp.wg.Add(workers)
+	for i := 0; i < workers; i++ {
+		go kp.generate()
+	}
+	return kp, nil
+}
+
+func (kp *KeyPool) generate() {
+	defer kp.wg.Done()
+	for {
+		select {
+		case <-kp.done:
+			return
+		default:
+		}
+		pub, priv, err := kp.gen(kp.kty, kp.crv, kp.size)
+		if err != nil {
+			kp.setErr(err)
+			return
+		}
+		select {
+		case kp.keys <- keyPoolItem{pub, priv}:
+		case <-kp.done:
+			return
+		}
+	}
+}
+
+// Get returns a key pair from the pool, or generates a new one if the pool is
+// empty or closed.
+func (kp *KeyPool) Get() (interface{}, interface{}, error) {
+	if pub, priv, ok := kp.tryGet(); ok {
+		return pub, priv, nil
+	}
+	return kp.gen(kp.kty, kp.crv, kp.size)
+}
+
+// Err returns the first error found generating the key pairs in the
+// background, or nil if there was none.
+func (kp *KeyPool) Err() error {
+	kp.mu.Lock()
+	defer kp.mu.Unlock()
+	return kp.err
+}
+
+// setErr records the first background generation error.
+func (kp *KeyPool) setErr(err error) {
+	kp.mu.Lock()
+	if kp.err == nil {
+		kp.err = errors.Wrap(err, "error generating key pool")
+	}
+	kp.mu.Unlock()
+}
+
+// tryGet returns a key pair from the pool without blocking.
+func (kp *KeyPool) tryGet() (interface{}, interface{}, bool) {
+	select {
+	case item := <-kp.keys:
+		return item.pub, item.priv, true
+	default:
+		return nil, nil, false
+	}
+}
+
+// matches returns true if the pool generates keys with the given parameters.
+func (kp *KeyPool) matches(kty, crv string, size int) bool {
+	return kp.kty == kty && kp.crv == crv && kp.size == size
+}
+
+// Close stops the background generation of keys and returns the error
+// returned by Err. Keys already in the pool can still be used.
+func (kp *KeyPool) Close() error {
+	kp.once.Do(func() {
+		close(kp.done)
+	})
+	kp.wg.Wait()
+	return kp.Err()
+}
+
+// WithKeyPool returns a Profile modifier that uses the given pool to get the
+// subject key pair instead of generating a new one. The pool is only used if
+// the parameters of the pool match the ones set with GenerateKeyPair, or the
+// default ones.
+func WithKeyPool(pool *KeyPool) WithOption {
+	return func(p Profile) error {
+		if pool == nil {
+			return errors.New("key pool cannot be nil")
+		}
+		b, err := getBase(p)
+		if err != nil {
+			return err
+		}
+		b.keyPool = pool
+		return nil
+	}
+}
@@ -0,0 +1,191 @@
+package x509util
+
+import (
+	"crypto/ecdsa"
+	"crypto/x509"
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/smallstep/cli/crypto/keys"
+)
+
+func TestNewKeyPool(t *testing.T) {
+	tests := []struct {
+		name    string
+		kty     string
+		crv     string
+		size    int
+		depth   int
+		wantErr bool
+	}{
+		{"ok ec", "EC", "P-256", 0, 4, false},
+		{"ok rsa", "RSA", "", 2048, 1, false},
+		{"fail depth", "EC", "P-256", 0, 0, true},
+		{"fail kty", "FOO", "", 0, 4, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			kp, err := NewKeyPool(tt.kty, tt.crv, tt.size, tt.depth)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("NewKeyPool() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err == nil {
+				if err := kp.Close(); err != nil {
+					t.Errorf("KeyPool.Close() error = %v", err)
+				}
+			}
+		})
+	}
+}
+
+func TestKeyPool_Concurrent(t *testing.T) {
+	kp, err := NewKeyPool("EC", "P-256", 0, 8)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer kp.Close()
+
+	var (
+		mu   sync.Mutex
+		wg   sync.WaitGroup
+		seen = make(map[string]struct{})
+	)
+	for i := 0; i < 16; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 10; j++ {
+				pub, _, err := kp.Get()
+				if err != nil {
+					t.Error(err)
+					return
+				}
+				b, err := x509.MarshalPKIXPublicKey(pub)
+				if err != nil {
+					t.Error(err)
+					return
+				}
+				mu.Lock()
+				if _, ok := seen[string(b)]; ok {
+					t.Error("KeyPool.Get() returned the same key twice")
+				}
+				seen[string(b)] = struct{}{}
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+
+	// Get must keep working after Close.
+	if err := kp.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := kp.Get(); err != nil {
+		t.Errorf("KeyPool.Get() error = %v", err)
+	}
+}
+
+func TestKeyPool_GenerateError(t *testing.T) {
+	var (
+		mu    sync.Mutex
+		calls int
+	)
+	// The second and the fourth keys fail.
+	gen := func(kty, crv string, size int) (interface{}, interface{}, error) {
+		mu.Lock()
+		calls++
+		n := calls
+		mu.Unlock()
+		if n == 2 || n == 4 {
+			return nil, nil, errors.New("force")
+		}
+		return keys.GenerateKeyPair(kty, crv, size)
+	}
+
+	// With a depth of 1 there is one background goroutine, and it fails on
+	// its first key.
+	kp, err := newKeyPool("EC", "P-256", 0, 1, gen)
+	if err != nil {
+		t.Fatal(err)
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for kp.Err() == nil && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	if err := kp.Err(); err == nil || !strings.Contains(err.Error(), "force") {
+		t.Fatalf("KeyPool.Err() error = %v, want force error", err)
+	}
+	if err := kp.Close(); err == nil || !strings.Contains(err.Error(), "force") {
+		t.Errorf("KeyPool.Close() error = %v, want force error", err)
+	}
+	mu.Lock()
+	if calls != 2 {
+		t.Errorf("KeyPool generated %d keys, want 2", calls)
+	}
+	mu.Unlock()
+
+	// The key in the pool, and then the inline keys.
+	for i, wantErr := range []bool{false, false, true} {
+		if _, _, err := kp.Get(); (err != nil) != wantErr {
+			t.Errorf("KeyPool.Get() %d error = %v, wantErr %v", i, err, wantErr)
+		}
+	}
+}
+
+func TestWithKeyPool(t *testing.T) {
+	iss := mustParseCertificate(t, "test_files/noPasscodeCa.crt")
+	issPriv := mustParseRSAKey(t, "test_files/noPasscodeCa.key")
+
+	kp, err := NewKeyPool("EC", "P-384", 0, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Wait for the pool to be filled and stop the generators so the pool
+	// is not refilled.
+	for i := 0; i < 100 && len(kp.keys) < 2; i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+	kp.Close()
+
+	p := mustNewProfile(t)(NewLeafProfile("test.smallstep.com", iss, issPriv,
+		GenerateKeyPair("EC", "P-384", 0), WithKeyPool(kp)))
+	if k, ok := p.SubjectPrivateKey().(*ecdsa.PrivateKey); !ok || k.Curve.Params().Name != "P-384" {
+		t.Errorf("SubjectPrivateKey() = %T, want P-384 key", p.SubjectPrivateKey())
+	}
+	if len(kp.keys) == 2 {
+		t.Error("WithKeyPool() did not use the pool")
+	}
+
+	// Parameters not matching the pool generate the key inline.
+	p = mustNewProfile(t)(NewLeafProfile("test.smallstep.com", iss, issPriv,
+		GenerateKeyPair("EC", "P-256", 0), WithKeyPool(kp)))
+	if k, ok := p.SubjectPrivateKey().(*ecdsa.PrivateKey); !ok || k.Curve.Params().Name != "P-256" {
+		t.Errorf("SubjectPrivateKey() = %T, want P-256 key", p.SubjectPrivateKey())
+	}
+
+	if _, err := NewLeafProfile("test.smallstep.com", iss, issPriv, WithKeyPool(nil)); err == nil {
+		t.Error("WithKeyPool(nil) error = nil, want error")
+	}
+}
+
+func BenchmarkKeyPool(b *testing.B) {
+	iss := mustParseCertificate(b, "test_files/noPasscodeCa.crt")
+	issPriv := mustParseRSAKey(b, "test_files/noPasscodeCa.key")
+
+	kp, err := NewKeyPool("RSA", "", 2048, 16)
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer kp.Close()
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := NewLeafProfile("test.smallstep.com", iss, issPriv,
+			GenerateKeyPair("RSA", "", 2048), WithKeyPool(kp)); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
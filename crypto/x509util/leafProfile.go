@@ -1,19 +1,60 @@
 package x509util
 
 import (
+	"bytes"
 	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
 	"crypto/x509"
 	"crypto/x509/pkix"
+	"net"
+	"net/url"
+	"reflect"
 	"time"
 
 	"github.com/pkg/errors"
 )
 
+// DefaultLeafCertValidity is the default validity of a leaf certificate. It
+// defaults to DefaultCertValidity and it is independent of the root and
+// intermediate defaults. Use WithDefaultDuration to change it per profile.
+var DefaultLeafCertValidity = DefaultCertValidity
+
+const (
+	// ShortLivedCertValidity is the default validity of the profiles created
+	// with NewShortLivedLeafProfile or WithShortLived.
+	ShortLivedCertValidity = 24 * time.Hour
+	// ShortLivedCertBackdate is the time the NotBefore of short-lived
+	// certificates is set before the current time.
+	ShortLivedCertBackdate = time.Minute
+)
+
 // Leaf implements the Profile for a leaf certificate.
 type Leaf struct {
 	base
 }
 
+// DefaultDuration returns the default Leaf Certificate duration.
+func (l *Leaf) DefaultDuration() time.Duration {
+	if l.defaultDuration > 0 {
+		return l.defaultDuration
+	}
+	return DefaultLeafCertValidity
+}
+
+// Validate checks the consistency of the leaf certificate. Leaf certificates
+// can be configured as a CA, but it is not recommended.
+func (l *Leaf) Validate() error {
+	if err := l.base.Validate(); err != nil {
+		return err
+	}
+	if l.sub.IsCA {
+		return errors.New("leaf certificate should not be a CA")
+	}
+	return nil
+}
+
 // NewLeafProfileWithTemplate returns a new leaf x509 Certificate Profile with
 // Subject Certificate set to the value of the template argument.
 // A public/private keypair **WILL NOT** be generated for this profile because
@@ -26,16 +67,70 @@ func NewLeafProfileWithTemplate(sub, iss *x509.Certificate, issPriv crypto.Priva
 // NewLeafProfile returns a new leaf x509 Certificate profile.
 // A new public/private key pair will be generated for the Profile if
 // not set in the `withOps` profile modifiers.
+//
+// Unless a key usage modifier is used, the key usage is set using
+// DefaultKeyUsageForKey.
 func NewLeafProfile(cn string, iss *x509.Certificate, issPriv crypto.PrivateKey, withOps ...WithOption) (Profile, error) {
 	sub := defaultLeafTemplate(pkix.Name{CommonName: cn}, iss.Subject)
+	withOps = append([]WithOption{withKeyUsageFromKey()}, withOps...)
 	return newProfile(&Leaf{}, sub, iss, issPriv, withOps...)
 }
 
+// NewEmptySubjectLeafProfile returns a new leaf x509 Certificate profile with
+// an empty subject, the identity of the certificate is only in the given
+// subject alternative names. As required by RFC 5280, the subject alternative
+// name extension is marked as critical.
+//
+// A new public/private key pair will be generated for the Profile if not set
+// in the `withOps` profile modifiers.
+func NewEmptySubjectLeafProfile(sans []string, iss *x509.Certificate, issPriv crypto.PrivateKey, withOps ...WithOption) (Profile, error) {
+	if len(sans) == 0 {
+		return nil, errors.New("certificates with an empty subject must have subject alternative names")
+	}
+	withOps = append([]WithOption{WithSANs(sans)}, withOps...)
+	return NewLeafProfile("", iss, issPriv, withOps...)
+}
+
+// NewShortLivedLeafProfile returns a new leaf x509 Certificate profile for
+// short-lived workload certificates. The certificate is valid for
+// ShortLivedCertValidity, its NotBefore is backdated ShortLivedCertBackdate,
+// and it only has the serverAuth and clientAuth extended key usages. The
+// defaults can be overridden with the `withOps` profile modifiers.
+//
+// The defaults are set on the profile, the package variables like
+// DefaultLeafCertValidity are not used or modified.
+func NewShortLivedLeafProfile(cn string, iss *x509.Certificate, issPriv crypto.PrivateKey, withOps ...WithOption) (Profile, error) {
+	withOps = append([]WithOption{WithShortLived()}, withOps...)
+	return NewLeafProfile(cn, iss, issPriv, withOps...)
+}
+
+// WithShortLived returns a Profile modifier that sets the defaults of
+// NewShortLivedLeafProfile. It can be used with the other leaf constructors,
+// like NewLeafProfileWithCSR.
+func WithShortLived() WithOption {
+	return func(p Profile) error {
+		if _, ok := p.(*Leaf); !ok {
+			return newError(ErrLeafOnly, "short-lived certificates must be leaf certificates, got %T", p)
+		}
+		for _, fn := range []WithOption{
+			WithDefaultDuration(ShortLivedCertValidity),
+			WithBackdate(ShortLivedCertBackdate),
+			WithExtKeyUsage(x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth),
+		} {
+			if err := fn(p); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+}
+
 // NewSelfSignedLeafProfile returns a new leaf x509 Certificate profile.
 // A new public/private key pair will be generated for the Profile if
 // not set in the `withOps` profile modifiers.
 func NewSelfSignedLeafProfile(cn string, withOps ...WithOption) (Profile, error) {
 	sub := defaultLeafTemplate(pkix.Name{CommonName: cn}, pkix.Name{CommonName: cn})
+	withOps = append([]WithOption{withKeyUsageFromKey()}, withOps...)
 	p, err := newProfile(&Leaf{}, sub, sub, nil, withOps...)
 	if err != nil {
 		return nil, err
@@ -45,32 +140,281 @@ func NewSelfSignedLeafProfile(cn string, withOps ...WithOption) (Profile, error)
 	return p, nil
 }
 
+// NewSelfSignedLeafProfileWithTemplate returns a new self-signed leaf x509
+// Certificate profile using the given template as the subject and the issuer.
+// A new public/private key pair will be generated for the Profile if not set
+// in the `withOps` profile modifiers, and it is used to sign the certificate.
+//
+// The template cannot be a CA, use NewRootProfileWithTemplate to create a
+// self-signed root certificate.
+func NewSelfSignedLeafProfileWithTemplate(sub *x509.Certificate, withOps ...WithOption) (Profile, error) {
+	if sub == nil {
+		return nil, errors.New("template cannot be nil")
+	}
+	if sub.IsCA {
+		return nil, errors.New("self-signed leaf certificate should not be a CA, use NewRootProfileWithTemplate instead")
+	}
+	p, err := newProfile(&Leaf{}, sub, sub, nil, withOps...)
+	if err != nil {
+		return nil, err
+	}
+	if p.SubjectPrivateKey() == nil {
+		return nil, newError(ErrMissingPrivateKey, "self-signed certificates require a subject private key")
+	}
+	// self-signed certificate
+	p.SetIssuerPrivateKey(p.SubjectPrivateKey())
+	return p, nil
+}
+
 // NewLeafProfileWithCSR returns a new leaf x509 Certificate Profile with
 // Subject Certificate fields populated directly from the CSR.
 // A public/private keypair **WILL NOT** be generated for this profile because
 // the public key will be populated from the CSR.
+//
+// It returns an error matching ErrMissingPublicKey if the CSR does not have a
+// public key. The signature of the CSR is not verified.
 func NewLeafProfileWithCSR(csr *x509.CertificateRequest, iss *x509.Certificate, issPriv crypto.PrivateKey, withOps ...WithOption) (Profile, error) {
 	if csr.PublicKey == nil {
-		return nil, errors.Errorf("CSR must have PublicKey")
+		return nil, newError(ErrMissingPublicKey, "CSR must have PublicKey")
 	}
 
 	sub := defaultLeafTemplate(csr.Subject, iss.Subject)
-	sub.ExtraExtensions = csr.Extensions
+	// The standard extensions, like the subject alternative name, are
+	// generated from the template fields, copying them would encode them
+	// twice.
+	sub.ExtraExtensions = removeStdExtensions(csr.Extensions)
 	sub.DNSNames = csr.DNSNames
 	sub.EmailAddresses = csr.EmailAddresses
 	sub.IPAddresses = csr.IPAddresses
 	sub.URIs = csr.URIs
 
-	withOps = append(withOps, WithPublicKey(csr.PublicKey))
+	withOps = append([]WithOption{withKeyUsageFromKey()}, withOps...)
+	withOps = append(withOps, WithPublicKey(csr.PublicKey), withCSRExtensionPolicy(csr), withCSRChallengePassword(csr), withCSRRawSubject(csr))
+	return newProfile(&Leaf{}, sub, iss, issPriv, withOps...)
+}
+
+// NewLeafProfileWithPublicKey returns a new leaf x509 Certificate profile
+// using the default leaf template for the given public key, e.g. when the
+// proof of possession of the private key is verified without a CSR. RSA, ECDSA
+// and Ed25519 keys are supported.
+//
+// A key pair is never generated, and the profile does not have a subject
+// private key. It returns an error matching ErrMissingPublicKey or
+// ErrUnsupportedKey if the key is nil or its type is not supported.
+func NewLeafProfileWithPublicKey(pub crypto.PublicKey, cn string, iss *x509.Certificate, issPriv crypto.PrivateKey, withOps ...WithOption) (Profile, error) {
+	switch k := pub.(type) {
+	case nil:
+		return nil, newError(ErrMissingPublicKey, "public key cannot be nil")
+	case *rsa.PublicKey:
+		if k == nil || k.N == nil {
+			return nil, newError(ErrMissingPublicKey, "public key cannot be nil")
+		}
+	case *ecdsa.PublicKey:
+		if k == nil || k.Curve == nil || k.X == nil || k.Y == nil {
+			return nil, newError(ErrMissingPublicKey, "public key cannot be nil")
+		}
+	case ed25519.PublicKey:
+		if len(k) != ed25519.PublicKeySize {
+			return nil, newError(ErrUnsupportedKey, "invalid Ed25519 public key size %d", len(k))
+		}
+	default:
+		return nil, newError(ErrUnsupportedKey, "unsupported public key type %T", pub)
+	}
+
+	sub := defaultLeafTemplate(pkix.Name{CommonName: cn}, iss.Subject)
+	withOps = append([]WithOption{withKeyUsageFromKey()}, withOps...)
+	withOps = append(withOps, WithPublicKey(pub))
 	return newProfile(&Leaf{}, sub, iss, issPriv, withOps...)
 }
 
+// WithRawSubjectFromCSR returns a Profile modifier that makes
+// NewLeafProfileWithCSR copy the subject of the CSR verbatim, so the subject
+// of the certificate is byte-identical to the one in the CSR. By default the
+// parsed subject is used, and multi-valued RDNs, the order of the attributes
+// and the non-standard attributes are lost.
+//
+// It cannot be combined with modifiers that change the subject, like
+// WithSubject, and it can only be used with NewLeafProfileWithCSR.
+func WithRawSubjectFromCSR() WithOption {
+	return func(p Profile) error {
+		b, err := getBase(p)
+		if err != nil {
+			return err
+		}
+		b.rawSubjectFromCSR = true
+		return nil
+	}
+}
+
+// withCSRRawSubject is a modifier of NewLeafProfileWithCSR that copies the
+// raw subject of the CSR if WithRawSubjectFromCSR is used.
+func withCSRRawSubject(csr *x509.CertificateRequest) WithOption {
+	return func(p Profile) error {
+		b, err := getBase(p)
+		if err != nil {
+			return err
+		}
+		if !b.rawSubjectFromCSR {
+			return nil
+		}
+		crt := p.Subject()
+		if !reflect.DeepEqual(crt.Subject, csr.Subject) {
+			return errors.New("WithRawSubjectFromCSR cannot be combined with modifiers that change the subject, like WithSubject")
+		}
+		crt.RawSubject = append([]byte(nil), csr.RawSubject...)
+		return nil
+	}
+}
+
+// CSRExtensionPolicy is the type of the function used to decide if an
+// extension in a CSR is copied into the certificate. Returning an error aborts
+// the creation of the profile.
+//
+// Standard extensions other than the subject alternative name, like the key
+// usage or the basic constraints, are always generated by the profile and
+// never copied from the CSR. The only exception are the extended key usage and
+// basic constraints extensions in NewIntermediateProfileWithCSR.
+type CSRExtensionPolicy func(ext pkix.Extension) (keep bool, err error)
+
+// CSRExtensionsDefault is the CSRExtensionPolicy used by default. It keeps
+// the subject alternative names and all the extensions not managed by the
+// profile.
+func CSRExtensionsDefault(ext pkix.Extension) (bool, error) {
+	if ext.Id.Equal(oidExtSubjectAltName) {
+		return true, nil
+	}
+	_, ok := oidStdExtHashMap[ext.Id.String()]
+	return !ok, nil
+}
+
+// CSRExtensionsNone is a CSRExtensionPolicy that does not copy any extension
+// from the CSR, not even the subject alternative names.
+func CSRExtensionsNone(ext pkix.Extension) (bool, error) {
+	return false, nil
+}
+
+// CSRExtensionsSANsOnly is a CSRExtensionPolicy that only copies the subject
+// alternative names from the CSR.
+func CSRExtensionsSANsOnly(ext pkix.Extension) (bool, error) {
+	return ext.Id.Equal(oidExtSubjectAltName), nil
+}
+
+// WithCSRExtensionPolicy returns a Profile modifier that sets the policy used
+// to decide which extensions of the CSR are copied into the certificate in
+// profiles created with NewLeafProfileWithCSR. The policy is called for each
+// extension in the CSR.
+func WithCSRExtensionPolicy(fn CSRExtensionPolicy) WithOption {
+	return func(p Profile) error {
+		if fn == nil {
+			return errors.New("CSR extension policy cannot be nil")
+		}
+		b, err := getBase(p)
+		if err != nil {
+			return err
+		}
+		b.csrExtPolicy = fn
+		return nil
+	}
+}
+
+// withCSRExtensionPolicy is a modifier of NewLeafProfileWithCSR and
+// NewIntermediateProfileWithCSR, it runs the CSR extension policy and removes
+// from the subject the extensions and names that came from the CSR and are
+// rejected by the policy.
+func withCSRExtensionPolicy(csr *x509.CertificateRequest) WithOption {
+	return func(p Profile) error {
+		b, err := getBase(p)
+		if err != nil {
+			return err
+		}
+		policy := b.csrExtPolicy
+		if policy == nil {
+			policy = CSRExtensionsDefault
+		}
+		crt := p.Subject()
+		for _, ext := range csr.Extensions {
+			keep, err := policy(ext)
+			if err != nil {
+				return errors.Wrapf(err, "CSR extension %s rejected", ext.Id)
+			}
+			if keep {
+				if _, ok := p.(*Intermediate); ok {
+					if err := applyCSRCAExtension(crt, ext); err != nil {
+						return err
+					}
+				}
+				continue
+			}
+			if ext.Id.Equal(oidExtSubjectAltName) {
+				crt.DNSNames = removeStrings(crt.DNSNames, csr.DNSNames)
+				crt.EmailAddresses = removeStrings(crt.EmailAddresses, csr.EmailAddresses)
+				crt.IPAddresses = removeIPs(crt.IPAddresses, csr.IPAddresses)
+				crt.URIs = removeURLs(crt.URIs, csr.URIs)
+				continue
+			}
+			crt.ExtraExtensions = removeExactExtension(crt.ExtraExtensions, ext)
+		}
+		return nil
+	}
+}
+
+// removeExactExtension returns a copy of the list of extensions without the
+// ones equal to the given extension.
+func removeExactExtension(exts []pkix.Extension, ext pkix.Extension) []pkix.Extension {
+	var ret []pkix.Extension
+	for _, e := range exts {
+		if !e.Id.Equal(ext.Id) || e.Critical != ext.Critical || !bytes.Equal(e.Value, ext.Value) {
+			ret = append(ret, e)
+		}
+	}
+	return ret
+}
+
+func removeStrings(values, remove []string) []string {
+	var ret []string
+loop:
+	for _, v := range values {
+		for _, r := range remove {
+			if v == r {
+				continue loop
+			}
+		}
+		ret = append(ret, v)
+	}
+	return ret
+}
+
+func removeIPs(values, remove []net.IP) []net.IP {
+	var ret []net.IP
+loop:
+	for _, v := range values {
+		for _, r := range remove {
+			if v.Equal(r) {
+				continue loop
+			}
+		}
+		ret = append(ret, v)
+	}
+	return ret
+}
+
+func removeURLs(values, remove []*url.URL) []*url.URL {
+	var ret []*url.URL
+loop:
+	for _, v := range values {
+		for _, r := range remove {
+			if v.String() == r.String() {
+				continue loop
+			}
+		}
+		ret = append(ret, v)
+	}
+	return ret
+}
+
 func defaultLeafTemplate(sub, iss pkix.Name) *x509.Certificate {
-	notBefore := time.Now()
 	return &x509.Certificate{
-		IsCA:      false,
-		NotBefore: notBefore,
-		NotAfter:  notBefore.Add(DefaultCertValidity),
+		IsCA: false,
 		// KeyEncipherment MUST only be used for RSA keys. At signing time we
 		// will check the type of the key and remove the KeyEncipherment if
 		// necessary.
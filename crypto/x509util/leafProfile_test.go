@@ -0,0 +1,497 @@
+package x509util
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"errors"
+	"net"
+	"net/url"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestNewLeafProfileWithCSR_duplicateExtensions(t *testing.T) {
+	iss := mustParseCertificate(t, "test_files/noPasscodeCa.crt")
+	issPriv := mustParseRSAKey(t, "test_files/noPasscodeCa.key")
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	customOID := asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 37476, 9000, 64, 2}
+	der, err := x509.CreateCertificateRequest(rand.Reader, &x509.CertificateRequest{
+		Subject:        pkix.Name{CommonName: "test.smallstep.com"},
+		DNSNames:       []string{"test.smallstep.com"},
+		IPAddresses:    []net.IP{net.ParseIP("127.0.0.1")},
+		EmailAddresses: []string{"test@smallstep.com"},
+		URIs:           []*url.URL{{Scheme: "spiffe", Host: "smallstep.com", Path: "/test"}},
+		ExtraExtensions: []pkix.Extension{
+			{Id: oidExtKeyUsage, Critical: true, Value: []byte{0x03, 0x02, 0x07, 0x80}},
+			{Id: oidExtBasicConstraints, Critical: true, Value: []byte{0x30, 0x03, 0x01, 0x01, 0xff}},
+			{Id: customOID, Value: []byte{0x05, 0x00}},
+		},
+	}, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	csr, err := x509.ParseCertificateRequest(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	p := mustNewProfile(t)(NewLeafProfileWithCSR(csr, iss, issPriv))
+	for _, ext := range p.Subject().ExtraExtensions {
+		if _, ok := oidStdExtHashMap[ext.Id.String()]; ok {
+			t.Errorf("ExtraExtensions contains the standard extension %s", ext.Id)
+		}
+	}
+
+	cert := mustCreateCertificate(t, p)
+	count := make(map[string]int)
+	for _, ext := range cert.Extensions {
+		count[ext.Id.String()]++
+	}
+	for oid, n := range count {
+		if n != 1 {
+			t.Errorf("extension %s found %d times", oid, n)
+		}
+	}
+	for _, oid := range []asn1.ObjectIdentifier{oidExtSubjectAltName, oidExtKeyUsage, oidExtExtendedKeyUsage, customOID} {
+		if count[oid.String()] != 1 {
+			t.Errorf("extension %s not found", oid)
+		}
+	}
+	if cert.IsCA {
+		t.Error("IsCA = true, want false")
+	}
+	if len(cert.DNSNames) != 1 || len(cert.IPAddresses) != 1 || len(cert.EmailAddresses) != 1 || len(cert.URIs) != 1 {
+		t.Errorf("unexpected SANs: %v %v %v %v", cert.DNSNames, cert.IPAddresses, cert.EmailAddresses, cert.URIs)
+	}
+}
+
+func TestWithCSRExtensionPolicy(t *testing.T) {
+	iss := mustParseCertificate(t, "test_files/noPasscodeCa.crt")
+	issPriv := mustParseRSAKey(t, "test_files/noPasscodeCa.key")
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	privateOID := asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 37476, 9000, 64, 3}
+	der, err := x509.CreateCertificateRequest(rand.Reader, &x509.CertificateRequest{
+		Subject:  pkix.Name{CommonName: "test.smallstep.com"},
+		DNSNames: []string{"test.smallstep.com"},
+		ExtraExtensions: []pkix.Extension{
+			// keyUsage with keyCertSign
+			{Id: oidExtKeyUsage, Critical: true, Value: []byte{0x03, 0x02, 0x02, 0x04}},
+			{Id: privateOID, Value: []byte{0x05, 0x00}},
+		},
+	}, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	csr, err := x509.ParseCertificateRequest(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name        string
+		options     []WithOption
+		wantSANs    bool
+		wantPrivate bool
+		wantErr     bool
+	}{
+		{"ok/default", nil, true, true, false},
+		{"ok/default-explicit", []WithOption{WithCSRExtensionPolicy(CSRExtensionsDefault)}, true, true, false},
+		{"ok/none", []WithOption{WithCSRExtensionPolicy(CSRExtensionsNone)}, false, false, false},
+		{"ok/sans-only", []WithOption{WithCSRExtensionPolicy(CSRExtensionsSANsOnly)}, true, false, false},
+		{"ok/keep-all", []WithOption{WithCSRExtensionPolicy(func(pkix.Extension) (bool, error) {
+			return true, nil
+		})}, true, true, false},
+		{"fail/error", []WithOption{WithCSRExtensionPolicy(func(ext pkix.Extension) (bool, error) {
+			if ext.Id.Equal(privateOID) {
+				return false, errors.New("private extension not allowed")
+			}
+			return true, nil
+		})}, false, false, true},
+		{"fail/nil", []WithOption{WithCSRExtensionPolicy(nil)}, false, false, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, err := NewLeafProfileWithCSR(csr, iss, issPriv, tt.options...)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("NewLeafProfileWithCSR() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			cert := mustCreateCertificate(t, p)
+			if cert.KeyUsage&x509.KeyUsageCertSign != 0 {
+				t.Error("KeyUsage contains CertSign from the CSR")
+			}
+			if got := len(cert.DNSNames) == 1; got != tt.wantSANs {
+				t.Errorf("DNSNames = %v, wantSANs %v", cert.DNSNames, tt.wantSANs)
+			}
+			var got bool
+			for _, ext := range cert.Extensions {
+				if ext.Id.Equal(privateOID) {
+					got = true
+				}
+			}
+			if got != tt.wantPrivate {
+				t.Errorf("private extension found = %v, want %v", got, tt.wantPrivate)
+			}
+		})
+	}
+}
+
+func TestNewShortLivedLeafProfile(t *testing.T) {
+	iss := mustParseCertificate(t, "test_files/noPasscodeCa.crt")
+	issPriv := mustParseRSAKey(t, "test_files/noPasscodeCa.key")
+	now := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+	clock := func() time.Time { return now }
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	der, err := x509.CreateCertificateRequest(rand.Reader, &x509.CertificateRequest{
+		Subject:  pkix.Name{CommonName: "csr.smallstep.com"},
+		DNSNames: []string{"csr.smallstep.com"},
+	}, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	csr, err := x509.ParseCertificateRequest(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name          string
+		profile       func() (Profile, error)
+		wantNotBefore time.Time
+		wantNotAfter  time.Time
+		wantDNSNames  []string
+	}{
+		{"ok", func() (Profile, error) {
+			return NewShortLivedLeafProfile("test.smallstep.com", iss, issPriv, WithClock(clock))
+		}, now.Add(-ShortLivedCertBackdate), now.Add(ShortLivedCertValidity), nil},
+		{"ok/sans", func() (Profile, error) {
+			return NewShortLivedLeafProfile("test.smallstep.com", iss, issPriv, WithClock(clock), WithSANs([]string{"test.smallstep.com", "127.0.0.1"}))
+		}, now.Add(-ShortLivedCertBackdate), now.Add(ShortLivedCertValidity), []string{"test.smallstep.com"}},
+		{"ok/validity", func() (Profile, error) {
+			return NewShortLivedLeafProfile("test.smallstep.com", iss, issPriv, WithClock(clock), WithValidity(time.Hour))
+		}, now.Add(-ShortLivedCertBackdate), now.Add(time.Hour), nil},
+		{"ok/no-backdate", func() (Profile, error) {
+			return NewShortLivedLeafProfile("test.smallstep.com", iss, issPriv, WithClock(clock), WithBackdate(0))
+		}, now, now.Add(ShortLivedCertValidity), nil},
+		{"ok/not-before", func() (Profile, error) {
+			return NewShortLivedLeafProfile("test.smallstep.com", iss, issPriv, WithNotBeforeAfterDuration(now.Add(time.Hour), time.Time{}, 0))
+		}, now.Add(time.Hour), now.Add(time.Hour + ShortLivedCertValidity), nil},
+		{"ok/csr", func() (Profile, error) {
+			return NewLeafProfileWithCSR(csr, iss, issPriv, WithClock(clock), WithShortLived())
+		}, now.Add(-ShortLivedCertBackdate), now.Add(ShortLivedCertValidity), []string{"csr.smallstep.com"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := mustNewProfile(t)(tt.profile())
+			if p.DefaultDuration() != ShortLivedCertValidity {
+				t.Errorf("DefaultDuration() = %s, want %s", p.DefaultDuration(), ShortLivedCertValidity)
+			}
+			cert := mustCreateCertificate(t, p)
+			if !cert.NotBefore.Equal(tt.wantNotBefore) {
+				t.Errorf("NotBefore = %s, want %s", cert.NotBefore, tt.wantNotBefore)
+			}
+			if !cert.NotAfter.Equal(tt.wantNotAfter) {
+				t.Errorf("NotAfter = %s, want %s", cert.NotAfter, tt.wantNotAfter)
+			}
+			if !reflect.DeepEqual(cert.ExtKeyUsage, []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth}) {
+				t.Errorf("ExtKeyUsage = %v, want serverAuth and clientAuth", cert.ExtKeyUsage)
+			}
+			if !reflect.DeepEqual(cert.DNSNames, tt.wantDNSNames) {
+				t.Errorf("DNSNames = %v, want %v", cert.DNSNames, tt.wantDNSNames)
+			}
+		})
+	}
+
+	t.Run("fail/root", func(t *testing.T) {
+		if _, err := NewRootProfile("root", WithShortLived()); err == nil {
+			t.Error("NewRootProfile() error = nil, want error")
+		}
+	})
+
+	t.Run("fail/negative-backdate", func(t *testing.T) {
+		if _, err := NewLeafProfile("test.smallstep.com", iss, issPriv, WithBackdate(-time.Minute)); err == nil {
+			t.Error("NewLeafProfile() error = nil, want error")
+		}
+	})
+
+	// The defaults of the other profiles are not modified.
+	t.Run("ok/defaults", func(t *testing.T) {
+		leaf := mustNewProfile(t)(NewLeafProfile("test.smallstep.com", iss, issPriv, WithClock(clock)))
+		if leaf.DefaultDuration() != DefaultLeafCertValidity {
+			t.Errorf("DefaultDuration() = %s, want %s", leaf.DefaultDuration(), DefaultLeafCertValidity)
+		}
+		if !leaf.Subject().NotBefore.Equal(now) || !leaf.Subject().NotAfter.Equal(now.Add(DefaultLeafCertValidity)) {
+			t.Errorf("validity = [%s, %s], want [%s, %s]", leaf.Subject().NotBefore, leaf.Subject().NotAfter, now, now.Add(DefaultLeafCertValidity))
+		}
+		inter := mustNewProfile(t)(NewIntermediateProfile("intermediate", iss, issPriv, WithSkipPathLenCheck()))
+		if inter.DefaultDuration() != DefaultIntermediateCertValidity {
+			t.Errorf("DefaultDuration() = %s, want %s", inter.DefaultDuration(), DefaultIntermediateCertValidity)
+		}
+		root := mustNewProfile(t)(NewRootProfile("root"))
+		if root.DefaultDuration() != DefaultRootCertValidity {
+			t.Errorf("DefaultDuration() = %s, want %s", root.DefaultDuration(), DefaultRootCertValidity)
+		}
+	})
+}
+
+func TestNewLeafProfile_emptySubject(t *testing.T) {
+	iss := mustParseCertificate(t, "test_files/noPasscodeCa.crt")
+	issPriv := mustParseRSAKey(t, "test_files/noPasscodeCa.key")
+	sans := []string{"test.smallstep.com", "127.0.0.1"}
+
+	tests := []struct {
+		name         string
+		profile      func() (Profile, error)
+		wantCritical bool
+		wantErr      bool
+	}{
+		{"ok/subject", func() (Profile, error) {
+			return NewLeafProfile("test.smallstep.com", iss, issPriv, WithSANs(sans))
+		}, false, false},
+		{"ok/empty-subject", func() (Profile, error) {
+			return NewLeafProfile("", iss, issPriv, WithSANs(sans))
+		}, true, false},
+		{"ok/empty-subject-constructor", func() (Profile, error) {
+			return NewEmptySubjectLeafProfile(sans, iss, issPriv)
+		}, true, false},
+		{"ok/empty-subject-critical", func() (Profile, error) {
+			return NewEmptySubjectLeafProfile(sans, iss, issPriv, WithCriticalExtension(oidExtSubjectAltName, true))
+		}, true, false},
+		{"ok/subject-critical", func() (Profile, error) {
+			return NewLeafProfile("test.smallstep.com", iss, issPriv, WithSANs(sans), WithCriticalExtension(oidExtSubjectAltName, true))
+		}, true, false},
+		{"fail/no-sans", func() (Profile, error) {
+			return NewLeafProfile("", iss, issPriv)
+		}, false, true},
+		{"fail/constructor-no-sans", func() (Profile, error) {
+			return NewEmptySubjectLeafProfile(nil, iss, issPriv)
+		}, false, true},
+		{"fail/not-critical", func() (Profile, error) {
+			return NewEmptySubjectLeafProfile(sans, iss, issPriv, WithCriticalExtension(oidExtSubjectAltName, false))
+		}, false, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, err := tt.profile()
+			if err == nil {
+				var der []byte
+				if der, err = p.CreateCertificate(); err == nil {
+					var cert *x509.Certificate
+					if cert, err = x509.ParseCertificate(der); err != nil {
+						t.Fatal(err)
+					}
+					ext, ok := findExtension(cert, oidExtSubjectAltName)
+					if !ok {
+						t.Fatal("certificate does not have a subject alternative name extension")
+					}
+					if ext.Critical != tt.wantCritical {
+						t.Errorf("SAN extension critical = %v, want %v", ext.Critical, tt.wantCritical)
+					}
+				}
+			}
+			if (err != nil) != tt.wantErr {
+				t.Errorf("error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestWithRawSubjectFromCSR(t *testing.T) {
+	iss := mustParseCertificate(t, "test_files/noPasscodeCa.crt")
+	issPriv := mustParseRSAKey(t, "test_files/noPasscodeCa.key")
+	// The subject of the CSR has a multi-valued RDN and the non-standard UID
+	// attribute: CN=Jane Doe,UID=jane,OU=Engineering+O=Smallstep,DC=smallstep,DC=com
+	csr := mustLoadCSR(t, "test_files/multiValuedRDN.csr")
+
+	t.Run("ok", func(t *testing.T) {
+		p := mustNewProfile(t)(NewLeafProfileWithCSR(csr, iss, issPriv, WithRawSubjectFromCSR()))
+		crt := mustCreateCertificate(t, p)
+		if !bytes.Equal(crt.RawSubject, csr.RawSubject) {
+			t.Errorf("RawSubject = %x, want %x", crt.RawSubject, csr.RawSubject)
+		}
+		if !reflect.DeepEqual(crt.EmailAddresses, []string{"jane@smallstep.com"}) {
+			t.Errorf("EmailAddresses = %v, want [jane@smallstep.com]", crt.EmailAddresses)
+		}
+	})
+
+	t.Run("ok/default", func(t *testing.T) {
+		// Without the option the parsed subject is re-encoded.
+		p := mustNewProfile(t)(NewLeafProfileWithCSR(csr, iss, issPriv))
+		crt := mustCreateCertificate(t, p)
+		if bytes.Equal(crt.RawSubject, csr.RawSubject) {
+			t.Error("RawSubject is equal to the CSR subject, want a different encoding")
+		}
+	})
+
+	t.Run("fail/with-subject", func(t *testing.T) {
+		if _, err := NewLeafProfileWithCSR(csr, iss, issPriv, WithRawSubjectFromCSR(), WithSubject(pkix.Name{CommonName: "Joe"})); err == nil {
+			t.Error("NewLeafProfileWithCSR() error = nil, want error")
+		}
+		if _, err := NewLeafProfileWithCSR(csr, iss, issPriv, WithSubjectOrganization("Other"), WithRawSubjectFromCSR()); err == nil {
+			t.Error("NewLeafProfileWithCSR() error = nil, want error")
+		}
+	})
+
+	t.Run("fail/no-csr", func(t *testing.T) {
+		if _, err := NewLeafProfile("test.smallstep.com", iss, issPriv, WithRawSubjectFromCSR()); err == nil {
+			t.Error("NewLeafProfile() error = nil, want error")
+		}
+	})
+}
+
+func TestNewSelfSignedLeafProfileWithTemplate(t *testing.T) {
+	template := func() *x509.Certificate {
+		return &x509.Certificate{
+			Subject:        pkix.Name{CommonName: "test.smallstep.com", Organization: []string{"Smallstep"}},
+			DNSNames:       []string{"test.smallstep.com", "www.smallstep.com"},
+			IPAddresses:    []net.IP{net.ParseIP("127.0.0.1").To4()},
+			EmailAddresses: []string{"test@smallstep.com"},
+			URIs:           []*url.URL{{Scheme: "spiffe", Host: "smallstep.com", Path: "/test"}},
+			KeyUsage:       x509.KeyUsageDigitalSignature,
+			ExtKeyUsage:    []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		}
+	}
+
+	p := mustNewProfile(t)(NewSelfSignedLeafProfileWithTemplate(template()))
+	crt := mustCreateCertificate(t, p)
+	if err := crt.CheckSignature(crt.SignatureAlgorithm, crt.RawTBSCertificate, crt.Signature); err != nil {
+		t.Errorf("certificate is not self-signed: %v", err)
+	}
+	if !bytes.Equal(crt.RawIssuer, crt.RawSubject) {
+		t.Errorf("certificate issuer = %s, want %s", crt.Issuer, crt.Subject)
+	}
+	if !reflect.DeepEqual(crt.PublicKey, p.SubjectPublicKey()) {
+		t.Error("certificate public key does not match the subject public key")
+	}
+	want := template()
+	if crt.IsCA {
+		t.Error("certificate should not be a CA")
+	}
+	if !reflect.DeepEqual(crt.DNSNames, want.DNSNames) {
+		t.Errorf("DNSNames = %v, want %v", crt.DNSNames, want.DNSNames)
+	}
+	if !reflect.DeepEqual(crt.IPAddresses, want.IPAddresses) {
+		t.Errorf("IPAddresses = %v, want %v", crt.IPAddresses, want.IPAddresses)
+	}
+	if !reflect.DeepEqual(crt.EmailAddresses, want.EmailAddresses) {
+		t.Errorf("EmailAddresses = %v, want %v", crt.EmailAddresses, want.EmailAddresses)
+	}
+	if !reflect.DeepEqual(crt.URIs, want.URIs) {
+		t.Errorf("URIs = %v, want %v", crt.URIs, want.URIs)
+	}
+	if !reflect.DeepEqual(crt.ExtKeyUsage, want.ExtKeyUsage) {
+		t.Errorf("ExtKeyUsage = %v, want %v", crt.ExtKeyUsage, want.ExtKeyUsage)
+	}
+
+	t.Run("fail/nil", func(t *testing.T) {
+		if _, err := NewSelfSignedLeafProfileWithTemplate(nil); err == nil {
+			t.Error("NewSelfSignedLeafProfileWithTemplate() error = nil, want error")
+		}
+	})
+	t.Run("fail/ca", func(t *testing.T) {
+		tpl := template()
+		tpl.IsCA, tpl.BasicConstraintsValid = true, true
+		if _, err := NewSelfSignedLeafProfileWithTemplate(tpl); err == nil {
+			t.Error("NewSelfSignedLeafProfileWithTemplate() error = nil, want error")
+		}
+	})
+	t.Run("fail/no-private-key", func(t *testing.T) {
+		key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := NewSelfSignedLeafProfileWithTemplate(template(), WithPublicKey(key.Public())); err == nil {
+			t.Error("NewSelfSignedLeafProfileWithTemplate() error = nil, want error")
+		}
+	})
+}
+
+func TestNewLeafProfileWithPublicKey(t *testing.T) {
+	iss := mustParseCertificate(t, "test_files/noPasscodeCa.crt")
+	issPriv := mustParseRSAKey(t, "test_files/noPasscodeCa.key")
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	edPub, _, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		pub     crypto.PublicKey
+		options []WithOption
+		wantKU  x509.KeyUsage
+		wantErr error
+	}{
+		{"ok/rsa", &rsaKey.PublicKey, nil, x509.KeyUsageDigitalSignature | x509.KeyUsageKeyEncipherment, nil},
+		{"ok/ecdsa", &ecKey.PublicKey, nil, x509.KeyUsageDigitalSignature | x509.KeyUsageKeyAgreement, nil},
+		{"ok/ed25519", edPub, nil, x509.KeyUsageDigitalSignature, nil},
+		{"ok/generate", &ecKey.PublicKey, []WithOption{GenerateKeyPair("RSA", "", 2048), WithPublicKey(&rsaKey.PublicKey)}, x509.KeyUsageDigitalSignature | x509.KeyUsageKeyAgreement, nil},
+		{"fail/nil", nil, nil, 0, ErrMissingPublicKey},
+		{"fail/nil-rsa", (*rsa.PublicKey)(nil), nil, 0, ErrMissingPublicKey},
+		{"fail/nil-ecdsa", (*ecdsa.PublicKey)(nil), nil, 0, ErrMissingPublicKey},
+		{"fail/ed25519-size", ed25519.PublicKey(edPub[:16]), nil, 0, ErrUnsupportedKey},
+		{"fail/private-key", ecKey, nil, 0, ErrUnsupportedKey},
+		{"fail/rsa-value", rsaKey.PublicKey, nil, 0, ErrUnsupportedKey},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			opts := append([]WithOption{WithHosts("test.smallstep.com")}, tt.options...)
+			p, err := NewLeafProfileWithPublicKey(tt.pub, "test.smallstep.com", iss, issPriv, opts...)
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Errorf("NewLeafProfileWithPublicKey() error = %v, want %v", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("NewLeafProfileWithPublicKey() error = %v", err)
+			}
+			if p.SubjectPrivateKey() != nil {
+				t.Errorf("SubjectPrivateKey() = %T, want nil", p.SubjectPrivateKey())
+			}
+			crt := mustCreateCertificate(t, p)
+			if !reflect.DeepEqual(crt.PublicKey, tt.pub) {
+				t.Errorf("PublicKey = %v, want %v", crt.PublicKey, tt.pub)
+			}
+			if crt.KeyUsage != tt.wantKU {
+				t.Errorf("KeyUsage = %v, want %v", crt.KeyUsage, tt.wantKU)
+			}
+			if crt.Subject.CommonName != "test.smallstep.com" || !reflect.DeepEqual(crt.ExtKeyUsage, []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth}) {
+				t.Errorf("Subject = %s, ExtKeyUsage = %v", crt.Subject, crt.ExtKeyUsage)
+			}
+			if err := crt.CheckSignatureFrom(iss); err != nil {
+				t.Errorf("CheckSignatureFrom() error = %v", err)
+			}
+		})
+	}
+}
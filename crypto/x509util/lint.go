@@ -0,0 +1,169 @@
+package x509util
+
+import (
+	"crypto/x509"
+	"strings"
+)
+
+// Codes of the findings reported by the profile linter.
+const (
+	// LintLeafCertSign is reported when a leaf certificate has the CertSign or
+	// CRLSign key usages.
+	LintLeafCertSign = "leaf_cert_sign"
+	// LintCABasicConstraints is reported when a CA certificate does not have
+	// valid basic constraints with IsCA set.
+	LintCABasicConstraints = "ca_basic_constraints"
+	// LintCACertSign is reported when a CA certificate does not have the
+	// CertSign key usage.
+	LintCACertSign = "ca_cert_sign"
+	// LintMaxPathLenZero is reported when MaxPathLenZero is set and MaxPathLen
+	// is greater than 0.
+	LintMaxPathLenZero = "max_path_len_zero"
+	// LintTimeStampingEKU is reported when the timeStamping extended key usage
+	// is combined with other extended key usages and strict RFC 3161 checks are
+	// enabled.
+	LintTimeStampingEKU = "time_stamping_eku"
+	// LintEmptySubject is reported when a certificate has an empty subject and
+	// no subject alternative names.
+	LintEmptySubject = "empty_subject"
+	// LintValidityPeriod is reported when NotAfter is before NotBefore.
+	LintValidityPeriod = "validity_period"
+	// LintCodeSigningEKU is reported when codeSigning is not the only extended
+	// key usage and strict code signing checks are enabled.
+	LintCodeSigningEKU = "code_signing_eku"
+	// LintCodeSigningKeyUsage is reported when DigitalSignature is not the only
+	// key usage and strict code signing checks are enabled.
+	LintCodeSigningKeyUsage = "code_signing_key_usage"
+	// LintCodeSigningKeyType is reported when the subject key is not an RSA or
+	// ECDSA key and strict code signing checks are enabled.
+	LintCodeSigningKeyType = "code_signing_key_type"
+	// LintCodeSigningValidity is reported when the validity is longer than
+	// MaxCodeSigningCertMonths and strict code signing checks are enabled.
+	LintCodeSigningValidity = "code_signing_validity"
+	// LintServerSAN is reported when a certificate created with
+	// NewServerProfile does not have any DNS or IP subject alternative name.
+	LintServerSAN = "server_san"
+	// LintClientServerAuth is reported when a certificate created with
+	// NewClientProfile has the serverAuth extended key usage.
+	LintClientServerAuth = "client_server_auth"
+)
+
+// LintError is a finding of the profile linter. The code is stable and can be
+// used to skip specific findings using WithSkipLint.
+type LintError struct {
+	Code    string
+	Message string
+}
+
+// Error implements the error interface.
+func (e LintError) Error() string {
+	return e.Code + ": " + e.Message
+}
+
+// LintErrors is the error returned when the linter reports any finding.
+type LintErrors []LintError
+
+// Error implements the error interface.
+func (e LintErrors) Error() string {
+	msgs := make([]string, len(e))
+	for i, err := range e {
+		msgs[i] = err.Error()
+	}
+	return "certificate lint failed: " + strings.Join(msgs, "; ")
+}
+
+// Is returns true if target is ErrLint.
+func (e LintErrors) Is(target error) bool {
+	return target == ErrLint
+}
+
+// Lint returns the consistency problems of the subject certificate of the
+// profile. The same checks are run on the final template by
+// CreateCertificate unless WithSkipLint is used.
+func (b *base) Lint() []LintError {
+	if b.sub == nil {
+		return nil
+	}
+	return b.lint(b.sub)
+}
+
+// lint checks the given template and returns the findings that have not been
+// skipped.
+func (b *base) lint(crt *x509.Certificate) []LintError {
+	var errs []LintError
+	add := func(code, msg string) {
+		if _, ok := b.skipLints[code]; !ok {
+			errs = append(errs, LintError{Code: code, Message: msg})
+		}
+	}
+
+	if b.isLeaf {
+		if crt.KeyUsage&(x509.KeyUsageCertSign|x509.KeyUsageCRLSign) != 0 {
+			add(LintLeafCertSign, "leaf certificates cannot have the CertSign or CRLSign key usages")
+		}
+	} else {
+		if !crt.BasicConstraintsValid || !crt.IsCA {
+			add(LintCABasicConstraints, "CA certificates must have valid basic constraints with IsCA set")
+		}
+		if crt.KeyUsage&x509.KeyUsageCertSign == 0 {
+			add(LintCACertSign, "CA certificates must have the CertSign key usage")
+		}
+	}
+
+	if crt.MaxPathLenZero && crt.MaxPathLen > 0 {
+		add(LintMaxPathLenZero, "MaxPathLenZero cannot be combined with a MaxPathLen greater than 0")
+	}
+
+	for _, r := range b.lintRules {
+		r.check(b, crt, add)
+	}
+
+	if isEmptySubject(crt) && !hasSANs(crt) && len(b.generalNames) == 0 {
+		add(LintEmptySubject, "certificates with an empty subject must have subject alternative names")
+	}
+
+	if !crt.NotBefore.IsZero() && !crt.NotAfter.IsZero() && crt.NotAfter.Before(crt.NotBefore) {
+		add(LintValidityPeriod, "NotAfter cannot be before NotBefore")
+	}
+
+	return errs
+}
+
+// lintRule is a set of additional checks enabled by a profile preset, like
+// the code signing or the TLS server profiles. The check calls add with the
+// code and the message of each finding.
+type lintRule struct {
+	name  string
+	check func(b *base, crt *x509.Certificate, add func(code, msg string))
+}
+
+// withLintRule returns a Profile modifier that enables the given lint rule.
+// Rules with the same name are only added once.
+func withLintRule(r lintRule) WithOption {
+	return func(p Profile) error {
+		b, err := getBase(p)
+		if err != nil {
+			return err
+		}
+		for _, rr := range b.lintRules {
+			if rr.name == r.name {
+				return nil
+			}
+		}
+		b.lintRules = append(b.lintRules, r)
+		return nil
+	}
+}
+
+// isEmptySubject returns true if the subject of the given template does not
+// have any attribute.
+func isEmptySubject(crt *x509.Certificate) bool {
+	return len(crt.RawSubject) == 0 && len(crt.Subject.ToRDNSequence()) == 0
+}
+
+// hasSANs returns true if the given template has any subject alternative name.
+func hasSANs(crt *x509.Certificate) bool {
+	return len(crt.DNSNames) > 0 || len(crt.IPAddresses) > 0 ||
+		len(crt.EmailAddresses) > 0 || len(crt.URIs) > 0 ||
+		hasExtension(crt.ExtraExtensions, oidExtSubjectAltName)
+}
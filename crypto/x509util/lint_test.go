@@ -0,0 +1,85 @@
+package x509util
+
+import (
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+func TestBase_Lint(t *testing.T) {
+	iss := mustParseCertificate(t, "test_files/noPasscodeCa.crt")
+	issPriv := mustParseRSAKey(t, "test_files/noPasscodeCa.key")
+
+	leaf := func(options ...WithOption) func() (Profile, error) {
+		return func() (Profile, error) {
+			return NewLeafProfile("test.smallstep.com", iss, issPriv, options...)
+		}
+	}
+	intermediate := func(options ...WithOption) func() (Profile, error) {
+		return func() (Profile, error) {
+			return NewIntermediateProfile("intermediate", iss, issPriv, append(options, WithSkipPathLenCheck())...)
+		}
+	}
+	now := time.Now()
+
+	tests := []struct {
+		name       string
+		newProfile func() (Profile, error)
+		want       string
+	}{
+		{"ok/leaf", leaf(), ""},
+		{"ok/intermediate", intermediate(), ""},
+		{"ok/root", func() (Profile, error) { return NewRootProfile("root") }, ""},
+		{"ok/empty-subject-with-sans", leaf(withTemplateFields(func(c *x509.Certificate) { c.Subject = pkix.Name{} }), WithDNSNames([]string{"test.smallstep.com"})), ""},
+		{"ok/time-stamping", leaf(WithStrictRFC3161(), WithExtKeyUsage(x509.ExtKeyUsageTimeStamping)), ""},
+		{"ok/time-stamping-not-strict", leaf(WithExtKeyUsage(x509.ExtKeyUsageTimeStamping, x509.ExtKeyUsageServerAuth)), ""},
+		{"ok/skip", leaf(WithAddKeyUsage(x509.KeyUsageCertSign), WithSkipLint(LintLeafCertSign)), ""},
+		{"ok/skip-all", leaf(WithAddKeyUsage(x509.KeyUsageCertSign), WithSkipLint()), ""},
+		{"fail/leaf-cert-sign", leaf(WithAddKeyUsage(x509.KeyUsageCertSign)), LintLeafCertSign},
+		{"fail/leaf-crl-sign", leaf(WithAddKeyUsage(x509.KeyUsageCRLSign)), LintLeafCertSign},
+		{"fail/ca-basic-constraints", intermediate(withTemplateFields(func(c *x509.Certificate) { c.BasicConstraintsValid = false })), LintCABasicConstraints},
+		{"fail/ca-cert-sign", intermediate(WithKeyUsage(x509.KeyUsageCRLSign)), LintCACertSign},
+		{"fail/max-path-len-zero", intermediate(withTemplateFields(func(c *x509.Certificate) { c.MaxPathLen = 1 })), LintMaxPathLenZero},
+		{"fail/time-stamping", leaf(WithStrictRFC3161(), WithExtKeyUsage(x509.ExtKeyUsageTimeStamping, x509.ExtKeyUsageServerAuth)), LintTimeStampingEKU},
+		{"fail/empty-subject", leaf(withTemplateFields(func(c *x509.Certificate) { c.Subject = pkix.Name{} })), LintEmptySubject},
+		{"fail/validity-period", leaf(WithNotBeforeAfterDuration(now, now.Add(-time.Hour), 0)), LintValidityPeriod},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, err := tt.newProfile()
+			if err != nil {
+				t.Fatal(err)
+			}
+			_, err = p.CreateCertificate()
+			if tt.want == "" {
+				if err != nil {
+					t.Errorf("CreateCertificate() error = %v", err)
+				}
+				return
+			}
+
+			var lintErrs LintErrors
+			if !errors.As(err, &lintErrs) {
+				t.Fatalf("CreateCertificate() error = %v, want LintErrors", err)
+			}
+			if len(lintErrs) != 1 || lintErrs[0].Code != tt.want {
+				t.Errorf("CreateCertificate() error = %v, want %s", lintErrs, tt.want)
+			}
+			if errs := p.Lint(); len(errs) != 1 || errs[0].Code != tt.want {
+				t.Errorf("Lint() = %v, want %s", errs, tt.want)
+			}
+		})
+	}
+}
+
+// withTemplateFields returns a profile modifier that calls fn with the subject
+// template.
+func withTemplateFields(fn func(*x509.Certificate)) WithOption {
+	return func(p Profile) error {
+		fn(p.Subject())
+		return nil
+	}
+}
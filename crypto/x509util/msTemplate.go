@@ -0,0 +1,88 @@
+package x509util
+
+import (
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"unicode/utf16"
+
+	"github.com/pkg/errors"
+)
+
+var (
+	// oidExtMSCertificateTemplate is the OID for the Microsoft certificate
+	// template information extension.
+	oidExtMSCertificateTemplate = asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 311, 21, 7}
+	// oidExtMSCertificateTemplateName is the OID for the Microsoft certificate
+	// template name extension.
+	oidExtMSCertificateTemplateName = asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 311, 20, 2}
+)
+
+// msCertificateTemplate is the ASN.1 structure of the Microsoft certificate
+// template information extension.
+//
+//	CertificateTemplate ::= SEQUENCE {
+//	    templateID              OBJECT IDENTIFIER,
+//	    templateMajorVersion    INTEGER,
+//	    templateMinorVersion    INTEGER OPTIONAL }
+type msCertificateTemplate struct {
+	TemplateID   asn1.ObjectIdentifier
+	MajorVersion int
+	MinorVersion int `asn1:"optional"`
+}
+
+// WithMSTemplate returns a Profile modifier that adds the Microsoft
+// certificate template information extension with the given template object
+// identifier and versions. Active Directory clients use it to match the
+// certificate with an enrollment template.
+func WithMSTemplate(oid asn1.ObjectIdentifier, majorVersion, minorVersion int) WithOption {
+	return func(p Profile) error {
+		if len(oid) == 0 {
+			return errors.New("certificate template object identifier cannot be empty")
+		}
+		if majorVersion < 0 || minorVersion < 0 {
+			return errors.New("certificate template versions cannot be negative")
+		}
+		value, err := asn1.Marshal(msCertificateTemplate{
+			TemplateID:   oid,
+			MajorVersion: majorVersion,
+			MinorVersion: minorVersion,
+		})
+		if err != nil {
+			return errors.Wrap(err, "error marshaling certificate template")
+		}
+		crt := p.Subject()
+		crt.ExtraExtensions = append(removeExtension(crt.ExtraExtensions, oidExtMSCertificateTemplate), pkix.Extension{
+			Id:    oidExtMSCertificateTemplate,
+			Value: value,
+		})
+		return nil
+	}
+}
+
+// WithMSTemplateName returns a Profile modifier that adds the Microsoft
+// certificate template name extension, used by the legacy version 1
+// templates.
+func WithMSTemplateName(name string) WithOption {
+	return func(p Profile) error {
+		if name == "" {
+			return errors.New("certificate template name cannot be empty")
+		}
+		b := make([]byte, 0, 2*len(name))
+		for _, r := range name {
+			if t, _ := utf16.EncodeRune(r); t != 0xfffd {
+				return errors.New("certificate template name contains characters that cannot be encoded in a BMPString")
+			}
+			b = append(b, byte(r>>8), byte(r))
+		}
+		value, err := asn1.Marshal(asn1.RawValue{Tag: asn1.TagBMPString, Bytes: b})
+		if err != nil {
+			return errors.Wrap(err, "error marshaling certificate template name")
+		}
+		crt := p.Subject()
+		crt.ExtraExtensions = append(removeExtension(crt.ExtraExtensions, oidExtMSCertificateTemplateName), pkix.Extension{
+			Id:    oidExtMSCertificateTemplateName,
+			Value: value,
+		})
+		return nil
+	}
+}
@@ -0,0 +1,74 @@
+package x509util
+
+import (
+	"encoding/asn1"
+	"strings"
+	"testing"
+)
+
+func TestWithMSTemplate(t *testing.T) {
+	iss := mustParseCertificate(t, "test_files/noPasscodeCa.crt")
+	issPriv := mustParseRSAKey(t, "test_files/noPasscodeCa.key")
+	oid := asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 311, 21, 8, 1, 2, 3}
+
+	tests := []struct {
+		name    string
+		oid     asn1.ObjectIdentifier
+		major   int
+		minor   int
+		wantErr string
+	}{
+		{"ok", oid, 100, 4, ""},
+		{"ok zero minor", oid, 1, 0, ""},
+		{"fail empty oid", nil, 1, 0, "object identifier cannot be empty"},
+		{"fail negative major", oid, -1, 0, "versions cannot be negative"},
+		{"fail negative minor", oid, 1, -1, "versions cannot be negative"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, err := NewLeafProfile("leaf", iss, issPriv, WithHosts("leaf.smallstep.com"), WithMSTemplate(tt.oid, tt.major, tt.minor))
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("NewLeafProfile() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			crt := mustCreateCertificate(t, mustNewProfile(t)(p, err))
+			ext, ok := findExtension(crt, oidExtMSCertificateTemplate)
+			if !ok {
+				t.Fatal("certificate does not have the certificate template extension")
+			}
+			var got msCertificateTemplate
+			if rest, err := asn1.Unmarshal(ext.Value, &got); err != nil || len(rest) > 0 {
+				t.Fatalf("asn1.Unmarshal() error = %v, rest = %x", err, rest)
+			}
+			if !got.TemplateID.Equal(tt.oid) || got.MajorVersion != tt.major || got.MinorVersion != tt.minor {
+				t.Errorf("certificate template = %v %d %d, want %v %d %d",
+					got.TemplateID, got.MajorVersion, got.MinorVersion, tt.oid, tt.major, tt.minor)
+			}
+		})
+	}
+}
+
+func TestWithMSTemplateName(t *testing.T) {
+	iss := mustParseCertificate(t, "test_files/noPasscodeCa.crt")
+	issPriv := mustParseRSAKey(t, "test_files/noPasscodeCa.key")
+
+	p := mustNewProfile(t)(NewLeafProfile("leaf", iss, issPriv, WithHosts("leaf.smallstep.com"), WithMSTemplateName("Machine")))
+	crt := mustCreateCertificate(t, p)
+	ext, ok := findExtension(crt, oidExtMSCertificateTemplateName)
+	if !ok {
+		t.Fatal("certificate does not have the certificate template name extension")
+	}
+	var v asn1.RawValue
+	if _, err := asn1.Unmarshal(ext.Value, &v); err != nil {
+		t.Fatal(err)
+	}
+	if got, err := parseDirectoryString(v); err != nil || got != "Machine" {
+		t.Errorf("certificate template name = %q, %v, want Machine", got, err)
+	}
+
+	if _, err := NewLeafProfile("leaf", iss, issPriv, WithMSTemplateName("")); err == nil {
+		t.Error("NewLeafProfile() error = nil, want error")
+	}
+}
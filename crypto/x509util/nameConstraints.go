@@ -0,0 +1,157 @@
+package x509util
+
+import (
+	"crypto/x509"
+	"net"
+	"net/url"
+	"strings"
+)
+
+// WithSkipNameConstraintCheck returns a Profile modifier that disables the
+// validation of the subject alternative names against the name constraints of
+// the issuer certificate. It can be used to cross-sign certificates that are
+// not subject to the constraints of the new issuer.
+func WithSkipNameConstraintCheck() WithOption {
+	return func(p Profile) error {
+		b, err := getBase(p)
+		if err != nil {
+			return err
+		}
+		b.skipNameConstraintCheck = true
+		return nil
+	}
+}
+
+// checkNameConstraints returns a NameConstraintError if the subject alternative
+// names in the template do not satisfy the name constraints of the issuer. The
+// matching follows RFC 5280, section 4.2.1.10, as implemented by the Go
+// verifier.
+func checkNameConstraints(iss, tpl *x509.Certificate) error {
+	var violations []NameConstraintViolation
+	check := func(typ, name string, permitted, excluded []string, match func(string, string) (bool, string)) {
+		for _, c := range excluded {
+			if ok, reason := match(name, c); reason != "" {
+				violations = append(violations, NameConstraintViolation{Type: typ, Name: name, Reason: reason})
+				return
+			} else if ok {
+				violations = append(violations, NameConstraintViolation{Type: typ, Name: name, Reason: "is excluded by " + c})
+				return
+			}
+		}
+		if len(permitted) == 0 {
+			return
+		}
+		for _, c := range permitted {
+			if ok, reason := match(name, c); reason != "" {
+				violations = append(violations, NameConstraintViolation{Type: typ, Name: name, Reason: reason})
+				return
+			} else if ok {
+				return
+			}
+		}
+		violations = append(violations, NameConstraintViolation{Type: typ, Name: name, Reason: "is not permitted"})
+	}
+
+	for _, name := range tpl.DNSNames {
+		check("DNS", name, iss.PermittedDNSDomains, iss.ExcludedDNSDomains, matchDNSConstraint)
+	}
+	for _, name := range tpl.EmailAddresses {
+		check("email", name, iss.PermittedEmailAddresses, iss.ExcludedEmailAddresses, matchEmailConstraint)
+	}
+	for _, u := range tpl.URIs {
+		check("URI", u.String(), iss.PermittedURIDomains, iss.ExcludedURIDomains, matchURIConstraint)
+	}
+	for _, ip := range tpl.IPAddresses {
+		var violation string
+		for _, c := range iss.ExcludedIPRanges {
+			if matchIPConstraint(ip, c) {
+				violation = "is excluded by " + c.String()
+				break
+			}
+		}
+		if violation == "" && len(iss.PermittedIPRanges) > 0 {
+			violation = "is not permitted"
+			for _, c := range iss.PermittedIPRanges {
+				if matchIPConstraint(ip, c) {
+					violation = ""
+					break
+				}
+			}
+		}
+		if violation != "" {
+			violations = append(violations, NameConstraintViolation{Type: "IP", Name: ip.String(), Reason: violation})
+		}
+	}
+
+	if len(violations) > 0 {
+		return &NameConstraintError{Violations: violations}
+	}
+	return nil
+}
+
+// matchDomainConstraint reports whether the domain matches the constraint. A
+// constraint with a leading period only matches subdomains, otherwise it
+// matches the domain itself and its subdomains.
+func matchDomainConstraint(domain, constraint string) bool {
+	if constraint == "" {
+		return true
+	}
+	domain = strings.ToLower(strings.TrimSuffix(domain, "."))
+	constraint = strings.ToLower(constraint)
+	if strings.HasPrefix(constraint, ".") {
+		return strings.HasSuffix(domain, constraint)
+	}
+	return domain == constraint || strings.HasSuffix(domain, "."+constraint)
+}
+
+func matchDNSConstraint(name, constraint string) (bool, string) {
+	return matchDomainConstraint(name, constraint), ""
+}
+
+// matchEmailConstraint matches an email address against a mailbox or a domain
+// constraint.
+func matchEmailConstraint(email, constraint string) (bool, string) {
+	i := strings.LastIndex(email, "@")
+	if i < 0 {
+		return false, "is not a valid email address"
+	}
+	if strings.Contains(constraint, "@") {
+		j := strings.LastIndex(constraint, "@")
+		// The local part is case sensitive, the domain is not.
+		return email[:i] == constraint[:j] && strings.EqualFold(email[i+1:], constraint[j+1:]), ""
+	}
+	return matchDomainConstraint(email[i+1:], constraint), ""
+}
+
+// matchURIConstraint matches the host of the URI against a domain constraint.
+// URIs without a host or with an IP address as host cannot satisfy a
+// constraint.
+func matchURIConstraint(uri, constraint string) (bool, string) {
+	u, err := url.Parse(uri)
+	if err != nil {
+		return false, "is not a valid URI"
+	}
+	host := u.Hostname()
+	if host == "" {
+		return false, "does not have a host to match " + constraint
+	}
+	if net.ParseIP(host) != nil {
+		return false, "has an IP address as host and cannot match " + constraint
+	}
+	if strings.HasPrefix(constraint, ".") {
+		return strings.HasSuffix(strings.ToLower(host), strings.ToLower(constraint)), ""
+	}
+	return strings.EqualFold(host, constraint), ""
+}
+
+// matchIPConstraint reports whether the IP address is in the given range. IPv4
+// and IPv6 ranges only match addresses of the same family.
+func matchIPConstraint(ip net.IP, constraint *net.IPNet) bool {
+	if ip4 := ip.To4(); ip4 != nil {
+		ip = ip4
+	}
+	if len(ip) != len(constraint.IP) {
+		return false
+	}
+	return constraint.Contains(ip)
+}
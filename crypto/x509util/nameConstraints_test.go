@@ -0,0 +1,124 @@
+package x509util
+
+import (
+	"crypto/x509"
+	"net"
+	"net/url"
+	"reflect"
+	"testing"
+
+	"github.com/pkg/errors"
+)
+
+func TestNameConstraints(t *testing.T) {
+	mustCIDR := func(s string) *net.IPNet {
+		_, n, err := net.ParseCIDR(s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return n
+	}
+	mustURL := func(s string) *url.URL {
+		u, err := url.Parse(s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return u
+	}
+
+	newIssuer := func(fn func(*x509.Certificate)) (*x509.Certificate, interface{}) {
+		root := mustNewProfile(t)(NewRootProfile("Constrained Root", withTemplateFields(fn)))
+		return mustCreateCertificate(t, root), root.SubjectPrivateKey()
+	}
+
+	permitted := func(c *x509.Certificate) {
+		c.PermittedDNSDomains = []string{".internal.example.com"}
+		c.PermittedEmailAddresses = []string{"example.com"}
+		c.PermittedURIDomains = []string{".example.com"}
+		c.PermittedIPRanges = []*net.IPNet{mustCIDR("10.0.0.0/8")}
+	}
+	excluded := func(c *x509.Certificate) {
+		c.ExcludedDNSDomains = []string{"evil.com"}
+		c.ExcludedEmailAddresses = []string{"root@example.com"}
+		c.ExcludedURIDomains = []string{"evil.com"}
+		c.ExcludedIPRanges = []*net.IPNet{mustCIDR("192.168.0.0/16")}
+	}
+	empty := func(c *x509.Certificate) {}
+
+	sans := func(dns []string, emails []string, uris []string, ips []string) WithOption {
+		return withTemplateFields(func(c *x509.Certificate) {
+			c.DNSNames = dns
+			c.EmailAddresses = emails
+			for _, s := range uris {
+				c.URIs = append(c.URIs, mustURL(s))
+			}
+			for _, s := range ips {
+				c.IPAddresses = append(c.IPAddresses, net.ParseIP(s))
+			}
+		})
+	}
+
+	tests := []struct {
+		name           string
+		constraints    func(*x509.Certificate)
+		options        []WithOption
+		wantViolations []NameConstraintViolation
+	}{
+		{"ok permitted", permitted, []WithOption{sans(
+			[]string{"api.internal.example.com"}, []string{"jane@example.com", "joe@mail.example.com"},
+			[]string{"spiffe://svc.example.com/api"}, []string{"10.1.2.3"},
+		)}, nil},
+		{"ok excluded", excluded, []WithOption{sans(
+			[]string{"example.com", "notevil.com"}, []string{"jane@example.com"},
+			[]string{"https://example.com"}, []string{"10.1.2.3", "::1"},
+		)}, nil},
+		{"ok empty constraints", empty, []WithOption{sans(
+			[]string{"evil.com"}, []string{"root@example.com"},
+			[]string{"https://evil.com"}, []string{"192.168.1.1"},
+		)}, nil},
+		{"ok skip", permitted, []WithOption{sans([]string{"evil.com"}, nil, nil, nil), WithSkipNameConstraintCheck()}, nil},
+		{"fail permitted", permitted, []WithOption{sans(
+			[]string{"api.internal.example.com", "internal.example.com", "evil.com"}, []string{"jane@evil.com"},
+			[]string{"spiffe://example.com/api", "https://10.0.0.1/"}, []string{"10.1.2.3", "192.168.1.1", "::1"},
+		)}, []NameConstraintViolation{
+			{"DNS", "internal.example.com", "is not permitted"},
+			{"DNS", "evil.com", "is not permitted"},
+			{"email", "jane@evil.com", "is not permitted"},
+			{"URI", "spiffe://example.com/api", "is not permitted"},
+			{"URI", "https://10.0.0.1/", "has an IP address as host and cannot match .example.com"},
+			{"IP", "192.168.1.1", "is not permitted"},
+			{"IP", "::1", "is not permitted"},
+		}},
+		{"fail excluded", excluded, []WithOption{sans(
+			[]string{"evil.com", "www.EVIL.com"}, []string{"root@example.com", "root@EXAMPLE.com", "Root@example.com"},
+			[]string{"https://evil.com/path", "https://www.evil.com"}, []string{"192.168.1.1"},
+		)}, []NameConstraintViolation{
+			{"DNS", "evil.com", "is excluded by evil.com"},
+			{"DNS", "www.EVIL.com", "is excluded by evil.com"},
+			{"email", "root@example.com", "is excluded by root@example.com"},
+			{"email", "root@EXAMPLE.com", "is excluded by root@example.com"},
+			{"URI", "https://evil.com/path", "is excluded by evil.com"},
+			{"IP", "192.168.1.1", "is excluded by 192.168.0.0/16"},
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			iss, issPriv := newIssuer(tt.constraints)
+			p := mustNewProfile(t)(NewLeafProfile("leaf", iss, issPriv, tt.options...))
+			_, err := p.CreateCertificate()
+			if tt.wantViolations == nil {
+				if err != nil {
+					t.Fatalf("CreateCertificate() error = %v", err)
+				}
+				return
+			}
+			var ncErr *NameConstraintError
+			if !errors.As(err, &ncErr) {
+				t.Fatalf("CreateCertificate() error = %v, want *NameConstraintError", err)
+			}
+			if !reflect.DeepEqual(ncErr.Violations, tt.wantViolations) {
+				t.Errorf("NameConstraintError.Violations = %v, want %v", ncErr.Violations, tt.wantViolations)
+			}
+		})
+	}
+}
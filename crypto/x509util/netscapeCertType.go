@@ -0,0 +1,76 @@
+package x509util
+
+import (
+	"crypto/x509/pkix"
+	"encoding/asn1"
+
+	"github.com/pkg/errors"
+)
+
+// oidExtNetscapeCertType is the OID for the legacy Netscape certificate type
+// extension.
+var oidExtNetscapeCertType = asn1.ObjectIdentifier{2, 16, 840, 1, 113730, 1, 1}
+
+// NetscapeCertType is a set of flags of the legacy Netscape certificate type
+// extension. Bit 4 of the extension is reserved and it does not have a flag.
+type NetscapeCertType int
+
+// Flags of the Netscape certificate type extension.
+const (
+	NetscapeCertTypeSSLClient       NetscapeCertType = 1 << 0
+	NetscapeCertTypeSSLServer       NetscapeCertType = 1 << 1
+	NetscapeCertTypeSMIME           NetscapeCertType = 1 << 2
+	NetscapeCertTypeObjectSigning   NetscapeCertType = 1 << 3
+	NetscapeCertTypeSSLCA           NetscapeCertType = 1 << 5
+	NetscapeCertTypeSMIMECA         NetscapeCertType = 1 << 6
+	NetscapeCertTypeObjectSigningCA NetscapeCertType = 1 << 7
+
+	netscapeCertTypeAll = NetscapeCertTypeSSLClient | NetscapeCertTypeSSLServer | NetscapeCertTypeSMIME |
+		NetscapeCertTypeObjectSigning | NetscapeCertTypeSSLCA | NetscapeCertTypeSMIMECA | NetscapeCertTypeObjectSigningCA
+)
+
+// WithNetscapeCertType returns a Profile modifier that adds the Netscape
+// certificate type extension with the given flags, e.g.
+// NetscapeCertTypeSSLClient|NetscapeCertTypeSSLServer.
+//
+// The extension is obsolete and it is ignored by modern software, which uses
+// the key usage and extended key usage extensions instead. It should only be
+// used for legacy devices, like old VPN concentrators, that still require it.
+func WithNetscapeCertType(flags NetscapeCertType) WithOption {
+	return func(p Profile) error {
+		if flags == 0 {
+			return errors.New("netscape certificate type cannot be empty")
+		}
+		if flags&^netscapeCertTypeAll != 0 {
+			return errors.Errorf("invalid netscape certificate type %#x", int(flags))
+		}
+		value, err := marshalNetscapeCertType(flags)
+		if err != nil {
+			return err
+		}
+		crt := p.Subject()
+		crt.ExtraExtensions = append(removeExtension(crt.ExtraExtensions, oidExtNetscapeCertType), pkix.Extension{
+			Id:    oidExtNetscapeCertType,
+			Value: value,
+		})
+		return nil
+	}
+}
+
+// marshalNetscapeCertType encodes the flags as a DER named bit list, where the
+// flag 1<<n is the bit n of the BIT STRING and trailing zero bits are removed.
+func marshalNetscapeCertType(flags NetscapeCertType) ([]byte, error) {
+	var b byte
+	bitLength := 0
+	for i := 0; i < 8; i++ {
+		if flags&(1<<uint(i)) != 0 {
+			b |= 0x80 >> uint(i)
+			bitLength = i + 1
+		}
+	}
+	value, err := asn1.Marshal(asn1.BitString{Bytes: []byte{b}, BitLength: bitLength})
+	if err != nil {
+		return nil, errors.Wrap(err, "error marshaling netscape certificate type")
+	}
+	return value, nil
+}
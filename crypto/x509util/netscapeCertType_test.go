@@ -0,0 +1,63 @@
+package x509util
+
+import (
+	"bytes"
+	"encoding/asn1"
+	"testing"
+)
+
+func TestWithNetscapeCertType(t *testing.T) {
+	iss := mustParseCertificate(t, "test_files/noPasscodeCa.crt")
+	issPriv := mustParseRSAKey(t, "test_files/noPasscodeCa.key")
+
+	tests := []struct {
+		name     string
+		flags    NetscapeCertType
+		wantBits []int
+		wantDER  []byte
+		wantErr  bool
+	}{
+		{"ok client", NetscapeCertTypeSSLClient, []int{0}, []byte{0x03, 0x02, 0x07, 0x80}, false},
+		{"ok client server", NetscapeCertTypeSSLClient | NetscapeCertTypeSSLServer, []int{0, 1}, []byte{0x03, 0x02, 0x06, 0xc0}, false},
+		{"ok smime object signing", NetscapeCertTypeSMIME | NetscapeCertTypeObjectSigning, []int{2, 3}, []byte{0x03, 0x02, 0x04, 0x30}, false},
+		{"ok ca", NetscapeCertTypeSSLCA | NetscapeCertTypeSMIMECA | NetscapeCertTypeObjectSigningCA, []int{5, 6, 7}, []byte{0x03, 0x02, 0x00, 0x07}, false},
+		{"fail empty", 0, nil, nil, true},
+		{"fail reserved", 1 << 4, nil, nil, true},
+		{"fail unknown", 1 << 8, nil, nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, err := NewLeafProfile("leaf", iss, issPriv, WithHosts("leaf.smallstep.com"), WithNetscapeCertType(tt.flags))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("NewLeafProfile() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			crt := mustCreateCertificate(t, p)
+			ext, ok := findExtension(crt, oidExtNetscapeCertType)
+			if !ok {
+				t.Fatal("certificate does not have the netscape certificate type extension")
+			}
+			if ext.Critical {
+				t.Error("netscape certificate type extension is critical")
+			}
+			if !bytes.Equal(ext.Value, tt.wantDER) {
+				t.Errorf("extension value = %x, want %x", ext.Value, tt.wantDER)
+			}
+			var bs asn1.BitString
+			if rest, err := asn1.Unmarshal(ext.Value, &bs); err != nil || len(rest) > 0 {
+				t.Fatalf("asn1.Unmarshal() error = %v", err)
+			}
+			want := make(map[int]bool)
+			for _, i := range tt.wantBits {
+				want[i] = true
+			}
+			for i := 0; i < 8; i++ {
+				if got := bs.At(i) == 1; got != want[i] {
+					t.Errorf("bit %d = %v, want %v", i, got, want[i])
+				}
+			}
+		})
+	}
+}
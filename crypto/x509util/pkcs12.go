@@ -0,0 +1,315 @@
+package x509util
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"unicode/utf16"
+
+	"github.com/pkg/errors"
+	pkcs12 "software.sslmate.com/src/go-pkcs12"
+)
+
+// pkcs12Iterations is the number of iterations used in the PBKDF2 and MAC key
+// derivation of PKCS#12 files.
+const pkcs12Iterations = 2048
+
+var (
+	oidPKCS7Data            = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 7, 1}
+	oidPKCS7EncryptedData   = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 7, 6}
+	oidPKCS9LocalKeyID      = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 21}
+	oidPKCS9X509Certificate = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 22, 1}
+	oidPKCS12ShroudedKeyBag = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 12, 10, 1, 2}
+	oidPKCS12CertBag        = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 12, 10, 1, 3}
+	oidSHA256               = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 2, 1}
+)
+
+type pfxPDU struct {
+	Version  int
+	AuthSafe pkcs7ContentInfo
+	MacData  pfxMacData
+}
+
+type pkcs7ContentInfo struct {
+	ContentType asn1.ObjectIdentifier
+	Content     asn1.RawValue `asn1:"tag:0,explicit"`
+}
+
+type pfxMacData struct {
+	Mac struct {
+		Algorithm pkix.AlgorithmIdentifier
+		Digest    []byte
+	}
+	MacSalt    []byte
+	Iterations int
+}
+
+type pkcs7EncryptedData struct {
+	Version              int
+	EncryptedContentInfo struct {
+		ContentType                asn1.ObjectIdentifier
+		ContentEncryptionAlgorithm pkix.AlgorithmIdentifier
+		EncryptedContent           []byte `asn1:"tag:0,optional"`
+	}
+}
+
+type pkcs12SafeBag struct {
+	ID         asn1.ObjectIdentifier
+	Value      asn1.RawValue     `asn1:"tag:0,explicit"`
+	Attributes []pkcs12Attribute `asn1:"set,optional"`
+}
+
+type pkcs12Attribute struct {
+	ID    asn1.ObjectIdentifier
+	Value asn1.RawValue `asn1:"set"`
+}
+
+type pkcs12CertBag struct {
+	ID   asn1.ObjectIdentifier
+	Data []byte `asn1:"tag:0,explicit"`
+}
+
+// WithLegacyPKCS12Encryption returns a Profile modifier that makes
+// CreatePKCS12 use the legacy PKCS#12 encryption algorithms: RC2 for the
+// certificates, 3DES for the private key and a SHA-1 MAC. Use it only with
+// old keystores that do not support PBES2 with AES.
+func WithLegacyPKCS12Encryption() WithOption {
+	return func(p Profile) error {
+		b, err := getBase(p)
+		if err != nil {
+			return err
+		}
+		b.legacyPKCS12 = true
+		return nil
+	}
+}
+
+// CreatePKCS12 returns a DER encoded PKCS#12 file with the last certificate
+// created by CreateCertificate, the given chain, and the subject private key,
+// protected with the given password.
+//
+// By default the certificates and the private key are encrypted with PBES2
+// using PBKDF2 with HMAC-SHA256 and AES-256-CBC, and the file is authenticated
+// using HMAC-SHA256. Use WithLegacyPKCS12Encryption for the legacy
+// algorithms.
+func (b *base) CreatePKCS12(password string, chain ...*x509.Certificate) ([]byte, error) {
+	if b.crt == nil {
+		return nil, newError(ErrNotCreated, "certificate has not been created yet, call 'profile.CreateCertificate()' first")
+	}
+	key, err := b.exportableSubjectPrivateKey()
+	if err != nil {
+		return nil, err
+	}
+	if b.legacyPKCS12 {
+		data, err := pkcs12.Encode(rand.Reader, key, b.crt, chain, password)
+		return data, errors.Wrap(err, "error creating PKCS#12")
+	}
+	data, err := encodePKCS12(key, b.crt, chain, password)
+	return data, errors.Wrap(err, "error creating PKCS#12")
+}
+
+// encodePKCS12 creates a PKCS#12 file like the one created by OpenSSL 3. It
+// contains two safe contents, one encrypted with the certificates, and one
+// with the shrouded private key. Both use PBES2 with AES-256-CBC.
+func encodePKCS12(priv interface{}, crt *x509.Certificate, chain []*x509.Certificate, password string) ([]byte, error) {
+	fingerprint := sha1.Sum(crt.Raw)
+	localKeyID, err := newLocalKeyIDAttribute(fingerprint[:])
+	if err != nil {
+		return nil, err
+	}
+
+	// Certificates
+	certBags := make([]pkcs12SafeBag, 0, len(chain)+1)
+	for i, c := range append([]*x509.Certificate{crt}, chain...) {
+		if c == nil {
+			return nil, errors.New("chain cannot contain nil certificates")
+		}
+		bag, err := newCertBag(c)
+		if err != nil {
+			return nil, err
+		}
+		if i == 0 {
+			bag.Attributes = []pkcs12Attribute{localKeyID}
+		}
+		certBags = append(certBags, bag)
+	}
+	certsData, err := asn1.Marshal(certBags)
+	if err != nil {
+		return nil, err
+	}
+	certsAlg, certsEncrypted, err := pbes2Encrypt(certsData, []byte(password), KeyEncAES256CBC, pkcs12Iterations)
+	if err != nil {
+		return nil, err
+	}
+	var encryptedData pkcs7EncryptedData
+	encryptedData.EncryptedContentInfo.ContentType = oidPKCS7Data
+	encryptedData.EncryptedContentInfo.ContentEncryptionAlgorithm = certsAlg
+	encryptedData.EncryptedContentInfo.EncryptedContent = certsEncrypted
+	certsContent, err := newContentInfo(oidPKCS7EncryptedData, encryptedData)
+	if err != nil {
+		return nil, err
+	}
+
+	// Private key
+	keyData, err := x509.MarshalPKCS8PrivateKey(priv)
+	if err != nil {
+		return nil, errors.Wrap(err, "error marshaling private key")
+	}
+	keyAlg, keyEncrypted, err := pbes2Encrypt(keyData, []byte(password), KeyEncAES256CBC, pkcs12Iterations)
+	if err != nil {
+		return nil, err
+	}
+	keyBag := pkcs12SafeBag{
+		ID:         oidPKCS12ShroudedKeyBag,
+		Attributes: []pkcs12Attribute{localKeyID},
+	}
+	if keyBag.Value, err = newExplicitValue(encryptedPrivateKeyInfo{
+		Algorithm:     keyAlg,
+		EncryptedData: keyEncrypted,
+	}); err != nil {
+		return nil, err
+	}
+	keyBags, err := asn1.Marshal([]pkcs12SafeBag{keyBag})
+	if err != nil {
+		return nil, err
+	}
+	keyContent, err := newContentInfo(oidPKCS7Data, keyBags)
+	if err != nil {
+		return nil, err
+	}
+
+	// Authenticated safe
+	authSafe, err := asn1.Marshal([]pkcs7ContentInfo{certsContent, keyContent})
+	if err != nil {
+		return nil, err
+	}
+	pfx := pfxPDU{Version: 3}
+	if pfx.AuthSafe, err = newContentInfo(oidPKCS7Data, authSafe); err != nil {
+		return nil, err
+	}
+	if pfx.MacData, err = newMacData(authSafe, password); err != nil {
+		return nil, err
+	}
+	return asn1.Marshal(pfx)
+}
+
+func newLocalKeyIDAttribute(id []byte) (pkcs12Attribute, error) {
+	b, err := asn1.Marshal(id)
+	if err != nil {
+		return pkcs12Attribute{}, err
+	}
+	return pkcs12Attribute{
+		ID: oidPKCS9LocalKeyID,
+		Value: asn1.RawValue{
+			Class: asn1.ClassUniversal, Tag: asn1.TagSet, IsCompound: true, Bytes: b,
+		},
+	}, nil
+}
+
+func newCertBag(crt *x509.Certificate) (pkcs12SafeBag, error) {
+	value, err := newExplicitValue(pkcs12CertBag{
+		ID:   oidPKCS9X509Certificate,
+		Data: crt.Raw,
+	})
+	if err != nil {
+		return pkcs12SafeBag{}, err
+	}
+	return pkcs12SafeBag{ID: oidPKCS12CertBag, Value: value}, nil
+}
+
+func newContentInfo(oid asn1.ObjectIdentifier, v interface{}) (pkcs7ContentInfo, error) {
+	value, err := newExplicitValue(v)
+	if err != nil {
+		return pkcs7ContentInfo{}, err
+	}
+	return pkcs7ContentInfo{ContentType: oid, Content: value}, nil
+}
+
+// newExplicitValue returns the raw value used in a context-specific explicit
+// tag 0.
+func newExplicitValue(v interface{}) (asn1.RawValue, error) {
+	b, err := asn1.Marshal(v)
+	if err != nil {
+		return asn1.RawValue{}, err
+	}
+	return asn1.RawValue{
+		Class: asn1.ClassContextSpecific, Tag: 0, IsCompound: true, Bytes: b,
+	}, nil
+}
+
+// newMacData returns the HMAC-SHA256 of the authenticated safe, using a key
+// derived with the PKCS#12 key derivation function defined in RFC 7292,
+// appendix B.
+func newMacData(authSafe []byte, password string) (pfxMacData, error) {
+	var md pfxMacData
+	bmpPassword, err := bmpStringZeroTerminated(password)
+	if err != nil {
+		return md, err
+	}
+	salt := make([]byte, 16)
+	if _, err := rand.Read(salt); err != nil {
+		return md, errors.Wrap(err, "error generating salt")
+	}
+
+	key := pkcs12MacKey(salt, bmpPassword, pkcs12Iterations)
+	mac := hmac.New(sha256.New, key)
+	mac.Write(authSafe)
+
+	md.Mac.Algorithm = pkix.AlgorithmIdentifier{
+		Algorithm:  oidSHA256,
+		Parameters: asn1.NullRawValue,
+	}
+	md.Mac.Digest = mac.Sum(nil)
+	md.MacSalt = salt
+	md.Iterations = pkcs12Iterations
+	return md, nil
+}
+
+// pkcs12MacKey derives a SHA-256 MAC key using the PKCS#12 key derivation
+// function. As the key length is equal to the hash size, only the first block
+// of the derivation is needed.
+func pkcs12MacKey(salt, password []byte, iterations int) []byte {
+	const u, v = sha256.Size, sha256.BlockSize
+	fill := func(b []byte) []byte {
+		if len(b) == 0 {
+			return nil
+		}
+		n := v * ((len(b) + v - 1) / v)
+		ret := make([]byte, n)
+		for i := range ret {
+			ret[i] = b[i%len(b)]
+		}
+		return ret
+	}
+
+	// D is the diversifier, 3 for MAC keys.
+	d := make([]byte, v)
+	for i := range d {
+		d[i] = 3
+	}
+	input := append(d, fill(salt)...)
+	input = append(input, fill(password)...)
+
+	sum := sha256.Sum256(input)
+	for i := 1; i < iterations; i++ {
+		sum = sha256.Sum256(sum[:])
+	}
+	return sum[:u]
+}
+
+// bmpStringZeroTerminated returns the string encoded as a zero terminated
+// BMPString, the encoding used in PKCS#12 passwords.
+func bmpStringZeroTerminated(s string) ([]byte, error) {
+	ret := make([]byte, 0, 2*len(s)+2)
+	for _, r := range s {
+		if t, _ := utf16.EncodeRune(r); t != 0xfffd {
+			return nil, errors.New("password contains characters that cannot be encoded in a BMPString")
+		}
+		ret = append(ret, byte(r>>8), byte(r))
+	}
+	return append(ret, 0, 0), nil
+}
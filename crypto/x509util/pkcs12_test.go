@@ -0,0 +1,76 @@
+package x509util
+
+import (
+	"crypto/x509"
+	"reflect"
+	"testing"
+
+	pkcs12 "software.sslmate.com/src/go-pkcs12"
+)
+
+func TestBase_CreatePKCS12(t *testing.T) {
+	iss := mustParseCertificate(t, "test_files/noPasscodeCa.crt")
+	issPriv := mustParseRSAKey(t, "test_files/noPasscodeCa.key")
+
+	tests := []struct {
+		name     string
+		password string
+		options  []WithOption
+		chain    []*x509.Certificate
+	}{
+		{"ok", "password", nil, []*x509.Certificate{iss}},
+		{"ok/no-chain", "password", nil, nil},
+		{"ok/empty-password", "", nil, []*x509.Certificate{iss}},
+		{"ok/unicode-password", "contraseña", nil, []*x509.Certificate{iss}},
+		{"ok/rsa", "password", []WithOption{GenerateKeyPair("RSA", "", 2048)}, []*x509.Certificate{iss}},
+		{"ok/ed25519", "password", []WithOption{GenerateKeyPair("OKP", "Ed25519", 0)}, []*x509.Certificate{iss}},
+		{"ok/legacy", "password", []WithOption{WithLegacyPKCS12Encryption()}, []*x509.Certificate{iss}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := mustNewProfile(t)(NewLeafProfile("test.smallstep.com", iss, issPriv, tt.options...))
+			if _, err := p.CreatePKCS12(tt.password, tt.chain...); err == nil {
+				t.Fatal("CreatePKCS12() error = nil, want error before CreateCertificate")
+			}
+			crt := mustCreateCertificate(t, p)
+
+			data, err := p.CreatePKCS12(tt.password, tt.chain...)
+			if err != nil {
+				t.Fatalf("CreatePKCS12() error = %v", err)
+			}
+			key, cert, caCerts, err := pkcs12.DecodeChain(data, tt.password)
+			if err != nil {
+				t.Fatalf("pkcs12.DecodeChain() error = %v", err)
+			}
+			if !cert.Equal(crt) {
+				t.Error("pkcs12.DecodeChain() certificate does not match")
+			}
+			if len(caCerts) != len(tt.chain) {
+				t.Fatalf("pkcs12.DecodeChain() got %d ca certificates, want %d", len(caCerts), len(tt.chain))
+			}
+			for i := range caCerts {
+				if !caCerts[i].Equal(tt.chain[i]) {
+					t.Errorf("pkcs12.DecodeChain() ca certificate %d does not match", i)
+				}
+			}
+			if !reflect.DeepEqual(key, p.SubjectPrivateKey()) {
+				t.Error("pkcs12.DecodeChain() private key does not match")
+			}
+			if _, _, _, err := pkcs12.DecodeChain(data, tt.password+"x"); err == nil {
+				t.Error("pkcs12.DecodeChain() with wrong password error = nil")
+			}
+		})
+	}
+}
+
+func TestBase_CreatePKCS12_noPrivateKey(t *testing.T) {
+	iss := mustParseCertificate(t, "test_files/noPasscodeCa.crt")
+	issPriv := mustParseRSAKey(t, "test_files/noPasscodeCa.key")
+
+	p := mustNewProfile(t)(NewLeafProfile("test.smallstep.com", iss, issPriv,
+		WithPublicKey(mustParseCertificate(t, "test_files/ca.crt").PublicKey)))
+	mustCreateCertificate(t, p)
+	if _, err := p.CreatePKCS12("password"); err == nil {
+		t.Error("CreatePKCS12() error = nil, want error")
+	}
+}
@@ -0,0 +1,99 @@
+package x509util
+
+import (
+	"crypto/x509/pkix"
+	"encoding/asn1"
+
+	"github.com/pkg/errors"
+)
+
+var (
+	// oidExtPolicyConstraints is the OID for the policy constraints
+	// extension defined in RFC 5280, section 4.2.1.11.
+	oidExtPolicyConstraints = asn1.ObjectIdentifier{2, 5, 29, 36}
+	// oidExtInhibitAnyPolicy is the OID for the inhibit anyPolicy extension
+	// defined in RFC 5280, section 4.2.1.14.
+	oidExtInhibitAnyPolicy = asn1.ObjectIdentifier{2, 5, 29, 54}
+)
+
+// policyConstraints is the ASN.1 structure of the policy constraints
+// extension. A value of -1 omits the field.
+//
+//	PolicyConstraints ::= SEQUENCE {
+//	     requireExplicitPolicy           [0] SkipCerts OPTIONAL,
+//	     inhibitPolicyMapping            [1] SkipCerts OPTIONAL }
+type policyConstraints struct {
+	RequireExplicitPolicy int `asn1:"optional,tag:0,default:-1"`
+	InhibitPolicyMapping  int `asn1:"optional,tag:1,default:-1"`
+}
+
+// WithPolicyConstraints returns a Profile modifier that adds the critical
+// policy constraints extension to the subject x509 Certificate.
+// requireExplicit and inhibitMapping are the number of additional
+// certificates that may appear in the path before an explicit policy is
+// required or policy mapping is no longer permitted; a nil value omits the
+// field, but at least one of them must be set.
+//
+// The policy constraints extension can only be used in CA profiles.
+func WithPolicyConstraints(requireExplicit, inhibitMapping *int) WithOption {
+	return func(p Profile) error {
+		if err := requireCAProfile(p, "WithPolicyConstraints"); err != nil {
+			return err
+		}
+		if requireExplicit == nil && inhibitMapping == nil {
+			return errors.New("policy constraints must set requireExplicit or inhibitMapping")
+		}
+		pc := policyConstraints{RequireExplicitPolicy: -1, InhibitPolicyMapping: -1}
+		if requireExplicit != nil {
+			if *requireExplicit < 0 {
+				return errors.New("policy constraints requireExplicit cannot be negative")
+			}
+			pc.RequireExplicitPolicy = *requireExplicit
+		}
+		if inhibitMapping != nil {
+			if *inhibitMapping < 0 {
+				return errors.New("policy constraints inhibitMapping cannot be negative")
+			}
+			pc.InhibitPolicyMapping = *inhibitMapping
+		}
+		value, err := asn1.Marshal(pc)
+		if err != nil {
+			return errors.Wrap(err, "error marshaling policy constraints")
+		}
+		crt := p.Subject()
+		crt.ExtraExtensions = append(removeExtension(crt.ExtraExtensions, oidExtPolicyConstraints), pkix.Extension{
+			Id:       oidExtPolicyConstraints,
+			Critical: true,
+			Value:    value,
+		})
+		return nil
+	}
+}
+
+// WithInhibitAnyPolicy returns a Profile modifier that adds the critical
+// inhibit anyPolicy extension to the subject x509 Certificate. skipCerts is
+// the number of additional certificates that may appear in the path before
+// anyPolicy is no longer permitted.
+//
+// The inhibit anyPolicy extension can only be used in CA profiles.
+func WithInhibitAnyPolicy(skipCerts int) WithOption {
+	return func(p Profile) error {
+		if err := requireCAProfile(p, "WithInhibitAnyPolicy"); err != nil {
+			return err
+		}
+		if skipCerts < 0 {
+			return errors.New("inhibit anyPolicy skipCerts cannot be negative")
+		}
+		value, err := asn1.Marshal(skipCerts)
+		if err != nil {
+			return errors.Wrap(err, "error marshaling inhibit anyPolicy")
+		}
+		crt := p.Subject()
+		crt.ExtraExtensions = append(removeExtension(crt.ExtraExtensions, oidExtInhibitAnyPolicy), pkix.Extension{
+			Id:       oidExtInhibitAnyPolicy,
+			Critical: true,
+			Value:    value,
+		})
+		return nil
+	}
+}
@@ -0,0 +1,121 @@
+package x509util
+
+import (
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"strings"
+	"testing"
+)
+
+func findExtension(crt *x509.Certificate, oid asn1.ObjectIdentifier) (pkix.Extension, bool) {
+	for _, ext := range crt.Extensions {
+		if ext.Id.Equal(oid) {
+			return ext, true
+		}
+	}
+	return pkix.Extension{}, false
+}
+
+func TestWithPolicyConstraints(t *testing.T) {
+	iss := mustParseCertificate(t, "test_files/noPasscodeCa.crt")
+	issPriv := mustParseRSAKey(t, "test_files/noPasscodeCa.key")
+	zero, one, minusOne := 0, 1, -1
+
+	tests := []struct {
+		name            string
+		requireExplicit *int
+		inhibitMapping  *int
+		want            policyConstraints
+		wantErr         string
+	}{
+		{"ok both", &zero, &one, policyConstraints{0, 1}, ""},
+		{"ok requireExplicit", &one, nil, policyConstraints{1, -1}, ""},
+		{"ok inhibitMapping", nil, &zero, policyConstraints{-1, 0}, ""},
+		{"fail none", nil, nil, policyConstraints{}, "must set requireExplicit or inhibitMapping"},
+		{"fail negative requireExplicit", &minusOne, nil, policyConstraints{}, "requireExplicit cannot be negative"},
+		{"fail negative inhibitMapping", nil, &minusOne, policyConstraints{}, "inhibitMapping cannot be negative"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, err := NewIntermediateProfile("intermediate", iss, issPriv, WithPolicyConstraints(tt.requireExplicit, tt.inhibitMapping), WithSkipPathLenCheck())
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("NewIntermediateProfile() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			crt := mustCreateCertificate(t, mustNewProfile(t)(p, err))
+			ext, ok := findExtension(crt, oidExtPolicyConstraints)
+			if !ok {
+				t.Fatal("certificate does not have the policy constraints extension")
+			}
+			if !ext.Critical {
+				t.Error("policy constraints extension is not critical")
+			}
+			var got policyConstraints
+			if rest, err := asn1.Unmarshal(ext.Value, &got); err != nil || len(rest) > 0 {
+				t.Fatalf("asn1.Unmarshal() error = %v, rest = %x", err, rest)
+			}
+			if got != tt.want {
+				t.Errorf("policy constraints = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+
+	t.Run("fail leaf", func(t *testing.T) {
+		_, err := NewLeafProfile("leaf", iss, issPriv, WithPolicyConstraints(&zero, nil))
+		if err == nil || !strings.Contains(err.Error(), "can only be used in CA profiles") {
+			t.Errorf("NewLeafProfile() error = %v, want CA profiles error", err)
+		}
+	})
+}
+
+func TestWithInhibitAnyPolicy(t *testing.T) {
+	iss := mustParseCertificate(t, "test_files/noPasscodeCa.crt")
+	issPriv := mustParseRSAKey(t, "test_files/noPasscodeCa.key")
+
+	tests := []struct {
+		name      string
+		skipCerts int
+		wantErr   string
+	}{
+		{"ok zero", 0, ""},
+		{"ok two", 2, ""},
+		{"fail negative", -1, "skipCerts cannot be negative"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, err := NewIntermediateProfile("intermediate", iss, issPriv, WithInhibitAnyPolicy(tt.skipCerts), WithSkipPathLenCheck())
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("NewIntermediateProfile() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			crt := mustCreateCertificate(t, mustNewProfile(t)(p, err))
+			ext, ok := findExtension(crt, oidExtInhibitAnyPolicy)
+			if !ok {
+				t.Fatal("certificate does not have the inhibit anyPolicy extension")
+			}
+			if !ext.Critical {
+				t.Error("inhibit anyPolicy extension is not critical")
+			}
+			var got int
+			if rest, err := asn1.Unmarshal(ext.Value, &got); err != nil || len(rest) > 0 {
+				t.Fatalf("asn1.Unmarshal() error = %v, rest = %x", err, rest)
+			}
+			if got != tt.skipCerts {
+				t.Errorf("skipCerts = %d, want %d", got, tt.skipCerts)
+			}
+		})
+	}
+
+	t.Run("fail leaf", func(t *testing.T) {
+		_, err := NewLeafProfile("leaf", iss, issPriv, WithInhibitAnyPolicy(0))
+		if err == nil || !strings.Contains(err.Error(), "can only be used in CA profiles") {
+			t.Errorf("NewLeafProfile() error = %v, want CA profiles error", err)
+		}
+	})
+}
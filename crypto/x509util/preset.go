@@ -0,0 +1,161 @@
+package x509util
+
+import (
+	"crypto/elliptic"
+	"crypto/x509"
+	"encoding/asn1"
+
+	"github.com/pkg/errors"
+)
+
+// Preset is a bundle of profile settings required by a PKI regime, like the
+// key type and size, the signature algorithm and the certificate policies.
+// Presets are applied using WithPreset, the zero value of a field means that
+// the preset does not change that setting.
+type Preset struct {
+	// Name is the name of the preset used in error messages.
+	Name string
+	// KeyType, KeyCurve and KeySize are the parameters used to generate the
+	// subject key pair, see GenerateKeyPair.
+	KeyType  string
+	KeyCurve string
+	KeySize  int
+	// KeyPolicy, if set, validates the subject public key, see WithKeyPolicy.
+	KeyPolicy *KeyPolicy
+	// SignatureAlgorithm is the algorithm used to sign the certificate, it
+	// must be compatible with the issuer key.
+	SignatureAlgorithm x509.SignatureAlgorithm
+	// PolicyIdentifiers are added to the certificate policies of the
+	// certificate.
+	PolicyIdentifiers []asn1.ObjectIdentifier
+	// QCStatements are the qualified certificate statements of the
+	// certificate, see WithQCStatements.
+	QCStatements []asn1.ObjectIdentifier
+}
+
+// Certificate policies used by the named presets.
+var (
+	// OIDPolicyEIDASQCPnQSCD is the ETSI EN 319 411-2 policy for EU qualified
+	// certificates issued to natural persons with the private key in a
+	// qualified signature creation device (QCP-n-qscd).
+	OIDPolicyEIDASQCPnQSCD = asn1.ObjectIdentifier{0, 4, 0, 194112, 1, 2}
+	// OIDPolicyEIDASQCPw is the ETSI EN 319 411-2 policy for EU qualified
+	// website authentication certificates (QCP-w).
+	OIDPolicyEIDASQCPw = asn1.ObjectIdentifier{0, 4, 0, 194112, 1, 4}
+	// OIDPolicyFBCAMediumHardware is the US Federal Bridge CA medium
+	// hardware assurance policy (id-fpki-certpcy-mediumHardware).
+	OIDPolicyFBCAMediumHardware = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 2, 1, 3, 12}
+)
+
+// Named presets for common national PKIs. They can be copied and modified to
+// create custom presets.
+var (
+	// PresetEIDASQualifiedNaturalPerson is a preset for EU qualified
+	// certificates for natural persons with the key in a QSCD: RSA 3072 keys
+	// signed with SHA-256, the QCP-n-qscd policy, and the QC compliance and
+	// QSCD statements.
+	PresetEIDASQualifiedNaturalPerson = Preset{
+		Name:               "eIDAS qualified natural person",
+		KeyType:            "RSA",
+		KeySize:            3072,
+		KeyPolicy:          &KeyPolicy{MinRSABits: 3072, ECDSACurves: []elliptic.Curve{elliptic.P256(), elliptic.P384(), elliptic.P521()}},
+		SignatureAlgorithm: x509.SHA256WithRSA,
+		PolicyIdentifiers:  []asn1.ObjectIdentifier{OIDPolicyEIDASQCPnQSCD},
+		QCStatements:       []asn1.ObjectIdentifier{OIDQCCompliance, OIDQCSSCD},
+	}
+	// PresetEIDASQualifiedWebsite is a preset for EU qualified website
+	// authentication certificates: RSA 3072 keys signed with SHA-256, the
+	// QCP-w policy, and the QC compliance statement.
+	PresetEIDASQualifiedWebsite = Preset{
+		Name:               "eIDAS qualified website",
+		KeyType:            "RSA",
+		KeySize:            3072,
+		KeyPolicy:          &KeyPolicy{MinRSABits: 3072, ECDSACurves: []elliptic.Curve{elliptic.P256(), elliptic.P384(), elliptic.P521()}},
+		SignatureAlgorithm: x509.SHA256WithRSA,
+		PolicyIdentifiers:  []asn1.ObjectIdentifier{OIDPolicyEIDASQCPw},
+		QCStatements:       []asn1.ObjectIdentifier{OIDQCCompliance},
+	}
+	// PresetFederalBridgeMediumHardware is a preset for certificates asserting
+	// the US Federal Bridge medium hardware policy: RSA 2048 keys signed with
+	// SHA-256.
+	PresetFederalBridgeMediumHardware = Preset{
+		Name:               "Federal Bridge medium hardware",
+		KeyType:            "RSA",
+		KeySize:            2048,
+		KeyPolicy:          &KeyPolicy{MinRSABits: 2048, ECDSACurves: []elliptic.Curve{elliptic.P256(), elliptic.P384()}},
+		SignatureAlgorithm: x509.SHA256WithRSA,
+		PolicyIdentifiers:  []asn1.ObjectIdentifier{OIDPolicyFBCAMediumHardware},
+	}
+)
+
+// WithPreset returns a Profile modifier that applies all the settings of the
+// given preset. The preset is applied atomically, if any setting fails, the
+// profile is not modified.
+//
+// Modifiers are applied in order, so the settings of the preset override the
+// ones set by previous modifiers, and the modifiers after WithPreset override
+// the preset. For example, WithSignatureAlgorithm after WithPreset replaces the
+// signature algorithm of the preset. The policy identifiers of the preset are
+// added to the existing ones.
+func WithPreset(preset Preset) WithOption {
+	return func(p Profile) error {
+		b, err := getBase(p)
+		if err != nil {
+			return err
+		}
+		var opts []WithOption
+		if preset.KeyType != "" {
+			opts = append(opts, GenerateKeyPair(preset.KeyType, preset.KeyCurve, preset.KeySize))
+		}
+		if preset.KeyPolicy != nil {
+			opts = append(opts, WithKeyPolicy(*preset.KeyPolicy))
+		}
+		if preset.SignatureAlgorithm != x509.UnknownSignatureAlgorithm {
+			opts = append(opts, WithSignatureAlgorithm(preset.SignatureAlgorithm))
+		}
+		if len(preset.PolicyIdentifiers) > 0 {
+			opts = append(opts, withPolicyIdentifiers(preset.PolicyIdentifiers))
+		}
+		if len(preset.QCStatements) > 0 {
+			opts = append(opts, WithQCStatements(preset.QCStatements))
+		}
+
+		// Restore the profile if any of the modifiers fails.
+		saved, savedSub := *b, *copyCertificate(b.sub)
+		for _, fn := range opts {
+			if err := fn(p); err != nil {
+				*b = saved
+				*b.sub = savedSub
+				return errors.Wrapf(err, "error applying preset %q", preset.Name)
+			}
+		}
+		return nil
+	}
+}
+
+// withPolicyIdentifiers adds the given policy identifiers to the subject
+// certificate, skipping the ones already present.
+func withPolicyIdentifiers(oids []asn1.ObjectIdentifier) WithOption {
+	return func(p Profile) error {
+		crt := p.Subject()
+		for _, oid := range oids {
+			if len(oid) == 0 {
+				return errors.New("policy identifier cannot be empty")
+			}
+			if !containsOID(crt.PolicyIdentifiers, oid) {
+				crt.PolicyIdentifiers = append(crt.PolicyIdentifiers, oid)
+			}
+		}
+		return nil
+	}
+}
+
+// containsOID returns true if the list contains the given object identifier.
+func containsOID(oids []asn1.ObjectIdentifier, oid asn1.ObjectIdentifier) bool {
+	for _, o := range oids {
+		if o.Equal(oid) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,82 @@
+package x509util
+
+import (
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/asn1"
+	"reflect"
+	"testing"
+)
+
+func TestWithPreset(t *testing.T) {
+	iss := mustParseCertificate(t, "test_files/noPasscodeCa.crt")
+	issPriv := mustParseRSAKey(t, "test_files/noPasscodeCa.key")
+	oidCustom := asn1.ObjectIdentifier{1, 2, 3, 4}
+
+	tests := []struct {
+		name         string
+		opts         []WithOption
+		wantAlg      x509.SignatureAlgorithm
+		wantPolicies []asn1.ObjectIdentifier
+		wantQC       bool
+		wantKeySize  int
+	}{
+		{"ok/eidas-natural-person", []WithOption{WithPreset(PresetEIDASQualifiedNaturalPerson)},
+			x509.SHA256WithRSA, []asn1.ObjectIdentifier{OIDPolicyEIDASQCPnQSCD}, true, 3072},
+		{"ok/eidas-website", []WithOption{WithPreset(PresetEIDASQualifiedWebsite)},
+			x509.SHA256WithRSA, []asn1.ObjectIdentifier{OIDPolicyEIDASQCPw}, true, 3072},
+		{"ok/federal-bridge", []WithOption{WithPreset(PresetFederalBridgeMediumHardware)},
+			x509.SHA256WithRSA, []asn1.ObjectIdentifier{OIDPolicyFBCAMediumHardware}, false, 2048},
+		{"ok/override-after", []WithOption{WithPreset(PresetFederalBridgeMediumHardware), WithSignatureAlgorithm(x509.SHA384WithRSA)},
+			x509.SHA384WithRSA, []asn1.ObjectIdentifier{OIDPolicyFBCAMediumHardware}, false, 2048},
+		{"ok/overridden-before", []WithOption{WithSignatureAlgorithm(x509.SHA384WithRSA), WithPreset(PresetFederalBridgeMediumHardware)},
+			x509.SHA256WithRSA, []asn1.ObjectIdentifier{OIDPolicyFBCAMediumHardware}, false, 2048},
+		{"ok/add-policies", []WithOption{withPolicyIdentifiers([]asn1.ObjectIdentifier{oidCustom}), WithPreset(PresetFederalBridgeMediumHardware), WithPreset(PresetFederalBridgeMediumHardware)},
+			x509.SHA256WithRSA, []asn1.ObjectIdentifier{oidCustom, OIDPolicyFBCAMediumHardware}, false, 2048},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := mustNewProfile(t)(NewLeafProfile("leaf", iss, issPriv, append([]WithOption{WithHosts("leaf.smallstep.com")}, tt.opts...)...))
+			crt := mustCreateCertificate(t, p)
+			if crt.SignatureAlgorithm != tt.wantAlg {
+				t.Errorf("SignatureAlgorithm = %v, want %v", crt.SignatureAlgorithm, tt.wantAlg)
+			}
+			if !reflect.DeepEqual(crt.PolicyIdentifiers, tt.wantPolicies) {
+				t.Errorf("PolicyIdentifiers = %v, want %v", crt.PolicyIdentifiers, tt.wantPolicies)
+			}
+			if _, ok := findExtension(crt, oidExtQCStatements); ok != tt.wantQC {
+				t.Errorf("qcStatements extension present = %v, want %v", ok, tt.wantQC)
+			}
+			if pub, ok := crt.PublicKey.(*rsa.PublicKey); !ok || pub.N.BitLen() != tt.wantKeySize {
+				t.Errorf("PublicKey = %T, want a %d-bit RSA key", crt.PublicKey, tt.wantKeySize)
+			}
+		})
+	}
+
+	t.Run("fail/key-policy", func(t *testing.T) {
+		// The preset key policy rejects the 2048-bit key.
+		p := mustNewProfile(t)(NewLeafProfile("leaf", iss, issPriv, WithPreset(PresetEIDASQualifiedWebsite),
+			WithPublicKey(mustLoadCSR(t, "test_files/test.smallstep.com.csr").PublicKey)))
+		if _, err := p.CreateCertificate(); err == nil {
+			t.Error("CreateCertificate() error = nil, want error")
+		}
+	})
+
+	t.Run("fail/atomic", func(t *testing.T) {
+		p := mustNewProfile(t)(NewLeafProfile("leaf", iss, issPriv))
+		preset := PresetFederalBridgeMediumHardware
+		preset.QCStatements = []asn1.ObjectIdentifier{{}}
+		if err := WithPreset(preset)(p); err == nil {
+			t.Fatal("WithPreset() error = nil, want error")
+		}
+		if alg := p.Subject().SignatureAlgorithm; alg != x509.UnknownSignatureAlgorithm {
+			t.Errorf("SignatureAlgorithm = %v, want it unchanged", alg)
+		}
+		if len(p.Subject().PolicyIdentifiers) > 0 {
+			t.Errorf("PolicyIdentifiers = %v, want them unchanged", p.Subject().PolicyIdentifiers)
+		}
+		if b, _ := getBase(p); b.keyPolicy != nil || b.keyType != "" {
+			t.Error("key settings were modified by a failed preset")
+		}
+	})
+}
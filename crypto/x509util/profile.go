@@ -1,7 +1,11 @@
 package x509util
 
 import (
+	"context"
 	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
 	"crypto/rand"
 	"crypto/rsa"
 	"crypto/sha1"
@@ -9,16 +13,22 @@ import (
 	"crypto/x509/pkix"
 	"encoding/asn1"
 	"encoding/pem"
+	"fmt"
+	"io"
 	"math/big"
 	"net"
+	"net/mail"
 	"net/url"
+	"strconv"
 	"strings"
 	"time"
+	"unicode"
 
 	"github.com/pkg/errors"
 	"github.com/smallstep/cli/crypto/keys"
 	"github.com/smallstep/cli/crypto/pemutil"
 	"github.com/smallstep/cli/utils"
+	"golang.org/x/net/idna"
 )
 
 // Cribbed directly from golang src crypto/x509/x509.go
@@ -88,22 +98,45 @@ var (
 
 // Profile is an interface that certificate profiles (e.g. leaf,
 // intermediate, root) must implement.
+//
+// A profile is not safe for concurrent use. To create certificates
+// concurrently from the same configuration, create one profile and use Clone
+// to get a copy for each goroutine; a clone can be modified and signed
+// independently of the original and of the other clones.
 type Profile interface {
 	Issuer() *x509.Certificate
 	Subject() *x509.Certificate
 	SubjectPrivateKey() interface{}
-	SubjectPublicKey() interface{}
+	SubjectPublicKey() crypto.PublicKey
+	SubjectSigner() (crypto.Signer, error)
 	SetIssuer(*x509.Certificate)
 	SetSubject(*x509.Certificate)
 	SetSubjectPrivateKey(interface{})
 	SetSubjectPublicKey(interface{})
 	SetIssuerPrivateKey(interface{})
 	CreateCertificate() ([]byte, error)
+	CreatePrecertificate() ([]byte, error)
+	CreateCertificateWithCT() (precert, crt []byte, err error)
+	TBSCertificate() ([]byte, x509.SignatureAlgorithm, error)
+	AssembleSignedCertificate(signature []byte) ([]byte, error)
+	Verify(roots, intermediates *x509.CertPool, opts x509.VerifyOptions) ([][]*x509.Certificate, error)
+	CreatePKCS12(password string, chain ...*x509.Certificate) ([]byte, error)
+	WritePEMBundle(w io.Writer, chain []*x509.Certificate, includeKey bool) error
+	CertificateDER() ([]byte, error)
+	Fingerprint() (string, error)
+	EncryptedSubjectKeyPEM(passphrase []byte, opts ...KeyEncOption) (*pem.Block, error)
+	EncryptedPrivateKeyPEM(passphrase []byte) ([]byte, error)
+	SubjectKeyJWK() ([]byte, error)
+	SubjectPrivateKeyJWK() ([]byte, error)
 	GenerateKeyPair(string, string, int) error
 	DefaultDuration() time.Duration
 	CreateWriteCertificate(crtOut, keyOut, pass string) ([]byte, error)
 	AddExtension(pkix.Extension)
 	RemoveExtension(asn1.ObjectIdentifier)
+	Validate() error
+	Lint() []LintError
+	Describe() ProfileSummary
+	Clone() Profile
 }
 
 type base struct {
@@ -113,6 +146,133 @@ type base struct {
 	subPub  interface{}
 	subPriv interface{}
 	issPriv interface{}
+	// requiredKeyUsage contains the key usages explicitly requested using
+	// the key usage modifiers, these are never removed at signing time.
+	requiredKeyUsage x509.KeyUsage
+	// clock returns the current time, if not set time.Now is used.
+	clock func() time.Time
+	// serialNumberBits is the number of random bits of the serial number.
+	serialNumberBits int
+	// skipSerialNumberCheck disables the validation of the serial number.
+	skipSerialNumberCheck bool
+	// duration is the validity of the certificate if NotAfter is not set.
+	duration time.Duration
+	// skipIssuerValidation disables the validation of the issuer certificate
+	// and of its private key.
+	skipIssuerValidation bool
+	// batchWorkers is the number of concurrent workers used by IssueBatch.
+	batchWorkers int
+	// isLeaf is set if the profile is a leaf profile.
+	isLeaf bool
+	// skipLint disables the linter, skipLints disables only some findings.
+	skipLint  bool
+	skipLints map[string]struct{}
+	// lintRules are the additional lint checks enabled by the profile
+	// presets.
+	lintRules []lintRule
+	// authorityKeyID overrides the authority key identifier.
+	authorityKeyID []byte
+	// hooks and mutatingHooks are called before signing a certificate.
+	hooks         []PreIssuanceHook
+	mutatingHooks []PreIssuanceHook
+	// crt is the last certificate created by CreateCertificate.
+	crt *x509.Certificate
+	// tbs is the last to-be-signed certificate created by TBSCertificate.
+	tbs *tbsCertificate
+	// ctx is the context used to generate keys and sign certificates.
+	ctx context.Context
+	// keyType, keyCurve and keySize are the parameters used to generate the
+	// subject key pair.
+	keyType  string
+	keyCurve string
+	keySize  int
+	// keyPool is used to get the subject key pair.
+	keyPool *KeyPool
+	// sctProvider returns the SCTs of a precertificate in
+	// CreateCertificateWithCT.
+	sctProvider func(precertDER []byte) ([][]byte, error)
+	// keyPairGenerator replaces the generation of the subject key pair.
+	keyPairGenerator func() (crypto.PublicKey, crypto.PrivateKey, error)
+	// legacyPKCS12 enables the legacy encryption in CreatePKCS12.
+	legacyPKCS12 bool
+	// defaultDuration overrides the package default duration of the profile.
+	defaultDuration time.Duration
+	// backdate is subtracted from the default NotBefore to tolerate clock
+	// skew.
+	backdate time.Duration
+	// keyUsageFromKey sets the key usage using DefaultKeyUsageForKey once
+	// the subject key is known.
+	keyUsageFromKey bool
+	// skiMethod is the method used to generate the subject key identifier.
+	skiMethod SKIMethod
+	// csrExtPolicy is the policy used to copy the extensions of a CSR.
+	csrExtPolicy CSRExtensionPolicy
+	// challengePasswordValidator validates the challengePassword of a CSR.
+	challengePasswordValidator func(string) error
+	// templateFuncs are the functions set with WithTemplateFunc.
+	templateFuncs []func(*x509.Certificate) error
+	// skipNameConstraintCheck disables the validation of the subject
+	// alternative names against the issuer name constraints.
+	skipNameConstraintCheck bool
+	// skipPathLenCheck disables the validation of the path length of CA
+	// certificates against the issuer path length constraint.
+	skipPathLenCheck bool
+	// criticalExts are the extension criticalities set with
+	// WithCriticalExtension.
+	criticalExts []criticalExtension
+	// generalNames are the subject alternative names that cannot be set
+	// using the template fields.
+	generalNames []asn1.RawValue
+	// certificatePolicies are the certificate policies with qualifiers set
+	// with WithCertificatePolicy.
+	certificatePolicies []policyInformation
+	// keyPolicy is the policy used to validate the subject public key, if
+	// not set DefaultKeyPolicy is used.
+	keyPolicy *KeyPolicy
+	// random is the reader used to generate keys and serial numbers, if not
+	// set crypto/rand is used.
+	random io.Reader
+	// noSAN removes the subject alternative name extension.
+	noSAN bool
+	// dnsNamePolicy is the policy used to validate the DNS names, by default
+	// DNSNamePolicyNormalize.
+	dnsNamePolicy DNSNamePolicy
+	// ipSANPolicy is the policy used to validate the IP addresses, by
+	// default IPSANPolicyAllowInternal.
+	ipSANPolicy IPSANPolicy
+	// preserveSANOrder encodes the subject alternative names in the order
+	// they were added, recorded in sanOrder.
+	preserveSANOrder bool
+	sanOrder         []asn1.RawValue
+	// rawSubjectFromCSR copies the raw subject of the CSR in
+	// NewLeafProfileWithCSR.
+	rawSubjectFromCSR bool
+	// allowIssuerKeyReuse allows a subject public key equal to the issuer
+	// public key in certificates that are not self-signed.
+	allowIssuerKeyReuse bool
+	// allowIssuerValidityMismatch allows a validity that is not within the
+	// validity of the issuer.
+	allowIssuerValidityMismatch bool
+	// forceGeneralizedTime encodes the validity using GeneralizedTime.
+	forceGeneralizedTime bool
+}
+
+// baseProfile is implemented by all the profiles in this package, it gives
+// the profile modifiers access to the common state of a profile.
+type baseProfile interface {
+	baseProfile() *base
+}
+
+func (b *base) baseProfile() *base {
+	return b
+}
+
+// getBase returns the common state of the given profile.
+func getBase(p Profile) (*base, error) {
+	if bp, ok := p.(baseProfile); ok {
+		return bp.baseProfile(), nil
+	}
+	return nil, errors.Errorf("unsupported profile type %T", p)
 }
 
 // WithOption is a modifier function on base.
@@ -120,22 +280,69 @@ type WithOption func(Profile) error
 
 // GenerateKeyPair returns a Profile modifier that generates a public/private
 // key pair for a profile.
+//
+// The key pair is generated after all the modifiers have been applied, so it
+// will use the context set with WithContext. The key pair is not generated if
+// a public key is set using WithPublicKey.
 func GenerateKeyPair(kty, crv string, size int) WithOption {
 	return func(p Profile) error {
-		return p.GenerateKeyPair(kty, crv, size)
+		b, err := getBase(p)
+		if err != nil {
+			return err
+		}
+		b.keyType, b.keyCurve, b.keySize = kty, crv, size
+		return nil
+	}
+}
+
+// WithKeyPairGenerator returns a Profile modifier that uses the given function
+// to create the subject key pair instead of generating a software key. It can
+// be used to generate keys in an HSM or a KMS. The private key returned by the
+// function can be an opaque crypto.Signer, or nil if it never leaves the
+// device; these keys cannot be exported using EncryptedSubjectKeyPEM,
+// CreatePKCS12 or CreateWriteCertificate.
+//
+// As with GenerateKeyPair, the function is not called if a public key is set
+// using WithPublicKey.
+func WithKeyPairGenerator(fn func() (crypto.PublicKey, crypto.PrivateKey, error)) WithOption {
+	return func(p Profile) error {
+		if fn == nil {
+			return errors.New("key pair generator cannot be nil")
+		}
+		b, err := getBase(p)
+		if err != nil {
+			return err
+		}
+		b.keyPairGenerator = fn
+		return nil
 	}
 }
 
 // GenerateDefaultKeyPair generates a new public/private key pair using the
 // default values and sets them in the given profile.
 func GenerateDefaultKeyPair(p Profile) error {
-	pub, priv, err := keys.GenerateDefaultKeyPair()
+	b, err := getBase(p)
 	if err != nil {
 		return err
 	}
-	p.SetSubjectPublicKey(pub)
-	p.SetSubjectPrivateKey(priv)
-	return nil
+	return b.GenerateDefaultKeyPair()
+}
+
+// WithContext returns a Profile modifier that sets the context used to
+// generate the key pair and to sign the certificate. If the context is
+// canceled the operation will be aborted with the context error.
+func WithContext(ctx context.Context) WithOption {
+	return func(p Profile) error {
+		if ctx == nil {
+			return errors.New("context cannot be nil")
+		}
+		b, err := getBase(p)
+		if err != nil {
+			return err
+		}
+		b.ctx = ctx
+		return nil
+	}
 }
 
 // WithPublicKey returns a Profile modifier that sets the public key for a profile.
@@ -147,15 +354,85 @@ func WithPublicKey(pub interface{}) WithOption {
 }
 
 // WithSubject returns a Profile modifier that sets the Subject for a x509
-// Certificate.
+// Certificate. If the given name does not have a CommonName, the CommonName
+// of the current subject is preserved.
 func WithSubject(sub pkix.Name) WithOption {
 	return func(p Profile) error {
 		crt := p.Subject()
+		if sub.CommonName == "" {
+			sub.CommonName = crt.Subject.CommonName
+		}
 		crt.Subject = sub
 		return nil
 	}
 }
 
+// WithSubjectOrganization returns a Profile modifier that sets the
+// Organization attribute of the Subject for a x509 Certificate.
+func WithSubjectOrganization(o ...string) WithOption {
+	return func(p Profile) error {
+		p.Subject().Subject.Organization = o
+		return nil
+	}
+}
+
+// WithSubjectOrganizationalUnit returns a Profile modifier that sets the
+// OrganizationalUnit attribute of the Subject for a x509 Certificate.
+func WithSubjectOrganizationalUnit(ou ...string) WithOption {
+	return func(p Profile) error {
+		p.Subject().Subject.OrganizationalUnit = ou
+		return nil
+	}
+}
+
+// WithSubjectCountry returns a Profile modifier that sets the Country
+// attribute of the Subject for a x509 Certificate.
+func WithSubjectCountry(c ...string) WithOption {
+	return func(p Profile) error {
+		p.Subject().Subject.Country = c
+		return nil
+	}
+}
+
+// maxSubjectSerialNumberLen is the maximum length of the serialNumber
+// attribute, ub-serial-number in RFC 5280.
+const maxSubjectSerialNumberLen = 64
+
+// WithSubjectSerialNumber returns a Profile modifier that sets the
+// serialNumber attribute of the Subject for a x509 Certificate. This
+// attribute is not the serial number of the certificate, it is usually the
+// serial number of a device or the identifier of a person.
+//
+// The value must be a PrintableString of at most 64 characters.
+func WithSubjectSerialNumber(s string) WithOption {
+	return func(p Profile) error {
+		switch {
+		case s == "":
+			return errors.New("subject serial number cannot be empty")
+		case len(s) > maxSubjectSerialNumberLen:
+			return errors.Errorf("subject serial number cannot be longer than %d characters", maxSubjectSerialNumberLen)
+		case !isPrintableString(s):
+			return errors.Errorf("subject serial number %q contains characters not allowed in a PrintableString", s)
+		}
+		p.Subject().Subject.SerialNumber = s
+		return nil
+	}
+}
+
+// isPrintableString returns true if the string only contains the characters
+// allowed in an ASN.1 PrintableString.
+func isPrintableString(s string) bool {
+	for _, c := range s {
+		switch {
+		case 'a' <= c && c <= 'z', 'A' <= c && c <= 'Z', '0' <= c && c <= '9':
+		case strings.ContainsRune(" '()+,-./:=?", c):
+		default:
+			return false
+		}
+	}
+	return true
+}
+
 // WithIssuer returns a Profile modifier that sets the Subject for a x509
 // Certificate.
 func WithIssuer(iss pkix.Name) WithOption {
@@ -166,26 +443,230 @@ func WithIssuer(iss pkix.Name) WithOption {
 	}
 }
 
+// WithSerialNumber returns a Profile modifier that sets the serial number of
+// the subject x509 Certificate.
+//
+// The serial number must be positive, and it cannot be longer than 20 octets
+// when DER encoded unless WithSkipSerialNumberCheck is also used.
+func WithSerialNumber(sn *big.Int) WithOption {
+	return func(p Profile) error {
+		if sn == nil {
+			return errors.New("serial number cannot be nil")
+		}
+		p.Subject().SerialNumber = new(big.Int).Set(sn)
+		return nil
+	}
+}
+
+// WithSerialNumberBits returns a Profile modifier that sets the number of
+// random bits used to generate the serial number. The number of bits must be
+// between MinSerialNumberBits and DefaultSerialNumberBits.
+func WithSerialNumberBits(bits int) WithOption {
+	return func(p Profile) error {
+		if bits < MinSerialNumberBits || bits > DefaultSerialNumberBits {
+			return errors.Errorf("serial number bits must be between %d and %d", MinSerialNumberBits, DefaultSerialNumberBits)
+		}
+		b, err := getBase(p)
+		if err != nil {
+			return err
+		}
+		b.serialNumberBits = bits
+		return nil
+	}
+}
+
+// WithSkipSerialNumberCheck returns a Profile modifier that disables the
+// validation of the serial numbers set in the template or using
+// WithSerialNumber.
+func WithSkipSerialNumberCheck() WithOption {
+	return func(p Profile) error {
+		b, err := getBase(p)
+		if err != nil {
+			return err
+		}
+		b.skipSerialNumberCheck = true
+		return nil
+	}
+}
+
+// WithSkipIssuerValidation returns a Profile modifier that disables the
+// validation of the issuer certificate, and the check that the issuer private
+// key matches it. It should only be used to create test hierarchies signed by
+// issuers that are not CAs, or when the issuer has already been validated.
+func WithSkipIssuerValidation() WithOption {
+	return func(p Profile) error {
+		b, err := getBase(p)
+		if err != nil {
+			return err
+		}
+		b.skipIssuerValidation = true
+		return nil
+	}
+}
+
+// WithSkipPathLenCheck returns a Profile modifier that disables the validation
+// of the path length constraint of a CA certificate against the path length
+// constraint of the issuer.
+func WithSkipPathLenCheck() WithOption {
+	return func(p Profile) error {
+		b, err := getBase(p)
+		if err != nil {
+			return err
+		}
+		b.skipPathLenCheck = true
+		return nil
+	}
+}
+
+// WithAllowIssuerValidityMismatch returns a Profile modifier that allows a
+// certificate validity that is not within the validity of the issuer, and
+// issuing certificates with an expired or not yet valid issuer. By default
+// this is an error, and the default validity is shortened to fit the issuer.
+func WithAllowIssuerValidityMismatch() WithOption {
+	return func(p Profile) error {
+		b, err := getBase(p)
+		if err != nil {
+			return err
+		}
+		b.allowIssuerValidityMismatch = true
+		return nil
+	}
+}
+
+// WithAllowIssuerKeyReuse returns a Profile modifier that allows signing a
+// certificate whose subject public key is the public key of the issuer
+// certificate, e.g. to re-issue a root certificate with the same key. By
+// default this is only allowed in self-signed profiles.
+func WithAllowIssuerKeyReuse() WithOption {
+	return func(p Profile) error {
+		b, err := getBase(p)
+		if err != nil {
+			return err
+		}
+		b.allowIssuerKeyReuse = true
+		return nil
+	}
+}
+
+// WithSkipLint returns a Profile modifier that disables the findings of the
+// linter with the given codes. If no codes are given the linter is disabled.
+func WithSkipLint(codes ...string) WithOption {
+	return func(p Profile) error {
+		b, err := getBase(p)
+		if err != nil {
+			return err
+		}
+		if len(codes) == 0 {
+			b.skipLint = true
+			return nil
+		}
+		if b.skipLints == nil {
+			b.skipLints = make(map[string]struct{})
+		}
+		for _, code := range codes {
+			b.skipLints[code] = struct{}{}
+		}
+		return nil
+	}
+}
+
+// WithStrictRFC3161 returns a Profile modifier that enables the linter checks
+// for timestamping certificates defined in RFC 3161.
+func WithStrictRFC3161() WithOption {
+	return withLintRule(rfc3161LintRule)
+}
+
+// WithClock returns a Profile modifier that sets the function used to get the
+// current time. The clock is used to compute the default validity of the
+// certificate; by default time.Now is used.
+func WithClock(now func() time.Time) WithOption {
+	return func(p Profile) error {
+		if now == nil {
+			return errors.New("clock cannot be nil")
+		}
+		b, err := getBase(p)
+		if err != nil {
+			return err
+		}
+		b.clock = now
+		return nil
+	}
+}
+
 // WithNotBeforeAfterDuration returns a Profile modifier that sets the
 // `NotBefore` and `NotAfter` attributes of the subject x509 Certificate.
+//
+// A zero `NotBefore` defaults to the current time of the profile clock, and a
+// zero `NotAfter` defaults to `NotBefore` plus the given duration or the
+// default duration of the profile if the duration is 0.
 func WithNotBeforeAfterDuration(nb, na time.Time, d time.Duration) WithOption {
 	return func(p Profile) error {
+		b, err := getBase(p)
+		if err != nil {
+			return err
+		}
+		// Zero values are resolved in newProfile after all the modifiers have
+		// been applied, so the result does not depend on the order of the
+		// WithClock modifier.
 		crt := p.Subject()
+		crt.NotBefore = nb
+		crt.NotAfter = na
+		if d != 0 {
+			b.duration = d
+		}
+		return nil
+	}
+}
 
-		now := time.Now()
-		if nb.IsZero() {
-			nb = now
+// WithValidity returns a Profile modifier that sets the validity of the
+// subject x509 Certificate. The `NotAfter` attribute is set to `NotBefore`
+// plus the given duration unless it's set explicitly.
+func WithValidity(d time.Duration) WithOption {
+	return func(p Profile) error {
+		if d <= 0 {
+			return errors.Errorf("validity must be greater than 0, got %s", d)
 		}
-		if na.IsZero() {
-			if d == 0 {
-				na = nb.Add(p.DefaultDuration())
-			} else {
-				na = nb.Add(d)
-			}
+		b, err := getBase(p)
+		if err != nil {
+			return err
+		}
+		b.duration = d
+		return nil
+	}
+}
+
+// WithDefaultDuration returns a Profile modifier that overrides the default
+// duration of the profile, the value returned by DefaultDuration, without
+// modifying the package variables like DefaultLeafCertValidity.
+func WithDefaultDuration(d time.Duration) WithOption {
+	return func(p Profile) error {
+		if d <= 0 {
+			return errors.Errorf("default duration must be greater than 0, got %s", d)
 		}
+		b, err := getBase(p)
+		if err != nil {
+			return err
+		}
+		b.defaultDuration = d
+		return nil
+	}
+}
 
-		crt.NotBefore = nb
-		crt.NotAfter = na
+// WithBackdate returns a Profile modifier that sets the NotBefore attribute of
+// the subject x509 Certificate the given duration before the current time, to
+// tolerate clock skew between the issuer and the relying parties. The default
+// NotAfter is still computed from the current time. It does not modify an
+// explicit NotBefore.
+func WithBackdate(d time.Duration) WithOption {
+	return func(p Profile) error {
+		if d < 0 {
+			return errors.Errorf("backdate cannot be negative, got %s", d)
+		}
+		b, err := getBase(p)
+		if err != nil {
+			return err
+		}
+		b.backdate = d
 		return nil
 	}
 }
@@ -230,14 +711,55 @@ func WithIPAddresses(ips []net.IP) WithOption {
 
 // WithEmailAddresses returns a Profile modifier which sets the Email Addresses
 // that will be bound to the subject alternative name extension of the Certificate.
-func WithEmailAddresses(emails []string) WithOption {
+//
+// Each address is validated using mail.ParseAddress, and internationalized
+// domain names are converted to their ASCII form. The modifier returns an
+// error listing all the invalid addresses.
+func WithEmailAddresses(emails ...string) WithOption {
 	return func(p Profile) error {
+		var normalized, invalid []string
+		for _, e := range emails {
+			s, err := normalizeEmailAddress(e)
+			if err != nil {
+				invalid = append(invalid, fmt.Sprintf("%q (%v)", e, err))
+				continue
+			}
+			normalized = append(normalized, s)
+		}
+		if len(invalid) > 0 {
+			return errors.Errorf("invalid email addresses: %s", strings.Join(invalid, ", "))
+		}
 		crt := p.Subject()
-		crt.EmailAddresses = emails
+		crt.EmailAddresses = normalized
 		return nil
 	}
 }
 
+// normalizeEmailAddress validates the given email address and returns it with
+// the domain converted to ASCII. The local part must be ASCII, as the rfc822
+// name in the subject alternative name is an IA5String.
+func normalizeEmailAddress(email string) (string, error) {
+	addr, err := mail.ParseAddress(email)
+	if err != nil {
+		return "", err
+	}
+	if addr.Name != "" || addr.Address != strings.TrimSpace(email) {
+		return "", errors.New("display names are not allowed")
+	}
+	i := strings.LastIndex(addr.Address, "@")
+	local, domain := addr.Address[:i], addr.Address[i+1:]
+	for _, r := range local {
+		if r > unicode.MaxASCII {
+			return "", errors.New("local part must be ASCII")
+		}
+	}
+	domain, err = idna.Lookup.ToASCII(domain)
+	if err != nil {
+		return "", err
+	}
+	return local + "@" + domain, nil
+}
+
 // WithURIs returns a Profile modifier which sets the URIs
 // that will be bound to the subject alternative name extension of the Certificate.
 func WithURIs(uris []*url.URL) WithOption {
@@ -249,7 +771,8 @@ func WithURIs(uris []*url.URL) WithOption {
 }
 
 // WithSANs returns a profile modifier which set the dnsNames, emailAddresses,
-// ipAddresses, and URIs attributes of the Certificate.
+// ipAddresses, and URIs attributes of the Certificate. The DNS names are
+// validated using the DNS name policy, see WithDNSNamePolicy.
 func WithSANs(sans []string) WithOption {
 	return func(p Profile) error {
 		dnsNames, ips, emails, uris := SplitSANs(sans)
@@ -285,91 +808,614 @@ func WithHosts(hosts string) WithOption {
 	}
 }
 
-// WithCTPoison returns a Profile modifier that adds the CT poison extension
-// defined in RFC6962.
-func WithCTPoison() WithOption {
-	return func(p Profile) error {
-		crt := p.Subject()
-		crt.ExtraExtensions = append(crt.ExtraExtensions, pkix.Extension{
-			Id:       oidExtensionCTPoison,
-			Critical: true,
-			Value:    asn1.NullBytes,
-		})
+// WithCommonNameInSAN returns a Profile modifier that adds the common name of
+// the subject x509 Certificate to the subject alternative names, as an IP
+// address if it parses as one and as a DNS name otherwise. It does nothing if
+// the common name is empty or it is already in the subject alternative names.
+//
+// The common name is copied after all the other modifiers have been applied,
+// so it is not removed by modifiers like WithSANs.
+func WithCommonNameInSAN() WithOption {
+	return WithTemplateFunc(func(crt *x509.Certificate) error {
+		cn := crt.Subject.CommonName
+		if cn == "" {
+			return nil
+		}
+		if ip := net.ParseIP(cn); ip != nil {
+			crt.IPAddresses = appendIfMissingIP(crt.IPAddresses, ip)
+			return nil
+		}
+		for _, name := range crt.DNSNames {
+			if strings.EqualFold(name, cn) {
+				return nil
+			}
+		}
+		crt.DNSNames = append(crt.DNSNames, cn)
 		return nil
-	}
-
+	})
 }
 
-// newProfile initializes the given profile.
+// WithKeyUsage returns a Profile modifier that replaces the key usage of the
+// subject x509 Certificate.
 //
-// If the public/private key pair of the subject identity are not set by
-// the optional modifiers then a pair will be generated using sane defaults.
-func newProfile(p Profile, sub, iss *x509.Certificate, issPriv crypto.PrivateKey, withOps ...WithOption) (Profile, error) {
-	if p == nil {
-		return nil, errors.New("profile cannot be nil")
-	}
-	if sub == nil {
-		return nil, errors.New("subject certificate cannot be nil")
-	}
-	if iss == nil {
-		return nil, errors.New("issuing certificate cannot be nil")
+// The key usages set with this modifier are considered explicit, and they
+// will not be silently removed at signing time. Creating a certificate with
+// KeyEncipherment or DataEncipherment for a non-RSA key will fail.
+func WithKeyUsage(ku x509.KeyUsage) WithOption {
+	return func(p Profile) error {
+		b, err := getBase(p)
+		if err != nil {
+			return err
+		}
+		p.Subject().KeyUsage = ku
+		b.requiredKeyUsage = ku
+		b.keyUsageFromKey = false
+		return nil
 	}
+}
 
-	p.SetSubject(sub)
-	p.SetIssuer(iss)
-	p.SetIssuerPrivateKey(issPriv)
-
-	for _, op := range withOps {
-		if err := op(p); err != nil {
-			return nil, err
-		}
+// DefaultKeyUsageForKey returns the key usages appropriate for a certificate
+// with the given public key. All keys get the DigitalSignature key usage, RSA
+// keys also get KeyEncipherment and ECDSA keys get KeyAgreement.
+func DefaultKeyUsageForKey(pub crypto.PublicKey) x509.KeyUsage {
+	switch pub.(type) {
+	case *rsa.PublicKey:
+		return x509.KeyUsageDigitalSignature | x509.KeyUsageKeyEncipherment
+	case *ecdsa.PublicKey:
+		return x509.KeyUsageDigitalSignature | x509.KeyUsageKeyAgreement
+	default:
+		return x509.KeyUsageDigitalSignature
 	}
+}
 
-	if p.SubjectPublicKey() == nil {
-		if err := GenerateDefaultKeyPair(p); err != nil {
-			return nil, err
+// withKeyUsageFromKey is the modifier used by the leaf profiles created from
+// the default template to set the key usage from the subject key if no key
+// usage modifier is used.
+func withKeyUsageFromKey() WithOption {
+	return func(p Profile) error {
+		b, err := getBase(p)
+		if err != nil {
+			return err
 		}
+		b.keyUsageFromKey = true
+		return nil
 	}
+}
 
-	if sub.SubjectKeyId == nil {
-		id, err := generateSubjectKeyID(p.SubjectPublicKey())
+// WithAddKeyUsage returns a Profile modifier that adds the given key usages
+// to the ones already present in the subject x509 Certificate.
+//
+// Like in WithKeyUsage, the added key usages are considered explicit.
+func WithAddKeyUsage(ku x509.KeyUsage) WithOption {
+	return func(p Profile) error {
+		b, err := getBase(p)
 		if err != nil {
-			return nil, err
+			return err
 		}
-		sub.SubjectKeyId = id
+		p.Subject().KeyUsage |= ku
+		b.requiredKeyUsage |= ku
+		b.keyUsageFromKey = false
+		return nil
 	}
+}
 
-	if sub.SerialNumber == nil {
-		serialNumberLimit := new(big.Int).Lsh(big.NewInt(1), 128)
-		sn, err := rand.Int(rand.Reader, serialNumberLimit)
+// WithRemoveKeyUsage returns a Profile modifier that removes the given key
+// usages from the subject x509 Certificate.
+func WithRemoveKeyUsage(ku x509.KeyUsage) WithOption {
+	return func(p Profile) error {
+		b, err := getBase(p)
 		if err != nil {
-			return nil, errors.Wrapf(err, "Failed to generate serial number for "+
-				"certificate with common name '%s'", sub.Subject.CommonName)
+			return err
 		}
-		sub.SerialNumber = sn
+		p.Subject().KeyUsage &^= ku
+		b.requiredKeyUsage &^= ku
+		b.keyUsageFromKey = false
+		return nil
 	}
-
-	return p, nil
 }
 
-func (b *base) Issuer() *x509.Certificate {
-	return b.iss
+// WithExtKeyUsage returns a Profile modifier that sets the extended key usages
+// of the subject x509 Certificate, replacing the ones in the template. Calling
+// it without arguments removes the extended key usage extension.
+//
+// Root profiles do not have extended key usages by default, this modifier can
+// be used to add them for the verifiers that require them.
+func WithExtKeyUsage(eku ...x509.ExtKeyUsage) WithOption {
+	return func(p Profile) error {
+		crt := p.Subject()
+		crt.ExtKeyUsage = append([]x509.ExtKeyUsage(nil), eku...)
+		crt.UnknownExtKeyUsage = nil
+		return nil
+	}
 }
 
-func (b *base) Subject() *x509.Certificate {
-	return b.sub
+// WithBasicConstraints returns a Profile modifier that sets the basic
+// constraints of the subject x509 Certificate.
+//
+// A maxPathLen of 0 sets a path length constraint of zero, and a negative
+// value leaves the path length unconstrained. The maxPathLen is ignored if
+// isCA is false.
+func WithBasicConstraints(isCA bool, maxPathLen int) WithOption {
+	return func(p Profile) error {
+		crt := p.Subject()
+		crt.BasicConstraintsValid = true
+		crt.IsCA = isCA
+		switch {
+		case !isCA:
+			crt.MaxPathLen = 0
+			crt.MaxPathLenZero = false
+		case maxPathLen < 0:
+			crt.MaxPathLen = -1
+			crt.MaxPathLenZero = false
+		default:
+			crt.MaxPathLen = maxPathLen
+			crt.MaxPathLenZero = maxPathLen == 0
+		}
+		return nil
+	}
 }
 
-func (b *base) SubjectPrivateKey() interface{} {
-	return b.subPriv
+// WithMaxPathLen returns a Profile modifier that sets the path length
+// constraint of a CA certificate, keeping MaxPathLenZero consistent with it. A
+// value of -1 leaves the path length unconstrained, like
+// WithNoPathLenConstraint, other negative values are not valid.
+//
+// The path length can only be set in CA profiles, like the root, intermediate
+// and cross-sign profiles.
+func WithMaxPathLen(n int) WithOption {
+	return withMaxPathLen("WithMaxPathLen", n)
 }
 
-func (b *base) SubjectPublicKey() interface{} {
-	return b.subPub
+// WithNoPathLenConstraint returns a Profile modifier that removes the path
+// length constraint of a CA certificate. It can only be used in CA profiles.
+func WithNoPathLenConstraint() WithOption {
+	return withMaxPathLen("WithNoPathLenConstraint", -1)
 }
 
-func (b *base) SetIssuer(iss *x509.Certificate) {
-	b.iss = iss
+// withMaxPathLen implements WithMaxPathLen, option is the name of the
+// modifier used in the errors.
+func withMaxPathLen(option string, n int) WithOption {
+	return func(p Profile) error {
+		if err := requireCAProfile(p, option); err != nil {
+			return err
+		}
+		if n < -1 {
+			return errors.Errorf("path length %d is not valid, use -1 to remove the constraint", n)
+		}
+		crt := p.Subject()
+		if n == -1 {
+			crt.MaxPathLen = -1
+			crt.MaxPathLenZero = false
+		} else {
+			crt.MaxPathLen = n
+			crt.MaxPathLenZero = n == 0
+		}
+		return nil
+	}
+}
+
+// requireCAProfile returns an error naming the given option if the profile
+// is a leaf profile.
+func requireCAProfile(p Profile, option string) error {
+	if _, ok := p.(*Leaf); ok {
+		return newError(ErrCAOnly, "%s can only be used in CA profiles", option)
+	}
+	return nil
+}
+
+// validateLeafTemplate returns an error if the template of a leaf profile
+// has any of the fields or extensions that are only valid in CA
+// certificates. They can be set using modifiers like WithTemplateFunc or
+// WithExtraExtension, or with the template of NewLeafProfileWithTemplate. The
+// name constraints extension is not checked because it is always generated
+// from the template fields.
+func validateLeafTemplate(crt *x509.Certificate, exts []pkix.Extension) error {
+	if len(crt.PermittedDNSDomains) > 0 || len(crt.ExcludedDNSDomains) > 0 ||
+		len(crt.PermittedIPRanges) > 0 || len(crt.ExcludedIPRanges) > 0 ||
+		len(crt.PermittedEmailAddresses) > 0 || len(crt.ExcludedEmailAddresses) > 0 ||
+		len(crt.PermittedURIDomains) > 0 || len(crt.ExcludedURIDomains) > 0 {
+		return newError(ErrCAOnly, "name constraints can only be used in CA profiles")
+	}
+	for _, ext := range append(crt.ExtraExtensions[:len(crt.ExtraExtensions):len(crt.ExtraExtensions)], exts...) {
+		switch {
+		case ext.Id.Equal(oidExtPolicyConstraints):
+			return newError(ErrCAOnly, "the policy constraints extension can only be used in CA profiles")
+		case ext.Id.Equal(oidExtInhibitAnyPolicy):
+			return newError(ErrCAOnly, "the inhibit anyPolicy extension can only be used in CA profiles")
+		}
+	}
+	return nil
+}
+
+// pathLen returns the path length constraint of a certificate or template, or
+// -1 if it is not constrained.
+func pathLen(crt *x509.Certificate) int {
+	switch {
+	case crt.MaxPathLen > 0:
+		return crt.MaxPathLen
+	case crt.MaxPathLen == 0 && crt.MaxPathLenZero:
+		return 0
+	default:
+		return -1
+	}
+}
+
+// formatPathLen returns the string representation of a path length.
+func formatPathLen(n int) string {
+	if n < 0 {
+		return "unconstrained"
+	}
+	return strconv.Itoa(n)
+}
+
+// checkPathLen returns an error if the template is a CA certificate that would
+// allow a longer chain than the path length constraint of the issuer permits.
+func checkPathLen(iss, tpl *x509.Certificate) error {
+	if !tpl.IsCA || !iss.BasicConstraintsValid {
+		return nil
+	}
+	issLen := pathLen(iss)
+	if issLen < 0 {
+		return nil
+	}
+	subLen := pathLen(tpl)
+	if issLen == 0 {
+		return newError(ErrPathLenConstraint, "issuer certificate has a path length of 0 and cannot issue CA certificates, requested path length is %s",
+			formatPathLen(subLen))
+	}
+	if subLen < 0 || subLen >= issLen {
+		return newError(ErrPathLenConstraint, "issuer certificate has a path length of %d, the path length of the CA certificate must be less than %d, requested path length is %s",
+			issLen, issLen, formatPathLen(subLen))
+	}
+	return nil
+}
+
+// WithCTPoison returns a Profile modifier that adds the CT poison extension
+// defined in RFC6962. The poison extension can only be used in leaf profiles,
+// and certificates created with it are precertificates.
+//
+// To create a precertificate and its final certificate from the same profile,
+// use CreatePrecertificate and CreateCertificate instead.
+func WithCTPoison() WithOption {
+	return func(p Profile) error {
+		if _, ok := p.(*Leaf); !ok {
+			return newError(ErrLeafOnly, "the CT poison extension can only be used in leaf profiles")
+		}
+		crt := p.Subject()
+		if !hasExtension(crt.ExtraExtensions, oidExtensionCTPoison) {
+			crt.ExtraExtensions = append(crt.ExtraExtensions, newCTPoisonExtension())
+		}
+		return nil
+	}
+}
+
+// WithExtraExtension returns a Profile modifier that adds the given extension
+// to the subject x509 Certificate. It returns an error if an extension with
+// the same object identifier has already been added, use
+// WithReplaceExtraExtension to replace it.
+//
+// Standard extensions generated from the certificate fields, like the
+// subject alternative name or the subject key identifier, cannot be set using
+// this modifier.
+func WithExtraExtension(ext pkix.Extension) WithOption {
+	return func(p Profile) error {
+		if err := validateExtraExtension(ext); err != nil {
+			return err
+		}
+		crt := p.Subject()
+		if hasExtension(crt.ExtraExtensions, ext.Id) {
+			return errors.Errorf("extension %s has already been added", ext.Id)
+		}
+		crt.ExtraExtensions = append(crt.ExtraExtensions, ext)
+		return nil
+	}
+}
+
+// WithReplaceExtraExtension returns a Profile modifier that adds the given
+// extension to the subject x509 Certificate, replacing any extension with the
+// same object identifier.
+func WithReplaceExtraExtension(ext pkix.Extension) WithOption {
+	return func(p Profile) error {
+		if err := validateExtraExtension(ext); err != nil {
+			return err
+		}
+		crt := p.Subject()
+		crt.ExtraExtensions = append(removeExtension(crt.ExtraExtensions, ext.Id), ext)
+		return nil
+	}
+}
+
+// validateExtraExtension checks that the given extension can be added with
+// WithExtraExtension.
+func validateExtraExtension(ext pkix.Extension) error {
+	if len(ext.Id) == 0 {
+		return errors.New("extension object identifier cannot be empty")
+	}
+	if _, ok := oidStdExtHashMap[ext.Id.String()]; ok {
+		return errors.Errorf("extension %s is generated by the profile and cannot be added", ext.Id)
+	}
+	return nil
+}
+
+// newCTPoisonExtension returns the critical CT poison extension.
+func newCTPoisonExtension() pkix.Extension {
+	return pkix.Extension{
+		Id:       oidExtensionCTPoison,
+		Critical: true,
+		Value:    asn1.NullBytes,
+	}
+}
+
+// hasExtension returns true if the list of extensions contains an extension
+// with the given object identifier.
+func hasExtension(exts []pkix.Extension, oid asn1.ObjectIdentifier) bool {
+	for _, ext := range exts {
+		if ext.Id.Equal(oid) {
+			return true
+		}
+	}
+	return false
+}
+
+// removeExtension returns a copy of the list of extensions without the
+// extensions with the given object identifier.
+func removeExtension(exts []pkix.Extension, oid asn1.ObjectIdentifier) []pkix.Extension {
+	var ret []pkix.Extension
+	for _, ext := range exts {
+		if !ext.Id.Equal(oid) {
+			ret = append(ret, ext)
+		}
+	}
+	return ret
+}
+
+// removeStdExtensions returns a copy of the list of extensions without the
+// standard extensions generated from the x509 Certificate fields.
+func removeStdExtensions(exts []pkix.Extension) []pkix.Extension {
+	var ret []pkix.Extension
+	for _, ext := range exts {
+		if _, ok := oidStdExtHashMap[ext.Id.String()]; !ok {
+			ret = append(ret, ext)
+		}
+	}
+	return ret
+}
+
+// newProfile initializes the given profile.
+//
+// If the public/private key pair of the subject identity are not set by
+// the optional modifiers then a pair will be generated using sane defaults.
+func newProfile(p Profile, sub, iss *x509.Certificate, issPriv crypto.PrivateKey, withOps ...WithOption) (Profile, error) {
+	if p == nil {
+		return nil, errors.New("profile cannot be nil")
+	}
+	if sub == nil {
+		return nil, errors.New("subject certificate cannot be nil")
+	}
+	if iss == nil {
+		return nil, errors.New("issuing certificate cannot be nil")
+	}
+	b, err := getBase(p)
+	if err != nil {
+		return nil, err
+	}
+	_, b.isLeaf = p.(*Leaf)
+
+	p.SetSubject(sub)
+	p.SetIssuer(iss)
+	p.SetIssuerPrivateKey(issPriv)
+
+	// The names in the template are removed by WithNoSAN, the names added by
+	// the modifiers are an error.
+	templateSANs := newSANSnapshot(sub, nil)
+	b.recordSANOrder(sub)
+	for _, op := range withOps {
+		if err := op(p); err != nil {
+			return nil, err
+		}
+		b.recordSANOrder(sub)
+	}
+
+	if b.issPriv != nil && !b.skipIssuerValidation {
+		if err := validateIssuerKey(b.iss, b.issPriv); err != nil {
+			return nil, err
+		}
+	}
+
+	// Self-signed leaves are not required to be a CA.
+	if !b.skipIssuerValidation && !(b.isLeaf && iss == sub) {
+		if err := validateIssuer(iss); err != nil {
+			return nil, err
+		}
+	}
+
+	// Set the default validity using the profile clock. The backdate only
+	// applies to the default NotBefore and does not reduce the validity.
+	backdate := time.Duration(0)
+	defaultNotBefore := sub.NotBefore.IsZero()
+	defaultNotAfter := sub.NotAfter.IsZero() && b.duration == 0
+	if sub.NotBefore.IsZero() {
+		sub.NotBefore = b.now().Add(-b.backdate)
+		backdate = b.backdate
+	}
+	if sub.NotAfter.IsZero() {
+		if b.duration == 0 {
+			sub.NotAfter = sub.NotBefore.Add(backdate + p.DefaultDuration())
+		} else {
+			sub.NotAfter = sub.NotBefore.Add(backdate + b.duration)
+		}
+	}
+
+	if !b.allowIssuerValidityMismatch && iss != sub {
+		if err := checkIssuerValidity(iss, sub, b.now(), defaultNotBefore, defaultNotAfter); err != nil {
+			return nil, err
+		}
+	}
+
+	if p.SubjectPublicKey() == nil {
+		if err := b.generateSubjectKeyPair(); err != nil {
+			return nil, err
+		}
+	}
+	if b.keyUsageFromKey {
+		sub.KeyUsage = DefaultKeyUsageForKey(p.SubjectPublicKey())
+	}
+
+	for i, fn := range b.templateFuncs {
+		if err := fn(sub); err != nil {
+			return nil, errors.Wrapf(err, "template function %d failed", i)
+		}
+		b.recordSANOrder(sub)
+	}
+
+	if b.isLeaf {
+		if err := validateLeafTemplate(sub, b.ext); err != nil {
+			return nil, err
+		}
+	}
+
+	if b.rawSubjectFromCSR && len(sub.RawSubject) == 0 {
+		return nil, errors.New("WithRawSubjectFromCSR can only be used with NewLeafProfileWithCSR")
+	}
+
+	if b.noSAN {
+		if !templateSANs.contains(newSANSnapshot(sub, b.generalNames)) {
+			return nil, errors.New("WithNoSAN cannot be combined with modifiers that add subject alternative names")
+		}
+		sub.DNSNames = nil
+		sub.IPAddresses = nil
+		sub.EmailAddresses = nil
+		sub.URIs = nil
+	}
+
+	if err := b.validateDNSNames(sub); err != nil {
+		return nil, err
+	}
+	if err := b.validateIPAddresses(sub); err != nil {
+		return nil, err
+	}
+
+	if sub.SubjectKeyId == nil {
+		id, err := generateSubjectKeyIDWithMethod(p.SubjectPublicKey(), b.skiMethod)
+		if err != nil {
+			return nil, err
+		}
+		sub.SubjectKeyId = id
+	}
+
+	if sub.SerialNumber == nil {
+		if err := b.generateSerialNumber(sub); err != nil {
+			return nil, err
+		}
+	} else if !b.skipSerialNumberCheck {
+		if err := validateSerialNumber(sub.SerialNumber); err != nil {
+			return nil, err
+		}
+	}
+
+	return p, nil
+}
+
+// generateSerialNumber sets a new random serial number in the given template
+// using the number of bits of the profile.
+func (b *base) generateSerialNumber(sub *x509.Certificate) error {
+	bits := b.serialNumberBits
+	if bits == 0 {
+		bits = DefaultSerialNumberBits
+	}
+	sn, err := newSerialNumber(b.randomReader(), bits)
+	if err != nil {
+		return errors.Wrapf(err, "Failed to generate serial number for "+
+			"certificate with common name '%s'", sub.Subject.CommonName)
+	}
+	sub.SerialNumber = sn
+	return nil
+}
+
+// now returns the current time using the clock of the profile.
+func (b *base) now() time.Time {
+	if b.clock != nil {
+		return b.clock()
+	}
+	return time.Now()
+}
+
+// checkIssuerValidity checks that the issuer is valid at the given time and
+// that the validity of the subject is within the validity of the issuer. The
+// NotBefore and NotAfter set by default are adjusted to the issuer validity.
+// Zero issuer times are not checked.
+func checkIssuerValidity(iss, sub *x509.Certificate, now time.Time, defaultNotBefore, defaultNotAfter bool) error {
+	if !iss.NotAfter.IsZero() && now.After(iss.NotAfter) {
+		return newError(ErrValidityExceedsIssuer, "issuer certificate expired on %s", iss.NotAfter.UTC().Format(time.RFC3339))
+	}
+	if !iss.NotBefore.IsZero() && now.Before(iss.NotBefore) {
+		return newError(ErrValidityExceedsIssuer, "issuer certificate is not valid until %s", iss.NotBefore.UTC().Format(time.RFC3339))
+	}
+	if !iss.NotBefore.IsZero() && sub.NotBefore.Before(iss.NotBefore) {
+		if !defaultNotBefore {
+			return newError(ErrValidityExceedsIssuer, "certificate NotBefore %s is before the issuer NotBefore %s",
+				sub.NotBefore.UTC().Format(time.RFC3339), iss.NotBefore.UTC().Format(time.RFC3339))
+		}
+		sub.NotBefore = iss.NotBefore
+	}
+	if !iss.NotAfter.IsZero() && sub.NotAfter.After(iss.NotAfter) {
+		if !defaultNotAfter {
+			return newError(ErrValidityExceedsIssuer, "certificate NotAfter %s is after the issuer NotAfter %s",
+				sub.NotAfter.UTC().Format(time.RFC3339), iss.NotAfter.UTC().Format(time.RFC3339))
+		}
+		sub.NotAfter = iss.NotAfter
+	}
+	return nil
+}
+
+// validateIssuer checks that the given certificate can be used to sign other
+// certificates.
+func validateIssuer(iss *x509.Certificate) error {
+	switch {
+	case !iss.BasicConstraintsValid:
+		return &InvalidIssuerError{Property: "BasicConstraintsValid"}
+	case !iss.IsCA:
+		return &InvalidIssuerError{Property: "IsCA"}
+	case iss.KeyUsage&x509.KeyUsageCertSign == 0:
+		return &InvalidIssuerError{Property: "KeyUsageCertSign"}
+	default:
+		return nil
+	}
+}
+
+func (b *base) Issuer() *x509.Certificate {
+	return b.iss
+}
+
+func (b *base) Subject() *x509.Certificate {
+	return b.sub
+}
+
+func (b *base) SubjectPrivateKey() interface{} {
+	return b.subPriv
+}
+
+// SubjectPublicKey returns the public key of the subject.
+func (b *base) SubjectPublicKey() crypto.PublicKey {
+	return b.subPub
+}
+
+// SubjectSigner returns the private key of the subject as a crypto.Signer. It
+// returns an error if the profile does not have a subject private key or if
+// the key is not a crypto.Signer.
+func (b *base) SubjectSigner() (crypto.Signer, error) {
+	if b.subPriv == nil {
+		return nil, newError(ErrMissingPrivateKey, "profile does not have a subject private key")
+	}
+	signer, ok := b.subPriv.(crypto.Signer)
+	if !ok {
+		return nil, errors.Errorf("subject private key %T is not a crypto.Signer", b.subPriv)
+	}
+	return signer, nil
+}
+
+func (b *base) SetIssuer(iss *x509.Certificate) {
+	b.iss = iss
 }
 
 func (b *base) SetSubject(sub *x509.Certificate) {
@@ -409,12 +1455,26 @@ func (b *base) RemoveExtension(oid asn1.ObjectIdentifier) {
 	}
 }
 
+// Validate checks the consistency of the subject x509 Certificate.
+func (b *base) Validate() error {
+	if b.sub == nil {
+		return errors.New("profile does not have a subject certificate")
+	}
+	if b.sub.MaxPathLenZero && b.sub.MaxPathLen > 0 {
+		return errors.Errorf("certificate MaxPathLenZero cannot be combined with MaxPathLen %d", b.sub.MaxPathLen)
+	}
+	return nil
+}
+
 func (b *base) DefaultDuration() time.Duration {
+	if b.defaultDuration > 0 {
+		return b.defaultDuration
+	}
 	return DefaultCertValidity
 }
 
 func (b *base) GenerateKeyPair(kty, crv string, size int) error {
-	pub, priv, err := keys.GenerateKeyPair(kty, crv, size)
+	pub, priv, err := b.generateKeyPair(kty, crv, size)
 	if err != nil {
 		return err
 	}
@@ -424,30 +1484,281 @@ func (b *base) GenerateKeyPair(kty, crv string, size int) error {
 }
 
 func (b *base) GenerateDefaultKeyPair() error {
-	pub, priv, err := keys.GenerateDefaultKeyPair()
+	return b.GenerateKeyPair(keys.DefaultKeyType, keys.DefaultKeyCurve, keys.DefaultKeySize)
+}
+
+// generateSubjectKeyPair sets a new subject key pair using the parameters
+// set with GenerateKeyPair or the default ones.
+func (b *base) generateSubjectKeyPair() error {
+	if b.keyPairGenerator != nil {
+		return b.generateSubjectKeyPairWith(b.keyPairGenerator)
+	}
+	kty, crv, size := b.keyType, b.keyCurve, b.keySize
+	if kty == "" {
+		kty, crv, size = keys.DefaultKeyType, keys.DefaultKeyCurve, keys.DefaultKeySize
+	}
+	if b.keyPool != nil && b.random == nil && b.keyPool.matches(kty, crv, size) {
+		if pub, priv, ok := b.keyPool.tryGet(); ok {
+			b.SetSubjectPublicKey(pub)
+			b.SetSubjectPrivateKey(priv)
+			return nil
+		}
+	}
+	return b.GenerateKeyPair(kty, crv, size)
+}
+
+// context returns the context of the profile.
+func (b *base) context() context.Context {
+	if b.ctx != nil {
+		return b.ctx
+	}
+	return context.Background()
+}
+
+// generateSubjectKeyPairWith sets the subject key pair returned by the given
+// generator. If the private key is a crypto.Signer, its public key must match
+// the returned one.
+func (b *base) generateSubjectKeyPairWith(fn func() (crypto.PublicKey, crypto.PrivateKey, error)) error {
+	pub, priv, err := fn()
 	if err != nil {
-		return err
+		return errors.Wrap(err, "error generating key pair")
+	}
+	if pub == nil {
+		return newError(ErrMissingPublicKey, "key pair generator returned a nil public key")
+	}
+	if signer, ok := priv.(crypto.Signer); ok {
+		if k, ok := signer.Public().(interface{ Equal(crypto.PublicKey) bool }); !ok || !k.Equal(pub) {
+			return errors.New("key pair generator returned a private key that does not match the public key")
+		}
 	}
 	b.SetSubjectPublicKey(pub)
 	b.SetSubjectPrivateKey(priv)
 	return nil
 }
 
+// generateKeyPair generates a new key pair. The key is generated in a new
+// goroutine so a canceled context aborts the generation without waiting for
+// it; the generated key is then discarded. The random reader is also wrapped
+// so the context is checked every time the generation reads from it, this
+// stops the goroutine early, e.g. between prime attempts, with the generators
+// that use the given reader. Since Go 1.26 the crypto/rsa and crypto/ecdsa
+// generators ignore it by default, so the goroutine may run to completion.
+func (b *base) generateKeyPair(kty, crv string, size int) (interface{}, interface{}, error) {
+	ctx := b.context()
+	if err := ctx.Err(); err != nil {
+		return nil, nil, err
+	}
+
+	type keyPair struct {
+		pub, priv interface{}
+		err       error
+	}
+	r := &contextReader{ctx: ctx, r: b.randomReader()}
+	deterministic := b.random != nil
+	ch := make(chan keyPair, 1)
+	go func() {
+		var kp keyPair
+		if deterministic {
+			kp.pub, kp.priv, kp.err = generateDeterministicKeyPair(r, kty, crv, size)
+		} else {
+			kp.pub, kp.priv, kp.err = generateKeyPairWithReader(r, kty, crv, size)
+		}
+		ch <- kp
+	}()
+
+	select {
+	case <-ctx.Done():
+		return nil, nil, ctx.Err()
+	case kp := <-ch:
+		if kp.err != nil && ctx.Err() != nil {
+			return nil, nil, ctx.Err()
+		}
+		return kp.pub, kp.priv, kp.err
+	}
+}
+
+// contextReader is an io.Reader that returns the error of the context once it
+// is done.
+type contextReader struct {
+	ctx context.Context
+	r   io.Reader
+}
+
+func (r *contextReader) Read(p []byte) (int, error) {
+	if err := r.ctx.Err(); err != nil {
+		return 0, err
+	}
+	return r.r.Read(p)
+}
+
+// generateKeyPairWithReader generates a key pair like keys.GenerateKeyPair,
+// but using the given random reader.
+func generateKeyPairWithReader(r io.Reader, kty, crv string, size int) (interface{}, interface{}, error) {
+	switch kty {
+	case "EC":
+		var c elliptic.Curve
+		switch crv {
+		case "P-256":
+			c = elliptic.P256()
+		case "P-384":
+			c = elliptic.P384()
+		case "P-521":
+			c = elliptic.P521()
+		default:
+			return nil, nil, errors.Errorf("invalid value for argument crv (crv: '%s')", crv)
+		}
+		key, err := ecdsa.GenerateKey(c, r)
+		if err != nil {
+			return nil, nil, errors.Wrap(err, "error generating EC key")
+		}
+		return key.Public(), key, nil
+	case "RSA":
+		key, err := rsa.GenerateKey(r, size)
+		if err != nil {
+			return nil, nil, errors.Wrap(err, "error generating RSA key")
+		}
+		return key.Public(), key, nil
+	case "OKP":
+		if crv != "Ed25519" {
+			return nil, nil, errors.Errorf("missing or invalid value for argument 'crv'. "+
+				"expected 'Ed25519', but got '%s'", crv)
+		}
+		pub, priv, err := ed25519.GenerateKey(r)
+		if err != nil {
+			return nil, nil, errors.Wrap(err, "error generating Ed25519 key")
+		}
+		return pub, priv, nil
+	default:
+		return keys.GenerateKeyPair(kty, crv, size)
+	}
+}
+
 // CreateCertificate creates an x509 Certificate using the configuration stored
 // in the profile.
 func (b *base) CreateCertificate() ([]byte, error) {
+	tpl, err := b.template()
+	if err != nil {
+		return nil, err
+	}
+	der, err := b.sign(tpl)
+	if err != nil {
+		return nil, err
+	}
+	crt, err := x509.ParseCertificate(der)
+	if err != nil {
+		return nil, errors.Wrap(err, "error parsing certificate")
+	}
+	b.crt = crt
+	return der, nil
+}
+
+// CertificateDER returns the DER encoded certificate created by the profile.
+// If CreateCertificate has not been called yet, it creates the certificate.
+// The result is cached, so subsequent calls return the same certificate.
+func (b *base) CertificateDER() ([]byte, error) {
+	if b.crt == nil {
+		if _, err := b.CreateCertificate(); err != nil {
+			return nil, err
+		}
+	}
+	return append([]byte(nil), b.crt.Raw...), nil
+}
+
+// Fingerprint returns the SHA-256 fingerprint of the last certificate created
+// by CreateCertificate.
+func (b *base) Fingerprint() (string, error) {
+	if b.crt == nil {
+		return "", newError(ErrNotCreated, "certificate has not been created yet, call 'profile.CreateCertificate()' first")
+	}
+	return Fingerprint(b.crt), nil
+}
+
+// Verify verifies the last certificate created by CreateCertificate using the
+// given roots and intermediates, and returns the verified chains. The roots
+// and intermediates override the ones in opts if they are not nil.
+//
+// If no intermediates are given, a pool with the issuer of the profile is
+// used.
+func (b *base) Verify(roots, intermediates *x509.CertPool, opts x509.VerifyOptions) ([][]*x509.Certificate, error) {
+	if b.crt == nil {
+		return nil, newError(ErrNotCreated, "certificate has not been created yet, call 'profile.CreateCertificate()' first")
+	}
+	if roots != nil {
+		opts.Roots = roots
+	}
+	if intermediates != nil {
+		opts.Intermediates = intermediates
+	}
+	if opts.Intermediates == nil && b.iss != nil {
+		opts.Intermediates = x509.NewCertPool()
+		opts.Intermediates.AddCert(b.iss)
+	}
+	chains, err := b.crt.Verify(opts)
+	return chains, errors.Wrap(err, "error verifying certificate")
+}
+
+// CreatePrecertificate creates a precertificate as defined in RFC 6962 using
+// the configuration stored in the profile. The precertificate is identical to
+// the certificate returned by CreateCertificate, but it includes the critical
+// CT poison extension.
+func (b *base) CreatePrecertificate() ([]byte, error) {
+	tpl, err := b.template()
+	if err != nil {
+		return nil, err
+	}
+	if !hasExtension(tpl.ExtraExtensions, oidExtensionCTPoison) {
+		tpl.ExtraExtensions = append(tpl.ExtraExtensions, newCTPoisonExtension())
+	}
+	return b.sign(tpl)
+}
+
+// template returns a copy of the subject certificate ready to be signed.
+func (b *base) template() (*x509.Certificate, error) {
+	return b.templateWithIssuerKey(b.issPriv)
+}
+
+// templateWithIssuerKey returns a copy of the subject certificate ready to be
+// signed with the given issuer key.
+func (b *base) templateWithIssuerKey(issPriv interface{}) (*x509.Certificate, error) {
 	pub := b.SubjectPublicKey()
 	if pub == nil {
-		return nil, errors.Errorf("Profile does not have subject public key. Need to call 'profile.GenerateKeyPair(...)' or use setters to populate keys")
+		return nil, newError(ErrMissingPublicKey, "Profile does not have subject public key. Need to call 'profile.GenerateKeyPair(...)' or use setters to populate keys")
 	}
-	if b.issPriv == nil {
-		return nil, errors.Errorf("Profile does not have issuer private key. Use setters to populate this field.")
+	if issPriv == nil {
+		return nil, newError(ErrMissingIssuerKey, "Profile does not have issuer private key. Use setters to populate this field.")
+	}
+	if err := b.validateSubjectKey(pub); err != nil {
+		return nil, err
+	}
+	// Clones do not have a serial number until they are signed.
+	if sub := b.Subject(); sub.SerialNumber == nil {
+		if err := b.generateSerialNumber(sub); err != nil {
+			return nil, err
+		}
+	}
+	if !b.allowIssuerKeyReuse && b.iss != b.sub {
+		if err := checkIssuerKeyReuse(b.iss, pub); err != nil {
+			return nil, err
+		}
 	}
 
-	sub := b.Subject()
-	iss := b.Issuer()
+	tpl := *copyCertificate(b.Subject())
 	if len(b.ext) > 0 {
-		sub.ExtraExtensions = append(sub.ExtraExtensions, b.ext...)
+		tpl.ExtraExtensions = append(tpl.ExtraExtensions, b.ext...)
+	}
+
+	// The mutating hooks run before the template is checked, so their
+	// changes are subject to the same validations as the modifiers.
+	if len(b.mutatingHooks) > 0 {
+		if err := b.runMutatingHooks(&tpl); err != nil {
+			return nil, err
+		}
+		if err := b.validateDNSNames(&tpl); err != nil {
+			return nil, err
+		}
+		if err := b.validateIPAddresses(&tpl); err != nil {
+			return nil, err
+		}
 	}
 
 	// Remove KeyEncipherment and DataEncipherment for non-rsa keys.
@@ -455,8 +1766,11 @@ func (b *base) CreateCertificate() ([]byte, error) {
 	// https://github.com/golang/go/issues/36499
 	// https://tools.ietf.org/html/draft-ietf-lamps-5480-ku-clarifications-02
 	if _, ok := pub.(*rsa.PublicKey); !ok {
-		sub.KeyUsage &= ^x509.KeyUsageKeyEncipherment
-		sub.KeyUsage &= ^x509.KeyUsageDataEncipherment
+		if b.requiredKeyUsage&(x509.KeyUsageKeyEncipherment|x509.KeyUsageDataEncipherment) != 0 {
+			return nil, errors.Errorf("key usage KeyEncipherment or DataEncipherment cannot be used with a %T", pub)
+		}
+		tpl.KeyUsage &= ^x509.KeyUsageKeyEncipherment
+		tpl.KeyUsage &= ^x509.KeyUsageDataEncipherment
 	}
 
 	// Only keep those extensions that are not considered standard x509 Ext as
@@ -464,21 +1778,91 @@ func (b *base) CreateCertificate() ([]byte, error) {
 	// necessary) logic when converting x509 templates to certificates -- but
 	// that logic is superseded by extensions in the ExtraExtensions list, which
 	// are copied to the certificate verbatim.
-	var exts []pkix.Extension
-	for _, ext := range sub.ExtraExtensions {
-		if _, ok := oidStdExtHashMap[ext.Id.String()]; !ok {
-			exts = append(exts, ext)
+	tpl.ExtraExtensions = removeStdExtensions(tpl.ExtraExtensions)
+
+	if tpl.SignatureAlgorithm == x509.UnknownSignatureAlgorithm {
+		tpl.SignatureAlgorithm = defaultSignatureAlgorithm(issPriv)
+	}
+	if err := validateSignatureAlgorithm(tpl.SignatureAlgorithm, issPriv); err != nil {
+		return nil, err
+	}
+
+	if !b.skipLint {
+		if errs := b.lint(&tpl); len(errs) > 0 {
+			return nil, LintErrors(errs)
+		}
+	}
+
+	return &tpl, nil
+}
+
+// sign signs the given template with the issuer of the profile.
+func (b *base) sign(tpl *x509.Certificate) ([]byte, error) {
+	der, err := b.signWith(tpl, b.Issuer(), b.issPriv)
+	if err != nil {
+		return nil, err
+	}
+	// Self-signed certificates must verify with their own public key, this
+	// catches an issuer key that does not match the subject key.
+	if b.iss == b.sub {
+		if err := verifySelfSigned(der); err != nil {
+			return nil, err
 		}
 	}
-	sub.ExtraExtensions = exts
+	return der, nil
+}
 
-	bytes, err := x509.CreateCertificate(rand.Reader, sub, iss, pub, b.issPriv)
+// signWith signs the given template with the given parent certificate and
+// issuer key.
+func (b *base) signWith(tpl, parent *x509.Certificate, issPriv interface{}) ([]byte, error) {
+	if err := b.context().Err(); err != nil {
+		return nil, err
+	}
+	// Self-signed certificates are not subject to their own constraints.
+	if !b.skipNameConstraintCheck && b.iss != b.sub {
+		if err := checkNameConstraints(b.iss, tpl); err != nil {
+			return nil, err
+		}
+	}
+	if !b.skipPathLenCheck && b.iss != b.sub {
+		if err := checkPathLen(b.iss, tpl); err != nil {
+			return nil, err
+		}
+	}
+	if err := b.applyGeneralNames(tpl); err != nil {
+		return nil, err
+	}
+	if err := b.applyCertificatePolicies(tpl); err != nil {
+		return nil, err
+	}
+	if err := b.applyCriticalExtensions(tpl); err != nil {
+		return nil, err
+	}
+	// The x509 package takes the authority key identifier from the parent
+	// unless the certificate is self-signed.
+	if b.authorityKeyID != nil {
+		p := *parent
+		p.SubjectKeyId = b.authorityKeyID
+		parent = &p
+		tpl.AuthorityKeyId = b.authorityKeyID
+	}
+	if err := b.runPreIssuanceHooks(tpl, parent); err != nil {
+		return nil, err
+	}
+	if b.forceGeneralizedTime {
+		return createCertificateWithGeneralizedTime(tpl, parent, b.SubjectPublicKey(), issPriv)
+	}
+	bytes, err := x509.CreateCertificate(rand.Reader, tpl, parent, b.SubjectPublicKey(), issPriv)
 	return bytes, errors.WithStack(err)
 }
 
 // Create Certificate from profile and write the certificate and private key
 // to disk.
 func (b *base) CreateWriteCertificate(crtOut, keyOut, pass string) ([]byte, error) {
+	key, err := b.exportableSubjectPrivateKey()
+	if err != nil {
+		return nil, err
+	}
 	crtBytes, err := b.CreateCertificate()
 	if err != nil {
 		return nil, errors.WithStack(err)
@@ -490,7 +1874,7 @@ func (b *base) CreateWriteCertificate(crtOut, keyOut, pass string) ([]byte, erro
 		return nil, errors.WithStack(err)
 	}
 
-	_, err = pemutil.Serialize(b.SubjectPrivateKey(),
+	_, err = pemutil.Serialize(key,
 		pemutil.WithPassword([]byte(pass)), pemutil.ToFile(keyOut, 0600))
 	if err != nil {
 		return nil, errors.WithStack(err)
@@ -498,12 +1882,181 @@ func (b *base) CreateWriteCertificate(crtOut, keyOut, pass string) ([]byte, erro
 	return crtBytes, nil
 }
 
+// exportableSubjectPrivateKey returns the subject private key if it can be
+// serialized. Opaque keys, like the ones returned by a generator set with
+// WithKeyPairGenerator, cannot be exported.
+func (b *base) exportableSubjectPrivateKey() (interface{}, error) {
+	switch k := b.subPriv.(type) {
+	case nil:
+		return nil, newError(ErrMissingPrivateKey, "profile does not have a subject private key")
+	case *rsa.PrivateKey, *ecdsa.PrivateKey, ed25519.PrivateKey:
+		return k, nil
+	default:
+		return nil, newError(ErrKeyNotExportable, "subject private key of type %T cannot be exported", k)
+	}
+}
+
+// copyCertificate returns a copy of the given template. The slices in the
+// template are copied, but not the keys or the raw fields.
+func copyCertificate(c *x509.Certificate) *x509.Certificate {
+	cc := *c
+	cc.Subject = copyName(c.Subject)
+	cc.Issuer = copyName(c.Issuer)
+	cc.Extensions = append(c.Extensions[:0:0], c.Extensions...)
+	cc.ExtraExtensions = append(c.ExtraExtensions[:0:0], c.ExtraExtensions...)
+	cc.UnhandledCriticalExtensions = append(c.UnhandledCriticalExtensions[:0:0], c.UnhandledCriticalExtensions...)
+	cc.ExtKeyUsage = append(c.ExtKeyUsage[:0:0], c.ExtKeyUsage...)
+	cc.UnknownExtKeyUsage = append(c.UnknownExtKeyUsage[:0:0], c.UnknownExtKeyUsage...)
+	cc.SubjectKeyId = append(c.SubjectKeyId[:0:0], c.SubjectKeyId...)
+	cc.AuthorityKeyId = append(c.AuthorityKeyId[:0:0], c.AuthorityKeyId...)
+	cc.OCSPServer = append(c.OCSPServer[:0:0], c.OCSPServer...)
+	cc.IssuingCertificateURL = append(c.IssuingCertificateURL[:0:0], c.IssuingCertificateURL...)
+	cc.DNSNames = append(c.DNSNames[:0:0], c.DNSNames...)
+	cc.EmailAddresses = append(c.EmailAddresses[:0:0], c.EmailAddresses...)
+	cc.IPAddresses = copyIPs(c.IPAddresses)
+	cc.URIs = copyURLs(c.URIs)
+	cc.PermittedDNSDomains = append(c.PermittedDNSDomains[:0:0], c.PermittedDNSDomains...)
+	cc.ExcludedDNSDomains = append(c.ExcludedDNSDomains[:0:0], c.ExcludedDNSDomains...)
+	cc.PermittedIPRanges = copyIPNets(c.PermittedIPRanges)
+	cc.ExcludedIPRanges = copyIPNets(c.ExcludedIPRanges)
+	cc.PermittedEmailAddresses = append(c.PermittedEmailAddresses[:0:0], c.PermittedEmailAddresses...)
+	cc.ExcludedEmailAddresses = append(c.ExcludedEmailAddresses[:0:0], c.ExcludedEmailAddresses...)
+	cc.PermittedURIDomains = append(c.PermittedURIDomains[:0:0], c.PermittedURIDomains...)
+	cc.ExcludedURIDomains = append(c.ExcludedURIDomains[:0:0], c.ExcludedURIDomains...)
+	cc.CRLDistributionPoints = append(c.CRLDistributionPoints[:0:0], c.CRLDistributionPoints...)
+	cc.PolicyIdentifiers = append(c.PolicyIdentifiers[:0:0], c.PolicyIdentifiers...)
+	if c.SerialNumber != nil {
+		cc.SerialNumber = new(big.Int).Set(c.SerialNumber)
+	}
+	return &cc
+}
+
+func copyName(n pkix.Name) pkix.Name {
+	nn := n
+	nn.Country = append(n.Country[:0:0], n.Country...)
+	nn.Organization = append(n.Organization[:0:0], n.Organization...)
+	nn.OrganizationalUnit = append(n.OrganizationalUnit[:0:0], n.OrganizationalUnit...)
+	nn.Locality = append(n.Locality[:0:0], n.Locality...)
+	nn.Province = append(n.Province[:0:0], n.Province...)
+	nn.StreetAddress = append(n.StreetAddress[:0:0], n.StreetAddress...)
+	nn.PostalCode = append(n.PostalCode[:0:0], n.PostalCode...)
+	nn.Names = append(n.Names[:0:0], n.Names...)
+	nn.ExtraNames = append(n.ExtraNames[:0:0], n.ExtraNames...)
+	return nn
+}
+
+func copyIPs(ips []net.IP) []net.IP {
+	if ips == nil {
+		return nil
+	}
+	cc := make([]net.IP, len(ips))
+	for i, ip := range ips {
+		cc[i] = append(ip[:0:0], ip...)
+	}
+	return cc
+}
+
+func copyIPNets(nets []*net.IPNet) []*net.IPNet {
+	if nets == nil {
+		return nil
+	}
+	cc := make([]*net.IPNet, len(nets))
+	for i, n := range nets {
+		cc[i] = &net.IPNet{
+			IP:   append(n.IP[:0:0], n.IP...),
+			Mask: append(n.Mask[:0:0], n.Mask...),
+		}
+	}
+	return cc
+}
+
+func copyURLs(uris []*url.URL) []*url.URL {
+	if uris == nil {
+		return nil
+	}
+	cc := make([]*url.URL, len(uris))
+	for i, u := range uris {
+		uu := *u
+		if u.User != nil {
+			user := *u.User
+			uu.User = &user
+		}
+		cc[i] = &uu
+	}
+	return cc
+}
+
 // subjectPublicKeyInfo is a PKIX public key structure defined in RFC 5280.
 type subjectPublicKeyInfo struct {
 	Algorithm        pkix.AlgorithmIdentifier
 	SubjectPublicKey asn1.BitString
 }
 
+// SKIMethod is the method used to generate the subject key identifier. The
+// methods are defined in RFC 5280, section 4.2.1.2.
+type SKIMethod int
+
+const (
+	// SKIMethod1 generates a key identifier composed of the 160-bit SHA-1
+	// hash of the subject public key. This is the default.
+	SKIMethod1 SKIMethod = iota + 1
+	// SKIMethod2 generates a 64-bit key identifier composed of the four-bit
+	// type field with the value 0100 followed by the least significant 60
+	// bits of the SHA-1 hash of the subject public key.
+	SKIMethod2
+)
+
+// WithSKIMethod returns a Profile modifier that sets the method used to
+// generate the subject key identifier. The subject key identifier is only
+// generated if it's not set in the template.
+func WithSKIMethod(m SKIMethod) WithOption {
+	return func(p Profile) error {
+		if m != SKIMethod1 && m != SKIMethod2 {
+			return errors.Errorf("unsupported subject key identifier method %d", m)
+		}
+		b, err := getBase(p)
+		if err != nil {
+			return err
+		}
+		b.skiMethod = m
+		return nil
+	}
+}
+
+// WithAuthorityKeyId returns a Profile modifier that sets the authority key
+// identifier of the certificate. By default the x509 package uses the subject
+// key identifier of the issuer; this modifier takes precedence, and it can be
+// used in cross-signing and bridge scenarios where the identifier must not be
+// the one of the issuer certificate. The identifier must have between 1 and
+// 20 bytes, the size of the key identifiers generated with SKIMethod1.
+func WithAuthorityKeyId(id []byte) WithOption {
+	return func(p Profile) error {
+		if len(id) == 0 || len(id) > 20 {
+			return errors.Errorf("authority key identifier must have between 1 and 20 bytes, got %d", len(id))
+		}
+		b, err := getBase(p)
+		if err != nil {
+			return err
+		}
+		b.authorityKeyID = append([]byte(nil), id...)
+		return nil
+	}
+}
+
+// generateSubjectKeyIDWithMethod generates the key identifier using the given
+// RFC 5280 method. A zero method generates the key identifier using method 1.
+func generateSubjectKeyIDWithMethod(pub crypto.PublicKey, m SKIMethod) ([]byte, error) {
+	id, err := generateSubjectKeyID(pub)
+	if err != nil {
+		return nil, err
+	}
+	if m == SKIMethod2 {
+		id = id[len(id)-8:]
+		id[0] = 0x40 | (id[0] & 0x0f)
+	}
+	return id, nil
+}
+
 // generateSubjectKeyID generates the key identifier according the the RFC 5280
 // section 4.2.1.2.
 //
@@ -1,6 +1,8 @@
 package x509util
 
 import (
+	"bytes"
+	"context"
 	"crypto"
 	"crypto/ecdsa"
 	"crypto/ed25519"
@@ -11,17 +13,22 @@ import (
 	"crypto/x509/pkix"
 	"encoding/asn1"
 	"encoding/pem"
+	"io"
+	"math/big"
 	"net"
 	"net/url"
 	"os"
 	"reflect"
+	"strings"
+	"sync"
 	"testing"
+	"time"
 
 	"github.com/pkg/errors"
 	"github.com/smallstep/assert"
 )
 
-func mustParseRSAKey(t *testing.T, filename string) *rsa.PrivateKey {
+func mustParseRSAKey(t testing.TB, filename string) *rsa.PrivateKey {
 	t.Helper()
 
 	b, err := os.ReadFile("test_files/noPasscodeCa.key")
@@ -56,94 +63,6 @@ func decodeCertificateFile(t *testing.T, filename string) *x509.Certificate {
 	return crt
 }
 
-type basicConstraints struct {
-	IsCA       bool `asn1:"optional"`
-	MaxPathLen int  `asn1:"optional,default:-1"`
-}
-
-// asn1BitLength returns the bit-length of bitString by considering the
-// most-significant bit in a byte to be the "first" bit. This convention
-// matches ASN.1, but differs from almost everything else.
-func asn1BitLength(bitString []byte) int {
-	bitLen := len(bitString) * 8
-	for i := range bitString {
-		b := bitString[len(bitString)-i-1]
-		for bit := uint(0); bit < 8; bit++ {
-			if (b>>bit)&1 == 1 {
-				return bitLen
-			}
-			bitLen--
-		}
-	}
-	return 0
-}
-
-func reverseBitsInAByte(in byte) byte {
-	b1 := in>>4 | in<<4
-	b2 := b1>>2&0x33 | b1<<2&0xcc
-	b3 := b2>>1&0x55 | b2<<1&0xaa
-	return b3
-}
-
-// RFC 5280, 4.2.1.12  Extended Key Usage
-//
-// anyExtendedKeyUsage OBJECT IDENTIFIER ::= { id-ce-extKeyUsage 0 }
-//
-// id-kp OBJECT IDENTIFIER ::= { id-pkix 3 }
-//
-// id-kp-serverAuth             OBJECT IDENTIFIER ::= { id-kp 1 }
-// id-kp-clientAuth             OBJECT IDENTIFIER ::= { id-kp 2 }
-// id-kp-codeSigning            OBJECT IDENTIFIER ::= { id-kp 3 }
-// id-kp-emailProtection        OBJECT IDENTIFIER ::= { id-kp 4 }
-// id-kp-timeStamping           OBJECT IDENTIFIER ::= { id-kp 8 }
-// id-kp-OCSPSigning            OBJECT IDENTIFIER ::= { id-kp 9 }
-var (
-	oidExtKeyUsageAny                            = asn1.ObjectIdentifier{2, 5, 29, 37, 0}
-	oidExtKeyUsageServerAuth                     = asn1.ObjectIdentifier{1, 3, 6, 1, 5, 5, 7, 3, 1}
-	oidExtKeyUsageClientAuth                     = asn1.ObjectIdentifier{1, 3, 6, 1, 5, 5, 7, 3, 2}
-	oidExtKeyUsageCodeSigning                    = asn1.ObjectIdentifier{1, 3, 6, 1, 5, 5, 7, 3, 3}
-	oidExtKeyUsageEmailProtection                = asn1.ObjectIdentifier{1, 3, 6, 1, 5, 5, 7, 3, 4}
-	oidExtKeyUsageIPSECEndSystem                 = asn1.ObjectIdentifier{1, 3, 6, 1, 5, 5, 7, 3, 5}
-	oidExtKeyUsageIPSECTunnel                    = asn1.ObjectIdentifier{1, 3, 6, 1, 5, 5, 7, 3, 6}
-	oidExtKeyUsageIPSECUser                      = asn1.ObjectIdentifier{1, 3, 6, 1, 5, 5, 7, 3, 7}
-	oidExtKeyUsageTimeStamping                   = asn1.ObjectIdentifier{1, 3, 6, 1, 5, 5, 7, 3, 8}
-	oidExtKeyUsageOCSPSigning                    = asn1.ObjectIdentifier{1, 3, 6, 1, 5, 5, 7, 3, 9}
-	oidExtKeyUsageMicrosoftServerGatedCrypto     = asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 311, 10, 3, 3}
-	oidExtKeyUsageNetscapeServerGatedCrypto      = asn1.ObjectIdentifier{2, 16, 840, 1, 113730, 4, 1}
-	oidExtKeyUsageMicrosoftCommercialCodeSigning = asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 311, 2, 1, 22}
-	oidExtKeyUsageMicrosoftKernelCodeSigning     = asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 311, 61, 1, 1}
-)
-
-// extKeyUsageOIDs contains the mapping between an ExtKeyUsage and its OID.
-var extKeyUsageOIDs = []struct {
-	extKeyUsage x509.ExtKeyUsage
-	oid         asn1.ObjectIdentifier
-}{
-	{x509.ExtKeyUsageAny, oidExtKeyUsageAny},
-	{x509.ExtKeyUsageServerAuth, oidExtKeyUsageServerAuth},
-	{x509.ExtKeyUsageClientAuth, oidExtKeyUsageClientAuth},
-	{x509.ExtKeyUsageCodeSigning, oidExtKeyUsageCodeSigning},
-	{x509.ExtKeyUsageEmailProtection, oidExtKeyUsageEmailProtection},
-	{x509.ExtKeyUsageIPSECEndSystem, oidExtKeyUsageIPSECEndSystem},
-	{x509.ExtKeyUsageIPSECTunnel, oidExtKeyUsageIPSECTunnel},
-	{x509.ExtKeyUsageIPSECUser, oidExtKeyUsageIPSECUser},
-	{x509.ExtKeyUsageTimeStamping, oidExtKeyUsageTimeStamping},
-	{x509.ExtKeyUsageOCSPSigning, oidExtKeyUsageOCSPSigning},
-	{x509.ExtKeyUsageMicrosoftServerGatedCrypto, oidExtKeyUsageMicrosoftServerGatedCrypto},
-	{x509.ExtKeyUsageNetscapeServerGatedCrypto, oidExtKeyUsageNetscapeServerGatedCrypto},
-	{x509.ExtKeyUsageMicrosoftKernelCodeSigning, oidExtKeyUsageMicrosoftKernelCodeSigning},
-	{x509.ExtKeyUsageMicrosoftCommercialCodeSigning, oidExtKeyUsageMicrosoftCommercialCodeSigning},
-}
-
-func oidFromExtKeyUsage(eku x509.ExtKeyUsage) (oid asn1.ObjectIdentifier, ok bool) {
-	for _, pair := range extKeyUsageOIDs {
-		if eku == pair.extKeyUsage {
-			return pair.oid, true
-		}
-	}
-	return
-}
-
 // RFC 5280, 4.2.1.10
 type nameConstraints struct {
 	Permitted []generalSubtree `asn1:"optional,tag:0"`
@@ -159,37 +78,6 @@ type userExt struct {
 	LName string `asn1:"tag:1,optional,ia5"`
 }
 
-const (
-	nameTypeEmail = 1
-	nameTypeDNS   = 2
-	nameTypeURI   = 6
-	nameTypeIP    = 7
-)
-
-// marshalSANs marshals a list of addresses into a the contents of an X.509
-// SubjectAlternativeName extension.
-func marshalSANs(dnsNames, emailAddresses []string, ipAddresses []net.IP, uris []*url.URL) (derBytes []byte, err error) {
-	var rawValues []asn1.RawValue
-	for _, name := range dnsNames {
-		rawValues = append(rawValues, asn1.RawValue{Tag: nameTypeDNS, Class: 2, Bytes: []byte(name)})
-	}
-	for _, email := range emailAddresses {
-		rawValues = append(rawValues, asn1.RawValue{Tag: nameTypeEmail, Class: 2, Bytes: []byte(email)})
-	}
-	for _, rawIP := range ipAddresses {
-		// If possible, we always want to encode IPv4 addresses in 4 bytes.
-		ip := rawIP.To4()
-		if ip == nil {
-			ip = rawIP
-		}
-		rawValues = append(rawValues, asn1.RawValue{Tag: nameTypeIP, Class: 2, Bytes: ip})
-	}
-	for _, uri := range uris {
-		rawValues = append(rawValues, asn1.RawValue{Tag: nameTypeURI, Class: 2, Bytes: []byte(uri.String())})
-	}
-	return asn1.Marshal(rawValues)
-}
-
 func Test_base_CreateCertificate(t *testing.T) {
 	issCert := mustParseCertificate(t, "test_files/noPasscodeCa.crt")
 	issKey := mustParseRSAKey(t, "test_files/noPasscodeCa.key")
@@ -321,7 +209,7 @@ func Test_base_CreateCertificate(t *testing.T) {
 					cert, err := x509.ParseCertificate(certBytes)
 					assert.FatalError(t, err)
 					assert.Equals(t, cert.Subject.CommonName, "test.smallstep.com")
-					assert.Equals(t, cert.KeyUsage, x509.KeyUsageDigitalSignature)
+					assert.Equals(t, cert.KeyUsage, x509.KeyUsageDigitalSignature|x509.KeyUsageKeyAgreement)
 
 					assert.Len(t, 2, cert.ExtKeyUsage)
 					assert.Equals(t, cert.ExtKeyUsage[0], x509.ExtKeyUsageServerAuth)
@@ -448,3 +336,1403 @@ func Test_generateSubjectKeyID(t *testing.T) {
 		})
 	}
 }
+
+func TestWithKeyUsage(t *testing.T) {
+	iss := mustParseCertificate(t, "test_files/noPasscodeCa.crt")
+	issPriv := mustParseRSAKey(t, "test_files/noPasscodeCa.key")
+
+	ecdsaKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		pub     interface{}
+		options []WithOption
+		want    x509.KeyUsage
+		wantErr bool
+	}{
+		{"ok/replace", ecdsaKey.Public(), []WithOption{WithKeyUsage(x509.KeyUsageDigitalSignature)}, x509.KeyUsageDigitalSignature, false},
+		{"ok/replace-rsa", rsaKey.Public(), []WithOption{WithKeyUsage(x509.KeyUsageKeyEncipherment)}, x509.KeyUsageKeyEncipherment, false},
+		{"ok/add", ecdsaKey.Public(), []WithOption{WithAddKeyUsage(x509.KeyUsageContentCommitment)}, x509.KeyUsageDigitalSignature | x509.KeyUsageContentCommitment, false},
+		{"ok/remove", rsaKey.Public(), []WithOption{WithRemoveKeyUsage(x509.KeyUsageKeyEncipherment)}, x509.KeyUsageDigitalSignature, false},
+		{"ok/add-remove", ecdsaKey.Public(), []WithOption{WithAddKeyUsage(x509.KeyUsageKeyEncipherment), WithRemoveKeyUsage(x509.KeyUsageKeyEncipherment)}, x509.KeyUsageDigitalSignature, false},
+		{"ok/default-ecdsa", ecdsaKey.Public(), nil, x509.KeyUsageDigitalSignature | x509.KeyUsageKeyAgreement, false},
+		{"ok/default-rsa", rsaKey.Public(), nil, x509.KeyUsageDigitalSignature | x509.KeyUsageKeyEncipherment, false},
+		{"fail/replace-ecdsa", ecdsaKey.Public(), []WithOption{WithKeyUsage(x509.KeyUsageKeyEncipherment)}, 0, true},
+		{"fail/add-ecdsa", ecdsaKey.Public(), []WithOption{WithAddKeyUsage(x509.KeyUsageDataEncipherment)}, 0, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			options := append([]WithOption{WithPublicKey(tt.pub)}, tt.options...)
+			p, err := NewLeafProfile("test.smallstep.com", iss, issPriv, options...)
+			if err != nil {
+				t.Fatal(err)
+			}
+			der, err := p.CreateCertificate()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("CreateCertificate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			cert, err := x509.ParseCertificate(der)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if cert.KeyUsage != tt.want {
+				t.Errorf("CreateCertificate() keyUsage = %x, want %x", cert.KeyUsage, tt.want)
+			}
+		})
+	}
+}
+
+func TestWithBasicConstraints(t *testing.T) {
+	iss := mustParseCertificate(t, "test_files/noPasscodeCa.crt")
+	issPriv := mustParseRSAKey(t, "test_files/noPasscodeCa.key")
+
+	tests := []struct {
+		name               string
+		isCA               bool
+		maxPathLen         int
+		wantMaxPathLen     int
+		wantMaxPathLenZero bool
+	}{
+		{"ca/pathlen-0", true, 0, 0, true},
+		{"ca/pathlen-1", true, 1, 1, false},
+		{"ca/unset", true, -1, -1, false},
+		{"no-ca", false, 1, -1, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, err := NewIntermediateProfile("intermediate", iss, issPriv, WithBasicConstraints(tt.isCA, tt.maxPathLen),
+				WithSkipLint(LintCABasicConstraints), WithSkipPathLenCheck())
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := p.Validate(); err != nil {
+				t.Errorf("Validate() error = %v", err)
+			}
+			der, err := p.CreateCertificate()
+			if err != nil {
+				t.Fatal(err)
+			}
+			cert, err := x509.ParseCertificate(der)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !cert.BasicConstraintsValid {
+				t.Error("BasicConstraintsValid = false, want true")
+			}
+			if cert.IsCA != tt.isCA {
+				t.Errorf("IsCA = %v, want %v", cert.IsCA, tt.isCA)
+			}
+			if cert.MaxPathLen != tt.wantMaxPathLen {
+				t.Errorf("MaxPathLen = %d, want %d", cert.MaxPathLen, tt.wantMaxPathLen)
+			}
+			if cert.MaxPathLenZero != tt.wantMaxPathLenZero {
+				t.Errorf("MaxPathLenZero = %v, want %v", cert.MaxPathLenZero, tt.wantMaxPathLenZero)
+			}
+		})
+	}
+
+	t.Run("leaf", func(t *testing.T) {
+		p, err := NewLeafProfile("test.smallstep.com", iss, issPriv, WithBasicConstraints(true, 0), WithSkipPathLenCheck())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := p.Validate(); err == nil {
+			t.Error("Validate() error = nil, want error")
+		}
+		if _, err := p.CreateCertificate(); err != nil {
+			t.Errorf("CreateCertificate() error = %v", err)
+		}
+	})
+}
+
+func TestWithClock(t *testing.T) {
+	iss := mustParseCertificate(t, "test_files/noPasscodeCa.crt")
+	issPriv := mustParseRSAKey(t, "test_files/noPasscodeCa.key")
+
+	now := time.Date(2021, time.March, 14, 15, 9, 26, 0, time.UTC)
+	clock := func() time.Time { return now }
+
+	tests := []struct {
+		name     string
+		newFunc  func() (Profile, error)
+		duration time.Duration
+	}{
+		{"leaf", func() (Profile, error) {
+			return NewLeafProfile("test.smallstep.com", iss, issPriv, WithClock(clock))
+		}, DefaultLeafCertValidity},
+		{"intermediate", func() (Profile, error) {
+			return NewIntermediateProfile("intermediate", iss, issPriv, WithClock(clock), WithSkipPathLenCheck(), WithAllowIssuerValidityMismatch())
+		}, DefaultIntermediateCertValidity},
+		{"root", func() (Profile, error) {
+			return NewRootProfile("root", WithClock(clock))
+		}, DefaultRootCertValidity},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var validity [][]byte
+			for i := 0; i < 2; i++ {
+				p, err := tt.newFunc()
+				if err != nil {
+					t.Fatal(err)
+				}
+				der, err := p.CreateCertificate()
+				if err != nil {
+					t.Fatal(err)
+				}
+				cert, err := x509.ParseCertificate(der)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if !cert.NotBefore.Equal(now) {
+					t.Errorf("NotBefore = %v, want %v", cert.NotBefore, now)
+				}
+				if want := now.Add(tt.duration); !cert.NotAfter.Equal(want) {
+					t.Errorf("NotAfter = %v, want %v", cert.NotAfter, want)
+				}
+				validity = append(validity, mustMarshalValidity(t, cert))
+			}
+			if !bytes.Equal(validity[0], validity[1]) {
+				t.Errorf("validity %x is not equal to %x", validity[0], validity[1])
+			}
+		})
+	}
+
+	t.Run("fail/nil", func(t *testing.T) {
+		if _, err := NewLeafProfile("test.smallstep.com", iss, issPriv, WithClock(nil)); err == nil {
+			t.Error("NewLeafProfile() error = nil, want error")
+		}
+	})
+}
+
+// mustMarshalValidity returns the DER encoding of the validity of the given
+// certificate.
+func mustMarshalValidity(t *testing.T, cert *x509.Certificate) []byte {
+	t.Helper()
+	var tbs struct {
+		Raw          asn1.RawContent
+		Version      int `asn1:"optional,explicit,default:0,tag:0"`
+		SerialNumber asn1.RawValue
+		Signature    asn1.RawValue
+		Issuer       asn1.RawValue
+		Validity     asn1.RawValue
+	}
+	if _, err := asn1.Unmarshal(cert.RawTBSCertificate, &tbs); err != nil {
+		t.Fatal(err)
+	}
+	return tbs.Validity.FullBytes
+}
+
+func mustNewProfile(t *testing.T) func(Profile, error) Profile {
+	return func(p Profile, err error) Profile {
+		t.Helper()
+		if err != nil {
+			t.Fatal(err)
+		}
+		return p
+	}
+}
+
+func mustCreateCertificate(t *testing.T, p Profile) *x509.Certificate {
+	t.Helper()
+	der, err := p.CreateCertificate()
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cert
+}
+
+func TestWithNotBeforeAfterDuration(t *testing.T) {
+	iss := mustParseCertificate(t, "test_files/noPasscodeCa.crt")
+	issPriv := mustParseRSAKey(t, "test_files/noPasscodeCa.key")
+
+	now := time.Date(2021, time.March, 14, 15, 9, 26, 0, time.UTC)
+	clock := func() time.Time { return now }
+	nb := now.Add(-time.Hour)
+	na := now.Add(time.Hour)
+
+	tests := []struct {
+		name          string
+		options       []WithOption
+		wantNotBefore time.Time
+		wantNotAfter  time.Time
+	}{
+		{"defaults", []WithOption{WithClock(clock), WithNotBeforeAfterDuration(time.Time{}, time.Time{}, 0)}, now, now.Add(DefaultLeafCertValidity)},
+		{"duration", []WithOption{WithClock(clock), WithNotBeforeAfterDuration(time.Time{}, time.Time{}, time.Minute)}, now, now.Add(time.Minute)},
+		{"clock-after", []WithOption{WithNotBeforeAfterDuration(time.Time{}, time.Time{}, time.Minute), WithClock(clock)}, now, now.Add(time.Minute)},
+		{"backdate", []WithOption{WithClock(clock), WithNotBeforeAfterDuration(nb, time.Time{}, time.Minute)}, nb, nb.Add(time.Minute)},
+		{"not-after", []WithOption{WithClock(clock), WithNotBeforeAfterDuration(time.Time{}, na, time.Minute)}, now, na},
+		{"both", []WithOption{WithClock(clock), WithNotBeforeAfterDuration(nb, na, 0)}, nb, na},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, err := NewLeafProfile("test.smallstep.com", iss, issPriv, tt.options...)
+			if err != nil {
+				t.Fatal(err)
+			}
+			cert := mustCreateCertificate(t, p)
+			if !cert.NotBefore.Equal(tt.wantNotBefore) {
+				t.Errorf("NotBefore = %v, want %v", cert.NotBefore, tt.wantNotBefore)
+			}
+			if !cert.NotAfter.Equal(tt.wantNotAfter) {
+				t.Errorf("NotAfter = %v, want %v", cert.NotAfter, tt.wantNotAfter)
+			}
+		})
+	}
+}
+
+func TestNewProfile_validateIssuer(t *testing.T) {
+	issPriv := mustParseRSAKey(t, "test_files/noPasscodeCa.key")
+	newIssuer := func(fn func(*x509.Certificate)) *x509.Certificate {
+		crt := mustParseCertificate(t, "test_files/noPasscodeCa.crt")
+		fn(crt)
+		return crt
+	}
+
+	tests := []struct {
+		name     string
+		iss      *x509.Certificate
+		options  []WithOption
+		property string
+	}{
+		{"ok", newIssuer(func(*x509.Certificate) {}), nil, ""},
+		{"ok/skip", newIssuer(func(c *x509.Certificate) { c.IsCA = false }), []WithOption{WithSkipIssuerValidation()}, ""},
+		{"fail/basic-constraints", newIssuer(func(c *x509.Certificate) { c.BasicConstraintsValid = false }), nil, "BasicConstraintsValid"},
+		{"fail/ca", newIssuer(func(c *x509.Certificate) { c.IsCA = false }), nil, "IsCA"},
+		{"fail/cert-sign", newIssuer(func(c *x509.Certificate) { c.KeyUsage = x509.KeyUsageCRLSign }), nil, "KeyUsageCertSign"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := NewLeafProfile("test.smallstep.com", tt.iss, issPriv, tt.options...)
+			if tt.property == "" {
+				if err != nil {
+					t.Errorf("NewLeafProfile() error = %v", err)
+				}
+				return
+			}
+			var e *InvalidIssuerError
+			if !errors.As(err, &e) {
+				t.Fatalf("NewLeafProfile() error = %v, want *InvalidIssuerError", err)
+			}
+			if e.Property != tt.property {
+				t.Errorf("InvalidIssuerError.Property = %s, want %s", e.Property, tt.property)
+			}
+		})
+	}
+
+	t.Run("ok/self-signed-leaf", func(t *testing.T) {
+		if _, err := NewSelfSignedLeafProfile("test.smallstep.com"); err != nil {
+			t.Errorf("NewSelfSignedLeafProfile() error = %v", err)
+		}
+	})
+	t.Run("fail/self-signed-root", func(t *testing.T) {
+		if _, err := NewRootProfile("root", WithKeyUsage(x509.KeyUsageCRLSign)); err == nil {
+			t.Error("NewRootProfile() error = nil, want error")
+		}
+	})
+}
+
+func TestBase_CreatePrecertificate(t *testing.T) {
+	iss := mustParseCertificate(t, "test_files/noPasscodeCa.crt")
+	issPriv := mustParseRSAKey(t, "test_files/noPasscodeCa.key")
+
+	countPoison := func(cert *x509.Certificate) (n int) {
+		for _, ext := range cert.Extensions {
+			if ext.Id.Equal(oidExtensionCTPoison) {
+				if !ext.Critical {
+					t.Error("CT poison extension is not critical")
+				}
+				if !bytes.Equal(ext.Value, asn1.NullBytes) {
+					t.Errorf("CT poison extension value = %x, want %x", ext.Value, asn1.NullBytes)
+				}
+				n++
+			}
+		}
+		return
+	}
+
+	p, err := NewLeafProfile("test.smallstep.com", iss, issPriv, WithDNSNames([]string{"test.smallstep.com"}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	der, err := p.CreatePrecertificate()
+	if err != nil {
+		t.Fatal(err)
+	}
+	precert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert := mustCreateCertificate(t, p)
+
+	if n := countPoison(precert); n != 1 {
+		t.Errorf("precertificate has %d CT poison extensions, want 1", n)
+	}
+	if n := countPoison(cert); n != 0 {
+		t.Errorf("certificate has %d CT poison extensions, want 0", n)
+	}
+	var exts []pkix.Extension
+	for _, ext := range precert.Extensions {
+		if !ext.Id.Equal(oidExtensionCTPoison) {
+			exts = append(exts, ext)
+		}
+	}
+	if !reflect.DeepEqual(exts, cert.Extensions) {
+		t.Errorf("precertificate extensions = %v, want %v", exts, cert.Extensions)
+	}
+	if precert.SerialNumber.Cmp(cert.SerialNumber) != 0 ||
+		!precert.NotBefore.Equal(cert.NotBefore) || !precert.NotAfter.Equal(cert.NotAfter) ||
+		!bytes.Equal(precert.RawSubject, cert.RawSubject) ||
+		!bytes.Equal(precert.RawSubjectPublicKeyInfo, cert.RawSubjectPublicKeyInfo) {
+		t.Error("precertificate does not match the certificate")
+	}
+
+	t.Run("WithCTPoison", func(t *testing.T) {
+		p, err := NewLeafProfile("test.smallstep.com", iss, issPriv, WithCTPoison(), WithCTPoison())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if n := countPoison(mustCreateCertificate(t, p)); n != 1 {
+			t.Errorf("certificate has %d CT poison extensions, want 1", n)
+		}
+		if _, err := NewIntermediateProfile("intermediate", iss, issPriv, WithCTPoison()); err == nil {
+			t.Error("NewIntermediateProfile() error = nil, want error")
+		}
+	})
+}
+
+func TestBase_Verify(t *testing.T) {
+	root := mustNewProfile(t)(NewRootProfile("Root"))
+	rootCert := mustCreateCertificate(t, root)
+	intermediate := mustNewProfile(t)(NewIntermediateProfile("Intermediate", rootCert, root.SubjectPrivateKey()))
+	intermediateCert := mustCreateCertificate(t, intermediate)
+	otherRoot := mustNewProfile(t)(NewRootProfile("Other Root"))
+	otherRootCert := mustCreateCertificate(t, otherRoot)
+
+	leaf := mustNewProfile(t)(NewLeafProfile("test.smallstep.com", intermediateCert, intermediate.SubjectPrivateKey()))
+	if _, err := leaf.Verify(nil, nil, x509.VerifyOptions{}); err == nil {
+		t.Error("Verify() error = nil, want error")
+	}
+	leafCert := mustCreateCertificate(t, leaf)
+
+	roots := x509.NewCertPool()
+	roots.AddCert(rootCert)
+	chains, err := leaf.Verify(roots, nil, x509.VerifyOptions{})
+	if err != nil {
+		t.Fatalf("Verify() error = %v", err)
+	}
+	if len(chains) != 1 || len(chains[0]) != 3 {
+		t.Fatalf("Verify() = %v, want 1 chain with 3 certificates", chains)
+	}
+	for i, want := range []*x509.Certificate{leafCert, intermediateCert, rootCert} {
+		if !chains[0][i].Equal(want) {
+			t.Errorf("Verify() chain[%d] = %s, want %s", i, chains[0][i].Subject, want.Subject)
+		}
+	}
+
+	otherRoots := x509.NewCertPool()
+	otherRoots.AddCert(otherRootCert)
+	if _, err := leaf.Verify(otherRoots, nil, x509.VerifyOptions{}); err == nil {
+		t.Error("Verify() error = nil, want error")
+	}
+}
+
+func TestWithContext(t *testing.T) {
+	iss := mustParseCertificate(t, "test_files/noPasscodeCa.crt")
+	issPriv := mustParseRSAKey(t, "test_files/noPasscodeCa.key")
+
+	t.Run("canceled", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		p, err := NewLeafProfile("test.smallstep.com", iss, issPriv, GenerateKeyPair("RSA", "", 4096), WithContext(ctx))
+		if !errors.Is(err, context.Canceled) {
+			t.Errorf("NewLeafProfile() error = %v, want %v", err, context.Canceled)
+		}
+		if p != nil {
+			t.Errorf("NewLeafProfile() = %v, want nil", p)
+		}
+	})
+
+	t.Run("deadline", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+		defer cancel()
+		start := time.Now()
+		_, err := NewLeafProfile("test.smallstep.com", iss, issPriv, WithContext(ctx), GenerateKeyPair("RSA", "", 4096))
+		if !errors.Is(err, context.DeadlineExceeded) {
+			t.Errorf("NewLeafProfile() error = %v, want %v", err, context.DeadlineExceeded)
+		}
+		if d := time.Since(start); d > time.Second {
+			t.Errorf("NewLeafProfile() took %s", d)
+		}
+	})
+
+	t.Run("stops", func(t *testing.T) {
+		// The wrapped reader fails once the context is canceled.
+		ctx, cancel := context.WithCancel(context.Background())
+		r := &contextReader{ctx: ctx, r: rand.Reader}
+		if _, err := r.Read(make([]byte, 8)); err != nil {
+			t.Fatalf("Read() error = %v", err)
+		}
+		cancel()
+		if _, err := r.Read(make([]byte, 8)); !errors.Is(err, context.Canceled) {
+			t.Errorf("Read() error = %v, want %v", err, context.Canceled)
+		}
+
+		// The deterministic generator always uses the given reader, it cancels
+		// the context on the first read and the generation must not read
+		// again.
+		ctx, cancel = context.WithCancel(context.Background())
+		cr := &cancelingReader{r: rand.Reader, cancel: cancel}
+		_, err := NewLeafProfile("test.smallstep.com", iss, issPriv, WithContext(ctx), WithDeterministicRandom(cr), GenerateKeyPair("RSA", "", 2048))
+		if !errors.Is(err, context.Canceled) {
+			t.Errorf("NewLeafProfile() error = %v, want %v", err, context.Canceled)
+		}
+		// Give the generation goroutine a chance to read again.
+		time.Sleep(10 * time.Millisecond)
+		if n := cr.Reads(); n != 1 {
+			t.Errorf("NewLeafProfile() reads = %d, want 1", n)
+		}
+	})
+
+	t.Run("sign", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		p, err := NewLeafProfile("test.smallstep.com", iss, issPriv, WithContext(ctx))
+		if err != nil {
+			t.Fatal(err)
+		}
+		cancel()
+		if _, err := p.CreateCertificate(); !errors.Is(err, context.Canceled) {
+			t.Errorf("CreateCertificate() error = %v, want %v", err, context.Canceled)
+		}
+	})
+
+	t.Run("ok", func(t *testing.T) {
+		p, err := NewLeafProfile("test.smallstep.com", iss, issPriv, WithContext(context.Background()), GenerateKeyPair("EC", "P-384", 0))
+		if err != nil {
+			t.Fatal(err)
+		}
+		key, ok := p.SubjectPrivateKey().(*ecdsa.PrivateKey)
+		if !ok || key.Curve != elliptic.P384() {
+			t.Errorf("SubjectPrivateKey() = %T, want P-384 *ecdsa.PrivateKey", p.SubjectPrivateKey())
+		}
+	})
+}
+
+// cancelingReader is an io.Reader that counts the reads and calls cancel on
+// the first one.
+type cancelingReader struct {
+	r      io.Reader
+	cancel context.CancelFunc
+	mu     sync.Mutex
+	reads  int
+}
+
+func (r *cancelingReader) Read(p []byte) (int, error) {
+	r.mu.Lock()
+	r.reads++
+	r.mu.Unlock()
+	r.cancel()
+	return r.r.Read(p)
+}
+
+func (r *cancelingReader) Reads() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.reads
+}
+
+func TestWithSubject(t *testing.T) {
+	iss := mustParseCertificate(t, "test_files/noPasscodeCa.crt")
+	issPriv := mustParseRSAKey(t, "test_files/noPasscodeCa.key")
+
+	tests := []struct {
+		name    string
+		options []WithOption
+		want    pkix.Name
+	}{
+		{"ok/subject", []WithOption{WithSubject(pkix.Name{
+			Organization:       []string{"Smallstep Labs"},
+			OrganizationalUnit: []string{"Engineering"},
+			Country:            []string{"US"},
+		})}, pkix.Name{
+			CommonName:         "test.smallstep.com",
+			Organization:       []string{"Smallstep Labs"},
+			OrganizationalUnit: []string{"Engineering"},
+			Country:            []string{"US"},
+		}},
+		{"ok/subject-common-name", []WithOption{WithSubject(pkix.Name{
+			CommonName:   "other.smallstep.com",
+			Organization: []string{"Smallstep Labs"},
+		})}, pkix.Name{
+			CommonName:   "other.smallstep.com",
+			Organization: []string{"Smallstep Labs"},
+		}},
+		{"ok/helpers", []WithOption{
+			WithSubjectOrganization("Smallstep Labs"),
+			WithSubjectOrganizationalUnit("Engineering"),
+			WithSubjectCountry("US"),
+		}, pkix.Name{
+			CommonName:         "test.smallstep.com",
+			Organization:       []string{"Smallstep Labs"},
+			OrganizationalUnit: []string{"Engineering"},
+			Country:            []string{"US"},
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, err := NewLeafProfile("test.smallstep.com", iss, issPriv, tt.options...)
+			if err != nil {
+				t.Fatal(err)
+			}
+			cert := mustCreateCertificate(t, p)
+			if got := cert.Subject.String(); got != tt.want.String() {
+				t.Errorf("Subject = %s, want %s", got, tt.want.String())
+			}
+		})
+	}
+}
+
+func TestWithSubjectSerialNumber(t *testing.T) {
+	iss := mustParseCertificate(t, "test_files/noPasscodeCa.crt")
+	issPriv := mustParseRSAKey(t, "test_files/noPasscodeCa.key")
+
+	tests := []struct {
+		name    string
+		sn      string
+		wantErr bool
+	}{
+		{"ok", "DEV-1234", false},
+		{"ok/printable", "A-Z a-z 0-9 '()+,-./:=?", false},
+		{"ok/max-length", strings.Repeat("1", 64), false},
+		{"fail/empty", "", true},
+		{"fail/too-long", strings.Repeat("1", 65), true},
+		{"fail/not-printable", "DEV_1234", true},
+		{"fail/utf8", "DEV-1234é", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, err := NewLeafProfile("test.smallstep.com", iss, issPriv, WithSubjectSerialNumber(tt.sn), WithSerialNumber(big.NewInt(4321)))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("NewLeafProfile() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			cert := mustCreateCertificate(t, p)
+			if cert.Subject.SerialNumber != tt.sn {
+				t.Errorf("Subject.SerialNumber = %q, want %q", cert.Subject.SerialNumber, tt.sn)
+			}
+			if cert.SerialNumber.Cmp(big.NewInt(4321)) != 0 {
+				t.Errorf("SerialNumber = %s, want 4321", cert.SerialNumber)
+			}
+			// The attribute is in the encoded subject.
+			var rdns pkix.RDNSequence
+			if _, err := asn1.Unmarshal(cert.RawSubject, &rdns); err != nil {
+				t.Fatal(err)
+			}
+			var found bool
+			for _, rdn := range rdns {
+				for _, atv := range rdn {
+					if atv.Type.Equal(asn1.ObjectIdentifier{2, 5, 4, 5}) {
+						found = true
+					}
+				}
+			}
+			if !found {
+				t.Error("subject does not have the serialNumber attribute")
+			}
+		})
+	}
+}
+
+func TestWithExtraExtension(t *testing.T) {
+	iss := mustParseCertificate(t, "test_files/noPasscodeCa.crt")
+	issPriv := mustParseRSAKey(t, "test_files/noPasscodeCa.key")
+
+	oid := asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 37476, 9000, 64, 1}
+	ext := pkix.Extension{Id: oid, Critical: true, Value: []byte{0x05, 0x00}}
+	other := pkix.Extension{Id: oid, Value: []byte{0x01, 0x01, 0xff}}
+
+	tests := []struct {
+		name    string
+		options []WithOption
+		want    *pkix.Extension
+		wantErr bool
+	}{
+		{"ok", []WithOption{WithExtraExtension(ext)}, &ext, false},
+		{"ok/replace", []WithOption{WithExtraExtension(ext), WithReplaceExtraExtension(other)}, &other, false},
+		{"fail/duplicate", []WithOption{WithExtraExtension(ext), WithExtraExtension(other)}, nil, true},
+		{"fail/standard", []WithOption{WithExtraExtension(pkix.Extension{Id: oidExtSubjectAltName, Value: []byte{0x30, 0x00}})}, nil, true},
+		{"fail/replace-standard", []WithOption{WithReplaceExtraExtension(pkix.Extension{Id: oidExtSubjectKeyID, Value: []byte{0x04, 0x00}})}, nil, true},
+		{"fail/empty", []WithOption{WithExtraExtension(pkix.Extension{})}, nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			opts := append([]WithOption{WithHosts("test.smallstep.com")}, tt.options...)
+			p, err := NewLeafProfile("test.smallstep.com", iss, issPriv, opts...)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("NewLeafProfile() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			cert := mustCreateCertificate(t, p)
+			var found []pkix.Extension
+			for _, e := range cert.Extensions {
+				if e.Id.Equal(oid) {
+					found = append(found, e)
+				}
+			}
+			if len(found) != 1 {
+				t.Fatalf("found %d extensions with id %s, want 1", len(found), oid)
+			}
+			if found[0].Critical != tt.want.Critical || !bytes.Equal(found[0].Value, tt.want.Value) {
+				t.Errorf("extension = %+v, want %+v", found[0], *tt.want)
+			}
+			// The generated extensions are still present.
+			if len(cert.SubjectKeyId) == 0 || len(cert.DNSNames) != 1 {
+				t.Errorf("generated extensions are missing: SubjectKeyId = %x, DNSNames = %v", cert.SubjectKeyId, cert.DNSNames)
+			}
+		})
+	}
+}
+
+func TestWithDefaultDuration(t *testing.T) {
+	iss := mustParseCertificate(t, "test_files/noPasscodeCa.crt")
+	issPriv := mustParseRSAKey(t, "test_files/noPasscodeCa.key")
+	now := time.Date(2021, time.March, 14, 15, 9, 26, 0, time.UTC)
+	clock := func() time.Time { return now }
+
+	// Package variables are used if the option is not set.
+	defer func(leaf, intermediate, root time.Duration) {
+		DefaultLeafCertValidity = leaf
+		DefaultIntermediateCertValidity = intermediate
+		DefaultRootCertValidity = root
+	}(DefaultLeafCertValidity, DefaultIntermediateCertValidity, DefaultRootCertValidity)
+	DefaultLeafCertValidity = 2 * time.Hour
+	DefaultIntermediateCertValidity = 3 * time.Hour
+	DefaultRootCertValidity = 4 * time.Hour
+
+	type newFunc func(...WithOption) (Profile, error)
+	leaf := func(opts ...WithOption) (Profile, error) {
+		return NewLeafProfile("test.smallstep.com", iss, issPriv, opts...)
+	}
+	intermediate := func(opts ...WithOption) (Profile, error) {
+		return NewIntermediateProfile("intermediate", iss, issPriv, opts...)
+	}
+	root := func(opts ...WithOption) (Profile, error) {
+		return NewRootProfile("root", opts...)
+	}
+
+	tests := []struct {
+		name    string
+		newFunc newFunc
+		options []WithOption
+		want    time.Duration
+		wantErr bool
+	}{
+		{"leaf/package", leaf, nil, 2 * time.Hour, false},
+		{"leaf/option", leaf, []WithOption{WithDefaultDuration(time.Minute)}, time.Minute, false},
+		{"leaf/validity", leaf, []WithOption{WithDefaultDuration(time.Minute), WithValidity(time.Second)}, time.Second, false},
+		{"intermediate/package", intermediate, nil, 3 * time.Hour, false},
+		{"intermediate/option", intermediate, []WithOption{WithDefaultDuration(time.Minute)}, time.Minute, false},
+		{"root/package", root, nil, 4 * time.Hour, false},
+		{"root/option", root, []WithOption{WithDefaultDuration(time.Minute)}, time.Minute, false},
+		{"fail/zero", leaf, []WithOption{WithDefaultDuration(0)}, 0, true},
+		{"fail/negative", root, []WithOption{WithDefaultDuration(-time.Minute)}, 0, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, err := tt.newFunc(append([]WithOption{WithClock(clock)}, tt.options...)...)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("new profile error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if got := p.Subject().NotAfter; !got.Equal(now.Add(tt.want)) {
+				t.Errorf("NotAfter = %v, want %v", got, now.Add(tt.want))
+			}
+		})
+	}
+}
+
+func TestDefaultKeyUsageForKey(t *testing.T) {
+	ecdsaKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	edPub, _, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		pub  crypto.PublicKey
+		want x509.KeyUsage
+	}{
+		{"rsa", rsaKey.Public(), x509.KeyUsageDigitalSignature | x509.KeyUsageKeyEncipherment},
+		{"ecdsa", ecdsaKey.Public(), x509.KeyUsageDigitalSignature | x509.KeyUsageKeyAgreement},
+		{"ed25519", edPub, x509.KeyUsageDigitalSignature},
+		{"nil", nil, x509.KeyUsageDigitalSignature},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := DefaultKeyUsageForKey(tt.pub); got != tt.want {
+				t.Errorf("DefaultKeyUsageForKey() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	// Leaf profiles use the key usage of the generated key.
+	iss := mustParseCertificate(t, "test_files/noPasscodeCa.crt")
+	issPriv := mustParseRSAKey(t, "test_files/noPasscodeCa.key")
+	for _, tt := range []struct {
+		kty, crv string
+		size     int
+		want     x509.KeyUsage
+	}{
+		{"RSA", "", 2048, x509.KeyUsageDigitalSignature | x509.KeyUsageKeyEncipherment},
+		{"EC", "P-256", 0, x509.KeyUsageDigitalSignature | x509.KeyUsageKeyAgreement},
+		{"OKP", "Ed25519", 0, x509.KeyUsageDigitalSignature},
+	} {
+		p := mustNewProfile(t)(NewLeafProfile("test.smallstep.com", iss, issPriv, GenerateKeyPair(tt.kty, tt.crv, tt.size)))
+		if cert := mustCreateCertificate(t, p); cert.KeyUsage != tt.want {
+			t.Errorf("NewLeafProfile() with %s key, KeyUsage = %v, want %v", tt.kty, cert.KeyUsage, tt.want)
+		}
+	}
+}
+
+func TestWithSKIMethod(t *testing.T) {
+	iss := mustParseCertificate(t, "test_files/noPasscodeCa.crt")
+	issPriv := mustParseRSAKey(t, "test_files/noPasscodeCa.key")
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	method1, err := generateSubjectKeyID(key.Public())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		options []WithOption
+		want    []byte
+		wantErr bool
+	}{
+		{"ok/default", nil, method1, false},
+		{"ok/method1", []WithOption{WithSKIMethod(SKIMethod1)}, method1, false},
+		{"ok/method2", []WithOption{WithSKIMethod(SKIMethod2)}, append([]byte{0x40 | method1[12]&0x0f}, method1[13:]...), false},
+		{"fail/zero", []WithOption{WithSKIMethod(0)}, nil, true},
+		{"fail/unknown", []WithOption{WithSKIMethod(3)}, nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			opts := append([]WithOption{WithPublicKey(key.Public())}, tt.options...)
+			p, err := NewLeafProfile("test.smallstep.com", iss, issPriv, opts...)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("NewLeafProfile() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			cert := mustCreateCertificate(t, p)
+			if !bytes.Equal(cert.SubjectKeyId, tt.want) {
+				t.Errorf("SubjectKeyId = %x, want %x", cert.SubjectKeyId, tt.want)
+			}
+		})
+	}
+
+	// Same key, both methods.
+	p1 := mustNewProfile(t)(NewLeafProfile("test.smallstep.com", iss, issPriv, WithPublicKey(key.Public()), WithSKIMethod(SKIMethod1)))
+	p2 := mustNewProfile(t)(NewLeafProfile("test.smallstep.com", iss, issPriv, WithPublicKey(key.Public()), WithSKIMethod(SKIMethod2)))
+	if n := len(p1.Subject().SubjectKeyId); n != 20 {
+		t.Errorf("SKIMethod1 length = %d, want 20", n)
+	}
+	if n := len(p2.Subject().SubjectKeyId); n != 8 {
+		t.Errorf("SKIMethod2 length = %d, want 8", n)
+	}
+	if p2.Subject().SubjectKeyId[0]>>4 != 0x4 {
+		t.Errorf("SKIMethod2 type field = %x, want 4", p2.Subject().SubjectKeyId[0]>>4)
+	}
+}
+
+func TestWithAuthorityKeyId(t *testing.T) {
+	iss := mustParseCertificate(t, "test_files/noPasscodeCa.crt")
+	issPriv := mustParseRSAKey(t, "test_files/noPasscodeCa.key")
+	bridgeID := bytes.Repeat([]byte{0xab}, 20)
+
+	tests := []struct {
+		name    string
+		options []WithOption
+		want    []byte
+		wantErr bool
+	}{
+		{"ok/default", nil, iss.SubjectKeyId, false},
+		{"ok/override", []WithOption{WithAuthorityKeyId(bridgeID)}, bridgeID, false},
+		{"ok/short", []WithOption{WithAuthorityKeyId([]byte{1, 2, 3, 4})}, []byte{1, 2, 3, 4}, false},
+		{"ok/tbs", []WithOption{WithAuthorityKeyId(bridgeID), WithForceGeneralizedTime()}, bridgeID, false},
+		{"fail/empty", []WithOption{WithAuthorityKeyId(nil)}, nil, true},
+		{"fail/too-long", []WithOption{WithAuthorityKeyId(make([]byte, 21))}, nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, err := NewLeafProfile("test.smallstep.com", iss, issPriv, tt.options...)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("NewLeafProfile() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			cert := mustCreateCertificate(t, p)
+			if !bytes.Equal(cert.AuthorityKeyId, tt.want) {
+				t.Errorf("AuthorityKeyId = %x, want %x", cert.AuthorityKeyId, tt.want)
+			}
+			if err := cert.CheckSignatureFrom(iss); err != nil {
+				t.Errorf("CheckSignatureFrom() error = %v", err)
+			}
+		})
+	}
+
+	// Self-signed certificates use the override too.
+	root := mustNewProfile(t)(NewRootProfile("Root", WithAuthorityKeyId(bridgeID)))
+	if cert := mustCreateCertificate(t, root); !bytes.Equal(cert.AuthorityKeyId, bridgeID) {
+		t.Errorf("AuthorityKeyId = %x, want %x", cert.AuthorityKeyId, bridgeID)
+	}
+}
+
+func TestIssuerValidity(t *testing.T) {
+	t0 := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	clockAt := func(t time.Time) WithOption {
+		return WithClock(func() time.Time { return t })
+	}
+	root := mustNewProfile(t)(NewRootProfile("Root", clockAt(t0), WithValidity(time.Hour)))
+	iss := mustCreateCertificate(t, root)
+	issPriv := root.SubjectPrivateKey()
+
+	tests := []struct {
+		name          string
+		options       []WithOption
+		wantNotBefore time.Time
+		wantNotAfter  time.Time
+		wantErr       bool
+	}{
+		{"ok/within", []WithOption{clockAt(t0.Add(time.Minute)), WithValidity(time.Minute)}, t0.Add(time.Minute), t0.Add(2 * time.Minute), false},
+		{"ok/default-not-after", []WithOption{clockAt(t0.Add(time.Minute))}, t0.Add(time.Minute), t0.Add(time.Hour), false},
+		{"ok/default-backdate", []WithOption{clockAt(t0), WithBackdate(5 * time.Minute), WithValidity(time.Minute)}, t0, t0.Add(time.Minute), false},
+		{"ok/exact", []WithOption{WithNotBeforeAfterDuration(t0, t0.Add(time.Hour), 0), clockAt(t0)}, t0, t0.Add(time.Hour), false},
+		{"ok/allow-outlive", []WithOption{clockAt(t0), WithValidity(2 * time.Hour), WithAllowIssuerValidityMismatch()}, t0, t0.Add(2 * time.Hour), false},
+		{"ok/allow-expired", []WithOption{clockAt(t0.Add(2 * time.Hour)), WithAllowIssuerValidityMismatch()}, t0.Add(2 * time.Hour), t0.Add(2*time.Hour + DefaultLeafCertValidity), false},
+		{"fail/outlive", []WithOption{clockAt(t0), WithValidity(2 * time.Hour)}, time.Time{}, time.Time{}, true},
+		{"fail/not-after", []WithOption{clockAt(t0), WithNotBeforeAfterDuration(t0, t0.Add(time.Hour+time.Second), 0)}, time.Time{}, time.Time{}, true},
+		{"fail/not-before", []WithOption{clockAt(t0), WithNotBeforeAfterDuration(t0.Add(-time.Second), t0.Add(time.Minute), 0)}, time.Time{}, time.Time{}, true},
+		{"fail/expired", []WithOption{clockAt(t0.Add(2 * time.Hour))}, time.Time{}, time.Time{}, true},
+		{"fail/not-yet-valid", []WithOption{clockAt(t0.Add(-time.Minute))}, time.Time{}, time.Time{}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, err := NewLeafProfile("test.smallstep.com", iss, issPriv, tt.options...)
+			if tt.wantErr {
+				if !errors.Is(err, ErrValidityExceedsIssuer) {
+					t.Errorf("NewLeafProfile() error = %v, want ErrValidityExceedsIssuer", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("NewLeafProfile() error = %v", err)
+			}
+			cert := mustCreateCertificate(t, p)
+			if !cert.NotBefore.Equal(tt.wantNotBefore) || !cert.NotAfter.Equal(tt.wantNotAfter) {
+				t.Errorf("validity = %s - %s, want %s - %s", cert.NotBefore, cert.NotAfter, tt.wantNotBefore, tt.wantNotAfter)
+			}
+		})
+	}
+
+	// Self-signed certificates are not checked.
+	if _, err := NewSelfSignedLeafProfile("test.smallstep.com", clockAt(t0), WithNotBeforeAfterDuration(t0.Add(-time.Hour), t0.Add(time.Hour), 0)); err != nil {
+		t.Errorf("NewSelfSignedLeafProfile() error = %v", err)
+	}
+}
+
+func TestBase_CertificateDER(t *testing.T) {
+	iss := mustParseCertificate(t, "test_files/noPasscodeCa.crt")
+	issPriv := mustParseRSAKey(t, "test_files/noPasscodeCa.key")
+
+	p := mustNewProfile(t)(NewLeafProfile("test.smallstep.com", iss, issPriv))
+	der1, err := p.CertificateDER()
+	if err != nil {
+		t.Fatal(err)
+	}
+	der2, err := p.CertificateDER()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(der1, der2) {
+		t.Error("CertificateDER() returned different certificates")
+	}
+	cert, err := x509.ParseCertificate(der1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cert.Subject.CommonName != "test.smallstep.com" {
+		t.Errorf("CommonName = %s, want test.smallstep.com", cert.Subject.CommonName)
+	}
+	if cert.SerialNumber.Cmp(p.Subject().SerialNumber) != 0 {
+		t.Errorf("SerialNumber = %s, want %s", cert.SerialNumber, p.Subject().SerialNumber)
+	}
+	if err := cert.CheckSignatureFrom(iss); err != nil {
+		t.Errorf("CheckSignatureFrom() error = %v", err)
+	}
+
+	// Modifying the result does not modify the cache.
+	der1[0] = 0
+	if der3, _ := p.CertificateDER(); !bytes.Equal(der2, der3) {
+		t.Error("CertificateDER() cache was modified")
+	}
+
+	// CertificateDER returns the certificate created by CreateCertificate.
+	p = mustNewProfile(t)(NewLeafProfile("test.smallstep.com", iss, issPriv))
+	der, err := p.CreateCertificate()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, err := p.CertificateDER(); err != nil || !bytes.Equal(got, der) {
+		t.Errorf("CertificateDER() = %x, %v, want %x", got, err, der)
+	}
+
+	// Errors are propagated.
+	p = mustNewProfile(t)(NewLeafProfile("test.smallstep.com", iss, issPriv))
+	p.SetIssuerPrivateKey(nil)
+	if _, err := p.CertificateDER(); err == nil {
+		t.Error("CertificateDER() error = nil, want error")
+	}
+}
+
+func TestWithEmailAddresses(t *testing.T) {
+	iss := mustParseCertificate(t, "test_files/noPasscodeCa.crt")
+	issPriv := mustParseRSAKey(t, "test_files/noPasscodeCa.key")
+
+	tests := []struct {
+		name    string
+		emails  []string
+		want    []string
+		wantErr bool
+	}{
+		{"ok", []string{"jane@smallstep.com"}, []string{"jane@smallstep.com"}, false},
+		{"ok/multiple", []string{"jane@smallstep.com", "joe+test@example.org"}, []string{"jane@smallstep.com", "joe+test@example.org"}, false},
+		{"ok/idn", []string{"jane@bücher.example"}, []string{"jane@xn--bcher-kva.example"}, false},
+		{"ok/idn-uppercase", []string{"jane@BÜCHER.example"}, []string{"jane@xn--bcher-kva.example"}, false},
+		{"ok/empty", nil, nil, false},
+		{"fail/invalid", []string{"jane@smallstep.com", "not-an-email", "@smallstep.com"}, nil, true},
+		{"fail/display-name", []string{"Jane <jane@smallstep.com>"}, nil, true},
+		{"fail/utf8-local", []string{"jäne@smallstep.com"}, nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, err := NewLeafProfile("test.smallstep.com", iss, issPriv, WithEmailAddresses(tt.emails...))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("NewLeafProfile() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			cert := mustCreateCertificate(t, p)
+			if !reflect.DeepEqual(cert.EmailAddresses, tt.want) {
+				t.Errorf("EmailAddresses = %v, want %v", cert.EmailAddresses, tt.want)
+			}
+		})
+	}
+
+	t.Run("fail/list", func(t *testing.T) {
+		_, err := NewLeafProfile("test.smallstep.com", iss, issPriv, WithEmailAddresses("a@smallstep.com", "bad1", "bad2"))
+		if err == nil || !strings.Contains(err.Error(), "bad1") || !strings.Contains(err.Error(), "bad2") {
+			t.Errorf("NewLeafProfile() error = %v, want error listing the invalid addresses", err)
+		}
+	})
+}
+
+func TestWithCommonNameInSAN(t *testing.T) {
+	iss := mustParseCertificate(t, "test_files/noPasscodeCa.crt")
+	issPriv := mustParseRSAKey(t, "test_files/noPasscodeCa.key")
+
+	tests := []struct {
+		name    string
+		cn      string
+		ops     []WithOption
+		wantDNS []string
+		wantIPs []net.IP
+	}{
+		{"ok", "test.smallstep.com", nil, []string{"test.smallstep.com"}, nil},
+		{"ok/ip", "127.0.0.1", nil, nil, []net.IP{net.ParseIP("127.0.0.1")}},
+		{"ok/with-sans", "test.smallstep.com", []WithOption{WithSANs([]string{"www.smallstep.com"})}, []string{"www.smallstep.com", "test.smallstep.com"}, nil},
+		{"ok/already-present", "test.smallstep.com", []WithOption{WithDNSNames([]string{"TEST.smallstep.com"})}, []string{"TEST.smallstep.com"}, nil},
+		{"ok/ip-already-present", "::1", []WithOption{WithIPAddresses([]net.IP{net.IPv6loopback})}, nil, []net.IP{net.IPv6loopback}},
+		{"ok/empty", "", []WithOption{WithDNSNames([]string{"test.smallstep.com"})}, []string{"test.smallstep.com"}, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// WithCommonNameInSAN goes first to check that it is applied
+			// after the other modifiers.
+			ops := append([]WithOption{WithCommonNameInSAN()}, tt.ops...)
+			p := mustNewProfile(t)(NewLeafProfile(tt.cn, iss, issPriv, ops...))
+			cert := mustCreateCertificate(t, p)
+			if !reflect.DeepEqual(cert.DNSNames, tt.wantDNS) {
+				t.Errorf("DNSNames = %v, want %v", cert.DNSNames, tt.wantDNS)
+			}
+			if len(cert.IPAddresses) != len(tt.wantIPs) {
+				t.Fatalf("IPAddresses = %v, want %v", cert.IPAddresses, tt.wantIPs)
+			}
+			for i, ip := range tt.wantIPs {
+				if !cert.IPAddresses[i].Equal(ip) {
+					t.Errorf("IPAddresses = %v, want %v", cert.IPAddresses, tt.wantIPs)
+				}
+			}
+			if tt.wantDNS != nil || tt.wantIPs != nil {
+				if _, ok := findExtension(cert, oidExtSubjectAltName); !ok {
+					t.Error("certificate does not have a subject alternative name extension")
+				}
+			}
+		})
+	}
+}
+
+func TestWithMaxPathLen(t *testing.T) {
+	root := mustNewProfile(t)(NewRootProfile("root", WithMaxPathLen(2)))
+	rootCert := mustCreateCertificate(t, root)
+	if rootCert.MaxPathLen != 2 || rootCert.MaxPathLenZero {
+		t.Errorf("root MaxPathLen = %d, MaxPathLenZero = %v, want 2 and false", rootCert.MaxPathLen, rootCert.MaxPathLenZero)
+	}
+
+	// An unconstrained root can issue intermediates with any path length.
+	root = mustNewProfile(t)(NewRootProfile("root", WithMaxPathLen(-1)))
+	rootCert = mustCreateCertificate(t, root)
+
+	tests := []struct {
+		name               string
+		maxPathLen         int
+		wantMaxPathLen     int
+		wantMaxPathLenZero bool
+	}{
+		{"unconstrained", -1, -1, false},
+		{"zero", 0, 0, true},
+		{"one", 1, 1, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := mustNewProfile(t)(NewIntermediateProfile("intermediate", rootCert, root.SubjectPrivateKey(), WithMaxPathLen(tt.maxPathLen)))
+			cert := mustCreateCertificate(t, p)
+			if cert.MaxPathLen != tt.wantMaxPathLen {
+				t.Errorf("MaxPathLen = %d, want %d", cert.MaxPathLen, tt.wantMaxPathLen)
+			}
+			if cert.MaxPathLenZero != tt.wantMaxPathLenZero {
+				t.Errorf("MaxPathLenZero = %v, want %v", cert.MaxPathLenZero, tt.wantMaxPathLenZero)
+			}
+
+			// The cross-sign profile copies the path length, override it.
+			cross := mustNewProfile(t)(NewCrossSignProfile(rootCert, rootCert, root.SubjectPrivateKey(), WithMaxPathLen(tt.maxPathLen), WithAllowIssuerKeyReuse()))
+			crossCert := mustCreateCertificate(t, cross)
+			if crossCert.MaxPathLen != tt.wantMaxPathLen || crossCert.MaxPathLenZero != tt.wantMaxPathLenZero {
+				t.Errorf("cross-signed MaxPathLen = %d, MaxPathLenZero = %v, want %d and %v",
+					crossCert.MaxPathLen, crossCert.MaxPathLenZero, tt.wantMaxPathLen, tt.wantMaxPathLenZero)
+			}
+		})
+	}
+
+	t.Run("leaf", func(t *testing.T) {
+		_, err := NewLeafProfile("leaf", rootCert, root.SubjectPrivateKey(), WithMaxPathLen(0))
+		if err == nil || !strings.Contains(err.Error(), "can only be used in CA profiles") {
+			t.Errorf("NewLeafProfile() error = %v, want CA profiles error", err)
+		}
+	})
+}
+
+func TestCheckPathLen(t *testing.T) {
+	newRoot := func(n int) (*x509.Certificate, interface{}) {
+		root := mustNewProfile(t)(NewRootProfile("root", WithMaxPathLen(n)))
+		return mustCreateCertificate(t, root), root.SubjectPrivateKey()
+	}
+
+	tests := []struct {
+		name         string
+		issPathLen   int
+		subPathLen   int
+		options      []WithOption
+		wantErr      string
+		wantErrOther string
+	}{
+		{"ok root(1) intermediate(0)", 1, 0, nil, "", ""},
+		{"ok root(2) intermediate(1)", 2, 1, nil, "", ""},
+		{"ok root(unconstrained) intermediate(unconstrained)", -1, -1, nil, "", ""},
+		{"ok skip", 0, 0, []WithOption{WithSkipPathLenCheck()}, "", ""},
+		{"fail root(0) intermediate(0)", 0, 0, nil, "path length of 0 and cannot issue CA certificates", "requested path length is 0"},
+		{"fail root(1) intermediate(1)", 1, 1, nil, "issuer certificate has a path length of 1", "requested path length is 1"},
+		{"fail root(1) intermediate(unconstrained)", 1, -1, nil, "issuer certificate has a path length of 1", "requested path length is unconstrained"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			iss, issPriv := newRoot(tt.issPathLen)
+			opts := append([]WithOption{WithMaxPathLen(tt.subPathLen)}, tt.options...)
+			p := mustNewProfile(t)(NewIntermediateProfile("intermediate", iss, issPriv, opts...))
+			_, err := p.CreateCertificate()
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Errorf("CreateCertificate() error = %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) || !strings.Contains(err.Error(), tt.wantErrOther) {
+				t.Errorf("CreateCertificate() error = %v, want %q and %q", err, tt.wantErr, tt.wantErrOther)
+			}
+		})
+	}
+
+	t.Run("leaf", func(t *testing.T) {
+		iss, issPriv := newRoot(0)
+		p := mustNewProfile(t)(NewLeafProfile("leaf", iss, issPriv, WithHosts("leaf.smallstep.com")))
+		if _, err := p.CreateCertificate(); err != nil {
+			t.Errorf("CreateCertificate() error = %v", err)
+		}
+	})
+}
+
+func TestWithNoPathLenConstraint(t *testing.T) {
+	root := mustNewProfile(t)(NewRootProfile("root", WithNoPathLenConstraint()))
+	rootCert := mustCreateCertificate(t, root)
+
+	// maxPathLen returns the encoded path length, or -1 if it is not present.
+	maxPathLen := func(t *testing.T, crt *x509.Certificate) int {
+		ext, ok := findExtension(crt, oidExtBasicConstraints)
+		if !ok {
+			t.Fatal("certificate does not have the basic constraints extension")
+		}
+		var bc basicConstraints
+		if rest, err := asn1.Unmarshal(ext.Value, &bc); err != nil || len(rest) > 0 {
+			t.Fatalf("asn1.Unmarshal() error = %v, rest = %x", err, rest)
+		}
+		if !bc.IsCA {
+			t.Error("basic constraints IsCA = false, want true")
+		}
+		return bc.MaxPathLen
+	}
+
+	tests := []struct {
+		name    string
+		option  WithOption
+		want    int
+		wantErr bool
+	}{
+		{"pathlen-0", WithMaxPathLen(0), 0, false},
+		{"pathlen-1", WithMaxPathLen(1), 1, false},
+		{"pathlen-2", WithMaxPathLen(2), 2, false},
+		{"absent", WithNoPathLenConstraint(), -1, false},
+		{"absent-sentinel", WithMaxPathLen(-1), -1, false},
+		{"fail-negative", WithMaxPathLen(-2), 0, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			profiles := map[string]func() (Profile, error){
+				"root": func() (Profile, error) {
+					return NewRootProfile("root", tt.option)
+				},
+				"intermediate": func() (Profile, error) {
+					return NewIntermediateProfile("intermediate", rootCert, root.SubjectPrivateKey(), tt.option)
+				},
+			}
+			for name, fn := range profiles {
+				p, err := fn()
+				if tt.wantErr {
+					if err == nil {
+						t.Errorf("%s: error = nil, want error", name)
+					}
+					continue
+				}
+				if got := maxPathLen(t, mustCreateCertificate(t, mustNewProfile(t)(p, err))); got != tt.want {
+					t.Errorf("%s: encoded path length = %d, want %d", name, got, tt.want)
+				}
+			}
+		})
+	}
+}
+
+func TestBase_SubjectSigner(t *testing.T) {
+	iss := mustParseCertificate(t, "test_files/noPasscodeCa.crt")
+	issPriv := mustParseRSAKey(t, "test_files/noPasscodeCa.key")
+
+	tests := []struct {
+		name    string
+		options []WithOption
+		wantErr string
+	}{
+		{"ok/rsa", []WithOption{GenerateKeyPair("RSA", "", 2048)}, ""},
+		{"ok/ecdsa", []WithOption{GenerateKeyPair("EC", "P-256", 0)}, ""},
+		{"fail/no-key", []WithOption{WithPublicKey(issPriv.Public())}, "does not have a subject private key"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := mustNewProfile(t)(NewLeafProfile("test.smallstep.com", iss, issPriv, tt.options...))
+			signer, err := p.SubjectSigner()
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("SubjectSigner() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("SubjectSigner() error = %v", err)
+			}
+			if !publicKeyEqual(signer.Public(), p.SubjectPublicKey()) {
+				t.Error("SubjectSigner() public key does not match SubjectPublicKey()")
+			}
+			crt := mustCreateCertificate(t, p)
+			if !publicKeyEqual(crt.PublicKey, signer.Public()) {
+				t.Error("certificate public key does not match SubjectSigner()")
+			}
+		})
+	}
+
+	t.Run("fail/not-signer", func(t *testing.T) {
+		p := mustNewProfile(t)(NewLeafProfile("test.smallstep.com", iss, issPriv))
+		p.SetSubjectPrivateKey([]byte("foo"))
+		if _, err := p.SubjectSigner(); err == nil || !strings.Contains(err.Error(), "is not a crypto.Signer") {
+			t.Errorf("SubjectSigner() error = %v, want not a crypto.Signer error", err)
+		}
+	})
+}
+
+func TestCAOnlyOptions(t *testing.T) {
+	root := mustNewProfile(t)(NewRootProfile("root"))
+	rootCert := mustCreateCertificate(t, root)
+	rootPriv := root.SubjectPrivateKey()
+	zero := 0
+
+	tests := []struct {
+		name    string
+		option  WithOption
+		wantErr string
+	}{
+		{"WithMaxPathLen", WithMaxPathLen(0), "WithMaxPathLen can only be used in CA profiles"},
+		{"WithNoPathLenConstraint", WithNoPathLenConstraint(), "WithNoPathLenConstraint can only be used in CA profiles"},
+		{"WithPolicyConstraints", WithPolicyConstraints(&zero, nil), "WithPolicyConstraints can only be used in CA profiles"},
+		{"WithInhibitAnyPolicy", WithInhibitAnyPolicy(0), "WithInhibitAnyPolicy can only be used in CA profiles"},
+		{"name constraints fields", WithTemplateFunc(func(crt *x509.Certificate) error {
+			crt.PermittedDNSDomains = []string{"smallstep.com"}
+			return nil
+		}), "name constraints can only be used in CA profiles"},
+		{"policy constraints extension", WithExtraExtension(pkix.Extension{Id: oidExtPolicyConstraints, Critical: true, Value: []byte{0x30, 0x03, 0x80, 0x01, 0x00}}),
+			"the policy constraints extension can only be used in CA profiles"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := NewLeafProfile("leaf", rootCert, rootPriv, tt.option)
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("NewLeafProfile() error = %v, want %q", err, tt.wantErr)
+			}
+			if _, err := NewIntermediateProfile("intermediate", rootCert, rootPriv, tt.option); err != nil {
+				t.Errorf("NewIntermediateProfile() error = %v", err)
+			}
+		})
+	}
+
+	t.Run("leaf options in CA", func(t *testing.T) {
+		p := mustNewProfile(t)(NewIntermediateProfile("intermediate", rootCert, rootPriv, WithHosts("ca.smallstep.com")))
+		if cert := mustCreateCertificate(t, p); !reflect.DeepEqual(cert.DNSNames, []string{"ca.smallstep.com"}) {
+			t.Errorf("DNSNames = %v, want [ca.smallstep.com]", cert.DNSNames)
+		}
+	})
+}
+
+// opaqueSigner hides the type of the private key, like a key in an HSM.
+type opaqueSigner struct {
+	crypto.Signer
+}
+
+func TestWithKeyPairGenerator(t *testing.T) {
+	iss := mustParseCertificate(t, "test_files/noPasscodeCa.crt")
+	issPriv := mustParseRSAKey(t, "test_files/noPasscodeCa.key")
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	generator := func(pub crypto.PublicKey, priv crypto.PrivateKey, err error) func() (crypto.PublicKey, crypto.PrivateKey, error) {
+		return func() (crypto.PublicKey, crypto.PrivateKey, error) {
+			return pub, priv, err
+		}
+	}
+
+	tests := []struct {
+		name       string
+		fn         func() (crypto.PublicKey, crypto.PrivateKey, error)
+		exportable bool
+		wantErr    bool
+	}{
+		{"ok", generator(key.Public(), key, nil), true, false},
+		{"ok/opaque", generator(key.Public(), opaqueSigner{key}, nil), false, false},
+		{"ok/no-private-key", generator(key.Public(), nil, nil), false, false},
+		{"fail/nil", nil, false, true},
+		{"fail/error", generator(nil, nil, errors.New("an error")), false, true},
+		{"fail/nil-public-key", generator(nil, key, nil), false, true},
+		{"fail/mismatch", generator(other.Public(), key, nil), false, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, err := NewLeafProfile("test.smallstep.com", iss, issPriv, WithKeyPairGenerator(tt.fn))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("NewLeafProfile() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if !reflect.DeepEqual(p.SubjectPublicKey(), key.Public()) {
+				t.Errorf("SubjectPublicKey() = %v, want %v", p.SubjectPublicKey(), key.Public())
+			}
+			if _, priv, _ := tt.fn(); !reflect.DeepEqual(p.SubjectPrivateKey(), priv) {
+				t.Errorf("SubjectPrivateKey() = %v, want %v", p.SubjectPrivateKey(), priv)
+			}
+			crt := mustCreateCertificate(t, p)
+			if !key.PublicKey.Equal(crt.PublicKey) {
+				t.Error("certificate public key does not match the generated key")
+			}
+
+			_, err = p.EncryptedSubjectKeyPEM([]byte("password"))
+			if (err == nil) != tt.exportable {
+				t.Errorf("EncryptedSubjectKeyPEM() error = %v, exportable %v", err, tt.exportable)
+			}
+			_, err = p.CreatePKCS12("password")
+			if (err == nil) != tt.exportable {
+				t.Errorf("CreatePKCS12() error = %v, exportable %v", err, tt.exportable)
+			}
+		})
+	}
+
+	t.Run("ok/public-key", func(t *testing.T) {
+		pub := mustParseCertificate(t, "test_files/ca.crt").PublicKey
+		p := mustNewProfile(t)(NewLeafProfile("test.smallstep.com", iss, issPriv,
+			WithPublicKey(pub), WithKeyPairGenerator(generator(key.Public(), key, nil))))
+		if !reflect.DeepEqual(p.SubjectPublicKey(), pub) {
+			t.Error("WithKeyPairGenerator() should not replace the key set with WithPublicKey()")
+		}
+	})
+}
@@ -0,0 +1,63 @@
+package x509util
+
+import (
+	"crypto/x509/pkix"
+	"encoding/asn1"
+
+	"github.com/pkg/errors"
+)
+
+// oidExtQCStatements is the OID for the qualified certificate statements
+// extension defined in RFC 3739, section 3.2.6.
+var oidExtQCStatements = asn1.ObjectIdentifier{1, 3, 6, 1, 5, 5, 7, 1, 3}
+
+// Common qualified certificate statements defined in RFC 3739 and ETSI EN 319
+// 412-5.
+var (
+	// OIDQCSyntaxV2 is id-qcs-pkixQCSyntax-v2, the statement that the
+	// certificate conforms to RFC 3739.
+	OIDQCSyntaxV2 = asn1.ObjectIdentifier{1, 3, 6, 1, 5, 5, 7, 11, 2}
+	// OIDQCCompliance is esi4-qcStatement-1, the statement that the
+	// certificate is an EU qualified certificate.
+	OIDQCCompliance = asn1.ObjectIdentifier{0, 4, 0, 1862, 1, 1}
+	// OIDQCSSCD is esi4-qcStatement-4, the statement that the private key
+	// resides in a qualified signature creation device.
+	OIDQCSSCD = asn1.ObjectIdentifier{0, 4, 0, 1862, 1, 4}
+)
+
+// qcStatement is the ASN.1 structure of a QCStatement without statement info.
+//
+//	QCStatement ::= SEQUENCE {
+//	    statementId   QC-STATEMENT.&Id({SupportedStatements}),
+//	    statementInfo QC-STATEMENT.&Type({SupportedStatements}{@statementId}) OPTIONAL }
+type qcStatement struct {
+	StatementID asn1.ObjectIdentifier
+}
+
+// WithQCStatements returns a Profile modifier that adds the qualified
+// certificate statements extension with the given statement identifiers, like
+// OIDQCCompliance. The statements do not include statement info.
+func WithQCStatements(statements []asn1.ObjectIdentifier) WithOption {
+	return func(p Profile) error {
+		if len(statements) == 0 {
+			return errors.New("qualified certificate statements cannot be empty")
+		}
+		qcs := make([]qcStatement, len(statements))
+		for i, oid := range statements {
+			if len(oid) == 0 {
+				return errors.Errorf("qualified certificate statement %d cannot be empty", i)
+			}
+			qcs[i] = qcStatement{StatementID: oid}
+		}
+		value, err := asn1.Marshal(qcs)
+		if err != nil {
+			return errors.Wrap(err, "error marshaling qualified certificate statements")
+		}
+		crt := p.Subject()
+		crt.ExtraExtensions = append(removeExtension(crt.ExtraExtensions, oidExtQCStatements), pkix.Extension{
+			Id:    oidExtQCStatements,
+			Value: value,
+		})
+		return nil
+	}
+}
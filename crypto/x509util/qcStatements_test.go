@@ -0,0 +1,57 @@
+package x509util
+
+import (
+	"encoding/asn1"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestWithQCStatements(t *testing.T) {
+	iss := mustParseCertificate(t, "test_files/noPasscodeCa.crt")
+	issPriv := mustParseRSAKey(t, "test_files/noPasscodeCa.key")
+
+	tests := []struct {
+		name       string
+		statements []asn1.ObjectIdentifier
+		wantErr    string
+	}{
+		{"ok", []asn1.ObjectIdentifier{OIDQCCompliance, OIDQCSSCD}, ""},
+		{"ok custom", []asn1.ObjectIdentifier{OIDQCSyntaxV2, {1, 2, 3, 4}}, ""},
+		{"fail empty", nil, "cannot be empty"},
+		{"fail empty oid", []asn1.ObjectIdentifier{OIDQCCompliance, {}}, "statement 1 cannot be empty"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, err := NewLeafProfile("leaf", iss, issPriv, WithHosts("leaf.smallstep.com"), WithQCStatements(tt.statements))
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("NewLeafProfile() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			crt := mustCreateCertificate(t, mustNewProfile(t)(p, err))
+			ext, ok := findExtension(crt, oidExtQCStatements)
+			if !ok {
+				t.Fatal("certificate does not have the qcStatements extension")
+			}
+			if ext.Critical {
+				t.Error("qcStatements extension is critical")
+			}
+			var qcs []struct {
+				StatementID   asn1.ObjectIdentifier
+				StatementInfo asn1.RawValue `asn1:"optional"`
+			}
+			if rest, err := asn1.Unmarshal(ext.Value, &qcs); err != nil || len(rest) > 0 {
+				t.Fatalf("asn1.Unmarshal() error = %v, rest = %x", err, rest)
+			}
+			var got []asn1.ObjectIdentifier
+			for _, qc := range qcs {
+				got = append(got, qc.StatementID)
+			}
+			if !reflect.DeepEqual(got, tt.statements) {
+				t.Errorf("statements = %v, want %v", got, tt.statements)
+			}
+		})
+	}
+}
@@ -1,6 +1,7 @@
 package x509util
 
 import (
+	"crypto"
 	"crypto/x509"
 	"crypto/x509/pkix"
 	"time"
@@ -18,6 +19,9 @@ type Root struct {
 
 // DefaultDuration returns the default Root Certificate duration.
 func (r *Root) DefaultDuration() time.Duration {
+	if r.defaultDuration > 0 {
+		return r.defaultDuration
+	}
 	return DefaultRootCertValidity
 }
 
@@ -38,12 +42,63 @@ func NewRootProfileWithTemplate(crt *x509.Certificate, withOps ...WithOption) (P
 	return p, nil
 }
 
+// NewRootProfileFromCertificate returns a new root x509 Certificate profile
+// that re-issues the given root certificate with the same key pair, for
+// example, to extend the validity of a root before it expires. Certificates
+// issued by the old root also chain to the new one.
+//
+// The subject, public key, subject key identifier, key usages, basic
+// constraints and name constraints of the old root are preserved, and a new
+// serial number and validity are generated. By default the new root is valid
+// for DefaultRootCertValidity from now. The given private key must match the
+// public key of the old root.
+func NewRootProfileFromCertificate(old *x509.Certificate, rootPriv crypto.PrivateKey, withOps ...WithOption) (Profile, error) {
+	if old == nil {
+		return nil, errors.New("root certificate cannot be nil")
+	}
+	if err := validateIssuerKey(old, rootPriv); err != nil {
+		return nil, err
+	}
+
+	sub := &x509.Certificate{
+		// The raw subject is used so the new subject is byte-identical to the
+		// issuer of the certificates issued by the old root.
+		RawSubject:                  old.RawSubject,
+		Subject:                     old.Subject,
+		Issuer:                      old.Subject,
+		KeyUsage:                    old.KeyUsage,
+		ExtKeyUsage:                 old.ExtKeyUsage,
+		UnknownExtKeyUsage:          old.UnknownExtKeyUsage,
+		BasicConstraintsValid:       old.BasicConstraintsValid,
+		IsCA:                        old.IsCA,
+		MaxPathLen:                  old.MaxPathLen,
+		MaxPathLenZero:              old.MaxPathLenZero,
+		SubjectKeyId:                old.SubjectKeyId,
+		PermittedDNSDomainsCritical: old.PermittedDNSDomainsCritical,
+		PermittedDNSDomains:         old.PermittedDNSDomains,
+		ExcludedDNSDomains:          old.ExcludedDNSDomains,
+		PermittedIPRanges:           old.PermittedIPRanges,
+		ExcludedIPRanges:            old.ExcludedIPRanges,
+		PermittedEmailAddresses:     old.PermittedEmailAddresses,
+		ExcludedEmailAddresses:      old.ExcludedEmailAddresses,
+		PermittedURIDomains:         old.PermittedURIDomains,
+		ExcludedURIDomains:          old.ExcludedURIDomains,
+	}
+
+	withOps = append([]WithOption{WithPublicKey(old.PublicKey)}, withOps...)
+	p, err := newProfile(&Root{}, sub, sub, nil, withOps...)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	// self-signed certificate
+	p.SetSubjectPrivateKey(rootPriv)
+	p.SetIssuerPrivateKey(rootPriv)
+	return p, nil
+}
+
 func defaultRootTemplate(cn string) *x509.Certificate {
-	notBefore := time.Now()
 	return &x509.Certificate{
 		IsCA:                  true,
-		NotBefore:             notBefore,
-		NotAfter:              notBefore.Add(DefaultRootCertValidity),
 		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageCRLSign,
 		BasicConstraintsValid: true,
 		MaxPathLen:            1,
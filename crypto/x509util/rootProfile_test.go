@@ -0,0 +1,96 @@
+package x509util
+
+import (
+	"bytes"
+	"crypto/x509"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestNewRootProfile_extKeyUsage(t *testing.T) {
+	tests := []struct {
+		name    string
+		options []WithOption
+		want    []x509.ExtKeyUsage
+	}{
+		{"default", nil, nil},
+		{"with-ext-key-usage", []WithOption{WithExtKeyUsage(x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth)},
+			[]x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth}},
+		{"with-empty-ext-key-usage", []WithOption{WithExtKeyUsage()}, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			crt := mustCreateCertificate(t, mustNewProfile(t)(NewRootProfile("root", tt.options...)))
+			_, ok := findExtension(crt, oidExtExtendedKeyUsage)
+			if ok != (tt.want != nil) {
+				t.Errorf("extended key usage extension present = %v, want %v", ok, tt.want != nil)
+			}
+			if !reflect.DeepEqual(crt.ExtKeyUsage, tt.want) {
+				t.Errorf("ExtKeyUsage = %v, want %v", crt.ExtKeyUsage, tt.want)
+			}
+			if len(crt.UnknownExtKeyUsage) > 0 {
+				t.Errorf("UnknownExtKeyUsage = %v, want none", crt.UnknownExtKeyUsage)
+			}
+		})
+	}
+}
+
+func TestNewRootProfileFromCertificate(t *testing.T) {
+	oldRoot := mustNewProfile(t)(NewRootProfile("Smallstep Root", WithValidity(time.Hour), WithMaxPathLen(2)))
+	oldCert := mustCreateCertificate(t, oldRoot)
+	rootPriv := oldRoot.SubjectPrivateKey()
+
+	intermediate := mustNewProfile(t)(NewIntermediateProfile("Smallstep Intermediate", oldCert, rootPriv))
+	intCert := mustCreateCertificate(t, intermediate)
+
+	p := mustNewProfile(t)(NewRootProfileFromCertificate(oldCert, rootPriv))
+	newCert := mustCreateCertificate(t, p)
+
+	if !bytes.Equal(newCert.RawSubject, oldCert.RawSubject) || !bytes.Equal(newCert.RawIssuer, oldCert.RawSubject) {
+		t.Errorf("new root subject = %s, issuer = %s, want %s", newCert.Subject, newCert.Issuer, oldCert.Subject)
+	}
+	if !bytes.Equal(newCert.RawSubjectPublicKeyInfo, oldCert.RawSubjectPublicKeyInfo) {
+		t.Error("new root public key does not match the old one")
+	}
+	if !bytes.Equal(newCert.SubjectKeyId, oldCert.SubjectKeyId) {
+		t.Errorf("new root SubjectKeyId = %x, want %x", newCert.SubjectKeyId, oldCert.SubjectKeyId)
+	}
+	if newCert.KeyUsage != oldCert.KeyUsage || !newCert.IsCA || newCert.MaxPathLen != 2 {
+		t.Errorf("new root KeyUsage = %v, IsCA = %v, MaxPathLen = %d, want %v, true, 2", newCert.KeyUsage, newCert.IsCA, newCert.MaxPathLen, oldCert.KeyUsage)
+	}
+	if newCert.SerialNumber.Cmp(oldCert.SerialNumber) == 0 {
+		t.Error("new root has the same serial number as the old one")
+	}
+	if d := newCert.NotAfter.Sub(newCert.NotBefore); d != DefaultRootCertValidity {
+		t.Errorf("new root validity = %s, want %s", d, DefaultRootCertValidity)
+	}
+
+	// The existing intermediate chains to both roots.
+	for _, root := range []*x509.Certificate{oldCert, newCert} {
+		roots := x509.NewCertPool()
+		roots.AddCert(root)
+		if _, err := intCert.Verify(x509.VerifyOptions{Roots: roots}); err != nil {
+			t.Errorf("Verify() with root %s error = %v", root.SerialNumber, err)
+		}
+	}
+
+	t.Run("ok/options", func(t *testing.T) {
+		p := mustNewProfile(t)(NewRootProfileFromCertificate(oldCert, rootPriv, WithValidity(24*time.Hour)))
+		crt := mustCreateCertificate(t, p)
+		if d := crt.NotAfter.Sub(crt.NotBefore); d != 24*time.Hour {
+			t.Errorf("new root validity = %s, want %s", d, 24*time.Hour)
+		}
+	})
+	t.Run("fail/key-mismatch", func(t *testing.T) {
+		other := mustNewProfile(t)(NewRootProfile("Other Root"))
+		if _, err := NewRootProfileFromCertificate(oldCert, other.SubjectPrivateKey()); err == nil {
+			t.Error("NewRootProfileFromCertificate() error = nil, want error")
+		}
+	})
+	t.Run("fail/nil", func(t *testing.T) {
+		if _, err := NewRootProfileFromCertificate(nil, rootPriv); err == nil {
+			t.Error("NewRootProfileFromCertificate() error = nil, want error")
+		}
+	})
+}
@@ -0,0 +1,481 @@
+package x509util
+
+import (
+	"bytes"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"net"
+	"net/url"
+	"sort"
+
+	"github.com/pkg/errors"
+)
+
+// Tags of the GeneralName types that cannot be set using the fields of
+// x509.Certificate.
+const (
+	nameTypeOtherName     = 0
+	nameTypeDirectoryName = 4
+	nameTypeRegisteredID  = 8
+)
+
+var (
+	// OIDUserPrincipalName is the type of the otherName used for the
+	// Microsoft user principal name (UPN).
+	OIDUserPrincipalName = asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 311, 20, 2, 3}
+	// OIDPermanentIdentifier is the type of the permanentIdentifier
+	// otherName defined in RFC 4043.
+	OIDPermanentIdentifier = asn1.ObjectIdentifier{1, 3, 6, 1, 5, 5, 7, 8, 3}
+	// OIDHardwareModuleName is the type of the hardwareModuleName otherName
+	// defined in RFC 4108.
+	OIDHardwareModuleName = asn1.ObjectIdentifier{1, 3, 6, 1, 5, 5, 7, 8, 4}
+)
+
+// PermanentIdentifier is the permanentIdentifier otherName defined in RFC
+// 4043. It identifies an entity, like a device, across certificate renewals.
+type PermanentIdentifier struct {
+	Value    string                `asn1:"utf8,optional"`
+	Assigner asn1.ObjectIdentifier `asn1:"optional"`
+}
+
+// HardwareModuleName is the hardwareModuleName otherName defined in RFC 4108.
+// It identifies a hardware module by its type and serial number.
+type HardwareModuleName struct {
+	Type         asn1.ObjectIdentifier
+	SerialNumber []byte
+}
+
+// OtherName is an otherName general name as defined in RFC 5280, section
+// 4.2.1.6. Value contains the value without the explicit tag.
+type OtherName struct {
+	TypeID asn1.ObjectIdentifier
+	Value  asn1.RawValue
+}
+
+// otherName is the ASN.1 encoding of the otherName general name, without the
+// implicit tag.
+type otherName struct {
+	TypeID asn1.ObjectIdentifier
+	Value  asn1.RawValue `asn1:"tag:0,explicit"`
+}
+
+// WithOtherNameSAN returns a Profile modifier that adds an otherName general
+// name to the subject alternative name extension. The value is encoded using
+// asn1.Marshal, an asn1.RawValue can be used to set an already encoded value.
+func WithOtherNameSAN(oid asn1.ObjectIdentifier, value interface{}) WithOption {
+	return func(p Profile) error {
+		if len(oid) == 0 {
+			return errors.New("otherName type cannot be empty")
+		}
+		der, err := asn1.Marshal(value)
+		if err != nil {
+			return errors.Wrap(err, "error marshaling otherName value")
+		}
+		return addOtherName(p, oid, der)
+	}
+}
+
+// WithUPN returns a Profile modifier that adds a Microsoft user principal name
+// to the subject alternative name extension. The UPN is used by Windows to map
+// the certificate to an account, e.g. in smart card logon.
+func WithUPN(upn string) WithOption {
+	return func(p Profile) error {
+		if upn == "" {
+			return errors.New("user principal name cannot be empty")
+		}
+		der, err := asn1.MarshalWithParams(upn, "utf8")
+		if err != nil {
+			return errors.Wrap(err, "error marshaling user principal name")
+		}
+		return addOtherName(p, OIDUserPrincipalName, der)
+	}
+}
+
+// WithPermanentIdentifier returns a Profile modifier that adds a
+// permanentIdentifier to the subject alternative name extension. The assigner
+// is the object identifier, in dotted notation, of the organization that
+// assigned the value; it is omitted if empty.
+func WithPermanentIdentifier(value, assigner string) WithOption {
+	return func(p Profile) error {
+		pi := PermanentIdentifier{Value: value}
+		if assigner != "" {
+			oid, err := parseObjectIdentifier(assigner)
+			if err != nil {
+				return errors.Wrap(err, "error parsing permanent identifier assigner")
+			}
+			pi.Assigner = oid
+		}
+		if pi.Value == "" && len(pi.Assigner) == 0 {
+			return errors.New("permanent identifier cannot be empty")
+		}
+		der, err := asn1.Marshal(pi)
+		if err != nil {
+			return errors.Wrap(err, "error marshaling permanent identifier")
+		}
+		return addOtherName(p, OIDPermanentIdentifier, der)
+	}
+}
+
+// WithHardwareModuleName returns a Profile modifier that adds a
+// hardwareModuleName to the subject alternative name extension.
+func WithHardwareModuleName(hwType asn1.ObjectIdentifier, serial []byte) WithOption {
+	return func(p Profile) error {
+		if len(hwType) == 0 {
+			return errors.New("hardware module type cannot be empty")
+		}
+		if len(serial) == 0 {
+			return errors.New("hardware module serial number cannot be empty")
+		}
+		der, err := asn1.Marshal(HardwareModuleName{Type: hwType, SerialNumber: serial})
+		if err != nil {
+			return errors.Wrap(err, "error marshaling hardware module name")
+		}
+		return addOtherName(p, OIDHardwareModuleName, der)
+	}
+}
+
+// addOtherName adds an otherName general name with the given type and DER
+// encoded value.
+func addOtherName(p Profile, oid asn1.ObjectIdentifier, der []byte) error {
+	var value asn1.RawValue
+	if rest, err := asn1.Unmarshal(der, &value); err != nil || len(rest) > 0 {
+		return errors.New("error marshaling otherName value: invalid DER")
+	}
+	b, err := asn1.Marshal(otherName{
+		TypeID: oid,
+		Value:  asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 0, IsCompound: true, Bytes: der},
+	})
+	if err != nil {
+		return errors.Wrap(err, "error marshaling otherName")
+	}
+	// Replace the SEQUENCE tag with the implicit tag of the general name.
+	var seq asn1.RawValue
+	if _, err := asn1.Unmarshal(b, &seq); err != nil {
+		return errors.Wrap(err, "error marshaling otherName")
+	}
+	return addGeneralName(p, asn1.RawValue{
+		Class:      asn1.ClassContextSpecific,
+		Tag:        nameTypeOtherName,
+		IsCompound: true,
+		Bytes:      seq.Bytes,
+	})
+}
+
+// OtherNames returns the otherName general names in the subject alternative
+// name extension of the given certificate.
+func OtherNames(crt *x509.Certificate) ([]OtherName, error) {
+	var ret []OtherName
+	for _, ext := range crt.Extensions {
+		if !ext.Id.Equal(oidExtSubjectAltName) {
+			continue
+		}
+		var names []asn1.RawValue
+		if rest, err := asn1.Unmarshal(ext.Value, &names); err != nil || len(rest) > 0 {
+			return nil, errors.New("error parsing subject alternative names")
+		}
+		for _, gn := range names {
+			if gn.Class != asn1.ClassContextSpecific || gn.Tag != nameTypeOtherName {
+				continue
+			}
+			var on otherName
+			if rest, err := asn1.UnmarshalWithParams(gn.FullBytes, &on, "tag:0"); err != nil || len(rest) > 0 {
+				return nil, errors.New("error parsing otherName")
+			}
+			var value asn1.RawValue
+			if rest, err := asn1.Unmarshal(on.Value.Bytes, &value); err != nil || len(rest) > 0 {
+				return nil, errors.New("error parsing otherName value")
+			}
+			ret = append(ret, OtherName{TypeID: on.TypeID, Value: value})
+		}
+	}
+	return ret, nil
+}
+
+// UPNs returns the Microsoft user principal names in the subject alternative
+// name extension of the given certificate.
+func UPNs(crt *x509.Certificate) ([]string, error) {
+	names, err := OtherNames(crt)
+	if err != nil {
+		return nil, err
+	}
+	var ret []string
+	for _, on := range names {
+		if !on.TypeID.Equal(OIDUserPrincipalName) {
+			continue
+		}
+		var upn string
+		if rest, err := asn1.UnmarshalWithParams(on.Value.FullBytes, &upn, "utf8"); err != nil || len(rest) > 0 {
+			return nil, errors.New("error parsing user principal name")
+		}
+		ret = append(ret, upn)
+	}
+	return ret, nil
+}
+
+// WithDirectoryNameSAN returns a Profile modifier that adds a directoryName
+// general name to the subject alternative name extension.
+func WithDirectoryNameSAN(name pkix.Name) WithOption {
+	return func(p Profile) error {
+		rdns := name.ToRDNSequence()
+		if len(rdns) == 0 {
+			return errors.New("directory name cannot be empty")
+		}
+		der, err := asn1.Marshal(rdns)
+		if err != nil {
+			return errors.Wrap(err, "error marshaling directory name")
+		}
+		return addGeneralName(p, asn1.RawValue{
+			Class:      asn1.ClassContextSpecific,
+			Tag:        nameTypeDirectoryName,
+			IsCompound: true,
+			Bytes:      der,
+		})
+	}
+}
+
+// WithRegisteredIDSAN returns a Profile modifier that adds a registeredID
+// general name to the subject alternative name extension.
+func WithRegisteredIDSAN(oid asn1.ObjectIdentifier) WithOption {
+	return func(p Profile) error {
+		if len(oid) == 0 {
+			return errors.New("registered ID cannot be empty")
+		}
+		der, err := asn1.Marshal(oid)
+		if err != nil {
+			return errors.Wrap(err, "error marshaling registered ID")
+		}
+		var raw asn1.RawValue
+		if _, err := asn1.Unmarshal(der, &raw); err != nil {
+			return errors.Wrap(err, "error marshaling registered ID")
+		}
+		return addGeneralName(p, asn1.RawValue{
+			Class: asn1.ClassContextSpecific,
+			Tag:   nameTypeRegisteredID,
+			Bytes: raw.Bytes,
+		})
+	}
+}
+
+// WithNoSAN returns a Profile modifier that removes the subject alternative
+// name extension from the subject x509 Certificate. The names in the template
+// of the profile, like the ones copied from a CSR, are removed, and creating
+// the profile fails if it is combined with a modifier that adds subject
+// alternative names, like WithSANs or WithDirectoryNameSAN.
+func WithNoSAN() WithOption {
+	return func(p Profile) error {
+		b, err := getBase(p)
+		if err != nil {
+			return err
+		}
+		b.noSAN = true
+		return nil
+	}
+}
+
+// sanSnapshot is a copy of the subject alternative names of a template, it
+// is used to detect the names added by the profile modifiers.
+type sanSnapshot struct {
+	dnsNames       []string
+	emailAddresses []string
+	ipAddresses    []net.IP
+	uris           []*url.URL
+	generalNames   []asn1.RawValue
+}
+
+func newSANSnapshot(crt *x509.Certificate, generalNames []asn1.RawValue) sanSnapshot {
+	return sanSnapshot{
+		dnsNames:       append([]string(nil), crt.DNSNames...),
+		emailAddresses: append([]string(nil), crt.EmailAddresses...),
+		ipAddresses:    append([]net.IP(nil), crt.IPAddresses...),
+		uris:           append([]*url.URL(nil), crt.URIs...),
+		generalNames:   append([]asn1.RawValue(nil), generalNames...),
+	}
+}
+
+// contains returns true if all the names in o are also in s.
+func (s sanSnapshot) contains(o sanSnapshot) bool {
+	return len(removeStrings(o.dnsNames, s.dnsNames)) == 0 &&
+		len(removeStrings(o.emailAddresses, s.emailAddresses)) == 0 &&
+		len(removeIPs(o.ipAddresses, s.ipAddresses)) == 0 &&
+		len(removeURLs(o.uris, s.uris)) == 0 &&
+		len(o.generalNames) <= len(s.generalNames)
+}
+
+// WithPreserveSANOrder returns a Profile modifier that encodes the subject
+// alternative names in the order they were added by the profile modifiers,
+// e.g. a DNS name added after an IP address is encoded after it. By default
+// the x509 package groups the names by type: DNS names, email addresses, IP
+// addresses and URIs, followed by the other general names. The order within
+// each type is always preserved.
+//
+// The names in the template come first, and the names added directly to the
+// subject after the profile is created go last. Exact repeats of a name are
+// removed.
+func WithPreserveSANOrder() WithOption {
+	return func(p Profile) error {
+		b, err := getBase(p)
+		if err != nil {
+			return err
+		}
+		b.preserveSANOrder = true
+		return nil
+	}
+}
+
+// recordSANOrder appends to the SAN order of the profile the names in the
+// given template that have not been recorded yet.
+func (b *base) recordSANOrder(crt *x509.Certificate) {
+	rawValues, err := sanRawValues(crt)
+	if err != nil {
+		// The error is returned when the certificate is signed.
+		return
+	}
+	for _, gn := range append(rawValues, b.generalNames...) {
+		if indexGeneralName(b.sanOrder, gn) < 0 {
+			b.sanOrder = append(b.sanOrder, gn)
+		}
+	}
+}
+
+// indexGeneralName returns the index of the given general name, or -1 if it
+// is not present.
+func indexGeneralName(names []asn1.RawValue, gn asn1.RawValue) int {
+	for i, n := range names {
+		if n.Class == gn.Class && n.Tag == gn.Tag && n.IsCompound == gn.IsCompound && bytes.Equal(n.Bytes, gn.Bytes) {
+			return i
+		}
+	}
+	return -1
+}
+
+// renameSANOrder replaces a name in the SAN order of the profile, e.g. when
+// the name is normalized.
+func (b *base) renameSANOrder(tag int, old, name string) {
+	i := indexGeneralName(b.sanOrder, asn1.RawValue{Tag: tag, Class: asn1.ClassContextSpecific, Bytes: []byte(old)})
+	if i >= 0 {
+		b.sanOrder[i] = asn1.RawValue{Tag: tag, Class: asn1.ClassContextSpecific, Bytes: []byte(name)}
+	}
+}
+
+// orderGeneralNames removes the exact repeats in the given general names and
+// sorts them using the SAN order of the profile.
+func (b *base) orderGeneralNames(names []asn1.RawValue) []asn1.RawValue {
+	var unique []asn1.RawValue
+	for _, gn := range names {
+		if indexGeneralName(unique, gn) < 0 {
+			unique = append(unique, gn)
+		}
+	}
+	index := func(gn asn1.RawValue) int {
+		if i := indexGeneralName(b.sanOrder, gn); i >= 0 {
+			return i
+		}
+		return len(b.sanOrder)
+	}
+	sort.SliceStable(unique, func(i, j int) bool {
+		return index(unique[i]) < index(unique[j])
+	})
+	return unique
+}
+
+// addGeneralName adds a general name to the list of subject alternative names
+// that are encoded by the profile.
+func addGeneralName(p Profile, gn asn1.RawValue) error {
+	b, err := getBase(p)
+	if err != nil {
+		return err
+	}
+	b.generalNames = append(b.generalNames, gn)
+	return nil
+}
+
+// applyGeneralNames replaces the subject alternative name extension generated
+// by the x509 package with one that contains the names in the template and
+// the general names added to the profile.
+func (b *base) applyGeneralNames(tpl *x509.Certificate) error {
+	if len(b.generalNames) == 0 && !b.preserveSANOrder {
+		return nil
+	}
+	rawValues, err := sanRawValues(tpl)
+	if err != nil {
+		return err
+	}
+	names := append(rawValues, b.generalNames...)
+	if b.preserveSANOrder {
+		if len(names) == 0 {
+			return nil
+		}
+		names = b.orderGeneralNames(names)
+	}
+	value, err := asn1.Marshal(names)
+	if err != nil {
+		return errors.Wrap(err, "error marshaling subject alternative names")
+	}
+	// RFC 5280, section 4.2.1.6, the extension is critical if the subject is
+	// empty.
+	ext := pkix.Extension{
+		Id:       oidExtSubjectAltName,
+		Critical: isEmptySubject(tpl),
+		Value:    value,
+	}
+	exts := removeExtension(tpl.ExtraExtensions, oidExtSubjectAltName)
+	tpl.ExtraExtensions = append(exts, ext)
+	return nil
+}
+
+// sanRawValues returns the general names of the subject alternative names in
+// the given template.
+func sanRawValues(tpl *x509.Certificate) ([]asn1.RawValue, error) {
+	der, err := marshalSANs(tpl.DNSNames, tpl.EmailAddresses, tpl.IPAddresses, tpl.URIs)
+	if err != nil {
+		return nil, errors.Wrap(err, "error marshaling subject alternative names")
+	}
+	var rawValues []asn1.RawValue
+	if _, err := asn1.Unmarshal(der, &rawValues); err != nil {
+		return nil, errors.Wrap(err, "error marshaling subject alternative names")
+	}
+	return rawValues, nil
+}
+
+// PermanentIdentifiers returns the permanent identifiers in the subject
+// alternative name extension of the given certificate.
+func PermanentIdentifiers(crt *x509.Certificate) ([]PermanentIdentifier, error) {
+	names, err := OtherNames(crt)
+	if err != nil {
+		return nil, err
+	}
+	var ret []PermanentIdentifier
+	for _, on := range names {
+		if !on.TypeID.Equal(OIDPermanentIdentifier) {
+			continue
+		}
+		var pi PermanentIdentifier
+		if rest, err := asn1.Unmarshal(on.Value.FullBytes, &pi); err != nil || len(rest) > 0 {
+			return nil, errors.New("error parsing permanent identifier")
+		}
+		ret = append(ret, pi)
+	}
+	return ret, nil
+}
+
+// HardwareModuleNames returns the hardware module names in the subject
+// alternative name extension of the given certificate.
+func HardwareModuleNames(crt *x509.Certificate) ([]HardwareModuleName, error) {
+	names, err := OtherNames(crt)
+	if err != nil {
+		return nil, err
+	}
+	var ret []HardwareModuleName
+	for _, on := range names {
+		if !on.TypeID.Equal(OIDHardwareModuleName) {
+			continue
+		}
+		var hmn HardwareModuleName
+		if rest, err := asn1.Unmarshal(on.Value.FullBytes, &hmn); err != nil || len(rest) > 0 {
+			return nil, errors.New("error parsing hardware module name")
+		}
+		ret = append(ret, hmn)
+	}
+	return ret, nil
+}
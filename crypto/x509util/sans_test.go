@@ -0,0 +1,430 @@
+package x509util
+
+import (
+	"bytes"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"fmt"
+	"net"
+	"net/url"
+	"reflect"
+	"testing"
+)
+
+func TestWithDirectoryNameSAN(t *testing.T) {
+	iss := mustParseCertificate(t, "test_files/noPasscodeCa.crt")
+	issPriv := mustParseRSAKey(t, "test_files/noPasscodeCa.key")
+	dirName := pkix.Name{CommonName: "Device 1234", Organization: []string{"Smallstep"}}
+	regID := asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 37476, 9000, 64, 1}
+
+	tests := []struct {
+		name         string
+		cn           string
+		options      []WithOption
+		wantDNS      []string
+		wantCritical bool
+	}{
+		{"ok with standard SANs", "leaf", []WithOption{WithHosts("leaf.smallstep.com,127.0.0.1"), WithDirectoryNameSAN(dirName), WithRegisteredIDSAN(regID)},
+			[]string{"leaf.smallstep.com"}, false},
+		{"ok only general names", "leaf", []WithOption{WithDirectoryNameSAN(dirName), WithRegisteredIDSAN(regID)}, nil, false},
+		{"ok empty subject", "", []WithOption{WithDirectoryNameSAN(dirName), WithRegisteredIDSAN(regID)}, nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			crt := mustCreateCertificate(t, mustNewProfile(t)(NewLeafProfile(tt.cn, iss, issPriv, tt.options...)))
+			if !reflect.DeepEqual(crt.DNSNames, tt.wantDNS) {
+				t.Errorf("DNSNames = %v, want %v", crt.DNSNames, tt.wantDNS)
+			}
+			if len(tt.wantDNS) > 0 && len(crt.IPAddresses) != 1 {
+				t.Errorf("IPAddresses = %v, want [127.0.0.1]", crt.IPAddresses)
+			}
+
+			var n int
+			for _, ext := range crt.Extensions {
+				if ext.Id.Equal(oidExtSubjectAltName) {
+					n++
+				}
+			}
+			if n != 1 {
+				t.Fatalf("certificate has %d SAN extensions, want 1", n)
+			}
+			ext, _ := findExtension(crt, oidExtSubjectAltName)
+			if ext.Critical != tt.wantCritical {
+				t.Errorf("SAN extension critical = %v, want %v", ext.Critical, tt.wantCritical)
+			}
+
+			var names []asn1.RawValue
+			if _, err := asn1.Unmarshal(ext.Value, &names); err != nil {
+				t.Fatal(err)
+			}
+			var gotDirName, gotRegID bool
+			for _, gn := range names {
+				switch gn.Tag {
+				case nameTypeDirectoryName:
+					var rdns pkix.RDNSequence
+					if _, err := asn1.Unmarshal(gn.Bytes, &rdns); err != nil {
+						t.Fatal(err)
+					}
+					var name pkix.Name
+					name.FillFromRDNSequence(&rdns)
+					gotDirName = name.CommonName == dirName.CommonName && reflect.DeepEqual(name.Organization, dirName.Organization)
+				case nameTypeRegisteredID:
+					var oid asn1.ObjectIdentifier
+					full := append([]byte{asn1.TagOID, byte(len(gn.Bytes))}, gn.Bytes...)
+					if _, err := asn1.Unmarshal(full, &oid); err != nil {
+						t.Fatal(err)
+					}
+					gotRegID = oid.Equal(regID)
+				}
+			}
+			if !gotDirName {
+				t.Error("SAN extension does not have the directoryName")
+			}
+			if !gotRegID {
+				t.Error("SAN extension does not have the registeredID")
+			}
+		})
+	}
+
+	t.Run("fail empty", func(t *testing.T) {
+		if _, err := NewLeafProfile("leaf", iss, issPriv, WithDirectoryNameSAN(pkix.Name{})); err == nil {
+			t.Error("NewLeafProfile() error = nil, want error")
+		}
+		if _, err := NewLeafProfile("leaf", iss, issPriv, WithRegisteredIDSAN(nil)); err == nil {
+			t.Error("NewLeafProfile() error = nil, want error")
+		}
+	})
+}
+
+func TestWithUPN(t *testing.T) {
+	iss := mustParseCertificate(t, "test_files/noPasscodeCa.crt")
+	issPriv := mustParseRSAKey(t, "test_files/noPasscodeCa.key")
+
+	// upn.der was created with OpenSSL using:
+	//   subjectAltName=DNS:test.smallstep.com,otherName:1.3.6.1.4.1.311.20.2.3;UTF8:jane@smallstep.com
+	fixture, err := x509.ParseCertificate(mustReadFile(t, "test_files/upn.der"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	upns, err := UPNs(fixture)
+	if err != nil {
+		t.Fatalf("UPNs() error = %v", err)
+	}
+	if !reflect.DeepEqual(upns, []string{"jane@smallstep.com"}) {
+		t.Errorf("UPNs() = %v, want [jane@smallstep.com]", upns)
+	}
+	want, _ := findExtension(fixture, oidExtSubjectAltName)
+
+	crt := mustCreateCertificate(t, mustNewProfile(t)(NewLeafProfile("jane", iss, issPriv,
+		WithDNSNames([]string{"test.smallstep.com"}), WithUPN("jane@smallstep.com"))))
+	var n int
+	for _, ext := range crt.Extensions {
+		if ext.Id.Equal(oidExtSubjectAltName) {
+			n++
+		}
+	}
+	if n != 1 {
+		t.Fatalf("certificate has %d SAN extensions, want 1", n)
+	}
+	got, _ := findExtension(crt, oidExtSubjectAltName)
+	if !bytes.Equal(got.Value, want.Value) {
+		t.Errorf("SAN extension = %x, want %x", got.Value, want.Value)
+	}
+	if !reflect.DeepEqual(crt.DNSNames, []string{"test.smallstep.com"}) {
+		t.Errorf("DNSNames = %v, want [test.smallstep.com]", crt.DNSNames)
+	}
+	if upns, err := UPNs(crt); err != nil || !reflect.DeepEqual(upns, []string{"jane@smallstep.com"}) {
+		t.Errorf("UPNs() = %v, %v, want [jane@smallstep.com]", upns, err)
+	}
+
+	t.Run("fail/empty", func(t *testing.T) {
+		if _, err := NewLeafProfile("jane", iss, issPriv, WithUPN("")); err == nil {
+			t.Error("NewLeafProfile() error = nil, want error")
+		}
+	})
+}
+
+func TestWithOtherNameSAN(t *testing.T) {
+	iss := mustParseCertificate(t, "test_files/noPasscodeCa.crt")
+	issPriv := mustParseRSAKey(t, "test_files/noPasscodeCa.key")
+	oid := asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 37476, 9000, 64, 3}
+
+	crt := mustCreateCertificate(t, mustNewProfile(t)(NewLeafProfile("leaf", iss, issPriv,
+		WithOtherNameSAN(oid, 42), WithUPN("leaf@smallstep.com"))))
+	names, err := OtherNames(crt)
+	if err != nil {
+		t.Fatalf("OtherNames() error = %v", err)
+	}
+	if len(names) != 2 {
+		t.Fatalf("OtherNames() = %v, want 2 names", names)
+	}
+	var v int
+	if _, err := asn1.Unmarshal(names[0].Value.FullBytes, &v); err != nil || !names[0].TypeID.Equal(oid) || v != 42 {
+		t.Errorf("OtherNames()[0] = %v, want %s with 42", names[0], oid)
+	}
+	if !names[1].TypeID.Equal(OIDUserPrincipalName) {
+		t.Errorf("OtherNames()[1].TypeID = %s, want %s", names[1].TypeID, OIDUserPrincipalName)
+	}
+
+	t.Run("fail/empty-oid", func(t *testing.T) {
+		if _, err := NewLeafProfile("leaf", iss, issPriv, WithOtherNameSAN(nil, 42)); err == nil {
+			t.Error("NewLeafProfile() error = nil, want error")
+		}
+	})
+	t.Run("fail/invalid-value", func(t *testing.T) {
+		if _, err := NewLeafProfile("leaf", iss, issPriv, WithOtherNameSAN(oid, asn1.RawValue{FullBytes: []byte{0x04}})); err == nil {
+			t.Error("NewLeafProfile() error = nil, want error")
+		}
+	})
+}
+
+func TestWithPermanentIdentifier(t *testing.T) {
+	iss := mustParseCertificate(t, "test_files/noPasscodeCa.crt")
+	issPriv := mustParseRSAKey(t, "test_files/noPasscodeCa.key")
+	assigner := asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 37476, 9000, 64, 1}
+	hwType := asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 37476, 9000, 64, 2}
+	serial := []byte{0x01, 0x02, 0x03, 0x04, 0x05, 0x06, 0x07, 0x08, 0x09, 0x0a, 0x0b, 0x0c, 0x0d, 0x0e, 0x0f, 0x10}
+	longSerial := bytes.Repeat([]byte{0xab}, 300)
+
+	// device.der was created with OpenSSL using:
+	//   subjectAltName = DNS:device.smallstep.com,otherName:1.3.6.1.5.5.7.8.3;SEQUENCE:pi,otherName:1.3.6.1.5.5.7.8.4;SEQUENCE:hmn
+	//   [pi]
+	//   value = UTF8:SN-1234
+	//   assigner = OID:1.3.6.1.4.1.37476.9000.64.1
+	//   [hmn]
+	//   type = OID:1.3.6.1.4.1.37476.9000.64.2
+	//   serial = FORMAT:HEX,OCT:0102030405060708090a0b0c0d0e0f10
+	fixture, err := x509.ParseCertificate(mustReadFile(t, "test_files/device.der"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want, _ := findExtension(fixture, oidExtSubjectAltName)
+
+	t.Run("ok/fixture", func(t *testing.T) {
+		crt := mustCreateCertificate(t, mustNewProfile(t)(NewLeafProfile("device", iss, issPriv,
+			WithDNSNames([]string{"device.smallstep.com"}),
+			WithPermanentIdentifier("SN-1234", assigner.String()),
+			WithHardwareModuleName(hwType, serial))))
+		got, _ := findExtension(crt, oidExtSubjectAltName)
+		if !bytes.Equal(got.Value, want.Value) {
+			t.Errorf("SAN extension = %x, want %x", got.Value, want.Value)
+		}
+		if !reflect.DeepEqual(crt.DNSNames, []string{"device.smallstep.com"}) {
+			t.Errorf("DNSNames = %v, want [device.smallstep.com]", crt.DNSNames)
+		}
+	})
+
+	tests := []struct {
+		name     string
+		options  []WithOption
+		wantPIs  []PermanentIdentifier
+		wantHMNs []HardwareModuleName
+	}{
+		{"ok/parse-fixture", nil, []PermanentIdentifier{{Value: "SN-1234", Assigner: assigner}}, []HardwareModuleName{{Type: hwType, SerialNumber: serial}}},
+		{"ok/no-assigner", []WithOption{WithPermanentIdentifier("SN-1234", "")}, []PermanentIdentifier{{Value: "SN-1234"}}, nil},
+		{"ok/only-assigner", []WithOption{WithPermanentIdentifier("", assigner.String())}, []PermanentIdentifier{{Assigner: assigner}}, nil},
+		{"ok/long-serial", []WithOption{WithHardwareModuleName(hwType, longSerial)}, nil, []HardwareModuleName{{Type: hwType, SerialNumber: longSerial}}},
+		{"ok/with-dns", []WithOption{WithHosts("device.smallstep.com"), WithPermanentIdentifier("SN-1234", ""), WithHardwareModuleName(hwType, serial)},
+			[]PermanentIdentifier{{Value: "SN-1234"}}, []HardwareModuleName{{Type: hwType, SerialNumber: serial}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			crt := fixture
+			if tt.options != nil {
+				crt = mustCreateCertificate(t, mustNewProfile(t)(NewLeafProfile("device", iss, issPriv, tt.options...)))
+			}
+			pis, err := PermanentIdentifiers(crt)
+			if err != nil {
+				t.Fatalf("PermanentIdentifiers() error = %v", err)
+			}
+			if !reflect.DeepEqual(pis, tt.wantPIs) {
+				t.Errorf("PermanentIdentifiers() = %v, want %v", pis, tt.wantPIs)
+			}
+			hmns, err := HardwareModuleNames(crt)
+			if err != nil {
+				t.Fatalf("HardwareModuleNames() error = %v", err)
+			}
+			if !reflect.DeepEqual(hmns, tt.wantHMNs) {
+				t.Errorf("HardwareModuleNames() = %v, want %v", hmns, tt.wantHMNs)
+			}
+		})
+	}
+
+	failTests := []struct {
+		name   string
+		option WithOption
+	}{
+		{"fail/empty-permanent-identifier", WithPermanentIdentifier("", "")},
+		{"fail/bad-assigner", WithPermanentIdentifier("SN-1234", "not-an-oid")},
+		{"fail/empty-hw-type", WithHardwareModuleName(nil, serial)},
+		{"fail/empty-serial", WithHardwareModuleName(hwType, nil)},
+	}
+	for _, tt := range failTests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := NewLeafProfile("device", iss, issPriv, tt.option); err == nil {
+				t.Error("NewLeafProfile() error = nil, want error")
+			}
+		})
+	}
+}
+
+func TestWithNoSAN(t *testing.T) {
+	iss := mustParseCertificate(t, "test_files/noPasscodeCa.crt")
+	issPriv := mustParseRSAKey(t, "test_files/noPasscodeCa.key")
+	csr := mustLoadCSR(t, "test_files/test.smallstep.com.csr")
+
+	tests := []struct {
+		name    string
+		profile func() (Profile, error)
+		wantErr bool
+	}{
+		{"ok/leaf", func() (Profile, error) {
+			return NewLeafProfile("test.smallstep.com", iss, issPriv, WithNoSAN())
+		}, false},
+		{"ok/intermediate", func() (Profile, error) {
+			return NewIntermediateProfile("intermediate", iss, issPriv, WithNoSAN(), WithSkipPathLenCheck())
+		}, false},
+		{"ok/csr", func() (Profile, error) {
+			return NewLeafProfileWithCSR(csr, iss, issPriv, WithNoSAN())
+		}, false},
+		{"ok/csr-policy", func() (Profile, error) {
+			return NewLeafProfileWithCSR(csr, iss, issPriv, WithNoSAN(), WithCSRExtensionPolicy(CSRExtensionsNone))
+		}, false},
+		{"ok/template", func() (Profile, error) {
+			return NewLeafProfileWithTemplate(&x509.Certificate{
+				Subject:  pkix.Name{CommonName: "test.smallstep.com"},
+				DNSNames: []string{"test.smallstep.com"},
+			}, iss, issPriv, WithNoSAN(), WithPublicKey(mustParseCertificate(t, "test_files/ca.crt").PublicKey))
+		}, false},
+		{"fail/sans-after", func() (Profile, error) {
+			return NewLeafProfile("test.smallstep.com", iss, issPriv, WithNoSAN(), WithSANs([]string{"test.smallstep.com"}))
+		}, true},
+		{"fail/sans-before", func() (Profile, error) {
+			return NewLeafProfile("test.smallstep.com", iss, issPriv, WithHosts("127.0.0.1"), WithNoSAN())
+		}, true},
+		{"fail/general-name", func() (Profile, error) {
+			return NewLeafProfile("test.smallstep.com", iss, issPriv, WithNoSAN(), WithUPN("test@smallstep.com"))
+		}, true},
+		{"fail/common-name", func() (Profile, error) {
+			return NewLeafProfile("test.smallstep.com", iss, issPriv, WithNoSAN(), WithCommonNameInSAN())
+		}, true},
+		{"fail/csr-sans", func() (Profile, error) {
+			return NewLeafProfileWithCSR(csr, iss, issPriv, WithNoSAN(), WithEmailAddresses("test@smallstep.com"))
+		}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, err := tt.profile()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			crt := mustCreateCertificate(t, p)
+			if _, ok := findExtension(crt, oidExtSubjectAltName); ok {
+				t.Error("certificate has a subject alternative name extension")
+			}
+		})
+	}
+}
+
+// sanNames returns the general names in the subject alternative name extension
+// of the given certificate as "tag:value" strings.
+func sanNames(t *testing.T, crt *x509.Certificate) []string {
+	t.Helper()
+	ext, ok := findExtension(crt, oidExtSubjectAltName)
+	if !ok {
+		t.Fatal("certificate does not have a subject alternative name extension")
+	}
+	var names []asn1.RawValue
+	if rest, err := asn1.Unmarshal(ext.Value, &names); err != nil || len(rest) > 0 {
+		t.Fatalf("error parsing subject alternative names: %v", err)
+	}
+	var ret []string
+	for _, gn := range names {
+		switch gn.Tag {
+		case nameTypeIP:
+			ret = append(ret, fmt.Sprintf("%d:%s", gn.Tag, net.IP(gn.Bytes)))
+		case nameTypeOtherName:
+			ret = append(ret, fmt.Sprintf("%d:%x", gn.Tag, gn.Bytes))
+		default:
+			ret = append(ret, fmt.Sprintf("%d:%s", gn.Tag, gn.Bytes))
+		}
+	}
+	return ret
+}
+
+func TestWithPreserveSANOrder(t *testing.T) {
+	iss := mustParseCertificate(t, "test_files/noPasscodeCa.crt")
+	issPriv := mustParseRSAKey(t, "test_files/noPasscodeCa.key")
+	upn, err := asn1.MarshalWithParams("jane@smallstep.com", "utf8")
+	if err != nil {
+		t.Fatal(err)
+	}
+	upnName, err := asn1.Marshal(otherName{
+		TypeID: OIDUserPrincipalName,
+		Value:  asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 0, IsCompound: true, Bytes: upn},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var upnSeq asn1.RawValue
+	if _, err := asn1.Unmarshal(upnName, &upnSeq); err != nil {
+		t.Fatal(err)
+	}
+	upnString := fmt.Sprintf("0:%x", upnSeq.Bytes)
+
+	tests := []struct {
+		name    string
+		options []WithOption
+		want    []string
+	}{
+		{"default", []WithOption{
+			WithIPAddresses([]net.IP{net.ParseIP("10.0.0.1")}),
+			WithHosts("b.smallstep.com"),
+			WithEmailAddresses("jane@smallstep.com"),
+		}, []string{"2:b.smallstep.com", "1:jane@smallstep.com", "7:10.0.0.1"}},
+		{"preserve", []WithOption{
+			WithPreserveSANOrder(),
+			WithIPAddresses([]net.IP{net.ParseIP("10.0.0.1")}),
+			WithHosts("b.smallstep.com"),
+			WithEmailAddresses("jane@smallstep.com"),
+			WithUPN("jane@smallstep.com"),
+			WithHosts("a.smallstep.com,10.0.0.2"),
+			WithURIs([]*url.URL{{Scheme: "https", Host: "smallstep.com"}}),
+		}, []string{"7:10.0.0.1", "2:b.smallstep.com", "1:jane@smallstep.com", upnString, "2:a.smallstep.com", "7:10.0.0.2", "6:https://smallstep.com"}},
+		{"preserve last", []WithOption{
+			WithURIs([]*url.URL{{Scheme: "https", Host: "smallstep.com"}}),
+			WithHosts("b.smallstep.com"),
+			WithPreserveSANOrder(),
+		}, []string{"6:https://smallstep.com", "2:b.smallstep.com"}},
+		{"preserve repeats", []WithOption{
+			WithPreserveSANOrder(),
+			WithEmailAddresses("jane@smallstep.com"),
+			WithDNSNames([]string{"a.smallstep.com", "a.smallstep.com", "A.smallstep.com"}),
+		}, []string{"1:jane@smallstep.com", "2:a.smallstep.com", "2:A.smallstep.com"}},
+		{"preserve replaced", []WithOption{
+			WithPreserveSANOrder(),
+			WithSANs([]string{"10.0.0.1", "b.smallstep.com"}),
+			WithSANs([]string{"jane@smallstep.com", "b.smallstep.com"}),
+		}, []string{"2:b.smallstep.com", "1:jane@smallstep.com"}},
+		{"preserve template func", []WithOption{
+			WithPreserveSANOrder(),
+			WithTemplateFunc(func(crt *x509.Certificate) error {
+				crt.DNSNames = append(crt.DNSNames, "c.smallstep.com")
+				return nil
+			}),
+			WithIPAddresses([]net.IP{net.ParseIP("10.0.0.1")}),
+		}, []string{"7:10.0.0.1", "2:c.smallstep.com"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := mustNewProfile(t)(NewLeafProfile("test.smallstep.com", iss, issPriv, tt.options...))
+			if got := sanNames(t, mustCreateCertificate(t, p)); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("SANs = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
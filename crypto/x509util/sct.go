@@ -0,0 +1,213 @@
+package x509util
+
+import (
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/binary"
+
+	"github.com/pkg/errors"
+)
+
+// oidExtensionSCTList is the OID for the embedded signed certificate
+// timestamp list extension defined in RFC 6962.
+var oidExtensionSCTList = asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 11129, 2, 4, 2}
+
+// WithEmbeddedSCTs returns a Profile modifier that adds the given signed
+// certificate timestamps to the SCT list extension defined in RFC 6962. Each
+// SCT must be a TLS encoded SignedCertificateTimestamp structure.
+func WithEmbeddedSCTs(scts [][]byte) WithOption {
+	return func(p Profile) error {
+		ext, err := newSCTListExtension(scts)
+		if err != nil {
+			return err
+		}
+		crt := p.Subject()
+		crt.ExtraExtensions = append(removeExtension(crt.ExtraExtensions, oidExtensionSCTList), ext)
+		return nil
+	}
+}
+
+// WithSCTProvider returns a Profile modifier that sets the function used by
+// CreateCertificateWithCT to get the signed certificate timestamps of a
+// precertificate, usually by submitting it to one or more CT logs. The
+// function gets the DER encoded precertificate, and must return a list of TLS
+// encoded SignedCertificateTimestamp structures. It can only be used in leaf
+// profiles.
+func WithSCTProvider(fn func(precertDER []byte) ([][]byte, error)) WithOption {
+	return func(p Profile) error {
+		if fn == nil {
+			return errors.New("SCT provider cannot be nil")
+		}
+		if _, ok := p.(*Leaf); !ok {
+			return newError(ErrLeafOnly, "the SCT provider can only be used in leaf profiles")
+		}
+		b, err := getBase(p)
+		if err != nil {
+			return err
+		}
+		b.sctProvider = fn
+		return nil
+	}
+}
+
+// CreateCertificateWithCT creates a precertificate, gets its SCTs using the
+// provider set with WithSCTProvider, and creates the final certificate with
+// the SCT list extension. It returns the DER encoded precertificate and
+// certificate.
+//
+// Both certificates are created from the same template, so they have the same
+// serial number, validity and extensions, except for the CT poison extension
+// in the precertificate and the SCT list extension in the certificate. If the
+// provider fails, the certificate is not created.
+func (b *base) CreateCertificateWithCT() ([]byte, []byte, error) {
+	if b.sctProvider == nil {
+		return nil, nil, errors.New("profile does not have an SCT provider, use WithSCTProvider")
+	}
+
+	pre, err := b.template()
+	if err != nil {
+		return nil, nil, err
+	}
+	pre.ExtraExtensions = append(removeCTExtensions(pre.ExtraExtensions), newCTPoisonExtension())
+	precert, err := b.sign(pre)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	scts, err := b.sctProvider(append([]byte(nil), precert...))
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "error getting the SCTs of the precertificate")
+	}
+	ext, err := newSCTListExtension(scts)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	tpl, err := b.template()
+	if err != nil {
+		return nil, nil, err
+	}
+	tpl.ExtraExtensions = append(removeCTExtensions(tpl.ExtraExtensions), ext)
+	der, err := b.sign(tpl)
+	if err != nil {
+		return nil, nil, err
+	}
+	crt, err := x509.ParseCertificate(der)
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "error parsing certificate")
+	}
+	b.crt = crt
+	return precert, der, nil
+}
+
+// removeCTExtensions returns a copy of the list of extensions without the CT
+// poison and the SCT list extensions.
+func removeCTExtensions(exts []pkix.Extension) []pkix.Extension {
+	return removeExtension(removeExtension(exts, oidExtensionCTPoison), oidExtensionSCTList)
+}
+
+// newSCTListExtension returns the SCT list extension with the given SCTs.
+func newSCTListExtension(scts [][]byte) (pkix.Extension, error) {
+	if len(scts) == 0 {
+		return pkix.Extension{}, errors.New("SCT list cannot be empty")
+	}
+
+	var list []byte
+	for i, sct := range scts {
+		if err := validateSCT(sct); err != nil {
+			return pkix.Extension{}, errors.Wrapf(err, "SCT %d is not valid", i)
+		}
+		list = appendUint16Prefixed(list, sct)
+	}
+	if len(list) > 0xffff {
+		return pkix.Extension{}, errors.New("SCT list is too long")
+	}
+
+	value, err := asn1.Marshal(appendUint16Prefixed(nil, list))
+	if err != nil {
+		return pkix.Extension{}, errors.Wrap(err, "error marshaling SCT list")
+	}
+	return pkix.Extension{
+		Id:    oidExtensionSCTList,
+		Value: value,
+	}, nil
+}
+
+// parseSCTList returns the SCTs in the value of the SCT list extension.
+func parseSCTList(value []byte) ([][]byte, error) {
+	var data []byte
+	if rest, err := asn1.Unmarshal(value, &data); err != nil {
+		return nil, errors.Wrap(err, "error unmarshaling SCT list")
+	} else if len(rest) > 0 {
+		return nil, errors.New("error unmarshaling SCT list: trailing data")
+	}
+
+	list, rest, ok := readUint16Prefixed(data)
+	if !ok || len(rest) > 0 {
+		return nil, errors.New("error parsing SCT list: invalid length")
+	}
+	var scts [][]byte
+	for len(list) > 0 {
+		var sct []byte
+		if sct, list, ok = readUint16Prefixed(list); !ok {
+			return nil, errors.New("error parsing SCT list: invalid SCT length")
+		}
+		scts = append(scts, sct)
+	}
+	return scts, nil
+}
+
+// validateSCT checks the structure of a TLS encoded SignedCertificateTimestamp:
+//
+//	struct {
+//	    Version sct_version;
+//	    LogID id;
+//	    uint64 timestamp;
+//	    CtExtensions extensions;
+//	    digitally-signed struct { ... };
+//	} SignedCertificateTimestamp;
+func validateSCT(sct []byte) error {
+	const headerSize = 1 + 32 + 8
+	switch {
+	case len(sct) == 0:
+		return errors.New("SCT cannot be empty")
+	case len(sct) > 0xffff:
+		return errors.New("SCT is too long")
+	case len(sct) < headerSize:
+		return errors.New("SCT is too short")
+	case sct[0] != 0:
+		return errors.Errorf("SCT version %d is not supported", sct[0])
+	}
+
+	_, rest, ok := readUint16Prefixed(sct[headerSize:])
+	if !ok {
+		return errors.New("SCT extensions have an invalid length")
+	}
+	// Hash and signature algorithms
+	if len(rest) < 2 {
+		return errors.New("SCT signature is too short")
+	}
+	if _, rest, ok = readUint16Prefixed(rest[2:]); !ok || len(rest) > 0 {
+		return errors.New("SCT signature has an invalid length")
+	}
+	return nil
+}
+
+func appendUint16Prefixed(dst, data []byte) []byte {
+	var n [2]byte
+	binary.BigEndian.PutUint16(n[:], uint16(len(data)))
+	dst = append(dst, n[:]...)
+	return append(dst, data...)
+}
+
+func readUint16Prefixed(data []byte) (value, rest []byte, ok bool) {
+	if len(data) < 2 {
+		return nil, nil, false
+	}
+	n := int(binary.BigEndian.Uint16(data))
+	if len(data) < 2+n {
+		return nil, nil, false
+	}
+	return data[2 : 2+n], data[2+n:], true
+}
@@ -0,0 +1,197 @@
+package x509util
+
+import (
+	"bytes"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/binary"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+// newTestSCT returns a TLS encoded SCT with the given log id and signature.
+func newTestSCT(logID byte, timestamp uint64, signature []byte) []byte {
+	sct := []byte{0}
+	sct = append(sct, bytes.Repeat([]byte{logID}, 32)...)
+	var ts [8]byte
+	binary.BigEndian.PutUint64(ts[:], timestamp)
+	sct = append(sct, ts[:]...)
+	sct = append(sct, 0, 0) // extensions
+	sct = append(sct, 4, 3) // sha256, ecdsa
+	return appendUint16Prefixed(sct, signature)
+}
+
+func TestWithEmbeddedSCTs(t *testing.T) {
+	iss := mustParseCertificate(t, "test_files/noPasscodeCa.crt")
+	issPriv := mustParseRSAKey(t, "test_files/noPasscodeCa.key")
+
+	sct1 := newTestSCT(1, 1600000000000, []byte("signature-1"))
+	sct2 := newTestSCT(2, 1600000000001, []byte("signature-2"))
+
+	tests := []struct {
+		name    string
+		scts    [][]byte
+		wantErr bool
+	}{
+		{"ok/one", [][]byte{sct1}, false},
+		{"ok/two", [][]byte{sct1, sct2}, false},
+		{"fail/nil", nil, true},
+		{"fail/empty", [][]byte{{}}, true},
+		{"fail/short", [][]byte{sct1[:40]}, true},
+		{"fail/version", [][]byte{append([]byte{1}, sct1[1:]...)}, true},
+		{"fail/truncated", [][]byte{sct1[:len(sct1)-1]}, true},
+		{"fail/trailing", [][]byte{append(sct1[:len(sct1):len(sct1)], 0)}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, err := NewLeafProfile("test.smallstep.com", iss, issPriv, WithEmbeddedSCTs(tt.scts))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("NewLeafProfile() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+
+			cert := mustCreateCertificate(t, p)
+			var found int
+			for _, ext := range cert.Extensions {
+				if ext.Id.Equal(oidExtensionSCTList) {
+					found++
+					if ext.Critical {
+						t.Error("SCT list extension is critical")
+					}
+					scts, err := parseSCTList(ext.Value)
+					if err != nil {
+						t.Fatal(err)
+					}
+					if !reflect.DeepEqual(scts, tt.scts) {
+						t.Errorf("SCT list = %x, want %x", scts, tt.scts)
+					}
+				}
+			}
+			if found != 1 {
+				t.Errorf("certificate has %d SCT list extensions, want 1", found)
+			}
+		})
+	}
+}
+
+func TestCreateCertificateWithCT(t *testing.T) {
+	iss := mustParseCertificate(t, "test_files/noPasscodeCa.crt")
+	issPriv := mustParseRSAKey(t, "test_files/noPasscodeCa.key")
+
+	scts := [][]byte{
+		newTestSCT(1, 1600000000000, []byte("signature-1")),
+		newTestSCT(2, 1600000000001, []byte("signature-2")),
+	}
+	// withoutCTExtensions returns the extensions of the given certificate
+	// without the CT poison and SCT list extensions.
+	withoutCTExtensions := func(crt *x509.Certificate) []pkix.Extension {
+		return removeCTExtensions(crt.Extensions)
+	}
+
+	tests := []struct {
+		name string
+		opts []WithOption
+	}{
+		{"ok", nil},
+		{"ok/poison", []WithOption{WithCTPoison()}},
+		{"ok/embedded-scts", []WithOption{WithEmbeddedSCTs(scts[:1])}},
+		{"ok/extensions", []WithOption{WithMustStaple(), WithQCStatements([]asn1.ObjectIdentifier{OIDQCCompliance})}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got []byte
+			provider := func(precertDER []byte) ([][]byte, error) {
+				got = precertDER
+				return scts, nil
+			}
+			opts := append([]WithOption{WithHosts("test.smallstep.com"), WithSCTProvider(provider)}, tt.opts...)
+			p := mustNewProfile(t)(NewLeafProfile("test.smallstep.com", iss, issPriv, opts...))
+			preDER, der, err := p.CreateCertificateWithCT()
+			if err != nil {
+				t.Fatalf("CreateCertificateWithCT() error = %v", err)
+			}
+			if !bytes.Equal(got, preDER) {
+				t.Error("SCT provider did not get the precertificate")
+			}
+			precert, err := x509.ParseCertificate(preDER)
+			if err != nil {
+				t.Fatal(err)
+			}
+			crt, err := x509.ParseCertificate(der)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if !hasExtension(precert.Extensions, oidExtensionCTPoison) || hasExtension(precert.Extensions, oidExtensionSCTList) {
+				t.Errorf("precertificate extensions = %v, want the poison and not the SCT list", precert.Extensions)
+			}
+			if hasExtension(crt.Extensions, oidExtensionCTPoison) {
+				t.Error("certificate has the CT poison extension")
+			}
+			ext, ok := findExtension(crt, oidExtensionSCTList)
+			if !ok {
+				t.Fatal("certificate does not have the SCT list extension")
+			}
+			if list, err := parseSCTList(ext.Value); err != nil || !reflect.DeepEqual(list, scts) {
+				t.Errorf("SCT list = %x, %v, want %x", list, err, scts)
+			}
+
+			if precert.SerialNumber.Cmp(crt.SerialNumber) != 0 {
+				t.Errorf("serial numbers %s and %s are not equal", precert.SerialNumber, crt.SerialNumber)
+			}
+			if !precert.NotBefore.Equal(crt.NotBefore) || !precert.NotAfter.Equal(crt.NotAfter) {
+				t.Errorf("validity [%s, %s] and [%s, %s] are not equal", precert.NotBefore, precert.NotAfter, crt.NotBefore, crt.NotAfter)
+			}
+			if !bytes.Equal(precert.RawSubject, crt.RawSubject) || !bytes.Equal(precert.RawIssuer, crt.RawIssuer) {
+				t.Error("precertificate and certificate names are not equal")
+			}
+			if !reflect.DeepEqual(withoutCTExtensions(precert), withoutCTExtensions(crt)) {
+				t.Errorf("extensions %v and %v are not equal", withoutCTExtensions(precert), withoutCTExtensions(crt))
+			}
+			if c, err := p.CertificateDER(); err != nil || !bytes.Equal(c, der) {
+				t.Error("CertificateDER() does not return the final certificate")
+			}
+		})
+	}
+
+	t.Run("fail/provider", func(t *testing.T) {
+		p := mustNewProfile(t)(NewLeafProfile("test.smallstep.com", iss, issPriv, WithSCTProvider(func([]byte) ([][]byte, error) {
+			return nil, errors.New("log is down")
+		})))
+		if _, _, err := p.CreateCertificateWithCT(); err == nil {
+			t.Fatal("CreateCertificateWithCT() error = nil, want error")
+		}
+		if _, err := p.Fingerprint(); err == nil {
+			t.Error("the certificate has been created after the provider failed")
+		}
+	})
+	t.Run("fail/invalid-scts", func(t *testing.T) {
+		p := mustNewProfile(t)(NewLeafProfile("test.smallstep.com", iss, issPriv, WithSCTProvider(func([]byte) ([][]byte, error) {
+			return nil, nil
+		})))
+		if _, _, err := p.CreateCertificateWithCT(); err == nil {
+			t.Error("CreateCertificateWithCT() error = nil, want error")
+		}
+	})
+	t.Run("fail/no-provider", func(t *testing.T) {
+		p := mustNewProfile(t)(NewLeafProfile("test.smallstep.com", iss, issPriv))
+		if _, _, err := p.CreateCertificateWithCT(); err == nil {
+			t.Error("CreateCertificateWithCT() error = nil, want error")
+		}
+	})
+	t.Run("fail/ca", func(t *testing.T) {
+		provider := func([]byte) ([][]byte, error) { return scts, nil }
+		if _, err := NewRootProfile("root", WithSCTProvider(provider)); err == nil {
+			t.Error("NewRootProfile() error = nil, want error")
+		}
+	})
+	t.Run("fail/nil", func(t *testing.T) {
+		if _, err := NewLeafProfile("test.smallstep.com", iss, issPriv, WithSCTProvider(nil)); err == nil {
+			t.Error("NewLeafProfile() error = nil, want error")
+		}
+	})
+}
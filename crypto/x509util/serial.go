@@ -0,0 +1,57 @@
+package x509util
+
+import (
+	"io"
+	"math/big"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	// DefaultSerialNumberBits is the default number of random bits in a
+	// certificate serial number. Using 159 bits guarantees that the leading
+	// bit of a 20 octets serial number is never set, so the DER encoding never
+	// requires a 21st octet.
+	DefaultSerialNumberBits = 159
+
+	// MinSerialNumberBits is the minimum number of random bits in a serial
+	// number required by the CA/Browser Forum Baseline Requirements.
+	MinSerialNumberBits = 64
+
+	// maxSerialNumberOctets is the maximum length of a serial number as
+	// defined in RFC 5280, section 4.1.2.2.
+	maxSerialNumberOctets = 20
+)
+
+// newSerialNumber returns a new positive serial number with the given number
+// of random bits read from the given reader.
+func newSerialNumber(rand io.Reader, bits int) (*big.Int, error) {
+	if bits < MinSerialNumberBits || bits > DefaultSerialNumberBits {
+		return nil, errors.Errorf("serial number bits must be between %d and %d", MinSerialNumberBits, DefaultSerialNumberBits)
+	}
+
+	b := make([]byte, (bits+7)/8)
+	for {
+		if _, err := io.ReadFull(rand, b); err != nil {
+			return nil, errors.Wrap(err, "error reading random bytes")
+		}
+		// Clear the bits over the requested size.
+		b[0] &= byte(0xff >> (uint(len(b)*8 - bits)))
+		if sn := new(big.Int).SetBytes(b); sn.Sign() > 0 {
+			return sn, nil
+		}
+	}
+}
+
+// validateSerialNumber checks that the given serial number is positive and it
+// does not exceed 20 octets when DER encoded.
+func validateSerialNumber(sn *big.Int) error {
+	if sn.Sign() <= 0 {
+		return errors.New("serial number must be a positive integer")
+	}
+	// A positive integer with the leading bit set requires an extra octet.
+	if sn.BitLen()/8+1 > maxSerialNumberOctets {
+		return errors.Errorf("serial number cannot be longer than %d octets", maxSerialNumberOctets)
+	}
+	return nil
+}
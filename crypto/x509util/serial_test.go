@@ -0,0 +1,102 @@
+package x509util
+
+import (
+	"crypto/rand"
+	"encoding/asn1"
+	"math/big"
+	"testing"
+
+	"github.com/pkg/errors"
+)
+
+type errReader struct{}
+
+func (errReader) Read(p []byte) (int, error) {
+	return 0, errors.New("read error")
+}
+
+func Test_newSerialNumber(t *testing.T) {
+	for _, bits := range []int{MinSerialNumberBits, 128, DefaultSerialNumberBits} {
+		for i := 0; i < 5000; i++ {
+			sn, err := newSerialNumber(rand.Reader, bits)
+			if err != nil {
+				t.Fatalf("newSerialNumber() error = %v", err)
+			}
+			if sn.Sign() <= 0 {
+				t.Fatalf("newSerialNumber() = %s, want a positive number", sn)
+			}
+			if sn.BitLen() > bits {
+				t.Fatalf("newSerialNumber() bit length = %d, want <= %d", sn.BitLen(), bits)
+			}
+			b, err := asn1.Marshal(sn)
+			if err != nil {
+				t.Fatal(err)
+			}
+			// Skip tag and length
+			if n := len(b) - 2; n > maxSerialNumberOctets {
+				t.Fatalf("newSerialNumber() DER length = %d, want <= %d", n, maxSerialNumberOctets)
+			}
+		}
+	}
+
+	t.Run("fail/rand", func(t *testing.T) {
+		if _, err := newSerialNumber(errReader{}, DefaultSerialNumberBits); err == nil {
+			t.Error("newSerialNumber() error = nil, want error")
+		}
+	})
+	t.Run("fail/bits", func(t *testing.T) {
+		for _, bits := range []int{0, MinSerialNumberBits - 1, DefaultSerialNumberBits + 1} {
+			if _, err := newSerialNumber(rand.Reader, bits); err == nil {
+				t.Errorf("newSerialNumber(%d) error = nil, want error", bits)
+			}
+		}
+	})
+}
+
+func TestWithSerialNumber(t *testing.T) {
+	iss := mustParseCertificate(t, "test_files/noPasscodeCa.crt")
+	issPriv := mustParseRSAKey(t, "test_files/noPasscodeCa.key")
+
+	max := new(big.Int).Sub(new(big.Int).Lsh(big.NewInt(1), 159), big.NewInt(1))
+	tooBig := new(big.Int).Lsh(big.NewInt(1), 159)
+
+	tests := []struct {
+		name    string
+		options []WithOption
+		want    *big.Int
+		wantErr bool
+	}{
+		{"ok", []WithOption{WithSerialNumber(big.NewInt(1234))}, big.NewInt(1234), false},
+		{"ok/max", []WithOption{WithSerialNumber(max)}, max, false},
+		{"ok/skip", []WithOption{WithSerialNumber(tooBig), WithSkipSerialNumberCheck()}, tooBig, false},
+		{"fail/nil", []WithOption{WithSerialNumber(nil)}, nil, true},
+		{"fail/zero", []WithOption{WithSerialNumber(big.NewInt(0))}, nil, true},
+		{"fail/negative", []WithOption{WithSerialNumber(big.NewInt(-1))}, nil, true},
+		{"fail/too-big", []WithOption{WithSerialNumber(tooBig)}, nil, true},
+		{"fail/bits", []WithOption{WithSerialNumberBits(32)}, nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, err := NewLeafProfile("test.smallstep.com", iss, issPriv, tt.options...)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("NewLeafProfile() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if got := p.Subject().SerialNumber; got.Cmp(tt.want) != 0 {
+				t.Errorf("SerialNumber = %s, want %s", got, tt.want)
+			}
+		})
+	}
+
+	t.Run("ok/bits", func(t *testing.T) {
+		p, err := NewLeafProfile("test.smallstep.com", iss, issPriv, WithSerialNumberBits(MinSerialNumberBits))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if n := p.Subject().SerialNumber.BitLen(); n > MinSerialNumberBits {
+			t.Errorf("SerialNumber bit length = %d, want <= %d", n, MinSerialNumberBits)
+		}
+	})
+}
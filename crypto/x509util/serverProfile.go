@@ -0,0 +1,73 @@
+package x509util
+
+import (
+	"crypto"
+	"crypto/x509"
+	"crypto/x509/pkix"
+)
+
+// NewServerProfile returns a new leaf x509 Certificate profile for a TLS
+// server. The certificate only has the serverAuth extended key usage, the
+// DigitalSignature key usage, and KeyEncipherment for RSA keys, and it
+// encodes a basic constraints extension with CA:FALSE. Certificate policies
+// and other extended key usages are not added.
+//
+// The certificate must have at least one DNS or IP subject alternative name,
+// creating it fails with an error matching ErrLint otherwise. The common name
+// is not added automatically, use WithCommonNameInSAN to add it, or
+// WithSkipLint(LintServerSAN) to allow certificates without them.
+//
+// A new public/private key pair will be generated for the Profile if
+// not set in the `withOps` profile modifiers.
+func NewServerProfile(cn string, iss *x509.Certificate, issPriv crypto.PrivateKey, withOps ...WithOption) (Profile, error) {
+	sub := defaultServerTemplate(pkix.Name{CommonName: cn}, iss.Subject)
+	withOps = append([]WithOption{withLintRule(serverLintRule)}, withOps...)
+	return newProfile(&Leaf{}, sub, iss, issPriv, withOps...)
+}
+
+// NewServerProfileWithCSR returns a new TLS server profile like
+// NewServerProfile, using the subject, the public key and the DNS and IP
+// subject alternative names of the given CSR. Other names and the extensions
+// of the CSR are not copied.
+//
+// It returns an error matching ErrMissingPublicKey or ErrInvalidCSRSignature
+// if the CSR does not have a public key or its signature is not valid.
+func NewServerProfileWithCSR(csr *x509.CertificateRequest, iss *x509.Certificate, issPriv crypto.PrivateKey, withOps ...WithOption) (Profile, error) {
+	if csr.PublicKey == nil {
+		return nil, newError(ErrMissingPublicKey, "CSR must have PublicKey")
+	}
+	if err := csr.CheckSignature(); err != nil {
+		return nil, newError(ErrInvalidCSRSignature, "error validating CSR signature: %v", err)
+	}
+
+	sub := defaultServerTemplate(csr.Subject, iss.Subject)
+	sub.DNSNames = csr.DNSNames
+	sub.IPAddresses = csr.IPAddresses
+	withOps = append([]WithOption{withLintRule(serverLintRule)}, withOps...)
+	withOps = append(withOps, WithPublicKey(csr.PublicKey), withCSRRawSubject(csr))
+	return newProfile(&Leaf{}, sub, iss, issPriv, withOps...)
+}
+
+// serverLintRule is enabled by the server profiles, it reports
+// LintServerSAN if the certificate does not have a DNS or IP subject
+// alternative name.
+var serverLintRule = lintRule{
+	name: "server",
+	check: func(b *base, crt *x509.Certificate, add func(code, msg string)) {
+		if len(crt.DNSNames) == 0 && len(crt.IPAddresses) == 0 {
+			add(LintServerSAN, "TLS server certificates must have a DNS or IP subject alternative name")
+		}
+	},
+}
+
+func defaultServerTemplate(sub, iss pkix.Name) *x509.Certificate {
+	return &x509.Certificate{
+		IsCA: false,
+		// KeyEncipherment is removed at signing time for non-RSA keys.
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageKeyEncipherment,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		BasicConstraintsValid: true,
+		Issuer:                iss,
+		Subject:               sub,
+	}
+}
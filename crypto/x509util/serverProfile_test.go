@@ -0,0 +1,118 @@
+package x509util
+
+import (
+	"bytes"
+	"crypto/x509"
+	"encoding/asn1"
+	"encoding/hex"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// goldenExtension is the expected value of an extension, a nil value is not
+// compared.
+type goldenExtension struct {
+	oid      asn1.ObjectIdentifier
+	critical bool
+	value    []byte
+}
+
+func mustDecodeHex(t *testing.T, s string) []byte {
+	t.Helper()
+	b, err := hex.DecodeString(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
+
+func TestNewServerProfile(t *testing.T) {
+	root := mustNewProfile(t)(NewRootProfile("Root"))
+	iss := mustCreateCertificate(t, root)
+	issPriv := root.SubjectPrivateKey()
+	now := time.Now().Truncate(time.Second)
+
+	var (
+		kuEC       = goldenExtension{oidExtKeyUsage, true, mustDecodeHex(t, "03020780")}
+		kuRSA      = goldenExtension{oidExtKeyUsage, true, mustDecodeHex(t, "030205a0")}
+		ekuServer  = goldenExtension{oidExtExtendedKeyUsage, false, mustDecodeHex(t, "300a06082b06010505070301")}
+		bcNotCA    = goldenExtension{oidExtBasicConstraints, true, mustDecodeHex(t, "3000")}
+		ski        = goldenExtension{oidExtSubjectKeyID, false, nil}
+		aki        = goldenExtension{oidExtAuthorityKeyID, false, nil}
+		san        = goldenExtension{oidExtSubjectAltName, false, nil}
+		golden     = []goldenExtension{kuEC, ekuServer, bcNotCA, ski, aki, san}
+		goldenRSA  = []goldenExtension{kuRSA, ekuServer, bcNotCA, ski, aki, san}
+		csr        = mustLoadCSR(t, "test_files/test.smallstep.com.csr")
+		newProfile = func(opts ...WithOption) (Profile, error) {
+			return NewServerProfile("test.smallstep.com", iss, issPriv, opts...)
+		}
+		newProfileWithCSR = func(opts ...WithOption) (Profile, error) {
+			return NewServerProfileWithCSR(csr, iss, issPriv, opts...)
+		}
+	)
+
+	tests := []struct {
+		name     string
+		fn       func(...WithOption) (Profile, error)
+		options  []WithOption
+		dnsNames []string
+		ips      []net.IP
+		want     []goldenExtension
+		wantErr  error
+	}{
+		{"ok/hosts", newProfile, []WithOption{WithHosts("test.smallstep.com,127.0.0.1")}, []string{"test.smallstep.com"}, []net.IP{net.ParseIP("127.0.0.1").To4()}, golden, nil},
+		{"ok/sans", newProfile, []WithOption{WithSANs([]string{"www.smallstep.com", "10.0.0.1"})}, []string{"www.smallstep.com"}, []net.IP{net.ParseIP("10.0.0.1").To4()}, golden, nil},
+		{"ok/cn-in-san", newProfile, []WithOption{WithCommonNameInSAN()}, []string{"test.smallstep.com"}, nil, golden, nil},
+		{"ok/rsa", newProfile, []WithOption{WithHosts("test.smallstep.com"), GenerateKeyPair("RSA", "", 2048)}, []string{"test.smallstep.com"}, nil, goldenRSA, nil},
+		{"ok/validity", newProfile, []WithOption{WithHosts("test.smallstep.com"), WithNotBeforeAfterDuration(now, now.Add(time.Hour), 0)}, []string{"test.smallstep.com"}, nil, golden, nil},
+		{"ok/csr", newProfileWithCSR, nil, []string{"test.smallstep.com"}, nil, goldenRSA, nil},
+		{"ok/csr-sans", newProfileWithCSR, []WithOption{WithHosts("www.smallstep.com")}, []string{"test.smallstep.com", "www.smallstep.com"}, nil, goldenRSA, nil},
+		{"fail/no-san", newProfile, nil, nil, nil, nil, ErrLint},
+		{"fail/email-only", newProfile, []WithOption{WithSANs([]string{"jane@smallstep.com"})}, nil, nil, nil, ErrLint},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := mustNewProfile(t)(tt.fn(tt.options...))
+			der, err := p.CreateCertificate()
+			if tt.wantErr != nil {
+				var lintErrs LintErrors
+				if !errors.Is(err, tt.wantErr) || !errors.As(err, &lintErrs) || lintErrs[0].Code != LintServerSAN {
+					t.Errorf("CreateCertificate() error = %v, want %s", err, LintServerSAN)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("CreateCertificate() error = %v", err)
+			}
+			cert, err := x509.ParseCertificate(der)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(cert.Extensions) != len(tt.want) {
+				t.Fatalf("Extensions = %v, want %d extensions", cert.Extensions, len(tt.want))
+			}
+			for i, want := range tt.want {
+				ext := cert.Extensions[i]
+				if !ext.Id.Equal(want.oid) || ext.Critical != want.critical || (want.value != nil && !bytes.Equal(ext.Value, want.value)) {
+					t.Errorf("extension %d = {%s %t %x}, want {%s %t %x}", i, ext.Id, ext.Critical, ext.Value, want.oid, want.critical, want.value)
+				}
+			}
+			if len(cert.DNSNames) != len(tt.dnsNames) || len(cert.IPAddresses) != len(tt.ips) {
+				t.Fatalf("DNSNames = %v, IPAddresses = %v, want %v, %v", cert.DNSNames, cert.IPAddresses, tt.dnsNames, tt.ips)
+			}
+			for i := range tt.dnsNames {
+				if cert.DNSNames[i] != tt.dnsNames[i] {
+					t.Errorf("DNSNames = %v, want %v", cert.DNSNames, tt.dnsNames)
+				}
+			}
+			for i := range tt.ips {
+				if !cert.IPAddresses[i].Equal(tt.ips[i]) {
+					t.Errorf("IPAddresses = %v, want %v", cert.IPAddresses, tt.ips)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,217 @@
+package x509util
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/x509"
+
+	"github.com/pkg/errors"
+)
+
+// WithSignatureAlgorithm returns a Profile modifier that sets the algorithm
+// used by the issuer to sign the certificate. If not set, the algorithm is
+// selected using the type of the issuer key.
+//
+// The RSASSA-PSS algorithms, x509.SHA256WithRSAPSS, x509.SHA384WithRSAPSS and
+// x509.SHA512WithRSAPSS, can only be used with RSA issuers. The ECDSA
+// algorithms can only be used with ECDSA issuers, and the digest must be at
+// least as strong as the curve: SHA-256 for P-256, SHA-384 for P-384 and
+// SHA-512 for P-521. By default, ECDSA issuers use that digest.
+func WithSignatureAlgorithm(alg x509.SignatureAlgorithm) WithOption {
+	return func(p Profile) error {
+		if alg == x509.UnknownSignatureAlgorithm {
+			return errors.New("signature algorithm cannot be unknown")
+		}
+		p.Subject().SignatureAlgorithm = alg
+		return nil
+	}
+}
+
+// isRSAPSS returns true if the given algorithm is an RSASSA-PSS algorithm.
+func isRSAPSS(alg x509.SignatureAlgorithm) bool {
+	switch alg {
+	case x509.SHA256WithRSAPSS, x509.SHA384WithRSAPSS, x509.SHA512WithRSAPSS:
+		return true
+	default:
+		return false
+	}
+}
+
+// isRSAPKCS1 returns true if the given algorithm is an RSA PKCS #1 v1.5
+// algorithm.
+func isRSAPKCS1(alg x509.SignatureAlgorithm) bool {
+	switch alg {
+	case x509.MD2WithRSA, x509.MD5WithRSA, x509.SHA1WithRSA, x509.SHA256WithRSA, x509.SHA384WithRSA, x509.SHA512WithRSA:
+		return true
+	default:
+		return false
+	}
+}
+
+// ecdsaHashBits returns the size in bits of the digest of the given ECDSA
+// algorithm, or 0 if it is not an ECDSA algorithm.
+func ecdsaHashBits(alg x509.SignatureAlgorithm) int {
+	switch alg {
+	case x509.ECDSAWithSHA1:
+		return 160
+	case x509.ECDSAWithSHA256:
+		return 256
+	case x509.ECDSAWithSHA384:
+		return 384
+	case x509.ECDSAWithSHA512:
+		return 512
+	default:
+		return 0
+	}
+}
+
+// ecdsaSignatureAlgorithm returns the ECDSA algorithm recommended for the
+// given curve: SHA-256 for P-256, SHA-384 for P-384 and SHA-512 for P-521 and
+// other curves.
+func ecdsaSignatureAlgorithm(c elliptic.Curve) x509.SignatureAlgorithm {
+	switch c {
+	case elliptic.P224(), elliptic.P256():
+		return x509.ECDSAWithSHA256
+	case elliptic.P384():
+		return x509.ECDSAWithSHA384
+	default:
+		return x509.ECDSAWithSHA512
+	}
+}
+
+// signerPublicKey returns the public key of the given private key or signer.
+func signerPublicKey(priv interface{}) (crypto.PublicKey, error) {
+	if s, ok := priv.(crypto.Signer); ok {
+		return s.Public(), nil
+	}
+	return nil, errors.Errorf("private key %T is not a crypto.Signer", priv)
+}
+
+// validateIssuerKey checks that the public key of the issuer private key
+// matches the public key in the issuer certificate.
+func validateIssuerKey(iss *x509.Certificate, issPriv interface{}) error {
+	pub, err := signerPublicKey(issPriv)
+	if err != nil {
+		return newError(ErrIssuerKeyMismatch, "error validating issuer private key: %v", err)
+	}
+	if !publicKeyEqual(pub, iss.PublicKey) {
+		return newError(ErrIssuerKeyMismatch, "issuer private key does not match the public key of the issuer certificate %q", iss.Subject.CommonName)
+	}
+	return nil
+}
+
+// checkIssuerKeyReuse returns an IssuerKeyReuseError if the subject public key
+// is the public key of the issuer certificate. The keys are compared using
+// their DER encoded SubjectPublicKeyInfo.
+func checkIssuerKeyReuse(iss *x509.Certificate, pub crypto.PublicKey) error {
+	if iss.PublicKey == nil {
+		return nil
+	}
+	issDER, err := x509.MarshalPKIXPublicKey(iss.PublicKey)
+	if err != nil {
+		return nil
+	}
+	subDER, err := x509.MarshalPKIXPublicKey(pub)
+	if err != nil {
+		return errors.Wrap(err, "error marshaling subject public key")
+	}
+	if bytes.Equal(issDER, subDER) {
+		return &IssuerKeyReuseError{Issuer: iss.Subject.String()}
+	}
+	return nil
+}
+
+// verifySelfSigned checks that the given DER encoded certificate is signed by
+// its own public key. CA certificates are verified with CheckSignatureFrom, so
+// the basic constraints and key usage are checked too. Leaf certificates
+// cannot be the parent of a certificate, only their signature is verified.
+func verifySelfSigned(der []byte) error {
+	crt, err := x509.ParseCertificate(der)
+	if err != nil {
+		return errors.Wrap(err, "error parsing certificate")
+	}
+	if crt.IsCA {
+		err = crt.CheckSignatureFrom(crt)
+	} else {
+		err = crt.CheckSignature(crt.SignatureAlgorithm, crt.RawTBSCertificate, crt.Signature)
+	}
+	if err != nil {
+		return newError(ErrIssuerKeyMismatch, "self-signed certificate does not verify with its own public key: %v", err)
+	}
+	return nil
+}
+
+// publicKeyEqual returns true if both public keys are equal.
+func publicKeyEqual(a, b crypto.PublicKey) bool {
+	if k, ok := a.(interface{ Equal(crypto.PublicKey) bool }); ok {
+		return k.Equal(b)
+	}
+	ab, err := x509.MarshalPKIXPublicKey(a)
+	if err != nil {
+		return false
+	}
+	bb, err := x509.MarshalPKIXPublicKey(b)
+	if err != nil {
+		return false
+	}
+	return bytes.Equal(ab, bb)
+}
+
+// validateSignatureAlgorithm checks that the given signature algorithm can be
+// used with the issuer key.
+func validateSignatureAlgorithm(alg x509.SignatureAlgorithm, issPriv interface{}) error {
+	if alg == x509.UnknownSignatureAlgorithm {
+		return nil
+	}
+	pub, err := signerPublicKey(issPriv)
+	if err != nil {
+		return err
+	}
+	if isRSAPSS(alg) || isRSAPKCS1(alg) {
+		if _, ok := pub.(*rsa.PublicKey); !ok {
+			return newError(ErrInvalidSignatureAlgorithm, "signature algorithm %s requires an RSA issuer key, not %T", alg, pub)
+		}
+	}
+	if bits := ecdsaHashBits(alg); bits > 0 {
+		k, ok := pub.(*ecdsa.PublicKey)
+		if !ok {
+			return newError(ErrInvalidSignatureAlgorithm, "signature algorithm %s requires an ECDSA issuer key, not %T", alg, pub)
+		}
+		// The digest must be at least as strong as the curve, P-521 keys use
+		// SHA-512.
+		if want := ecdsaHashBits(ecdsaSignatureAlgorithm(k.Curve)); bits < want {
+			return newError(ErrInvalidSignatureAlgorithm, "signature algorithm %s is too weak for an ECDSA %s issuer key, use %s",
+				alg, curveName(k.Curve), ecdsaSignatureAlgorithm(k.Curve))
+		}
+	}
+	_, isEd25519 := pub.(ed25519.PublicKey)
+	switch {
+	case isEd25519 && alg != x509.PureEd25519:
+		return newError(ErrInvalidSignatureAlgorithm, "signature algorithm %s cannot be used with an Ed25519 issuer key", alg)
+	case !isEd25519 && alg == x509.PureEd25519:
+		return newError(ErrInvalidSignatureAlgorithm, "signature algorithm %s requires an Ed25519 issuer key, not %T", alg, pub)
+	}
+	return nil
+}
+
+// defaultSignatureAlgorithm returns the signature algorithm to use with the
+// issuer key if it is not set in the template. Ed25519 keys, including the
+// ones behind a crypto.Signer, always use x509.PureEd25519, and ECDSA keys use
+// the digest that matches the curve, see ecdsaSignatureAlgorithm. For other
+// keys x509.UnknownSignatureAlgorithm is returned, and the x509 package
+// selects the algorithm.
+func defaultSignatureAlgorithm(issPriv interface{}) x509.SignatureAlgorithm {
+	if pub, err := signerPublicKey(issPriv); err == nil {
+		switch k := pub.(type) {
+		case ed25519.PublicKey:
+			return x509.PureEd25519
+		case *ecdsa.PublicKey:
+			return ecdsaSignatureAlgorithm(k.Curve)
+		}
+	}
+	return x509.UnknownSignatureAlgorithm
+}
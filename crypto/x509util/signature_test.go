@@ -0,0 +1,432 @@
+package x509util
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io"
+	"testing"
+)
+
+func TestWithSignatureAlgorithm_RSAPSS(t *testing.T) {
+	iss := mustParseCertificate(t, "test_files/noPasscodeCa.crt")
+	issPriv := mustParseRSAKey(t, "test_files/noPasscodeCa.key")
+
+	for _, alg := range []x509.SignatureAlgorithm{x509.SHA256WithRSAPSS, x509.SHA384WithRSAPSS, x509.SHA512WithRSAPSS} {
+		t.Run(alg.String(), func(t *testing.T) {
+			p, err := NewLeafProfile("test.smallstep.com", iss, issPriv, WithSignatureAlgorithm(alg))
+			if err != nil {
+				t.Fatal(err)
+			}
+			cert := mustCreateCertificate(t, p)
+			if cert.SignatureAlgorithm != alg {
+				t.Errorf("SignatureAlgorithm = %s, want %s", cert.SignatureAlgorithm, alg)
+			}
+			if err := cert.CheckSignatureFrom(iss); err != nil {
+				t.Errorf("CheckSignatureFrom() error = %v", err)
+			}
+		})
+	}
+
+	t.Run("fail/ecdsa-issuer", func(t *testing.T) {
+		ecIssPriv, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		if err != nil {
+			t.Fatal(err)
+		}
+		root, err := NewRootProfile("root", WithPublicKey(ecIssPriv.Public()))
+		if err != nil {
+			t.Fatal(err)
+		}
+		root.SetIssuerPrivateKey(ecIssPriv)
+		rootCert := mustCreateCertificate(t, root)
+
+		p, err := NewLeafProfile("test.smallstep.com", rootCert, ecIssPriv, WithSignatureAlgorithm(x509.SHA256WithRSAPSS))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := p.CreateCertificate(); err == nil {
+			t.Error("CreateCertificate() error = nil, want error")
+		}
+	})
+
+	t.Run("fail/unknown", func(t *testing.T) {
+		if _, err := NewLeafProfile("test.smallstep.com", iss, issPriv, WithSignatureAlgorithm(x509.UnknownSignatureAlgorithm)); err == nil {
+			t.Error("NewLeafProfile() error = nil, want error")
+		}
+	})
+}
+
+func TestWithSignatureAlgorithm_ECDSA(t *testing.T) {
+	roots := map[string]struct {
+		cert *x509.Certificate
+		key  crypto.Signer
+	}{}
+	for _, c := range []elliptic.Curve{elliptic.P256(), elliptic.P384(), elliptic.P521()} {
+		key, err := ecdsa.GenerateKey(c, rand.Reader)
+		if err != nil {
+			t.Fatal(err)
+		}
+		root := mustNewProfile(t)(NewRootProfile("root", WithPublicKey(key.Public())))
+		root.SetIssuerPrivateKey(key)
+		roots[c.Params().Name] = struct {
+			cert *x509.Certificate
+			key  crypto.Signer
+		}{mustCreateCertificate(t, root), key}
+	}
+	rsaKey := mustParseRSAKey(t, "test_files/noPasscodeCa.key")
+
+	tests := []struct {
+		name    string
+		curve   string
+		alg     x509.SignatureAlgorithm
+		want    x509.SignatureAlgorithm
+		wantErr bool
+	}{
+		{"ok/P-256 default", "P-256", x509.UnknownSignatureAlgorithm, x509.ECDSAWithSHA256, false},
+		{"ok/P-384 default", "P-384", x509.UnknownSignatureAlgorithm, x509.ECDSAWithSHA384, false},
+		{"ok/P-521 default", "P-521", x509.UnknownSignatureAlgorithm, x509.ECDSAWithSHA512, false},
+		{"ok/P-256 SHA-256", "P-256", x509.ECDSAWithSHA256, x509.ECDSAWithSHA256, false},
+		{"ok/P-256 SHA-384", "P-256", x509.ECDSAWithSHA384, x509.ECDSAWithSHA384, false},
+		{"ok/P-384 SHA-384", "P-384", x509.ECDSAWithSHA384, x509.ECDSAWithSHA384, false},
+		{"ok/P-384 SHA-512", "P-384", x509.ECDSAWithSHA512, x509.ECDSAWithSHA512, false},
+		{"ok/P-521 SHA-512", "P-521", x509.ECDSAWithSHA512, x509.ECDSAWithSHA512, false},
+		{"fail/P-384 SHA-256", "P-384", x509.ECDSAWithSHA256, 0, true},
+		{"fail/P-521 SHA-256", "P-521", x509.ECDSAWithSHA256, 0, true},
+		{"fail/P-521 SHA-384", "P-521", x509.ECDSAWithSHA384, 0, true},
+		{"fail/P-256 RSA", "P-256", x509.SHA256WithRSA, 0, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			root := roots[tt.curve]
+			var opts []WithOption
+			if tt.alg != x509.UnknownSignatureAlgorithm {
+				opts = append(opts, WithSignatureAlgorithm(tt.alg))
+			}
+			p := mustNewProfile(t)(NewLeafProfile("test.smallstep.com", root.cert, root.key, opts...))
+			cert, err := p.CreateCertificate()
+			if tt.wantErr {
+				if !errors.Is(err, ErrInvalidSignatureAlgorithm) {
+					t.Fatalf("CreateCertificate() error = %v, want ErrInvalidSignatureAlgorithm", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			crt, err := x509.ParseCertificate(cert)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if crt.SignatureAlgorithm != tt.want {
+				t.Errorf("SignatureAlgorithm = %s, want %s", crt.SignatureAlgorithm, tt.want)
+			}
+			if err := crt.CheckSignatureFrom(root.cert); err != nil {
+				t.Errorf("CheckSignatureFrom() error = %v", err)
+			}
+		})
+	}
+
+	t.Run("fail/rsa-issuer", func(t *testing.T) {
+		iss := mustParseCertificate(t, "test_files/noPasscodeCa.crt")
+		p := mustNewProfile(t)(NewLeafProfile("test.smallstep.com", iss, rsaKey, WithSignatureAlgorithm(x509.ECDSAWithSHA256)))
+		if _, err := p.CreateCertificate(); !errors.Is(err, ErrInvalidSignatureAlgorithm) {
+			t.Errorf("CreateCertificate() error = %v, want ErrInvalidSignatureAlgorithm", err)
+		}
+	})
+}
+
+// testSigner wraps a crypto.Signer hiding the concrete type of the key.
+type testSigner struct {
+	crypto.Signer
+}
+
+func TestNewProfile_validateIssuerKey(t *testing.T) {
+	mustRoot := func(kty, crv string, size int) (*x509.Certificate, crypto.Signer) {
+		t.Helper()
+		p := mustNewProfile(t)(NewRootProfile("root", GenerateKeyPair(kty, crv, size)))
+		return mustCreateCertificate(t, p), p.SubjectPrivateKey().(crypto.Signer)
+	}
+	rsaIss, rsaPriv := mustRoot("RSA", "", 2048)
+	ecIss, ecPriv := mustRoot("EC", "P-256", 0)
+	edIss, edPriv := mustRoot("OKP", "Ed25519", 0)
+	_, otherECPriv := mustRoot("EC", "P-256", 0)
+
+	tests := []struct {
+		name    string
+		iss     *x509.Certificate
+		issPriv crypto.PrivateKey
+		wantErr bool
+	}{
+		{"ok/rsa", rsaIss, rsaPriv, false},
+		{"ok/ecdsa", ecIss, ecPriv, false},
+		{"ok/ed25519", edIss, edPriv, false},
+		{"ok/signer", ecIss, testSigner{ecPriv}, false},
+		{"fail/rsa-ecdsa", rsaIss, ecPriv, true},
+		{"fail/ecdsa", ecIss, otherECPriv, true},
+		{"fail/ed25519-rsa", edIss, rsaPriv, true},
+		{"fail/signer", rsaIss, testSigner{otherECPriv}, true},
+		{"fail/not-signer", rsaIss, []byte("foo"), true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, err := NewLeafProfile("test.smallstep.com", tt.iss, tt.issPriv)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("NewLeafProfile() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err == nil {
+				crt := mustCreateCertificate(t, p)
+				if err := crt.CheckSignatureFrom(tt.iss); err != nil {
+					t.Errorf("CheckSignatureFrom() error = %v", err)
+				}
+			}
+		})
+	}
+}
+
+func TestEd25519Hierarchy(t *testing.T) {
+	okp := GenerateKeyPair("OKP", "Ed25519", 0)
+	root := mustNewProfile(t)(NewRootProfile("Root", okp, WithMaxPathLen(1)))
+	rootCert := mustCreateCertificate(t, root)
+
+	// The intermediate is signed using a crypto.Signer hiding the key type.
+	intermediate := mustNewProfile(t)(NewIntermediateProfile("Intermediate", rootCert, testSigner{root.SubjectPrivateKey().(crypto.Signer)}, okp))
+	intermediateCert := mustCreateCertificate(t, intermediate)
+
+	leaf := mustNewProfile(t)(NewLeafProfile("leaf.smallstep.com", intermediateCert, intermediate.SubjectPrivateKey(), okp,
+		WithHosts("leaf.smallstep.com")))
+	leafCert := mustCreateCertificate(t, leaf)
+
+	for _, crt := range []*x509.Certificate{rootCert, intermediateCert, leafCert} {
+		if crt.SignatureAlgorithm != x509.PureEd25519 {
+			t.Errorf("%s SignatureAlgorithm = %s, want %s", crt.Subject.CommonName, crt.SignatureAlgorithm, x509.PureEd25519)
+		}
+		if crt.PublicKeyAlgorithm != x509.Ed25519 {
+			t.Errorf("%s PublicKeyAlgorithm = %s, want %s", crt.Subject.CommonName, crt.PublicKeyAlgorithm, x509.Ed25519)
+		}
+		if crt.KeyUsage&(x509.KeyUsageKeyEncipherment|x509.KeyUsageDataEncipherment) != 0 {
+			t.Errorf("%s KeyUsage = %x, want no encipherment", crt.Subject.CommonName, crt.KeyUsage)
+		}
+		want, err := generateSubjectKeyID(crt.PublicKey)
+		if err != nil {
+			t.Fatal(err)
+		}
+		pub := crt.PublicKey.(ed25519.PublicKey)
+		if sum := sha1.Sum(pub); !bytes.Equal(want, sum[:]) || !bytes.Equal(crt.SubjectKeyId, want) {
+			t.Errorf("%s SubjectKeyId = %x, want %x", crt.Subject.CommonName, crt.SubjectKeyId, sum)
+		}
+	}
+
+	roots := x509.NewCertPool()
+	roots.AddCert(rootCert)
+	intermediates := x509.NewCertPool()
+	intermediates.AddCert(intermediateCert)
+	if _, err := leafCert.Verify(x509.VerifyOptions{DNSName: "leaf.smallstep.com", Roots: roots, Intermediates: intermediates}); err != nil {
+		t.Errorf("Verify() error = %v", err)
+	}
+
+	// Other signature algorithms cannot be used.
+	p := mustNewProfile(t)(NewLeafProfile("leaf.smallstep.com", intermediateCert, intermediate.SubjectPrivateKey(), WithSignatureAlgorithm(x509.ECDSAWithSHA256)))
+	if _, err := p.CreateCertificate(); err == nil {
+		t.Error("CreateCertificate() error = nil, want error")
+	}
+	p = mustNewProfile(t)(NewLeafProfile("leaf.smallstep.com", mustParseCertificate(t, "test_files/noPasscodeCa.crt"),
+		mustParseRSAKey(t, "test_files/noPasscodeCa.key"), WithSignatureAlgorithm(x509.PureEd25519)))
+	if _, err := p.CreateCertificate(); err == nil {
+		t.Error("CreateCertificate() error = nil, want error")
+	}
+}
+
+func TestIssuerKeyReuse(t *testing.T) {
+	rsaIss := mustParseCertificate(t, "test_files/noPasscodeCa.crt")
+	rsaIssPriv := mustParseRSAKey(t, "test_files/noPasscodeCa.key")
+
+	ecRoot := mustNewProfile(t)(NewRootProfile("ec-root", GenerateKeyPair("EC", "P-256", 0)))
+	ecIss := mustCreateCertificate(t, ecRoot)
+	ecIssPriv := ecRoot.SubjectPrivateKey()
+
+	tests := []struct {
+		name    string
+		iss     *x509.Certificate
+		issPriv interface{}
+	}{
+		{"rsa", rsaIss, rsaIssPriv},
+		{"ecdsa", ecIss, ecIssPriv},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pub := tt.iss.PublicKey
+			for _, fn := range []func(...WithOption) (Profile, error){
+				func(ops ...WithOption) (Profile, error) {
+					return NewLeafProfile("leaf", tt.iss, tt.issPriv, ops...)
+				},
+				func(ops ...WithOption) (Profile, error) {
+					return NewIntermediateProfile("intermediate", tt.iss, tt.issPriv, append(ops, WithSkipPathLenCheck())...)
+				},
+			} {
+				p := mustNewProfile(t)(fn(WithPublicKey(pub)))
+				_, err := p.CreateCertificate()
+				var reuseErr *IssuerKeyReuseError
+				if !errors.As(err, &reuseErr) {
+					t.Fatalf("CreateCertificate() error = %v, want IssuerKeyReuseError", err)
+				}
+				if reuseErr.Issuer != tt.iss.Subject.String() {
+					t.Errorf("IssuerKeyReuseError.Issuer = %q, want %q", reuseErr.Issuer, tt.iss.Subject.String())
+				}
+
+				p = mustNewProfile(t)(fn(WithPublicKey(pub), WithAllowIssuerKeyReuse()))
+				if _, err := p.CreateCertificate(); err != nil {
+					t.Errorf("CreateCertificate() with WithAllowIssuerKeyReuse error = %v", err)
+				}
+			}
+		})
+	}
+
+	// Self-signed profiles use the same key on purpose.
+	t.Run("self-signed", func(t *testing.T) {
+		mustCreateCertificate(t, mustNewProfile(t)(NewSelfSignedLeafProfile("leaf")))
+		mustCreateCertificate(t, mustNewProfile(t)(NewRootProfile("root")))
+		mustCreateCertificate(t, mustNewProfile(t)(NewRootProfileWithTemplate(defaultRootTemplate("root"))))
+	})
+}
+
+func TestSelfSignedVerification(t *testing.T) {
+	other, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	newRoot := func() (Profile, error) { return NewRootProfile("root") }
+	newLeaf := func() (Profile, error) { return NewSelfSignedLeafProfile("leaf") }
+	newRSARoot := func() (Profile, error) { return NewRootProfile("root", GenerateKeyPair("RSA", "", 2048)) }
+	newEd25519Leaf := func() (Profile, error) {
+		return NewSelfSignedLeafProfile("leaf", GenerateKeyPair("OKP", "Ed25519", 0))
+	}
+
+	tests := []struct {
+		name       string
+		newProfile func() (Profile, error)
+	}{
+		{"root", newRoot},
+		{"root/rsa", newRSARoot},
+		{"leaf", newLeaf},
+		{"leaf/ed25519", newEd25519Leaf},
+	}
+	for _, tt := range tests {
+		t.Run("ok/"+tt.name, func(t *testing.T) {
+			p := mustNewProfile(t)(tt.newProfile())
+			crt := mustCreateCertificate(t, p)
+			if err := verifySelfSigned(crt.Raw); err != nil {
+				t.Errorf("verifySelfSigned() error = %v", err)
+			}
+		})
+		t.Run("fail/"+tt.name, func(t *testing.T) {
+			p := mustNewProfile(t)(tt.newProfile())
+			// Sign with a key that does not match the subject key.
+			p.SetIssuerPrivateKey(other)
+			if _, err := p.CreateCertificate(); err == nil {
+				t.Error("CreateCertificate() error = nil, want error")
+			}
+			if _, err := p.CreatePrecertificate(); err == nil {
+				t.Error("CreatePrecertificate() error = nil, want error")
+			}
+		})
+	}
+
+	t.Run("fail/not-self-signed", func(t *testing.T) {
+		crt := mustParseCertificate(t, "test_files/smallstep.crt")
+		if err := verifySelfSigned(crt.Raw); err == nil {
+			t.Error("verifySelfSigned() error = nil, want error")
+		}
+	})
+}
+
+// ed25519Signer is an opaque Ed25519 crypto.Signer, like a KMS key, that
+// fails if it is asked to sign a pre-hashed message.
+type ed25519Signer struct {
+	key   ed25519.PrivateKey
+	calls int
+}
+
+func (s *ed25519Signer) Public() crypto.PublicKey {
+	return s.key.Public()
+}
+
+func (s *ed25519Signer) Sign(rand io.Reader, message []byte, opts crypto.SignerOpts) ([]byte, error) {
+	s.calls++
+	if opts.HashFunc() != crypto.Hash(0) {
+		return nil, fmt.Errorf("ed25519 signer called with hash %v", opts.HashFunc())
+	}
+	return ed25519.Sign(s.key, message), nil
+}
+
+func TestEd25519IntermediateSigner(t *testing.T) {
+	okp := GenerateKeyPair("OKP", "Ed25519", 0)
+	root := mustNewProfile(t)(NewRootProfile("Root", okp))
+	rootCert := mustCreateCertificate(t, root)
+	intermediate := mustNewProfile(t)(NewIntermediateProfile("Intermediate", rootCert, root.SubjectPrivateKey(), okp))
+	intermediateCert := mustCreateCertificate(t, intermediate)
+	signer := &ed25519Signer{key: intermediate.SubjectPrivateKey().(ed25519.PrivateKey)}
+
+	roots := x509.NewCertPool()
+	roots.AddCert(rootCert)
+	intermediates := x509.NewCertPool()
+	intermediates.AddCert(intermediateCert)
+	verify := func(t *testing.T, der []byte) {
+		t.Helper()
+		crt, err := x509.ParseCertificate(der)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if crt.SignatureAlgorithm != x509.PureEd25519 {
+			t.Errorf("SignatureAlgorithm = %s, want %s", crt.SignatureAlgorithm, x509.PureEd25519)
+		}
+		if _, err := crt.Verify(x509.VerifyOptions{DNSName: "leaf.smallstep.com", Roots: roots, Intermediates: intermediates}); err != nil {
+			t.Errorf("Verify() error = %v", err)
+		}
+	}
+
+	for _, kty := range []WithOption{GenerateKeyPair("EC", "P-256", 0), GenerateKeyPair("RSA", "", 2048), okp} {
+		p := mustNewProfile(t)(NewLeafProfile("leaf.smallstep.com", intermediateCert, signer, kty, WithHosts("leaf.smallstep.com")))
+		der, err := p.CreateCertificate()
+		if err != nil {
+			t.Fatalf("CreateCertificate() error = %v", err)
+		}
+		verify(t, der)
+	}
+
+	// The to-be-signed certificate is signed with the message, not a digest.
+	p := mustNewProfile(t)(NewLeafProfile("leaf.smallstep.com", intermediateCert, signer, WithHosts("leaf.smallstep.com")))
+	tbs, alg, err := p.TBSCertificate()
+	if err != nil {
+		t.Fatalf("TBSCertificate() error = %v", err)
+	}
+	if alg != x509.PureEd25519 {
+		t.Errorf("TBSCertificate() algorithm = %s, want %s", alg, x509.PureEd25519)
+	}
+	sig, err := signer.Sign(rand.Reader, tbs, crypto.Hash(0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	der, err := p.AssembleSignedCertificate(sig)
+	if err != nil {
+		t.Fatalf("AssembleSignedCertificate() error = %v", err)
+	}
+	verify(t, der)
+	if signer.calls != 4 {
+		t.Errorf("signer called %d times, want 4", signer.calls)
+	}
+
+	// A conflicting signature algorithm is an error.
+	for _, alg := range []x509.SignatureAlgorithm{x509.ECDSAWithSHA256, x509.SHA256WithRSA, x509.SHA256WithRSAPSS} {
+		p := mustNewProfile(t)(NewLeafProfile("leaf.smallstep.com", intermediateCert, signer, WithHosts("leaf.smallstep.com"), WithSignatureAlgorithm(alg)))
+		if _, err := p.CreateCertificate(); !errors.Is(err, ErrInvalidSignatureAlgorithm) {
+			t.Errorf("CreateCertificate() with %s error = %v, want ErrInvalidSignatureAlgorithm", alg, err)
+		}
+	}
+}
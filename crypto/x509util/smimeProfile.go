@@ -0,0 +1,55 @@
+package x509util
+
+import (
+	"crypto"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// DefaultSMIMECertValidity is the default validity of an S/MIME certificate.
+var DefaultSMIMECertValidity = 365 * 24 * time.Hour
+
+// NewSMIMEProfile returns a new leaf x509 Certificate profile for S/MIME
+// email protection. The email address is validated like in
+// WithEmailAddresses and it is used as the common name and as the only
+// rfc822Name in the subject alternative names.
+//
+// The certificate has the emailProtection extended key usage, use
+// WithExtKeyUsage(x509.ExtKeyUsageEmailProtection, x509.ExtKeyUsageClientAuth)
+// to also allow client authentication. Unless a key usage modifier is used,
+// the key usage is set using DefaultKeyUsageForKey, DigitalSignature and
+// KeyEncipherment for RSA keys, and DigitalSignature and KeyAgreement for
+// ECDSA keys. The default duration is DefaultSMIMECertValidity.
+//
+// A new public/private key pair will be generated for the Profile if
+// not set in the `withOps` profile modifiers.
+func NewSMIMEProfile(email string, iss *x509.Certificate, issPriv crypto.PrivateKey, withOps ...WithOption) (Profile, error) {
+	if email == "" {
+		return nil, errors.New("email address cannot be empty")
+	}
+	addr, err := normalizeEmailAddress(email)
+	if err != nil {
+		return nil, errors.Wrapf(err, "invalid email address %q", email)
+	}
+	sub := defaultSMIMETemplate(pkix.Name{CommonName: addr}, iss.Subject, addr)
+	withOps = append([]WithOption{
+		withKeyUsageFromKey(),
+		WithDefaultDuration(DefaultSMIMECertValidity),
+	}, withOps...)
+	return newProfile(&Leaf{}, sub, iss, issPriv, withOps...)
+}
+
+func defaultSMIMETemplate(sub, iss pkix.Name, email string) *x509.Certificate {
+	return &x509.Certificate{
+		IsCA:                  false,
+		KeyUsage:              x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageEmailProtection},
+		EmailAddresses:        []string{email},
+		BasicConstraintsValid: false,
+		Issuer:                iss,
+		Subject:               sub,
+	}
+}
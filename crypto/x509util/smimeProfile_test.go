@@ -0,0 +1,80 @@
+package x509util
+
+import (
+	"crypto/x509"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestNewSMIMEProfile(t *testing.T) {
+	root := mustNewProfile(t)(NewRootProfile("Root"))
+	iss := mustCreateCertificate(t, root)
+	issPriv := root.SubjectPrivateKey()
+	now := time.Now().Truncate(time.Second)
+	clock := WithClock(func() time.Time { return now })
+
+	tests := []struct {
+		name     string
+		email    string
+		options  []WithOption
+		wantMail string
+		wantKU   x509.KeyUsage
+		wantEKU  []x509.ExtKeyUsage
+		validity time.Duration
+		wantErr  bool
+	}{
+		{"ok", "jane@smallstep.com", []WithOption{clock}, "jane@smallstep.com",
+			x509.KeyUsageDigitalSignature | x509.KeyUsageKeyAgreement, []x509.ExtKeyUsage{x509.ExtKeyUsageEmailProtection}, DefaultSMIMECertValidity, false},
+		{"ok/rsa", "jane@smallstep.com", []WithOption{clock, GenerateKeyPair("RSA", "", 2048)}, "jane@smallstep.com",
+			x509.KeyUsageDigitalSignature | x509.KeyUsageKeyEncipherment, []x509.ExtKeyUsage{x509.ExtKeyUsageEmailProtection}, DefaultSMIMECertValidity, false},
+		{"ok/ed25519", "jane@smallstep.com", []WithOption{clock, GenerateKeyPair("OKP", "Ed25519", 0)}, "jane@smallstep.com",
+			x509.KeyUsageDigitalSignature, []x509.ExtKeyUsage{x509.ExtKeyUsageEmailProtection}, DefaultSMIMECertValidity, false},
+		{"ok/client-auth", "jane@smallstep.com", []WithOption{clock, WithExtKeyUsage(x509.ExtKeyUsageEmailProtection, x509.ExtKeyUsageClientAuth)}, "jane@smallstep.com",
+			x509.KeyUsageDigitalSignature | x509.KeyUsageKeyAgreement, []x509.ExtKeyUsage{x509.ExtKeyUsageEmailProtection, x509.ExtKeyUsageClientAuth}, DefaultSMIMECertValidity, false},
+		{"ok/idn", "jane@bücher.example", []WithOption{clock, WithValidity(2 * 365 * 24 * time.Hour)}, "jane@xn--bcher-kva.example",
+			x509.KeyUsageDigitalSignature | x509.KeyUsageKeyAgreement, []x509.ExtKeyUsage{x509.ExtKeyUsageEmailProtection}, 2 * 365 * 24 * time.Hour, false},
+		{"fail/empty", "", nil, "", 0, nil, 0, true},
+		{"fail/invalid", "jane.smallstep.com", nil, "", 0, nil, 0, true},
+		{"fail/display-name", "Jane <jane@smallstep.com>", nil, "", 0, nil, 0, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, err := NewSMIMEProfile(tt.email, iss, issPriv, tt.options...)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("NewSMIMEProfile() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			cert := mustCreateCertificate(t, p)
+			if !reflect.DeepEqual(cert.EmailAddresses, []string{tt.wantMail}) || cert.Subject.CommonName != tt.wantMail {
+				t.Errorf("EmailAddresses = %v, CommonName = %q, want %s", cert.EmailAddresses, cert.Subject.CommonName, tt.wantMail)
+			}
+			if len(cert.DNSNames) != 0 || len(cert.IPAddresses) != 0 || len(cert.URIs) != 0 {
+				t.Errorf("unexpected SANs: %v %v %v", cert.DNSNames, cert.IPAddresses, cert.URIs)
+			}
+			if cert.KeyUsage != tt.wantKU {
+				t.Errorf("KeyUsage = %v, want %v", cert.KeyUsage, tt.wantKU)
+			}
+			// No other extended key usages from the default leaf template.
+			if !reflect.DeepEqual(cert.ExtKeyUsage, tt.wantEKU) || len(cert.UnknownExtKeyUsage) != 0 {
+				t.Errorf("ExtKeyUsage = %v %v, want %v", cert.ExtKeyUsage, cert.UnknownExtKeyUsage, tt.wantEKU)
+			}
+			if len(cert.PolicyIdentifiers) != 0 {
+				t.Errorf("PolicyIdentifiers = %v, want none", cert.PolicyIdentifiers)
+			}
+			if cert.IsCA || cert.BasicConstraintsValid {
+				t.Error("certificate has basic constraints")
+			}
+			if !cert.NotBefore.Equal(now) || !cert.NotAfter.Equal(now.Add(tt.validity)) {
+				t.Errorf("validity = %s - %s, want %s", cert.NotBefore, cert.NotAfter, tt.validity)
+			}
+			roots := x509.NewCertPool()
+			roots.AddCert(iss)
+			if _, err := cert.Verify(x509.VerifyOptions{Roots: roots, KeyUsages: []x509.ExtKeyUsage{x509.ExtKeyUsageEmailProtection}}); err != nil {
+				t.Errorf("Verify() error = %v", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,87 @@
+package x509util
+
+import (
+	"crypto/x509/pkix"
+	"net/url"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// maxSPIFFEIDLength is the maximum length in bytes of a SPIFFE ID.
+const maxSPIFFEIDLength = 2048
+
+// WithSPIFFEID returns a Profile modifier that sets the given SPIFFE ID, e.g.
+// spiffe://example.org/workload, as the only URI in the subject alternative
+// name extension, and clears the subject, as an X.509 SVID identifies the
+// workload by its URI. The subject alternative name extension is marked as
+// critical because the subject is empty.
+//
+// The ID is validated using the SPIFFE ID specification: the scheme must be
+// spiffe, the trust domain must only contain lowercase letters, digits, dots,
+// dashes and underscores, and the path segments must not be empty, "." or
+// "..". Query, fragment, port and user info are not allowed.
+func WithSPIFFEID(id string) WithOption {
+	return func(p Profile) error {
+		u, err := parseSPIFFEID(id)
+		if err != nil {
+			return err
+		}
+		crt := p.Subject()
+		crt.Subject = pkix.Name{}
+		crt.RawSubject = nil
+		crt.URIs = []*url.URL{u}
+		return nil
+	}
+}
+
+// parseSPIFFEID validates the given SPIFFE ID and returns it as a URL.
+func parseSPIFFEID(id string) (*url.URL, error) {
+	if id == "" {
+		return nil, errors.New("SPIFFE ID cannot be empty")
+	}
+	if len(id) > maxSPIFFEIDLength {
+		return nil, errors.Errorf("SPIFFE ID cannot be longer than %d bytes", maxSPIFFEIDLength)
+	}
+	const scheme = "spiffe://"
+	if !strings.HasPrefix(id, scheme) {
+		return nil, errors.Errorf("invalid SPIFFE ID %q: scheme must be spiffe", id)
+	}
+	rest := id[len(scheme):]
+	td, path := rest, ""
+	if i := strings.IndexByte(rest, '/'); i >= 0 {
+		td, path = rest[:i], rest[i:]
+	}
+	if td == "" {
+		return nil, errors.Errorf("invalid SPIFFE ID %q: trust domain cannot be empty", id)
+	}
+	for _, c := range td {
+		if !isSPIFFETrustDomainChar(c) {
+			return nil, errors.Errorf("invalid SPIFFE ID %q: trust domain contains the invalid character %q", id, c)
+		}
+	}
+	if path != "" {
+		for _, seg := range strings.Split(path[1:], "/") {
+			switch seg {
+			case "":
+				return nil, errors.Errorf("invalid SPIFFE ID %q: path cannot contain empty segments or end with a slash", id)
+			case ".", "..":
+				return nil, errors.Errorf("invalid SPIFFE ID %q: path cannot contain dot segments", id)
+			}
+			for _, c := range seg {
+				if !isSPIFFEPathChar(c) {
+					return nil, errors.Errorf("invalid SPIFFE ID %q: path contains the invalid character %q", id, c)
+				}
+			}
+		}
+	}
+	return &url.URL{Scheme: "spiffe", Host: td, Path: path}, nil
+}
+
+func isSPIFFETrustDomainChar(c rune) bool {
+	return (c >= 'a' && c <= 'z') || (c >= '0' && c <= '9') || c == '.' || c == '-' || c == '_'
+}
+
+func isSPIFFEPathChar(c rune) bool {
+	return (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || (c >= '0' && c <= '9') || c == '.' || c == '-' || c == '_'
+}
@@ -0,0 +1,65 @@
+package x509util
+
+import (
+	"crypto/x509"
+	"testing"
+)
+
+func TestWithSPIFFEID(t *testing.T) {
+	iss := mustParseCertificate(t, "test_files/noPasscodeCa.crt")
+	issPriv := mustParseRSAKey(t, "test_files/noPasscodeCa.key")
+
+	tests := []struct {
+		name    string
+		id      string
+		wantErr bool
+	}{
+		{"ok", "spiffe://example.org/ns/default/sa/web", false},
+		{"ok trust domain only", "spiffe://example.org", false},
+		{"ok path characters", "spiffe://my-domain_1.example.org/Service.v1/a-b_c", false},
+		{"fail empty", "", true},
+		{"fail scheme", "https://example.org/web", true},
+		{"fail uppercase scheme", "SPIFFE://example.org/web", true},
+		{"fail empty trust domain", "spiffe:///web", true},
+		{"fail uppercase trust domain", "spiffe://Example.org/web", true},
+		{"fail port", "spiffe://example.org:8443/web", true},
+		{"fail user info", "spiffe://user@example.org/web", true},
+		{"fail trailing slash", "spiffe://example.org/web/", true},
+		{"fail empty segment", "spiffe://example.org//web", true},
+		{"fail dot segment", "spiffe://example.org/./web", true},
+		{"fail dot dot segment", "spiffe://example.org/web/..", true},
+		{"fail query", "spiffe://example.org/web?a=b", true},
+		{"fail fragment", "spiffe://example.org/web#a", true},
+		{"fail percent encoded", "spiffe://example.org/w%20eb", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, err := NewLeafProfile("web", iss, issPriv, WithSPIFFEID(tt.id))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("NewLeafProfile() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			crt := mustCreateCertificate(t, p)
+			if len(crt.URIs) != 1 || crt.URIs[0].String() != tt.id {
+				t.Errorf("URIs = %v, want [%s]", crt.URIs, tt.id)
+			}
+			if len(crt.Subject.Names) != 0 || crt.Subject.String() != "" {
+				t.Errorf("Subject = %q, want empty", crt.Subject)
+			}
+			ext, ok := findExtension(crt, oidExtSubjectAltName)
+			if !ok || !ext.Critical {
+				t.Errorf("subject alternative name extension = %v, want critical", ext)
+			}
+			if len(crt.DNSNames) != 0 || len(crt.IPAddresses) != 0 || len(crt.EmailAddresses) != 0 {
+				t.Errorf("unexpected SANs: %v %v %v", crt.DNSNames, crt.IPAddresses, crt.EmailAddresses)
+			}
+			roots := x509.NewCertPool()
+			roots.AddCert(iss)
+			if _, err := crt.Verify(x509.VerifyOptions{Roots: roots, KeyUsages: []x509.ExtKeyUsage{x509.ExtKeyUsageAny}}); err != nil {
+				t.Errorf("Verify() error = %v", err)
+			}
+		})
+	}
+}
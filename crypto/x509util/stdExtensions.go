@@ -0,0 +1,366 @@
+package x509util
+
+import (
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"net"
+	"net/url"
+
+	"github.com/pkg/errors"
+)
+
+// basicConstraints is the ASN.1 structure of the basic constraints extension.
+type basicConstraints struct {
+	IsCA       bool `asn1:"optional"`
+	MaxPathLen int  `asn1:"optional,default:-1"`
+}
+
+// asn1BitLength returns the bit-length of bitString by considering the
+// most-significant bit in a byte to be the "first" bit. This convention
+// matches ASN.1, but differs from almost everything else.
+func asn1BitLength(bitString []byte) int {
+	bitLen := len(bitString) * 8
+	for i := range bitString {
+		b := bitString[len(bitString)-i-1]
+		for bit := uint(0); bit < 8; bit++ {
+			if (b>>bit)&1 == 1 {
+				return bitLen
+			}
+			bitLen--
+		}
+	}
+	return 0
+}
+
+// reverseBitsInAByte reverses the order of the bits in a byte.
+func reverseBitsInAByte(in byte) byte {
+	b1 := in>>4 | in<<4
+	b2 := b1>>2&0x33 | b1<<2&0xcc
+	b3 := b2>>1&0x55 | b2<<1&0xaa
+	return b3
+}
+
+// RFC 5280, 4.2.1.12  Extended Key Usage
+//
+// anyExtendedKeyUsage OBJECT IDENTIFIER ::= { id-ce-extKeyUsage 0 }
+//
+// id-kp OBJECT IDENTIFIER ::= { id-pkix 3 }
+//
+// id-kp-serverAuth             OBJECT IDENTIFIER ::= { id-kp 1 }
+// id-kp-clientAuth             OBJECT IDENTIFIER ::= { id-kp 2 }
+// id-kp-codeSigning            OBJECT IDENTIFIER ::= { id-kp 3 }
+// id-kp-emailProtection        OBJECT IDENTIFIER ::= { id-kp 4 }
+// id-kp-timeStamping           OBJECT IDENTIFIER ::= { id-kp 8 }
+// id-kp-OCSPSigning            OBJECT IDENTIFIER ::= { id-kp 9 }
+var (
+	oidExtKeyUsageAny                            = asn1.ObjectIdentifier{2, 5, 29, 37, 0}
+	oidExtKeyUsageServerAuth                     = asn1.ObjectIdentifier{1, 3, 6, 1, 5, 5, 7, 3, 1}
+	oidExtKeyUsageClientAuth                     = asn1.ObjectIdentifier{1, 3, 6, 1, 5, 5, 7, 3, 2}
+	oidExtKeyUsageCodeSigning                    = asn1.ObjectIdentifier{1, 3, 6, 1, 5, 5, 7, 3, 3}
+	oidExtKeyUsageEmailProtection                = asn1.ObjectIdentifier{1, 3, 6, 1, 5, 5, 7, 3, 4}
+	oidExtKeyUsageIPSECEndSystem                 = asn1.ObjectIdentifier{1, 3, 6, 1, 5, 5, 7, 3, 5}
+	oidExtKeyUsageIPSECTunnel                    = asn1.ObjectIdentifier{1, 3, 6, 1, 5, 5, 7, 3, 6}
+	oidExtKeyUsageIPSECUser                      = asn1.ObjectIdentifier{1, 3, 6, 1, 5, 5, 7, 3, 7}
+	oidExtKeyUsageTimeStamping                   = asn1.ObjectIdentifier{1, 3, 6, 1, 5, 5, 7, 3, 8}
+	oidExtKeyUsageOCSPSigning                    = asn1.ObjectIdentifier{1, 3, 6, 1, 5, 5, 7, 3, 9}
+	oidExtKeyUsageMicrosoftServerGatedCrypto     = asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 311, 10, 3, 3}
+	oidExtKeyUsageNetscapeServerGatedCrypto      = asn1.ObjectIdentifier{2, 16, 840, 1, 113730, 4, 1}
+	oidExtKeyUsageMicrosoftCommercialCodeSigning = asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 311, 2, 1, 22}
+	oidExtKeyUsageMicrosoftKernelCodeSigning     = asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 311, 61, 1, 1}
+)
+
+// extKeyUsageOIDs contains the mapping between an ExtKeyUsage and its OID.
+var extKeyUsageOIDs = []struct {
+	extKeyUsage x509.ExtKeyUsage
+	oid         asn1.ObjectIdentifier
+}{
+	{x509.ExtKeyUsageAny, oidExtKeyUsageAny},
+	{x509.ExtKeyUsageServerAuth, oidExtKeyUsageServerAuth},
+	{x509.ExtKeyUsageClientAuth, oidExtKeyUsageClientAuth},
+	{x509.ExtKeyUsageCodeSigning, oidExtKeyUsageCodeSigning},
+	{x509.ExtKeyUsageEmailProtection, oidExtKeyUsageEmailProtection},
+	{x509.ExtKeyUsageIPSECEndSystem, oidExtKeyUsageIPSECEndSystem},
+	{x509.ExtKeyUsageIPSECTunnel, oidExtKeyUsageIPSECTunnel},
+	{x509.ExtKeyUsageIPSECUser, oidExtKeyUsageIPSECUser},
+	{x509.ExtKeyUsageTimeStamping, oidExtKeyUsageTimeStamping},
+	{x509.ExtKeyUsageOCSPSigning, oidExtKeyUsageOCSPSigning},
+	{x509.ExtKeyUsageMicrosoftServerGatedCrypto, oidExtKeyUsageMicrosoftServerGatedCrypto},
+	{x509.ExtKeyUsageNetscapeServerGatedCrypto, oidExtKeyUsageNetscapeServerGatedCrypto},
+	{x509.ExtKeyUsageMicrosoftKernelCodeSigning, oidExtKeyUsageMicrosoftKernelCodeSigning},
+	{x509.ExtKeyUsageMicrosoftCommercialCodeSigning, oidExtKeyUsageMicrosoftCommercialCodeSigning},
+}
+
+// oidFromExtKeyUsage returns the OID of the given ExtKeyUsage.
+func oidFromExtKeyUsage(eku x509.ExtKeyUsage) (oid asn1.ObjectIdentifier, ok bool) {
+	for _, pair := range extKeyUsageOIDs {
+		if eku == pair.extKeyUsage {
+			return pair.oid, true
+		}
+	}
+	return
+}
+
+// extKeyUsageFromOID returns the ExtKeyUsage of the given OID.
+func extKeyUsageFromOID(oid asn1.ObjectIdentifier) (eku x509.ExtKeyUsage, ok bool) {
+	for _, pair := range extKeyUsageOIDs {
+		if oid.Equal(pair.oid) {
+			return pair.extKeyUsage, true
+		}
+	}
+	return
+}
+
+// Tags of the GeneralName types used in the subject alternative name
+// extension.
+const (
+	nameTypeEmail = 1
+	nameTypeDNS   = 2
+	nameTypeURI   = 6
+	nameTypeIP    = 7
+)
+
+// marshalSANs marshals a list of addresses into a the contents of an X.509
+// SubjectAlternativeName extension.
+func marshalSANs(dnsNames, emailAddresses []string, ipAddresses []net.IP, uris []*url.URL) (derBytes []byte, err error) {
+	var rawValues []asn1.RawValue
+	for _, name := range dnsNames {
+		rawValues = append(rawValues, asn1.RawValue{Tag: nameTypeDNS, Class: 2, Bytes: []byte(name)})
+	}
+	for _, email := range emailAddresses {
+		rawValues = append(rawValues, asn1.RawValue{Tag: nameTypeEmail, Class: 2, Bytes: []byte(email)})
+	}
+	for _, rawIP := range ipAddresses {
+		// If possible, we always want to encode IPv4 addresses in 4 bytes.
+		ip := rawIP.To4()
+		if ip == nil {
+			ip = rawIP
+		}
+		rawValues = append(rawValues, asn1.RawValue{Tag: nameTypeIP, Class: 2, Bytes: ip})
+	}
+	for _, uri := range uris {
+		rawValues = append(rawValues, asn1.RawValue{Tag: nameTypeURI, Class: 2, Bytes: []byte(uri.String())})
+	}
+	return asn1.Marshal(rawValues)
+}
+
+// criticalExtension is an extension criticality set with
+// WithCriticalExtension.
+type criticalExtension struct {
+	oid      asn1.ObjectIdentifier
+	critical bool
+}
+
+// WithCriticalExtension returns a Profile modifier that sets the critical flag
+// of the extension with the given object identifier. The key usage, extended
+// key usage, basic constraints, subject alternative name and CRL distribution
+// points extensions generated from the certificate fields are marshaled by the
+// profile with the given flag, other extensions must be added with
+// WithExtraExtension or AddExtension. The subject and authority key
+// identifiers and the certificate policies extensions are not supported.
+//
+// Creating a certificate fails if the extension is not present in the final
+// template.
+func WithCriticalExtension(oid asn1.ObjectIdentifier, critical bool) WithOption {
+	return func(p Profile) error {
+		if len(oid) == 0 {
+			return errors.New("extension object identifier cannot be empty")
+		}
+		if _, ok := oidStdExtHashMap[oid.String()]; ok && marshalStdExtension[oid.String()] == nil {
+			return errors.Errorf("the criticality of extension %s cannot be changed", oid)
+		}
+		b, err := getBase(p)
+		if err != nil {
+			return err
+		}
+		for i, ce := range b.criticalExts {
+			if ce.oid.Equal(oid) {
+				b.criticalExts[i].critical = critical
+				return nil
+			}
+		}
+		b.criticalExts = append(b.criticalExts, criticalExtension{oid: oid, critical: critical})
+		return nil
+	}
+}
+
+// marshalStdExtension contains the functions used to marshal the standard
+// extensions whose criticality can be changed.
+var marshalStdExtension = map[string]func(*x509.Certificate) ([]byte, bool, error){
+	oidExtKeyUsage.String():              marshalKeyUsage,
+	oidExtExtendedKeyUsage.String():      marshalExtKeyUsage,
+	oidExtBasicConstraints.String():      marshalBasicConstraints,
+	oidExtSubjectAltName.String():        marshalSubjectAltName,
+	oidExtCRLDistributionPoints.String(): marshalCRLDistributionPoints,
+}
+
+// WithCRLDistributionPointsCritical returns a Profile modifier that sets the
+// critical flag of the CRL distribution points extension generated from the
+// CRLDistributionPoints field. The x509 package always marks it as
+// non-critical, so using false restores the default behavior.
+func WithCRLDistributionPointsCritical(critical bool) WithOption {
+	return func(p Profile) error {
+		if critical {
+			return WithCriticalExtension(oidExtCRLDistributionPoints, true)(p)
+		}
+		b, err := getBase(p)
+		if err != nil {
+			return err
+		}
+		var exts []criticalExtension
+		for _, ce := range b.criticalExts {
+			if !ce.oid.Equal(oidExtCRLDistributionPoints) {
+				exts = append(exts, ce)
+			}
+		}
+		b.criticalExts = exts
+		return nil
+	}
+}
+
+// WithAuthorityInfoAccessCritical is the analog of
+// WithCRLDistributionPointsCritical for the authority information access
+// extension. RFC 5280, section 4.2.2.1, requires this extension to be
+// non-critical, and the x509 package refuses to parse certificates with a
+// critical one, so only false, the default, is accepted.
+func WithAuthorityInfoAccessCritical(critical bool) WithOption {
+	return func(p Profile) error {
+		if critical {
+			return errors.New("the authority information access extension must be non-critical")
+		}
+		return nil
+	}
+}
+
+// applyCriticalExtensions sets the critical flag of the extensions configured
+// with WithCriticalExtension. Standard extensions are marshaled and added to
+// the extra extensions of the template, replacing the ones generated by the
+// x509 package.
+func (b *base) applyCriticalExtensions(tpl *x509.Certificate) error {
+	if len(b.criticalExts) == 0 {
+		return nil
+	}
+	exts := make([]pkix.Extension, len(tpl.ExtraExtensions), len(tpl.ExtraExtensions)+len(b.criticalExts))
+	copy(exts, tpl.ExtraExtensions)
+	for _, ce := range b.criticalExts {
+		// RFC 5280, section 4.2.1.6, the extension must be critical if the
+		// subject is empty.
+		if ce.oid.Equal(oidExtSubjectAltName) && !ce.critical && isEmptySubject(tpl) {
+			return errors.New("the subject alternative name extension must be critical if the subject is empty")
+		}
+		if i := indexExtension(exts, ce.oid); i >= 0 {
+			exts[i].Critical = ce.critical
+			continue
+		}
+		fn, ok := marshalStdExtension[ce.oid.String()]
+		if !ok {
+			return errors.Errorf("cannot set the criticality of extension %s: extension not found", ce.oid)
+		}
+		value, present, err := fn(tpl)
+		if err != nil {
+			return errors.Wrapf(err, "error marshaling extension %s", ce.oid)
+		}
+		if !present {
+			return errors.Errorf("cannot set the criticality of extension %s: extension not found", ce.oid)
+		}
+		exts = append(exts, pkix.Extension{Id: ce.oid, Critical: ce.critical, Value: value})
+	}
+	tpl.ExtraExtensions = exts
+	return nil
+}
+
+// indexExtension returns the index of the extension with the given object
+// identifier, or -1 if it is not present.
+func indexExtension(exts []pkix.Extension, oid asn1.ObjectIdentifier) int {
+	for i, ext := range exts {
+		if ext.Id.Equal(oid) {
+			return i
+		}
+	}
+	return -1
+}
+
+// marshalKeyUsage marshals the key usage extension like the x509 package.
+func marshalKeyUsage(crt *x509.Certificate) ([]byte, bool, error) {
+	if crt.KeyUsage == 0 {
+		return nil, false, nil
+	}
+	var a [2]byte
+	a[0] = reverseBitsInAByte(byte(crt.KeyUsage))
+	a[1] = reverseBitsInAByte(byte(crt.KeyUsage >> 8))
+	l := 1
+	if a[1] != 0 {
+		l = 2
+	}
+	bitString := a[:l]
+	value, err := asn1.Marshal(asn1.BitString{Bytes: bitString, BitLength: asn1BitLength(bitString)})
+	return value, true, err
+}
+
+// marshalExtKeyUsage marshals the extended key usage extension like the x509
+// package.
+func marshalExtKeyUsage(crt *x509.Certificate) ([]byte, bool, error) {
+	if len(crt.ExtKeyUsage) == 0 && len(crt.UnknownExtKeyUsage) == 0 {
+		return nil, false, nil
+	}
+	oids := make([]asn1.ObjectIdentifier, 0, len(crt.ExtKeyUsage)+len(crt.UnknownExtKeyUsage))
+	for _, u := range crt.ExtKeyUsage {
+		oid, ok := oidFromExtKeyUsage(u)
+		if !ok {
+			return nil, false, errors.Errorf("unknown extended key usage %d", u)
+		}
+		oids = append(oids, oid)
+	}
+	oids = append(oids, crt.UnknownExtKeyUsage...)
+	value, err := asn1.Marshal(oids)
+	return value, true, err
+}
+
+// marshalBasicConstraints marshals the basic constraints extension like the
+// x509 package.
+func marshalBasicConstraints(crt *x509.Certificate) ([]byte, bool, error) {
+	if !crt.BasicConstraintsValid {
+		return nil, false, nil
+	}
+	maxPathLen := crt.MaxPathLen
+	if maxPathLen == 0 && !crt.MaxPathLenZero {
+		maxPathLen = -1
+	}
+	value, err := asn1.Marshal(basicConstraints{IsCA: crt.IsCA, MaxPathLen: maxPathLen})
+	return value, true, err
+}
+
+// distributionPoint is the ASN.1 structure of a DistributionPoint with only
+// the full name of the distribution point.
+type distributionPoint struct {
+	DistributionPoint distributionPointName `asn1:"optional,tag:0"`
+}
+
+type distributionPointName struct {
+	FullName []asn1.RawValue `asn1:"optional,tag:0"`
+}
+
+// marshalCRLDistributionPoints marshals the CRL distribution points extension
+// like the x509 package.
+func marshalCRLDistributionPoints(crt *x509.Certificate) ([]byte, bool, error) {
+	if len(crt.CRLDistributionPoints) == 0 {
+		return nil, false, nil
+	}
+	dps := make([]distributionPoint, len(crt.CRLDistributionPoints))
+	for i, name := range crt.CRLDistributionPoints {
+		dps[i].DistributionPoint.FullName = []asn1.RawValue{
+			{Tag: nameTypeURI, Class: asn1.ClassContextSpecific, Bytes: []byte(name)},
+		}
+	}
+	value, err := asn1.Marshal(dps)
+	return value, true, err
+}
+
+// marshalSubjectAltName marshals the subject alternative name extension.
+func marshalSubjectAltName(crt *x509.Certificate) ([]byte, bool, error) {
+	if len(crt.DNSNames) == 0 && len(crt.EmailAddresses) == 0 && len(crt.IPAddresses) == 0 && len(crt.URIs) == 0 {
+		return nil, false, nil
+	}
+	value, err := marshalSANs(crt.DNSNames, crt.EmailAddresses, crt.IPAddresses, crt.URIs)
+	return value, true, err
+}
@@ -0,0 +1,160 @@
+package x509util
+
+import (
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestWithCriticalExtension(t *testing.T) {
+	iss := mustParseCertificate(t, "test_files/noPasscodeCa.crt")
+	issPriv := mustParseRSAKey(t, "test_files/noPasscodeCa.key")
+	oidCustom := asn1.ObjectIdentifier{1, 2, 3, 4}
+
+	countExtensions := func(crt *x509.Certificate, oid asn1.ObjectIdentifier) (n int) {
+		for _, ext := range crt.Extensions {
+			if ext.Id.Equal(oid) {
+				n++
+			}
+		}
+		return
+	}
+
+	tests := []struct {
+		name     string
+		newProf  func(...WithOption) (Profile, error)
+		options  []WithOption
+		oid      asn1.ObjectIdentifier
+		critical bool
+		wantErr  string
+	}{
+		{"ok critical eku", func(opts ...WithOption) (Profile, error) {
+			return NewLeafProfile("leaf", iss, issPriv, opts...)
+		}, []WithOption{WithHosts("leaf.smallstep.com")}, oidExtExtendedKeyUsage, true, ""},
+		{"ok non-critical key usage", func(opts ...WithOption) (Profile, error) {
+			return NewLeafProfile("leaf", iss, issPriv, opts...)
+		}, []WithOption{WithHosts("leaf.smallstep.com")}, oidExtKeyUsage, false, ""},
+		{"ok critical san", func(opts ...WithOption) (Profile, error) {
+			return NewLeafProfile("leaf", iss, issPriv, opts...)
+		}, []WithOption{WithSANs([]string{"leaf.smallstep.com", "127.0.0.1", "jane@smallstep.com"})}, oidExtSubjectAltName, true, ""},
+		{"ok non-critical basic constraints", func(opts ...WithOption) (Profile, error) {
+			return NewIntermediateProfile("intermediate", iss, issPriv, append(opts, WithSkipPathLenCheck())...)
+		}, nil, oidExtBasicConstraints, false, ""},
+		{"ok critical crl distribution points", func(opts ...WithOption) (Profile, error) {
+			return NewLeafProfile("leaf", iss, issPriv, opts...)
+		}, []WithOption{withTemplateFields(func(crt *x509.Certificate) {
+			crt.CRLDistributionPoints = []string{"http://crl.smallstep.com/1.crl", "ldap://crl.smallstep.com/2"}
+		})}, oidExtCRLDistributionPoints, true, ""},
+		{"ok critical extra extension", func(opts ...WithOption) (Profile, error) {
+			return NewLeafProfile("leaf", iss, issPriv, opts...)
+		}, []WithOption{WithHosts("leaf.smallstep.com"), WithExtraExtension(pkix.Extension{Id: oidCustom, Value: asn1.NullBytes})}, oidCustom, true, ""},
+		{"fail subject key id", func(opts ...WithOption) (Profile, error) {
+			return NewLeafProfile("leaf", iss, issPriv, opts...)
+		}, nil, oidExtSubjectKeyID, true, "cannot be changed"},
+		{"fail missing", func(opts ...WithOption) (Profile, error) {
+			return NewIntermediateProfile("intermediate", iss, issPriv, append(opts, WithSkipPathLenCheck())...)
+		}, nil, oidExtExtendedKeyUsage, true, "extension not found"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, err := tt.newProf(append(tt.options, WithCriticalExtension(tt.oid, tt.critical))...)
+			var der []byte
+			if err == nil {
+				der, err = p.CreateCertificate()
+			}
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			crt, err := x509.ParseCertificate(der)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, ok := findExtension(crt, tt.oid)
+			if c := countExtensions(crt, tt.oid); c != 1 || !ok {
+				t.Fatalf("certificate has %d extensions %s, want 1", c, tt.oid)
+			}
+			if got.Critical != tt.critical {
+				t.Errorf("extension %s critical = %v, want %v", tt.oid, got.Critical, tt.critical)
+			}
+
+			// The value must be the one generated by the x509 package.
+			want := mustCreateCertificate(t, mustNewProfile(t)(tt.newProf(append(tt.options, WithPublicKey(p.SubjectPublicKey()))...)))
+			if ext, _ := findExtension(want, tt.oid); !reflect.DeepEqual(got.Value, ext.Value) {
+				t.Errorf("extension %s value = %x, want %x", tt.oid, got.Value, ext.Value)
+			}
+		})
+	}
+}
+
+func TestWithCRLDistributionPointsCritical(t *testing.T) {
+	iss := mustParseCertificate(t, "test_files/noPasscodeCa.crt")
+	issPriv := mustParseRSAKey(t, "test_files/noPasscodeCa.key")
+	withURLs := withTemplateFields(func(crt *x509.Certificate) {
+		crt.CRLDistributionPoints = []string{"http://crl.smallstep.com/ca.crl"}
+		crt.OCSPServer = []string{"http://ocsp.smallstep.com"}
+		crt.IssuingCertificateURL = []string{"http://ca.smallstep.com/ca.crt"}
+	})
+
+	tests := []struct {
+		name    string
+		options []WithOption
+		wantN   int
+		wantCDP bool
+		wantErr bool
+	}{
+		{"ok default", []WithOption{withURLs}, 1, false, false},
+		{"ok critical cdp", []WithOption{withURLs, WithCRLDistributionPointsCritical(true)}, 1, true, false},
+		{"ok non-critical aia", []WithOption{withURLs, WithAuthorityInfoAccessCritical(false)}, 1, false, false},
+		{"ok reset", []WithOption{withURLs, WithCRLDistributionPointsCritical(true), WithCRLDistributionPointsCritical(false)}, 1, false, false},
+		{"ok non-critical without extension", []WithOption{WithCRLDistributionPointsCritical(false)}, 0, false, false},
+		{"fail missing", []WithOption{WithCRLDistributionPointsCritical(true)}, 0, false, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := mustNewProfile(t)(NewLeafProfile("leaf", iss, issPriv, append([]WithOption{WithHosts("leaf.smallstep.com")}, tt.options...)...))
+			der, err := p.CreateCertificate()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("CreateCertificate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			crt, err := x509.ParseCertificate(der)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, want := range []struct {
+				oid      asn1.ObjectIdentifier
+				critical bool
+			}{{oidExtCRLDistributionPoints, tt.wantCDP}, {oidExtAuthorityInfoAccess, false}} {
+				var n int
+				for _, ext := range crt.Extensions {
+					if ext.Id.Equal(want.oid) {
+						n++
+						if ext.Critical != want.critical {
+							t.Errorf("extension %s critical = %v, want %v", want.oid, ext.Critical, want.critical)
+						}
+					}
+				}
+				if n != tt.wantN {
+					t.Errorf("certificate has %d extensions %s, want %d", n, want.oid, tt.wantN)
+				}
+			}
+		})
+	}
+
+	t.Run("fail critical aia", func(t *testing.T) {
+		if _, err := NewLeafProfile("leaf", iss, issPriv, withURLs, WithAuthorityInfoAccessCritical(true)); err == nil {
+			t.Error("NewLeafProfile() error = nil, want error")
+		}
+	})
+}
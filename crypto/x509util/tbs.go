@@ -0,0 +1,141 @@
+package x509util
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+
+	"github.com/pkg/errors"
+)
+
+// certificate is the ASN.1 structure of an X.509 certificate.
+type certificate struct {
+	TBSCertificate     asn1.RawValue
+	SignatureAlgorithm pkix.AlgorithmIdentifier
+	SignatureValue     asn1.BitString
+}
+
+// tbsCertificate contains the to-be-signed certificate created by
+// TBSCertificate.
+type tbsCertificate struct {
+	raw    []byte
+	sigAlg pkix.AlgorithmIdentifier
+	issPub crypto.PublicKey
+	algo   x509.SignatureAlgorithm
+}
+
+// TBSCertificate returns the DER encoded to-be-signed certificate and the
+// signature algorithm that must be used to sign it. It does not require the
+// issuer private key, so the signature can be produced externally, e.g. by an
+// HSM or a remote KMS, and combined with AssembleSignedCertificate.
+//
+// The serial number and subject key identifier of the profile are set when the
+// profile is created, so they are the same in the to-be-signed certificate and
+// in the assembled one.
+func (b *base) TBSCertificate() ([]byte, x509.SignatureAlgorithm, error) {
+	issPub, err := b.issuerPublicKey()
+	if err != nil {
+		return nil, x509.UnknownSignatureAlgorithm, err
+	}
+
+	// The x509 package only creates signed certificates, so the certificate
+	// is signed with a temporary key of the same type as the issuer key and
+	// the signature is discarded.
+	priv, err := newTemporaryKey(issPub)
+	if err != nil {
+		return nil, x509.UnknownSignatureAlgorithm, err
+	}
+	parent := *b.Issuer()
+	parent.PublicKey = priv.Public()
+
+	tpl, err := b.templateWithIssuerKey(priv)
+	if err != nil {
+		return nil, x509.UnknownSignatureAlgorithm, err
+	}
+	der, err := b.signWith(tpl, &parent, priv)
+	if err != nil {
+		return nil, x509.UnknownSignatureAlgorithm, err
+	}
+	crt, err := x509.ParseCertificate(der)
+	if err != nil {
+		return nil, x509.UnknownSignatureAlgorithm, errors.Wrap(err, "error parsing certificate")
+	}
+	var c certificate
+	if _, err := asn1.Unmarshal(der, &c); err != nil {
+		return nil, x509.UnknownSignatureAlgorithm, errors.Wrap(err, "error parsing certificate")
+	}
+
+	b.tbs = &tbsCertificate{
+		raw:    crt.RawTBSCertificate,
+		sigAlg: c.SignatureAlgorithm,
+		issPub: issPub,
+		algo:   crt.SignatureAlgorithm,
+	}
+	return crt.RawTBSCertificate, crt.SignatureAlgorithm, nil
+}
+
+// AssembleSignedCertificate combines the to-be-signed certificate returned by
+// TBSCertificate with the given signature and returns the DER encoded
+// certificate. The signature is verified using the public key of the issuer.
+func (b *base) AssembleSignedCertificate(signature []byte) ([]byte, error) {
+	if b.tbs == nil {
+		return nil, newError(ErrNotCreated, "to-be-signed certificate has not been created yet, call 'profile.TBSCertificate()' first")
+	}
+	issuer := &x509.Certificate{PublicKey: b.tbs.issPub}
+	if err := issuer.CheckSignature(b.tbs.algo, b.tbs.raw, signature); err != nil {
+		return nil, errors.Wrap(err, "error verifying certificate signature")
+	}
+	der, err := asn1.Marshal(certificate{
+		TBSCertificate:     asn1.RawValue{FullBytes: b.tbs.raw},
+		SignatureAlgorithm: b.tbs.sigAlg,
+		SignatureValue:     asn1.BitString{Bytes: signature, BitLength: 8 * len(signature)},
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "error marshaling certificate")
+	}
+	crt, err := x509.ParseCertificate(der)
+	if err != nil {
+		return nil, errors.Wrap(err, "error parsing certificate")
+	}
+	b.crt = crt
+	return der, nil
+}
+
+// issuerPublicKey returns the public key of the issuer, taken from the issuer
+// private key if available, from the issuer certificate, or from the subject
+// for self-signed certificates.
+func (b *base) issuerPublicKey() (crypto.PublicKey, error) {
+	switch {
+	case b.issPriv != nil:
+		return signerPublicKey(b.issPriv)
+	case b.iss == nil:
+		return nil, errors.New("profile does not have an issuer")
+	case b.iss == b.sub && b.subPub != nil:
+		return b.subPub, nil
+	case b.iss.PublicKey != nil:
+		return b.iss.PublicKey, nil
+	default:
+		return nil, errors.New("issuer certificate does not have a public key")
+	}
+}
+
+// newTemporaryKey returns a new private key of the same type as the given
+// public key.
+func newTemporaryKey(pub crypto.PublicKey) (crypto.Signer, error) {
+	switch k := pub.(type) {
+	case *rsa.PublicKey:
+		return rsa.GenerateKey(rand.Reader, 2048)
+	case *ecdsa.PublicKey:
+		return ecdsa.GenerateKey(k.Curve, rand.Reader)
+	case ed25519.PublicKey:
+		_, priv, err := ed25519.GenerateKey(rand.Reader)
+		return priv, err
+	default:
+		return nil, errors.Errorf("unsupported issuer public key type %T", pub)
+	}
+}
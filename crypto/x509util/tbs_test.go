@@ -0,0 +1,150 @@
+package x509util
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"math/big"
+	"testing"
+)
+
+// signTBS signs the to-be-signed certificate like an external signer would.
+func signTBS(t *testing.T, signer crypto.Signer, tbs []byte, alg x509.SignatureAlgorithm) []byte {
+	t.Helper()
+	var opts crypto.SignerOpts
+	switch alg {
+	case x509.PureEd25519:
+		opts = crypto.Hash(0)
+	case x509.SHA256WithRSA, x509.ECDSAWithSHA256:
+		opts = crypto.SHA256
+	case x509.SHA384WithRSA, x509.ECDSAWithSHA384:
+		opts = crypto.SHA384
+	default:
+		t.Fatalf("unexpected signature algorithm %s", alg)
+	}
+	digest := tbs
+	if h := opts.HashFunc(); h != 0 {
+		hh := h.New()
+		hh.Write(tbs)
+		digest = hh.Sum(nil)
+	}
+	sig, err := signer.Sign(rand.Reader, digest, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return sig
+}
+
+func TestBase_TBSCertificate(t *testing.T) {
+	rsaIss := mustParseCertificate(t, "test_files/noPasscodeCa.crt")
+	rsaIssPriv := mustParseRSAKey(t, "test_files/noPasscodeCa.key")
+
+	ecIssPriv, err := ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ecRoot, err := NewRootProfile("ec-root", WithPublicKey(ecIssPriv.Public()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ecRoot.SetIssuerPrivateKey(ecIssPriv)
+	ecIss := mustCreateCertificate(t, ecRoot)
+
+	_, edPriv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		profile func() (Profile, error)
+		signer  crypto.Signer
+		issuer  func(Profile) *x509.Certificate
+		wantAlg x509.SignatureAlgorithm
+	}{
+		{"rsa-leaf", func() (Profile, error) {
+			return NewLeafProfile("test.smallstep.com", rsaIss, nil)
+		}, rsaIssPriv, func(Profile) *x509.Certificate { return rsaIss }, x509.SHA256WithRSA},
+		{"ecdsa-leaf", func() (Profile, error) {
+			return NewLeafProfile("test.smallstep.com", ecIss, nil)
+		}, ecIssPriv, func(Profile) *x509.Certificate { return ecIss }, x509.ECDSAWithSHA384},
+		{"ed25519-root", func() (Profile, error) {
+			return NewRootProfile("ed25519-root", WithPublicKey(edPriv.Public()))
+		}, edPriv, nil, x509.PureEd25519},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, err := tt.profile()
+			if err != nil {
+				t.Fatal(err)
+			}
+			serial := new(big.Int).Set(p.Subject().SerialNumber)
+			skid := append([]byte(nil), p.Subject().SubjectKeyId...)
+
+			tbs, alg, err := p.TBSCertificate()
+			if err != nil {
+				t.Fatalf("TBSCertificate() error = %v", err)
+			}
+			if alg != tt.wantAlg {
+				t.Errorf("TBSCertificate() algorithm = %s, want %s", alg, tt.wantAlg)
+			}
+
+			der, err := p.AssembleSignedCertificate(signTBS(t, tt.signer, tbs, alg))
+			if err != nil {
+				t.Fatalf("AssembleSignedCertificate() error = %v", err)
+			}
+			crt, err := x509.ParseCertificate(der)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(crt.RawTBSCertificate, tbs) {
+				t.Error("certificate does not contain the to-be-signed certificate")
+			}
+			if crt.SerialNumber.Cmp(serial) != 0 {
+				t.Errorf("SerialNumber = %s, want %s", crt.SerialNumber, serial)
+			}
+			if !bytes.Equal(crt.SubjectKeyId, skid) {
+				t.Errorf("SubjectKeyId = %x, want %x", crt.SubjectKeyId, skid)
+			}
+			iss := crt
+			if tt.issuer != nil {
+				iss = tt.issuer(p)
+			}
+			if err := crt.CheckSignatureFrom(iss); err != nil {
+				t.Errorf("CheckSignatureFrom() error = %v", err)
+			}
+			if got, err := p.CertificateDER(); err != nil || !bytes.Equal(got, der) {
+				t.Errorf("CertificateDER() = %x, %v, want %x", got, err, der)
+			}
+		})
+	}
+}
+
+func TestBase_AssembleSignedCertificate(t *testing.T) {
+	iss := mustParseCertificate(t, "test_files/noPasscodeCa.crt")
+	issPriv := mustParseRSAKey(t, "test_files/noPasscodeCa.key")
+
+	t.Run("fail/no-tbs", func(t *testing.T) {
+		p := mustNewProfile(t)(NewLeafProfile("test.smallstep.com", iss, nil))
+		if _, err := p.AssembleSignedCertificate([]byte("signature")); err == nil {
+			t.Error("AssembleSignedCertificate() error = nil, want error")
+		}
+	})
+
+	t.Run("fail/bad-signature", func(t *testing.T) {
+		p := mustNewProfile(t)(NewLeafProfile("test.smallstep.com", iss, nil))
+		tbs, alg, err := p.TBSCertificate()
+		if err != nil {
+			t.Fatal(err)
+		}
+		sig := signTBS(t, issPriv, tbs, alg)
+		sig[0] ^= 0xff
+		if _, err := p.AssembleSignedCertificate(sig); err == nil {
+			t.Error("AssembleSignedCertificate() error = nil, want error")
+		}
+	})
+}
@@ -0,0 +1,67 @@
+package x509util
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/x509"
+	"encoding/json"
+	"io/ioutil"
+	"path/filepath"
+	"text/template"
+
+	"github.com/pkg/errors"
+)
+
+// TemplateData is the data used to execute a certificate template file. The
+// keys are the names of the variables in the template, e.g. the value of the
+// "CommonName" key is used by {{ .CommonName }}.
+type TemplateData map[string]interface{}
+
+// templateFuncs are the functions available in certificate template files.
+var templateFuncs = template.FuncMap{
+	"toJson": func(v interface{}) (string, error) {
+		b, err := json.Marshal(v)
+		if err != nil {
+			return "", err
+		}
+		return string(b), nil
+	},
+}
+
+// NewLeafProfileFromTemplateFile returns a new leaf x509 Certificate profile
+// using the Go text/template in the given file. The template is executed with
+// the given data and the result is parsed as a JSON template, see
+// TemplateFromJSON for its format. All the variables used in the template are
+// required, and the toJson function can be used to render lists, e.g.
+// "dnsNames": {{ toJson .SANs }}.
+//
+// A new public/private key pair will be generated for the Profile if
+// not set in the `withOps` profile modifiers.
+func NewLeafProfileFromTemplateFile(path string, data TemplateData, iss *x509.Certificate, issPriv crypto.PrivateKey, withOps ...WithOption) (Profile, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, errors.Wrapf(err, "error reading %s", path)
+	}
+	out, err := executeTemplate(filepath.Base(path), string(b), data)
+	if err != nil {
+		return nil, err
+	}
+	return NewLeafProfileWithJSONTemplate(out, iss, issPriv, withOps...)
+}
+
+// executeTemplate executes the given text/template with the data. It fails if
+// the template uses a variable that is not in the data.
+func executeTemplate(name, text string, data TemplateData) ([]byte, error) {
+	tmpl, err := template.New(name).Option("missingkey=error").Funcs(templateFuncs).Parse(text)
+	if err != nil {
+		return nil, errors.Wrapf(err, "error parsing template %s", name)
+	}
+	if data == nil {
+		data = TemplateData{}
+	}
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, data); err != nil {
+		return nil, errors.Wrapf(err, "error executing template %s", name)
+	}
+	return buf.Bytes(), nil
+}
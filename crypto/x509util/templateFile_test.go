@@ -0,0 +1,92 @@
+package x509util
+
+import (
+	"crypto/x509"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestNewLeafProfileFromTemplateFile(t *testing.T) {
+	iss := mustParseCertificate(t, "test_files/noPasscodeCa.crt")
+	issPriv := mustParseRSAKey(t, "test_files/noPasscodeCa.key")
+
+	type want struct {
+		commonName   string
+		organization []string
+		dnsNames     []string
+		emails       []string
+		keyUsage     x509.KeyUsage
+		extKeyUsage  []x509.ExtKeyUsage
+		validity     time.Duration
+	}
+	tests := []struct {
+		name    string
+		path    string
+		data    TemplateData
+		want    want
+		wantErr string
+	}{
+		{"ok server", "test_files/templates/server.tpl", TemplateData{
+			"CommonName":   "test.smallstep.com",
+			"Organization": []string{"Smallstep"},
+			"SANs":         []string{"test.smallstep.com", "www.smallstep.com"},
+		}, want{
+			commonName:   "test.smallstep.com",
+			organization: []string{"Smallstep"},
+			dnsNames:     []string{"test.smallstep.com", "www.smallstep.com"},
+			// KeyEncipherment is removed for the generated EC key.
+			keyUsage:    x509.KeyUsageDigitalSignature,
+			extKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+			validity:    24 * time.Hour,
+		}, ""},
+		{"ok client", "test_files/templates/client.tpl", TemplateData{
+			"CommonName":   "jane",
+			"Organization": []string{"Smallstep", "Engineering"},
+			"SANs":         []string{"jane@smallstep.com"},
+		}, want{
+			commonName:   "jane",
+			organization: []string{"Smallstep", "Engineering"},
+			emails:       []string{"jane@smallstep.com"},
+			keyUsage:     x509.KeyUsageDigitalSignature,
+			extKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+			validity:     time.Hour,
+		}, ""},
+		{"fail missing variable", "test_files/templates/server.tpl", TemplateData{
+			"CommonName": "test.smallstep.com",
+			"SANs":       []string{"test.smallstep.com"},
+		}, want{}, `map has no entry for key "Organization"`},
+		{"fail nil data", "test_files/templates/client.tpl", nil, want{}, `map has no entry for key "CommonName"`},
+		{"fail missing file", "test_files/templates/missing.tpl", nil, want{}, "error reading test_files/templates/missing.tpl"},
+		{"fail invalid json", "test_files/templates/server.tpl", TemplateData{
+			"CommonName":   `"test"`,
+			"Organization": []string{"Smallstep"},
+			"SANs":         []string{"test.smallstep.com"},
+		}, want{}, "error parsing JSON template"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, err := NewLeafProfileFromTemplateFile(tt.path, tt.data, iss, issPriv)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("NewLeafProfileFromTemplateFile() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			crt := mustCreateCertificate(t, mustNewProfile(t)(p, err))
+			got := want{
+				commonName:   crt.Subject.CommonName,
+				organization: crt.Subject.Organization,
+				dnsNames:     crt.DNSNames,
+				emails:       crt.EmailAddresses,
+				keyUsage:     crt.KeyUsage,
+				extKeyUsage:  crt.ExtKeyUsage,
+				validity:     crt.NotAfter.Sub(crt.NotBefore),
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("NewLeafProfileFromTemplateFile() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,54 @@
+package x509util
+
+import (
+	"crypto/x509"
+
+	"github.com/pkg/errors"
+)
+
+// NewTestPKI creates a root, an intermediate signed by the root, and a leaf
+// signed by the intermediate, and returns their profiles with the certificates
+// already created, use CertificateDER to get them. It is intended for tests
+// and demos.
+//
+// The leaf has leafCN as a subject alternative name, and the given options
+// only apply to the leaf profile.
+func NewTestPKI(rootCN, intCN, leafCN string, withOps ...WithOption) (root, intermediate, leaf Profile, err error) {
+	root, err = NewRootProfile(rootCN)
+	if err != nil {
+		return nil, nil, nil, errors.Wrap(err, "error creating root profile")
+	}
+	rootCrt, err := createCertificate(root)
+	if err != nil {
+		return nil, nil, nil, errors.Wrap(err, "error creating root certificate")
+	}
+
+	intermediate, err = NewIntermediateProfile(intCN, rootCrt, root.SubjectPrivateKey())
+	if err != nil {
+		return nil, nil, nil, errors.Wrap(err, "error creating intermediate profile")
+	}
+	intCrt, err := createCertificate(intermediate)
+	if err != nil {
+		return nil, nil, nil, errors.Wrap(err, "error creating intermediate certificate")
+	}
+
+	withOps = append([]WithOption{WithHosts(leafCN)}, withOps...)
+	leaf, err = NewLeafProfile(leafCN, intCrt, intermediate.SubjectPrivateKey(), withOps...)
+	if err != nil {
+		return nil, nil, nil, errors.Wrap(err, "error creating leaf profile")
+	}
+	if _, err := leaf.CreateCertificate(); err != nil {
+		return nil, nil, nil, errors.Wrap(err, "error creating leaf certificate")
+	}
+	return root, intermediate, leaf, nil
+}
+
+// createCertificate creates the certificate of the profile and returns it
+// parsed.
+func createCertificate(p Profile) (*x509.Certificate, error) {
+	der, err := p.CreateCertificate()
+	if err != nil {
+		return nil, err
+	}
+	return x509.ParseCertificate(der)
+}
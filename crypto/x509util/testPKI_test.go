@@ -0,0 +1,52 @@
+package x509util
+
+import (
+	"crypto/x509"
+	"testing"
+)
+
+func TestNewTestPKI(t *testing.T) {
+	root, intermediate, leaf, err := NewTestPKI("Test Root", "Test Intermediate", "test.smallstep.com",
+		WithExtKeyUsage(x509.ExtKeyUsageServerAuth))
+	if err != nil {
+		t.Fatalf("NewTestPKI() error = %v", err)
+	}
+	mustParse := func(p Profile) *x509.Certificate {
+		der, err := p.CertificateDER()
+		if err != nil {
+			t.Fatal(err)
+		}
+		crt, err := x509.ParseCertificate(der)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return crt
+	}
+	rootCrt, intCrt, leafCrt := mustParse(root), mustParse(intermediate), mustParse(leaf)
+
+	if len(leafCrt.DNSNames) != 1 || leafCrt.DNSNames[0] != "test.smallstep.com" {
+		t.Errorf("leaf DNSNames = %v, want [test.smallstep.com]", leafCrt.DNSNames)
+	}
+	if len(leafCrt.ExtKeyUsage) != 1 || leafCrt.ExtKeyUsage[0] != x509.ExtKeyUsageServerAuth {
+		t.Errorf("leaf ExtKeyUsage = %v, want [ServerAuth]", leafCrt.ExtKeyUsage)
+	}
+	if len(intCrt.ExtKeyUsage) != 0 {
+		t.Errorf("intermediate ExtKeyUsage = %v, want none", intCrt.ExtKeyUsage)
+	}
+
+	roots := x509.NewCertPool()
+	roots.AddCert(rootCrt)
+	intermediates := x509.NewCertPool()
+	intermediates.AddCert(intCrt)
+	chains, err := leafCrt.Verify(x509.VerifyOptions{
+		DNSName:       "test.smallstep.com",
+		Roots:         roots,
+		Intermediates: intermediates,
+	})
+	if err != nil {
+		t.Fatalf("Verify() error = %v", err)
+	}
+	if len(chains) != 1 || len(chains[0]) != 3 {
+		t.Errorf("Verify() chains = %v, want one chain of 3 certificates", chains)
+	}
+}
@@ -0,0 +1,10 @@
+{
+  "subject": {
+    "commonName": "{{ .CommonName }}",
+    "organization": {{ toJson .Organization }}
+  },
+  "emailAddresses": {{ toJson .SANs }},
+  "keyUsage": ["digitalSignature"],
+  "extKeyUsage": ["clientAuth"],
+  "validity": "1h"
+}
@@ -0,0 +1,10 @@
+{
+  "subject": {
+    "commonName": "{{ .CommonName }}",
+    "organization": {{ toJson .Organization }}
+  },
+  "dnsNames": {{ toJson .SANs }},
+  "keyUsage": ["digitalSignature", "keyEncipherment"],
+  "extKeyUsage": ["serverAuth"],
+  "validity": "24h"
+}
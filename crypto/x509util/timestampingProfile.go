@@ -0,0 +1,55 @@
+package x509util
+
+import (
+	"crypto"
+	"crypto/x509"
+	"crypto/x509/pkix"
+)
+
+// NewTimestampingProfile returns a new leaf x509 Certificate profile for a
+// time-stamping authority as defined in RFC 3161. The certificate only has the
+// DigitalSignature key usage and a critical extended key usage extension with
+// timeStamping as the only extended key usage.
+//
+// The strict RFC 3161 checks are enabled, so creating the certificate fails if
+// other extended key usages are added, e.g. using WithExtKeyUsage, unless the
+// check is skipped using WithSkipLint(LintTimeStampingEKU).
+//
+// A new public/private key pair will be generated for the Profile if
+// not set in the `withOps` profile modifiers.
+func NewTimestampingProfile(cn string, iss *x509.Certificate, issPriv crypto.PrivateKey, withOps ...WithOption) (Profile, error) {
+	sub := defaultTimestampingTemplate(pkix.Name{CommonName: cn}, iss.Subject)
+	withOps = append([]WithOption{
+		WithStrictRFC3161(),
+		WithCriticalExtension(oidExtExtendedKeyUsage, true),
+	}, withOps...)
+	return newProfile(&Leaf{}, sub, iss, issPriv, withOps...)
+}
+
+func defaultTimestampingTemplate(sub, iss pkix.Name) *x509.Certificate {
+	return &x509.Certificate{
+		IsCA:                  false,
+		KeyUsage:              x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageTimeStamping},
+		BasicConstraintsValid: false,
+		Issuer:                iss,
+		Subject:               sub,
+	}
+}
+
+// rfc3161LintRule reports LintTimeStampingEKU if the timeStamping extended key
+// usage is combined with other extended key usages.
+var rfc3161LintRule = lintRule{
+	name: "rfc3161",
+	check: func(b *base, crt *x509.Certificate, add func(code, msg string)) {
+		if len(crt.ExtKeyUsage)+len(crt.UnknownExtKeyUsage) <= 1 {
+			return
+		}
+		for _, eku := range crt.ExtKeyUsage {
+			if eku == x509.ExtKeyUsageTimeStamping {
+				add(LintTimeStampingEKU, "the timeStamping extended key usage must be the only extended key usage")
+				return
+			}
+		}
+	},
+}
@@ -0,0 +1,75 @@
+package x509util
+
+import (
+	"bytes"
+	"crypto/x509"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestNewTimestampingProfile(t *testing.T) {
+	root := mustNewProfile(t)(NewRootProfile("Root"))
+	iss := mustCreateCertificate(t, root)
+	issPriv := root.SubjectPrivateKey()
+	// SEQUENCE { OID id-kp-timeStamping }
+	wantEKU := []byte{0x30, 0x0a, 0x06, 0x08, 0x2b, 0x06, 0x01, 0x05, 0x05, 0x07, 0x03, 0x08}
+
+	tests := []struct {
+		name    string
+		options []WithOption
+		wantEKU []x509.ExtKeyUsage
+		wantErr bool
+	}{
+		{"ok", nil, []x509.ExtKeyUsage{x509.ExtKeyUsageTimeStamping}, false},
+		{"ok/rsa", []WithOption{GenerateKeyPair("RSA", "", 2048)}, []x509.ExtKeyUsage{x509.ExtKeyUsageTimeStamping}, false},
+		{"ok/force", []WithOption{WithExtKeyUsage(x509.ExtKeyUsageTimeStamping, x509.ExtKeyUsageServerAuth), WithSkipLint(LintTimeStampingEKU)},
+			[]x509.ExtKeyUsage{x509.ExtKeyUsageTimeStamping, x509.ExtKeyUsageServerAuth}, false},
+		{"fail/server-auth", []WithOption{WithExtKeyUsage(x509.ExtKeyUsageTimeStamping, x509.ExtKeyUsageServerAuth)}, nil, true},
+		{"fail/client-auth", []WithOption{WithExtKeyUsage(x509.ExtKeyUsageClientAuth, x509.ExtKeyUsageTimeStamping)}, nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := mustNewProfile(t)(NewTimestampingProfile("Smallstep TSA", iss, issPriv, tt.options...))
+			if _, ok := p.(*Leaf); !ok {
+				t.Errorf("NewTimestampingProfile() = %T, want *Leaf", p)
+			}
+			der, err := p.CreateCertificate()
+			if tt.wantErr {
+				var lintErrs LintErrors
+				if !errors.As(err, &lintErrs) || len(lintErrs) != 1 || lintErrs[0].Code != LintTimeStampingEKU {
+					t.Errorf("CreateCertificate() error = %v, want %s", err, LintTimeStampingEKU)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("CreateCertificate() error = %v", err)
+			}
+			cert, err := x509.ParseCertificate(der)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if cert.KeyUsage != x509.KeyUsageDigitalSignature {
+				t.Errorf("KeyUsage = %v, want %v", cert.KeyUsage, x509.KeyUsageDigitalSignature)
+			}
+			if !reflect.DeepEqual(cert.ExtKeyUsage, tt.wantEKU) || len(cert.UnknownExtKeyUsage) != 0 {
+				t.Errorf("ExtKeyUsage = %v, want %v", cert.ExtKeyUsage, tt.wantEKU)
+			}
+			ext, ok := findExtension(cert, oidExtExtendedKeyUsage)
+			if !ok || !ext.Critical {
+				t.Errorf("extended key usage extension = %v, want critical", ext)
+			}
+			if len(tt.options) == 0 && !bytes.Equal(ext.Value, wantEKU) {
+				t.Errorf("extended key usage extension value = %x, want %x", ext.Value, wantEKU)
+			}
+			if cert.IsCA || cert.BasicConstraintsValid {
+				t.Error("certificate has basic constraints")
+			}
+			roots := x509.NewCertPool()
+			roots.AddCert(iss)
+			if _, err := cert.Verify(x509.VerifyOptions{Roots: roots, KeyUsages: []x509.ExtKeyUsage{x509.ExtKeyUsageTimeStamping}}); err != nil {
+				t.Errorf("Verify() error = %v", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,56 @@
+package x509util
+
+import (
+	"crypto/x509/pkix"
+	"encoding/asn1"
+
+	"github.com/pkg/errors"
+)
+
+// oidExtTLSFeature is the OID for the TLS feature extension defined in RFC
+// 7633.
+var oidExtTLSFeature = asn1.ObjectIdentifier{1, 3, 6, 1, 5, 5, 7, 1, 24}
+
+// tlsFeatureStatusRequest is the status_request TLS extension, the feature
+// that requires OCSP stapling.
+const tlsFeatureStatusRequest = 5
+
+// WithMustStaple returns a Profile modifier that adds the TLS feature
+// extension with the status_request feature, also known as OCSP must-staple.
+// TLS clients that support it will refuse the certificate if the server does
+// not staple an OCSP response. The extension is not critical.
+//
+// If the template already has a TLS feature extension, the status_request
+// feature is added to it, keeping its criticality. It can only be used in leaf profiles.
+func WithMustStaple() WithOption {
+	return func(p Profile) error {
+		if _, ok := p.(*Leaf); !ok {
+			return newError(ErrLeafOnly, "WithMustStaple can only be used in leaf profiles, got %T", p)
+		}
+		crt := p.Subject()
+		var features []int
+		var critical bool
+		if i := indexExtension(crt.ExtraExtensions, oidExtTLSFeature); i >= 0 {
+			critical = crt.ExtraExtensions[i].Critical
+			rest, err := asn1.Unmarshal(crt.ExtraExtensions[i].Value, &features)
+			if err != nil || len(rest) > 0 {
+				return errors.New("error parsing the TLS feature extension")
+			}
+		}
+		for _, f := range features {
+			if f == tlsFeatureStatusRequest {
+				return nil
+			}
+		}
+		value, err := asn1.Marshal(append(features, tlsFeatureStatusRequest))
+		if err != nil {
+			return errors.Wrap(err, "error marshaling the TLS feature extension")
+		}
+		crt.ExtraExtensions = append(removeExtension(crt.ExtraExtensions, oidExtTLSFeature), pkix.Extension{
+			Id:       oidExtTLSFeature,
+			Critical: critical,
+			Value:    value,
+		})
+		return nil
+	}
+}
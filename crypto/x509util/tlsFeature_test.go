@@ -0,0 +1,84 @@
+package x509util
+
+import (
+	"bytes"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"testing"
+)
+
+func TestWithMustStaple(t *testing.T) {
+	iss := mustParseCertificate(t, "test_files/noPasscodeCa.crt")
+	issPriv := mustParseRSAKey(t, "test_files/noPasscodeCa.key")
+
+	// Certificate created with openssl using "tlsfeature=status_request".
+	fixture, ok := findExtension(mustParseCertificate(t, "test_files/mustStaple.crt"), oidExtTLSFeature)
+	if !ok {
+		t.Fatal("fixture does not have the TLS feature extension")
+	}
+	mustMarshal := func(v interface{}) []byte {
+		b, err := asn1.Marshal(v)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return b
+	}
+
+	tests := []struct {
+		name         string
+		opts         []WithOption
+		want         []byte
+		wantCritical bool
+	}{
+		{"ok", []WithOption{WithMustStaple()}, fixture.Value, false},
+		{"ok/twice", []WithOption{WithMustStaple(), WithMustStaple()}, fixture.Value, false},
+		{"ok/with-extra-extensions", []WithOption{
+			WithExtraExtension(pkix.Extension{Id: asn1.ObjectIdentifier{1, 2, 3, 4}, Value: []byte{0x05, 0x00}}),
+			WithMustStaple(),
+		}, fixture.Value, false},
+		{"ok/existing-feature", []WithOption{
+			WithExtraExtension(pkix.Extension{Id: oidExtTLSFeature, Critical: true, Value: mustMarshal([]int{17})}),
+			WithMustStaple(),
+		}, mustMarshal([]int{17, 5}), true},
+		{"ok/existing-status-request", []WithOption{
+			WithExtraExtension(pkix.Extension{Id: oidExtTLSFeature, Value: fixture.Value}),
+			WithMustStaple(),
+		}, fixture.Value, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := mustNewProfile(t)(NewLeafProfile("leaf", iss, issPriv, append([]WithOption{WithHosts("leaf.smallstep.com")}, tt.opts...)...))
+			crt := mustCreateCertificate(t, p)
+			var n int
+			for _, ext := range crt.Extensions {
+				if !ext.Id.Equal(oidExtTLSFeature) {
+					continue
+				}
+				n++
+				if ext.Critical != tt.wantCritical {
+					t.Errorf("TLS feature extension critical = %v, want %v", ext.Critical, tt.wantCritical)
+				}
+				if !bytes.Equal(ext.Value, tt.want) {
+					t.Errorf("TLS feature extension = %x, want %x", ext.Value, tt.want)
+				}
+			}
+			if n != 1 {
+				t.Errorf("certificate has %d TLS feature extensions, want 1", n)
+			}
+		})
+	}
+
+	t.Run("fail/ca", func(t *testing.T) {
+		if _, err := NewIntermediateProfile("intermediate", iss, issPriv, WithSkipPathLenCheck(), WithMustStaple()); err == nil {
+			t.Error("NewIntermediateProfile() error = nil, want error")
+		}
+		if _, err := NewRootProfile("root", WithMustStaple()); err == nil {
+			t.Error("NewRootProfile() error = nil, want error")
+		}
+	})
+	t.Run("fail/invalid-extension", func(t *testing.T) {
+		if _, err := NewLeafProfile("leaf", iss, issPriv, WithExtraExtension(pkix.Extension{Id: oidExtTLSFeature, Value: []byte{0x05, 0x00}}), WithMustStaple()); err == nil {
+			t.Error("NewLeafProfile() error = nil, want error")
+		}
+	})
+}